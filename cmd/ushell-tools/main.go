@@ -0,0 +1,64 @@
+// ushell-tools bundles the tools of this repository into one binary, each
+// tool being a subcommand: "ushell-tools memcc ...", "ushell-tools nginx-log ...".
+// The standalone binaries (./memcache, ./nginx) run the same code.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/memcache/memcc"
+	"github.com/ushell/tools/nginx/nginxlog"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{"memcc", "Memcached command line client", memcc.Run},
+	{"nginx-log", "nginx access log analyzer", nginxlog.Run},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ushell-tools <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "  %-10s %s\n", "version", "Show version info")
+	fmt.Fprintln(w, "\nRun 'ushell-tools <command> --help' for the options of a command.")
+	fmt.Fprintf(w, "Exit codes: %d success, %d error, %d threshold exceeded (e.g. nginx-log --alert), %d precondition not met (e.g. memcc add on an existing key)\n",
+		cli.ExitOK, cli.ExitError, cli.ExitThreshold, cli.ExitPrecondition)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return cli.ExitError
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return cli.ExitOK
+	case "version", "-version", "--version":
+		fmt.Fprintln(stdout, "ushell-tools", cli.Version)
+		return cli.ExitOK
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "Unknown command: %s\n\n", args[0])
+	usage(stderr)
+	return cli.ExitError
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/internal/memcachetest"
+	"github.com/ushell/tools/nginx/analyzer"
+)
+
+// combinedLog is a fixture of the analyzer tests in the combined log format
+const combinedLog = "../../nginx/analyzer/testdata/combined.log"
+
+const combinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// runTool runs the binary with args and returns its exit code and output
+func runTool(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{nil, cli.ExitError, "", "Usage: ushell-tools"},
+		{[]string{"help"}, cli.ExitOK, "Usage: ushell-tools", ""},
+		{[]string{"version"}, cli.ExitOK, "ushell-tools " + cli.Version, ""},
+		{[]string{"bogus"}, cli.ExitError, "", "Unknown command: bogus"},
+		{[]string{"memcc", "version"}, cli.ExitOK, cli.Version, ""},
+		{[]string{"nginx-log", "--version"}, cli.ExitOK, "nginx-log " + cli.Version, ""},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runTool(tt.args...)
+		if code != tt.code || !strings.Contains(stdout, tt.stdout) || !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("run(%q) = %d, stdout %q, stderr %q; want %d, stdout containing %q, stderr containing %q",
+				tt.args, code, stdout, stderr, tt.code, tt.stdout, tt.stderr)
+		}
+	}
+}
+
+func TestNginxLogOutputs(t *testing.T) {
+	args := func(output string) []string {
+		return []string{"nginx-log", "--log-format", combinedFormat, "--output", output, combinedLog}
+	}
+
+	code, stdout, stderr := runTool(args("json")...)
+	if code != cli.ExitOK {
+		t.Fatalf("--output json exited with %d: %s", code, stderr)
+	}
+	var rep analyzer.Report
+	if err := json.Unmarshal([]byte(stdout), &rep); err != nil {
+		t.Fatalf("--output json is not a report: %v\n%s", err, stdout)
+	}
+	if rep.Lines != 40 || len(rep.TopIPs) == 0 {
+		t.Errorf("report has %d lines and %d top IPs, want 40 lines", rep.Lines, len(rep.TopIPs))
+	}
+
+	code, stdout, stderr = runTool(args("csv")...)
+	if code != cli.ExitOK {
+		t.Fatalf("--output csv exited with %d: %s", code, stderr)
+	}
+	records, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if err != nil {
+		t.Fatalf("--output csv is not CSV: %v\n%s", err, stdout)
+	}
+	if strings.Join(records[0], ",") != "section,rank,key,count,bytes" || len(records) < 2 {
+		t.Fatalf("CSV header and rows = %q", records)
+	}
+	// the first row of the IP ranking is the first of the JSON report
+	found := false
+	for _, r := range records[1:] {
+		found = found || r[1] == "1" && r[2] == rep.TopIPs[0].Key
+	}
+	if !found {
+		t.Errorf("CSV has no first-ranked row for %s:\n%s", rep.TopIPs[0].Key, stdout)
+	}
+
+	for _, output := range []string{"table", "text"} {
+		code, stdout, stderr = runTool(args(output)...)
+		if code != cli.ExitOK || !strings.Contains(stdout, rep.TopIPs[0].Key) {
+			t.Errorf("--output %s exited with %d, stderr %q:\n%s", output, code, stderr, stdout)
+		}
+	}
+
+	code, stdout, _ = runTool(args("markdown")...)
+	if code != cli.ExitOK || !strings.HasPrefix(stdout, "# ") {
+		t.Errorf("--output markdown exited with %d:\n%s", code, stdout)
+	}
+
+	if code, _, stderr = runTool(args("xml")...); code != cli.ExitError || !strings.Contains(stderr, "xml") {
+		t.Errorf("--output xml exited with %d, stderr %q", code, stderr)
+	}
+
+	// a gzipped log gives the same report, --parallel refuses it
+	code, stdout, stderr = runTool("nginx-log", "--log-format", combinedFormat, "--output", "json", combinedLog+".gz")
+	var gzRep analyzer.Report
+	if err := json.Unmarshal([]byte(stdout), &gzRep); code != cli.ExitOK || err != nil {
+		t.Fatalf("gzipped log exited with %d (%s): %v", code, stderr, err)
+	}
+	if gzRep.Lines != rep.Lines || len(gzRep.TopIPs) == 0 || gzRep.TopIPs[0] != rep.TopIPs[0] {
+		t.Errorf("gzipped log has %d lines, top IPs %v; want %d lines, %v", gzRep.Lines, gzRep.TopIPs, rep.Lines, rep.TopIPs)
+	}
+	code, _, stderr = runTool("nginx-log", "--log-format", combinedFormat, "--parallel", "2", combinedLog+".gz")
+	if code != cli.ExitError || !strings.Contains(stderr, "gzip") {
+		t.Errorf("--parallel on a gzipped log exited with %d, stderr %q", code, stderr)
+	}
+}
+
+func TestNginxLogExitCodes(t *testing.T) {
+	base := []string{"nginx-log", "--log-format", combinedFormat, "--output", "json", "-q"}
+	if code, _, stderr := runTool(append(base, "--alert", "requests<1000", combinedLog)...); code != cli.ExitThreshold {
+		t.Errorf("triggered alert exited with %d, want %d: %s", code, cli.ExitThreshold, stderr)
+	}
+	if code, _, stderr := runTool(append(base, "--alert", "requests<10", combinedLog)...); code != cli.ExitOK {
+		t.Errorf("quiet alert exited with %d, want %d: %s", code, cli.ExitOK, stderr)
+	}
+	if code, _, _ := runTool(append(base, "missing.log")...); code != cli.ExitError {
+		t.Errorf("missing log exited with %d, want %d", code, cli.ExitError)
+	}
+}
+
+func TestMemccOutputs(t *testing.T) {
+	server, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Set("user:1", "alice")
+	server.Set("user:2", "bob")
+	memcc := func(args ...string) (int, string, string) {
+		return runTool(append([]string{"memcc", "-s", server.Addr()}, args...)...)
+	}
+
+	if code, _, stderr := memcc("set", "greeting", "hello"); code != cli.ExitOK {
+		t.Fatalf("set exited with %d: %s", code, stderr)
+	}
+	if v, _ := server.Get("greeting"); v != "hello" {
+		t.Errorf("server has greeting = %q, want hello", v)
+	}
+
+	code, stdout, stderr := memcc("-o", "json", "get", "greeting")
+	var got struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Found bool   `json:"found"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &got); code != cli.ExitOK || err != nil {
+		t.Fatalf("get -o json exited with %d (%s), output %q: %v", code, stderr, stdout, err)
+	}
+	if got.Key != "greeting" || got.Value != "hello" || !got.Found {
+		t.Errorf("get -o json = %+v", got)
+	}
+
+	code, stdout, _ = memcc("--output", "csv", "get", "user:1", "user:2", "nobody")
+	want := "key,value,found,bytes\nuser:1,alice,true,5\nuser:2,bob,true,3\nnobody,,false,0\n"
+	if code != cli.ExitOK || stdout != want {
+		t.Errorf("get -o csv exited with %d:\n%s\nwant:\n%s", code, stdout, want)
+	}
+
+	code, stdout, _ = memcc("-o", "csv", "keys", "user")
+	if code != cli.ExitOK || stdout != "value\nuser:1\nuser:2\n" {
+		t.Errorf("keys -o csv exited with %d:\n%s", code, stdout)
+	}
+
+	code, stdout, _ = memcc("-o", "csv", "stats")
+	records, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if code != cli.ExitOK || err != nil || len(records) != 2 {
+		t.Fatalf("stats -o csv exited with %d: %v\n%s", code, err, stdout)
+	}
+	for i, name := range records[0] {
+		if name == "version" && records[1][i] != memcachetest.Version {
+			t.Errorf("stats -o csv has version %q, want %q", records[1][i], memcachetest.Version)
+		}
+	}
+
+	code, stdout, _ = memcc("-o", "table", "get", "greeting")
+	if code != cli.ExitOK || !strings.Contains(stdout, "hello") {
+		t.Errorf("get -o table exited with %d:\n%s", code, stdout)
+	}
+
+	// errors go to stderr as JSON, stdout stays empty
+	code, stdout, stderr = memcc("-o", "csv", "shell")
+	if code != cli.ExitError || stdout != "" || !strings.Contains(stderr, `{"error":`) {
+		t.Errorf("shell -o csv exited with %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if code, stdout, _ = memcc("-o", "xml", "stats"); code != cli.ExitError || !strings.Contains(stdout, "invalid output format: xml") {
+		t.Errorf("-o xml exited with %d, output %q", code, stdout)
+	}
+
+	// the global flag after the command is not taken for a file name
+	code, stdout, _ = memcc("get", "greeting", "--output", "json")
+	if code != cli.ExitError || !strings.Contains(stdout, "put the global -o json before the command") {
+		t.Errorf("get --output json exited with %d:\n%s", code, stdout)
+	}
+	file := filepath.Join(t.TempDir(), "greeting.txt")
+	if code, stdout, _ = memcc("get", "greeting", "--out-file", file); code != cli.ExitOK {
+		t.Errorf("get --out-file exited with %d:\n%s", code, stdout)
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "hello" {
+		t.Errorf("get --out-file wrote %q, %v", data, err)
+	}
+}
+
+// with --default the output is the bare value even in dry-run mode, whose
+// notices go to stderr
+func TestMemccDefaultDryRun(t *testing.T) {
+	server, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	code, stdout, stderr := runTool("memcc", "-s", server.Addr(), "--dry-run", "get", "missing", "--default", "v", "--on-miss", "set")
+	if code != cli.ExitOK || stdout != "v\n" || !strings.Contains(stderr, "[DRY RUN] would set key 'missing'") {
+		t.Errorf("exited with %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if _, found := server.Get("missing"); found {
+		t.Error("dry run stored the default value")
+	}
+}
+
+// values may start with "-" and --keep-ttl rewrites a key with the TTL it
+// has left
+func TestMemccSet(t *testing.T) {
+	server, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	memcc := func(args ...string) (int, string) {
+		code, stdout, _ := runTool(append([]string{"memcc", "-s", server.Addr()}, args...)...)
+		return code, stdout
+	}
+
+	for _, value := range []string{"-5", "-x", "--"} {
+		args := []string{"set", "n", value}
+		if value == "--" {
+			// "--" ends the flags, a value "--" needs one before it
+			args = []string{"set", "n", "--", value}
+		}
+		if code, stdout := memcc(args...); code != cli.ExitOK {
+			t.Errorf("set n %s exited with %d:\n%s", value, code, stdout)
+			continue
+		}
+		if v, _ := server.Get("n"); v != value {
+			t.Errorf("set n %s stored %q", value, v)
+		}
+	}
+	if code, stdout := memcc("set", "n", "-7", "60", "--if-changed"); code != cli.ExitOK {
+		t.Errorf("set n -7 60 --if-changed exited with %d:\n%s", code, stdout)
+	}
+	if v, _ := server.Get("n"); v != "-7" {
+		t.Errorf("set n -7 60 --if-changed stored %q", v)
+	}
+	if code, stdout := memcc("-o", "json", "set", "n", "-7", "--if-changed"); code != cli.ExitOK || !strings.Contains(stdout, `"unchanged": true`) {
+		t.Errorf("unchanged set exited with %d:\n%s", code, stdout)
+	}
+
+	// add on an existing key is told apart from errors
+	if code, stdout := memcc("add", "n", "x"); code != cli.ExitPrecondition || !strings.Contains(stdout, "already exists") {
+		t.Errorf("add on an existing key exited with %d, want %d:\n%s", code, cli.ExitPrecondition, stdout)
+	}
+	if code, stdout := memcc("add", "fresh", "x"); code != cli.ExitOK {
+		t.Errorf("add fresh exited with %d:\n%s", code, stdout)
+	}
+
+	if code, _ := memcc("set", "session", "a", "300"); code != cli.ExitOK {
+		t.Fatalf("set session exited with %d", code)
+	}
+	if code, stdout := memcc("set", "session", "b", "--keep-ttl"); code != cli.ExitOK || !strings.Contains(stdout, "TTL kept") {
+		t.Errorf("set --keep-ttl exited with %d:\n%s", code, stdout)
+	}
+	if v, _ := server.Get("session"); v != "b" {
+		t.Errorf("set --keep-ttl stored %q, want b", v)
+	}
+	if exp, _ := server.Expiry("session"); exp != 300 {
+		t.Errorf("set --keep-ttl stored expiry %d, want 300", exp)
+	}
+	if code, _ := memcc("set", "fresh", "x", "--keep-ttl", "--if-changed"); code != cli.ExitOK {
+		t.Errorf("set --keep-ttl of a missing key exited with %d", code)
+	}
+	if exp, found := server.Expiry("fresh"); !found || exp != 0 {
+		t.Errorf("set --keep-ttl of a missing key stored expiry %d, found %v; want no expiry", exp, found)
+	}
+	if code, stdout := memcc("set", "session", "c", "60", "--keep-ttl"); code != cli.ExitError || !strings.Contains(stdout, "cannot be combined") {
+		t.Errorf("set with an expiry and --keep-ttl exited with %d:\n%s", code, stdout)
+	}
+}
+
+// purge deletes with several connections and reports the keys it could not
+// delete, in JSON without any text around it
+func TestMemccPurge(t *testing.T) {
+	server, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	fill := func() {
+		for i := 1; i <= 20; i++ {
+			server.Set(fmt.Sprintf("job:%d", i), "x")
+		}
+	}
+	fill()
+	server.Set("other", "x")
+	server.FailDelete("job:7")
+
+	code, stdout, _ := runTool("memcc", "-s", server.Addr(), "purge", "job:", "--concurrency", "4")
+	if code != cli.ExitError || !strings.Contains(stdout, "Failed to delete 1 of 20 keys") || !strings.Contains(stdout, "job:7: ") {
+		t.Errorf("purge exited with %d:\n%s", code, stdout)
+	}
+	if keys := server.Keys(); len(keys) != 2 || keys[0] != "job:7" || keys[1] != "other" {
+		t.Errorf("keys left after purge: %q", keys)
+	}
+
+	fill()
+	code, stdout, stderr := runTool("memcc", "-s", server.Addr(), "-o", "json", "purge", "job:", "--concurrency", "3")
+	var got struct {
+		Matched int `json:"matched"`
+		Deleted int `json:"deleted"`
+		Failed  []struct {
+			Key string `json:"key"`
+		} `json:"failed"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("purge -o json output %q: %v", stdout, err)
+	}
+	if code != cli.ExitError || got.Matched != 20 || got.Deleted != 19 || len(got.Failed) != 1 || got.Failed[0].Key != "job:7" {
+		t.Errorf("purge -o json exited with %d: %+v (%s)", code, got, stderr)
+	}
+}
@@ -0,0 +1,124 @@
+// Package cli holds what the command line tools have in common: the release
+// version, exit codes, the exit mechanism used by their Run functions and
+// flag parsing helpers.
+package cli
+
+import (
+	"flag"
+	"strings"
+)
+
+// Version is the release version shared by all tools
+const Version = "1.0.0"
+
+// Exit codes. ExitThreshold means the command itself worked but found
+// something to report, such as an alert condition, so cron jobs and CI can
+// tell it apart from a failure. ExitPrecondition means a conditional write
+// was left undone because its condition did not hold, such as memcc add on
+// a key that exists.
+const (
+	ExitOK           = 0
+	ExitError        = 1
+	ExitThreshold    = 2
+	ExitPrecondition = 3
+)
+
+type exitCode int
+
+// Exit stops the running command with code. It unwinds the stack so deferred
+// cleanup still runs, and must only be called from the goroutine running a
+// Run function that defers Recover.
+func Exit(code int) {
+	panic(exitCode(code))
+}
+
+// Recover turns an Exit into the named result of the Run function it is
+// deferred in, e.g. "defer cli.Recover(&code)". Other panics are re-raised.
+func Recover(code *int) {
+	if r := recover(); r != nil {
+		c, ok := r.(exitCode)
+		if !ok {
+			panic(r)
+		}
+		*code = int(c)
+	}
+}
+
+// ParseInterspersed parses flags that may appear before or after the
+// positional arguments, e.g. "get mykey --default none", and returns the
+// positional arguments in order
+func ParseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// ParseInterspersedValues is ParseInterspersed for commands whose positional
+// arguments are arbitrary values, such as "set mykey -5": an argument that
+// starts with "-" but names no flag of fs is positional instead of an error.
+// "--" still ends the flags.
+func ParseInterspersedValues(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		f, ok := lookupFlag(fs, arg)
+		if !ok {
+			positional = append(positional, arg)
+			args = args[1:]
+			continue
+		}
+		// The flag's value is the next argument unless given with "="
+		n := 1
+		if f != nil && !isBoolFlag(f) && !strings.Contains(arg, "=") && len(args) > 1 {
+			n = 2
+		}
+		if err := fs.Parse(args[:n]); err != nil {
+			return nil, err
+		}
+		args = args[n:]
+	}
+	return positional, nil
+}
+
+// lookupFlag returns the flag of fs that arg, such as "--name=x", sets. It
+// reports -h and -help as flags with a nil *flag.Flag, fs.Parse handles them.
+func lookupFlag(fs *flag.FlagSet, arg string) (*flag.Flag, bool) {
+	if len(arg) < 2 || arg[0] != '-' {
+		return nil, false
+	}
+	name := strings.TrimPrefix(arg[1:], "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	if f := fs.Lookup(name); f != nil {
+		return f, true
+	}
+	return nil, name == "h" || name == "help"
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// FlagPassed reports whether a flag was set explicitly, even to an empty value
+func FlagPassed(fs *flag.FlagSet, name string) bool {
+	passed := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseInterspersedValues(t *testing.T) {
+	tests := []struct {
+		args       string
+		positional string
+		changed    bool
+		from       string
+		ok         bool
+	}{
+		{"k -5", "k -5", false, "", true},
+		{"k -5 60 --if-changed", "k -5 60", true, "", true},
+		{"--if-changed k -x", "k -x", true, "", true},
+		{"k - --from-file f", "k -", false, "f", true},
+		{"k --from-file=f -1", "k -1", false, "f", true},
+		{"k -if-changed=true v", "k v", true, "", true},
+		{"k -- --if-changed", "k --if-changed", false, "", true},
+		{"k --from-file", "", false, "", false},
+		{"k -h", "", false, "", false},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("set", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		changed := fs.Bool("if-changed", false, "")
+		from := fs.String("from-file", "", "")
+		positional, err := ParseInterspersedValues(fs, strings.Fields(tt.args))
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: error %v, want ok=%v", tt.args, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if got := strings.Join(positional, " "); got != tt.positional || *changed != tt.changed || *from != tt.from {
+			t.Errorf("%q: positional %q, if-changed %v, from-file %q; want %q, %v, %q",
+				tt.args, got, *changed, *from, tt.positional, tt.changed, tt.from)
+		}
+	}
+}
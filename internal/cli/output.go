@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats of the --output flag every tool accepts. OutputTable is the human
+// readable default, "text" is accepted as its older name.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+)
+
+// ParseOutput checks the value of an --output flag and returns the format it
+// names. extra lists the formats only one tool has, such as markdown.
+func ParseOutput(value string, extra ...string) (string, error) {
+	if value == "text" {
+		return OutputTable, nil
+	}
+	formats := append([]string{OutputTable, OutputJSON, OutputCSV}, extra...)
+	for _, f := range formats {
+		if value == f {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("invalid output format: %s (use %s)", value, strings.Join(formats, ", "))
+}
+
+// WriteCSV writes v as CSV, going through its JSON form so that the columns
+// are the JSON field names:
+//   - a list of objects is one row per object, under a header of their fields
+//   - a map of objects, or of lists of objects, such as results per server,
+//     gets a leading "group" column holding the map key
+//   - any other object is a single row
+//   - a list of plain values is a single "value" column
+//
+// Nested values are written as compact JSON. An empty list writes nothing.
+func WriteCSV(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := decodeOrdered(dec)
+	if err != nil {
+		return err
+	}
+
+	var t csvTable
+	switch root := root.(type) {
+	case []interface{}:
+		for _, elem := range root {
+			t.add(nil, elem)
+		}
+	case jsonObject:
+		if !root.nested() {
+			t.add(nil, root)
+			break
+		}
+		for _, f := range root {
+			group := &jsonField{"group", f.name}
+			if list, ok := f.value.([]interface{}); ok {
+				for _, elem := range list {
+					t.add(group, elem)
+				}
+				continue
+			}
+			t.add(group, f.value)
+		}
+	default:
+		t.add(nil, root)
+	}
+	return t.write(w)
+}
+
+// jsonObject is a decoded JSON object that keeps the order of its fields
+type jsonObject []jsonField
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// nested reports whether every field of o holds an object or a list of
+// objects, so that each field is a group of rows rather than a column
+func (o jsonObject) nested() bool {
+	if len(o) == 0 {
+		return false
+	}
+	for _, f := range o {
+		switch v := f.value.(type) {
+		case jsonObject:
+		case []interface{}:
+			for _, elem := range v {
+				if _, ok := elem.(jsonObject); !ok {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// decodeOrdered reads the next JSON value from dec, with objects as jsonObject
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			name, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{name.(string), value})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// csvTable collects rows, the header being every field name in the order
+// they first appear
+type csvTable struct {
+	header []string
+	rows   []map[string]string
+}
+
+// add appends value as a row, after the optional group column
+func (t *csvTable) add(group *jsonField, value interface{}) {
+	obj, ok := value.(jsonObject)
+	if !ok {
+		obj = jsonObject{{"value", value}}
+	}
+	if group != nil {
+		obj = append(jsonObject{*group}, obj...)
+	}
+	row := make(map[string]string, len(obj))
+	for _, f := range obj {
+		if _, seen := row[f.name]; seen {
+			continue
+		}
+		if !t.hasColumn(f.name) {
+			t.header = append(t.header, f.name)
+		}
+		row[f.name] = csvCell(f.value)
+	}
+	t.rows = append(t.rows, row)
+}
+
+func (t *csvTable) hasColumn(name string) bool {
+	for _, h := range t.header {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *csvTable) write(w io.Writer) error {
+	if len(t.rows) == 0 {
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(t.header)
+	record := make([]string, len(t.header))
+	for _, row := range t.rows {
+		for i, name := range t.header {
+			record[i] = row[name]
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
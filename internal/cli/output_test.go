@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		value string
+		extra []string
+		want  string
+		ok    bool
+	}{
+		{"table", nil, OutputTable, true},
+		{"text", nil, OutputTable, true},
+		{"json", nil, OutputJSON, true},
+		{"csv", nil, OutputCSV, true},
+		{"markdown", []string{"markdown"}, "markdown", true},
+		{"markdown", nil, "", false},
+		{"JSON", nil, "", false},
+		{"", nil, "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseOutput(tt.value, tt.extra...)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseOutput(%q, %q) = %q, %v; want %q, ok=%v", tt.value, tt.extra, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	type row struct {
+		Key   string `json:"key"`
+		Value string `json:"value,omitempty"`
+		Found bool   `json:"found"`
+		Bytes int    `json:"bytes"`
+	}
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"list of objects", []row{{"a", "1", true, 1}, {"b", "", false, 0}},
+			"key,value,found,bytes\na,1,true,1\nb,,false,0\n"},
+		{"columns in order of appearance", []row{{"b", "", false, 0}, {"a", "x,\"y\"", true, 5}},
+			"key,found,bytes,value\nb,false,0,\na,true,5,\"x,\"\"y\"\"\"\n"},
+		{"single object", row{"k", "v", true, 1},
+			"key,value,found,bytes\nk,v,true,1\n"},
+		{"map of strings", map[string]string{"uptime": "10", "pid": "1"},
+			"pid,uptime\n1,10\n"},
+		{"map of objects", map[string]map[string]int{"s1:11211": {"n": 1}, "s2:11211": {"n": 2}},
+			"group,n\ns1:11211,1\ns2:11211,2\n"},
+		{"map of lists", map[string][]row{"s1": {{"a", "1", true, 1}}, "s2": {{"b", "2", true, 1}, {"c", "3", true, 1}}},
+			"group,key,value,found,bytes\ns1,a,1,true,1\ns2,b,2,true,1\ns2,c,3,true,1\n"},
+		{"list of strings", []string{"a", "b"}, "value\na\nb\n"},
+		{"nested values", struct {
+			Name  string   `json:"name"`
+			Slabs []int    `json:"slabs"`
+			Extra *row     `json:"extra"`
+			Tags  []string `json:"tags"`
+		}{"x", []int{1, 2}, nil, []string{}},
+			"name,slabs,extra,tags\nx,\"[1,2]\",,[]\n"},
+		{"empty list", []row{}, ""},
+		{"number", 42, "value\n42\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteCSV(&buf, tt.v); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("WriteCSV = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+// Package memcachetest provides an in-memory Memcached server speaking the
+// text protocol, for tests of the client and the command line tools. It keeps
+// flags, CAS values and expiry times but never expires an item: "mg key t"
+// reports the expiry an item was stored with as its remaining TTL.
+package memcachetest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is what the server answers to "version"
+const Version = "1.6.21"
+
+type item struct {
+	value []byte
+	flags uint32
+	exp   int64
+	cas   uint64
+}
+
+// Server is a Memcached server listening on a random local port
+type Server struct {
+	// Host and Port are the address the server listens on
+	Host string
+	Port int
+
+	ln    net.Listener
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	items map[string]item
+	cas   uint64
+	conns map[net.Conn]struct{}
+	stats map[string]int
+	// undeletable keys fail to delete, see FailDelete
+	undeletable map[string]bool
+}
+
+// NewServer starts a server on 127.0.0.1
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &Server{
+		Host:  addr.IP.String(),
+		Port:  addr.Port,
+		ln:    ln,
+		items: make(map[string]item),
+		conns: make(map[net.Conn]struct{}),
+		stats: make(map[string]int),
+
+		undeletable: make(map[string]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address as host:port
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Close stops the server and closes the open connections
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Set stores value under key, as if a client had set it
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(key, []byte(value), 0, 0)
+}
+
+// Get returns the value stored under key
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[key]
+	return string(it.value), ok
+}
+
+// Expiry returns the expiry time key was last stored or touched with
+func (s *Server) Expiry(key string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[key]
+	return it.exp, ok
+}
+
+// FailDelete makes every delete of key answer with a SERVER_ERROR
+func (s *Server) FailDelete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.undeletable[key] = true
+}
+
+// Keys returns the stored keys in order
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.items))
+	for key := range s.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) store(key string, value []byte, flags uint32, exp int64) {
+	s.cas++
+	s.items[key] = item{value: value, flags: flags, exp: exp, cas: s.cas}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.stats["total_connections"]++
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			fmt.Fprint(w, "ERROR\r\n")
+		} else if fields[0] == "quit" {
+			w.Flush()
+			return
+		} else if err := s.command(r, w, fields); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// command runs one command and writes its reply to w. It only returns an
+// error when the connection is unusable.
+func (s *Server) command(r *bufio.Reader, w io.Writer, fields []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	noreply := fields[len(fields)-1] == "noreply"
+	if noreply {
+		fields = fields[:len(fields)-1]
+		w = io.Discard
+	}
+
+	switch cmd := fields[0]; cmd {
+	case "version":
+		fmt.Fprintf(w, "VERSION %s\r\n", Version)
+
+	case "get", "gets":
+		for _, key := range fields[1:] {
+			s.stats["cmd_get"]++
+			it, ok := s.items[key]
+			if !ok {
+				s.stats["get_misses"]++
+				continue
+			}
+			s.stats["get_hits"]++
+			if cmd == "gets" {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, it.flags, len(it.value), it.cas)
+			} else {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, it.flags, len(it.value))
+			}
+			w.Write(it.value)
+			fmt.Fprint(w, "\r\n")
+		}
+		fmt.Fprint(w, "END\r\n")
+
+	case "set", "add", "replace", "append", "prepend", "cas":
+		if len(fields) < 5 || cmd == "cas" && len(fields) < 6 {
+			fmt.Fprint(w, "ERROR\r\n")
+			return nil
+		}
+		flags, err1 := strconv.ParseUint(fields[2], 10, 32)
+		exp, err2 := strconv.ParseInt(fields[3], 10, 64)
+		size, err3 := strconv.Atoi(fields[4])
+		if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+			fmt.Fprint(w, "CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if string(data[size:]) != "\r\n" {
+			fmt.Fprint(w, "CLIENT_ERROR bad data chunk\r\n")
+			return nil
+		}
+		s.stats["cmd_set"]++
+		fmt.Fprint(w, s.write(cmd, fields, data[:size], uint32(flags), exp))
+
+	case "delete":
+		if len(fields) < 2 {
+			fmt.Fprint(w, "ERROR\r\n")
+			return nil
+		}
+		if _, ok := s.items[fields[1]]; !ok {
+			fmt.Fprint(w, "NOT_FOUND\r\n")
+			return nil
+		}
+		if s.undeletable[fields[1]] {
+			fmt.Fprint(w, "SERVER_ERROR delete refused\r\n")
+			return nil
+		}
+		delete(s.items, fields[1])
+		fmt.Fprint(w, "DELETED\r\n")
+
+	case "incr", "decr":
+		if len(fields) < 3 {
+			fmt.Fprint(w, "ERROR\r\n")
+			return nil
+		}
+		delta, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			fmt.Fprint(w, "CLIENT_ERROR invalid numeric delta argument\r\n")
+			return nil
+		}
+		it, ok := s.items[fields[1]]
+		if !ok {
+			fmt.Fprint(w, "NOT_FOUND\r\n")
+			return nil
+		}
+		n, err := strconv.ParseUint(string(it.value), 10, 64)
+		if err != nil {
+			fmt.Fprint(w, "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+			return nil
+		}
+		switch {
+		case cmd == "incr":
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+		s.store(fields[1], []byte(strconv.FormatUint(n, 10)), it.flags, it.exp)
+		fmt.Fprintf(w, "%d\r\n", n)
+
+	case "touch":
+		if len(fields) < 3 {
+			fmt.Fprint(w, "ERROR\r\n")
+			return nil
+		}
+		it, ok := s.items[fields[1]]
+		if !ok {
+			fmt.Fprint(w, "NOT_FOUND\r\n")
+			return nil
+		}
+		it.exp, _ = strconv.ParseInt(fields[2], 10, 64)
+		s.items[fields[1]] = it
+		fmt.Fprint(w, "TOUCHED\r\n")
+
+	case "mg":
+		// Only the t flag, the remaining TTL, is supported
+		if len(fields) < 2 {
+			fmt.Fprint(w, "CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		it, ok := s.items[fields[1]]
+		if !ok {
+			fmt.Fprint(w, "EN\r\n")
+			return nil
+		}
+		reply := "HD"
+		for _, flag := range fields[2:] {
+			if flag == "t" {
+				ttl := it.exp
+				if ttl == 0 {
+					ttl = -1
+				}
+				reply += fmt.Sprintf(" t%d", ttl)
+			}
+		}
+		fmt.Fprintf(w, "%s\r\n", reply)
+
+	case "flush_all":
+		s.items = make(map[string]item)
+		fmt.Fprint(w, "OK\r\n")
+
+	case "verbosity":
+		fmt.Fprint(w, "OK\r\n")
+
+	case "stats":
+		s.writeStats(w, fields[1:])
+
+	default:
+		fmt.Fprint(w, "ERROR\r\n")
+	}
+	return nil
+}
+
+// write applies a storage command and returns its reply
+func (s *Server) write(cmd string, fields []string, value []byte, flags uint32, exp int64) string {
+	key := fields[1]
+	it, exists := s.items[key]
+	switch cmd {
+	case "add":
+		if exists {
+			return "NOT_STORED\r\n"
+		}
+	case "replace":
+		if !exists {
+			return "NOT_STORED\r\n"
+		}
+	case "append", "prepend":
+		if !exists {
+			return "NOT_STORED\r\n"
+		}
+		if cmd == "append" {
+			value = append(append([]byte(nil), it.value...), value...)
+		} else {
+			value = append(append([]byte(nil), value...), it.value...)
+		}
+		flags, exp = it.flags, it.exp
+	case "cas":
+		if !exists {
+			return "NOT_FOUND\r\n"
+		}
+		if fields[5] != strconv.FormatUint(it.cas, 10) {
+			return "EXISTS\r\n"
+		}
+	}
+	s.store(key, value, flags, exp)
+	return "STORED\r\n"
+}
+
+func (s *Server) writeStats(w io.Writer, args []string) {
+	if len(args) == 0 {
+		var bytes int
+		for _, it := range s.items {
+			bytes += len(it.value)
+		}
+		for _, stat := range []struct {
+			name  string
+			value interface{}
+		}{
+			{"pid", os.Getpid()},
+			{"uptime", 3600},
+			{"time", time.Now().Unix()},
+			{"version", Version},
+			{"curr_connections", len(s.conns)},
+			{"total_connections", s.stats["total_connections"]},
+			{"cmd_get", s.stats["cmd_get"]},
+			{"cmd_set", s.stats["cmd_set"]},
+			{"get_hits", s.stats["get_hits"]},
+			{"get_misses", s.stats["get_misses"]},
+			{"curr_items", len(s.items)},
+			{"bytes", bytes},
+			{"evictions", 0},
+			{"limit_maxbytes", 64 << 20},
+		} {
+			fmt.Fprintf(w, "STAT %s %v\r\n", stat.name, stat.value)
+		}
+		fmt.Fprint(w, "END\r\n")
+		return
+	}
+
+	// Every item lives in slab class 1
+	switch args[0] {
+	case "items":
+		if len(s.items) > 0 {
+			fmt.Fprintf(w, "STAT items:1:number %d\r\n", len(s.items))
+			fmt.Fprint(w, "STAT items:1:evicted 0\r\n")
+		}
+	case "slabs":
+		if len(s.items) > 0 {
+			fmt.Fprint(w, "STAT 1:chunk_size 96\r\n")
+			fmt.Fprint(w, "STAT 1:total_pages 1\r\n")
+			fmt.Fprintf(w, "STAT 1:used_chunks %d\r\n", len(s.items))
+		}
+		fmt.Fprint(w, "STAT active_slabs 1\r\n")
+	case "cachedump":
+		if len(args) < 2 || args[1] != "1" {
+			break
+		}
+		limit := 0
+		if len(args) > 2 {
+			limit, _ = strconv.Atoi(args[2])
+		}
+		keys := make([]string, 0, len(s.items))
+		for key := range s.items {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for i, key := range keys {
+			if limit > 0 && i == limit {
+				break
+			}
+			it := s.items[key]
+			fmt.Fprintf(w, "ITEM %s [%d b; %d s]\r\n", key, len(it.value), it.exp)
+		}
+	case "settings":
+		fmt.Fprint(w, "STAT maxbytes 67108864\r\nSTAT maxconns 1024\r\n")
+	default:
+		fmt.Fprint(w, "ERROR\r\n")
+		return
+	}
+	fmt.Fprint(w, "END\r\n")
+}
@@ -0,0 +1,47 @@
+package tui
+
+import "strings"
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// BarLength scales n against max to a bar of at most width cells. Non-zero
+// values always get at least one cell so they stay visible next to large ones.
+func BarLength(n, max, width int) int {
+	if n <= 0 || max <= 0 {
+		return 0
+	}
+	length := n * width / max
+	if length == 0 {
+		length = 1
+	}
+	if length > width {
+		length = width
+	}
+	return length
+}
+
+// Bar renders n as a run of full blocks padded with spaces to width cells
+func Bar(n, max, width int) string {
+	length := BarLength(n, max, width)
+	return strings.Repeat("█", length) + strings.Repeat(" ", width-length)
+}
+
+// Sparkline maps each value to one of eight block heights relative to the
+// largest value. Zero and negative values are shown as a space so gaps stand out.
+func Sparkline(values []int) string {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if v <= 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		b.WriteRune(sparkBlocks[(v*len(sparkBlocks)-1)/max])
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package tui
+
+import "testing"
+
+func TestBarLength(t *testing.T) {
+	tests := []struct {
+		n, max, width, want int
+	}{
+		{0, 100, 40, 0},
+		{-5, 100, 40, 0},
+		{5, 0, 40, 0},
+		{100, 100, 40, 40},
+		{50, 100, 40, 20},
+		{1, 1000, 40, 1},
+		{200, 100, 40, 40},
+	}
+	for _, tt := range tests {
+		if got := BarLength(tt.n, tt.max, tt.width); got != tt.want {
+			t.Errorf("BarLength(%d, %d, %d) = %d, want %d", tt.n, tt.max, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestBar(t *testing.T) {
+	if got, want := Bar(1, 2, 4), "██  "; got != want {
+		t.Errorf("Bar(1, 2, 4) = %q, want %q", got, want)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []int
+		want   string
+	}{
+		{nil, ""},
+		{[]int{0, 0}, "  "},
+		{[]int{1, 2, 3, 4, 5, 6, 7, 8}, "▁▂▃▄▅▆▇█"},
+		{[]int{0, 100, 1, 50}, " █▁▄"},
+		{[]int{-3, 3}, " █"},
+	}
+	for _, tt := range tests {
+		if got := Sparkline(tt.values); got != tt.want {
+			t.Errorf("Sparkline(%v) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
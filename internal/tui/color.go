@@ -0,0 +1,70 @@
+// Package tui holds the terminal rendering helpers shared by the command line
+// tools: ANSI colors, boxed tables, headers, status messages and bar charts.
+package tui
+
+import (
+	"io"
+	"os"
+)
+
+// ANSI color codes. They are empty strings when color is disabled, so callers
+// can concatenate them unconditionally.
+var (
+	Reset  string
+	Red    string
+	Green  string
+	Yellow string
+	Blue   string
+	Purple string
+	Cyan   string
+	White  string
+	Bold   string
+	Dim    string
+)
+
+func init() {
+	SetColor(ColorSupported(os.Stdout))
+}
+
+// SetColor turns the color codes on or off
+func SetColor(enabled bool) {
+	if !enabled {
+		Reset, Red, Green, Yellow, Blue, Purple, Cyan, White, Bold, Dim = "", "", "", "", "", "", "", "", "", ""
+		return
+	}
+	Reset = "\033[0m"
+	Red = "\033[31m"
+	Green = "\033[32m"
+	Yellow = "\033[33m"
+	Blue = "\033[34m"
+	Purple = "\033[35m"
+	Cyan = "\033[36m"
+	White = "\033[37m"
+	Bold = "\033[1m"
+	Dim = "\033[2m"
+}
+
+// ColorEnabled reports whether color codes are currently emitted
+func ColorEnabled() bool {
+	return Reset != ""
+}
+
+// ColorSupported reports whether w is a terminal that should get colored
+// output: NO_COLOR (https://no-color.org) and TERM=dumb turn color off, as
+// does redirecting to a file or pipe or writing to anything but a file.
+func ColorSupported(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(w)
+}
+
+// IsTerminal reports whether w is a terminal, whatever the color settings
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
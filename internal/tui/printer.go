@@ -0,0 +1,158 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Box drawing characters
+const (
+	boxTopLeft     = "╭"
+	boxTopRight    = "╮"
+	boxBottomLeft  = "╰"
+	boxBottomRight = "╯"
+	boxHorizontal  = "─"
+	boxVertical    = "│"
+	boxTeeRight    = "├"
+	boxTeeLeft     = "┤"
+	boxTeeDown     = "┬"
+	boxTeeUp       = "┴"
+	boxCross       = "┼"
+)
+
+// headerWidth is the inner width of the box drawn by Header
+const headerWidth = 50
+
+// chartWidth is the widest bar drawn by BarChart
+const chartWidth = 40
+
+// Printer renders messages, headers and tables to a writer
+type Printer struct {
+	w io.Writer
+
+	// jsonErrors receives errors as JSON objects, see NewJSONPrinter
+	jsonErrors io.Writer
+}
+
+// NewPrinter creates a Printer writing to w
+func NewPrinter(w io.Writer) *Printer {
+	return &Printer{w: w}
+}
+
+// NewJSONPrinter creates a Printer for commands whose output is JSON: it drops
+// everything meant for humans and writes only errors, one {"error": "..."}
+// object per line, to errOut
+func NewJSONPrinter(errOut io.Writer) *Printer {
+	return &Printer{w: io.Discard, jsonErrors: errOut}
+}
+
+func (p *Printer) message(color, symbol, message string) {
+	fmt.Fprintf(p.w, "%s%s %s %s%s\n", color, Bold, symbol, message, Reset)
+}
+
+// Success prints a green check mark message
+func (p *Printer) Success(message string) { p.message(Green, "✓", message) }
+
+// Error prints a red cross message
+func (p *Printer) Error(message string) {
+	if p.jsonErrors != nil {
+		json.NewEncoder(p.jsonErrors).Encode(map[string]string{"error": message})
+		return
+	}
+	p.message(Red, "✗", message)
+}
+
+// Info prints a blue informational message
+func (p *Printer) Info(message string) { p.message(Blue, "ℹ", message) }
+
+// Warning prints a yellow warning message
+func (p *Printer) Warning(message string) { p.message(Yellow, "⚠", message) }
+
+// Header prints title centered in a rounded box, preceded by a blank line
+func (p *Printer) Header(title string) {
+	padding := (headerWidth - Width(title) - 2) / 2
+	if padding < 0 {
+		padding = 0
+	}
+	right := headerWidth - padding - Width(title)
+	if right < 0 {
+		right = 0
+	}
+
+	fmt.Fprintln(p.w)
+	fmt.Fprintf(p.w, "%s%s%s%s%s\n", Cyan, boxTopLeft, strings.Repeat(boxHorizontal, headerWidth), boxTopRight, Reset)
+	fmt.Fprintf(p.w, "%s%s%s", Cyan, boxVertical, Reset)
+	fmt.Fprintf(p.w, "%s%s%s", strings.Repeat(" ", padding), Bold+title+Reset, strings.Repeat(" ", right))
+	fmt.Fprintf(p.w, "%s%s%s\n", Cyan, boxVertical, Reset)
+	fmt.Fprintf(p.w, "%s%s%s%s%s\n", Cyan, boxBottomLeft, strings.Repeat(boxHorizontal, headerWidth), boxBottomRight, Reset)
+}
+
+// border prints a horizontal table border, each column being its width plus
+// one space of padding on either side
+func (p *Printer) border(left, middle, right string, widths []int) {
+	fmt.Fprintf(p.w, "%s%s", Cyan, left)
+	for i, w := range widths {
+		fmt.Fprint(p.w, strings.Repeat(boxHorizontal, w+2))
+		if i < len(widths)-1 {
+			fmt.Fprint(p.w, middle)
+		}
+	}
+	fmt.Fprintf(p.w, "%s%s\n", right, Reset)
+}
+
+// TableHeader prints the top border, the column titles and the separator
+// below them. widths are the content widths of the columns in terminal columns.
+func (p *Printer) TableHeader(columns []string, widths []int) {
+	p.border(boxTopLeft, boxTeeDown, boxTopRight, widths)
+	fmt.Fprintf(p.w, "%s%s%s", Cyan, boxVertical, Reset)
+	for i, col := range columns {
+		fmt.Fprintf(p.w, " %s%s%s%s ", Bold, White, PadRight(col, widths[i]), Reset)
+		fmt.Fprintf(p.w, "%s%s%s", Cyan, boxVertical, Reset)
+	}
+	fmt.Fprintln(p.w)
+	p.border(boxTeeRight, boxCross, boxTeeLeft, widths)
+}
+
+// TableRow prints one row, truncating values that do not fit their column
+func (p *Printer) TableRow(values []string, widths []int) {
+	fmt.Fprintf(p.w, "%s%s%s", Cyan, boxVertical, Reset)
+	for i, val := range values {
+		fmt.Fprintf(p.w, " %s ", PadRight(Truncate(val, widths[i]), widths[i]))
+		fmt.Fprintf(p.w, "%s%s%s", Cyan, boxVertical, Reset)
+	}
+	fmt.Fprintln(p.w)
+}
+
+// TableFooter prints the bottom border
+func (p *Printer) TableFooter(widths []int) {
+	p.border(boxBottomLeft, boxTeeUp, boxBottomRight, widths)
+}
+
+// BarChart prints one horizontal bar per label with its count and share of
+// the total. Bars are scaled against the largest count.
+func (p *Printer) BarChart(labels []string, counts []int) {
+	total, max, labelWidth := 0, 0, 0
+	for i, n := range counts {
+		total += n
+		if n > max {
+			max = n
+		}
+		if w := Width(labels[i]); w > labelWidth {
+			labelWidth = w
+		}
+	}
+
+	for i, n := range counts {
+		pct := 0.0
+		if total > 0 {
+			pct = float64(n) * 100 / float64(total)
+		}
+		length := BarLength(n, max, chartWidth)
+		fmt.Fprintf(p.w, "  %s %s%s%s%s %8d %s%5.1f%%%s\n",
+			PadRight(labels[i], labelWidth),
+			Green, strings.Repeat("█", length), Reset, strings.Repeat(" ", chartWidth-length),
+			n, Dim, pct, Reset)
+	}
+}
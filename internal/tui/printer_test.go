@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name.golden, or rewrites the file with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s, run go test -update if the change is intended:\n%s", path, got)
+	}
+}
+
+// plain turns color off for the duration of the test so the golden files hold
+// what a pipe or NO_COLOR terminal gets
+func plain(t *testing.T) {
+	enabled := ColorEnabled()
+	SetColor(false)
+	t.Cleanup(func() { SetColor(enabled) })
+}
+
+func TestTable(t *testing.T) {
+	plain(t)
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	widths := []int{12, 8, 6}
+	p.TableHeader([]string{"Key", "名称", "Size"}, widths)
+	p.TableRow([]string{"session:1", "用户", "128"}, widths)
+	p.TableRow([]string{"a:very:long:cache:key", "中文名称很长的值", "1048576"}, widths)
+	p.TableRow([]string{"", "", ""}, widths)
+	p.TableFooter(widths)
+
+	// every line of the table is as wide as the borders
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for _, line := range lines {
+		if Width(line) != Width(lines[0]) {
+			t.Errorf("line %q is %d columns wide, the border is %d", line, Width(line), Width(lines[0]))
+		}
+	}
+	golden(t, "table", buf.Bytes())
+}
+
+func TestHeader(t *testing.T) {
+	plain(t)
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.Header("Memcached Stats")
+	p.Header("缓存统计")
+	p.Header(strings.Repeat("x", headerWidth+10))
+	golden(t, "header", buf.Bytes())
+}
+
+func TestMessages(t *testing.T) {
+	plain(t)
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.Success("stored")
+	p.Error("not found")
+	p.Info("connected")
+	p.Warning("dry run")
+	golden(t, "messages", buf.Bytes())
+}
+
+func TestBarChart(t *testing.T) {
+	plain(t)
+	var buf bytes.Buffer
+	NewPrinter(&buf).BarChart([]string{"GET", "POST", "删除", "HEAD"}, []int{750, 200, 49, 1})
+	golden(t, "barchart", buf.Bytes())
+}
+
+// a JSON printer drops everything but errors, which go out as JSON objects
+func TestJSONPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewJSONPrinter(&buf)
+	p.Info("connected")
+	p.Header("Stats")
+	p.TableRow([]string{"a"}, []int{3})
+	p.Error(`bad "key"`)
+	if got, want := buf.String(), `{"error":"bad \"key\""}`+"\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package tui
+
+import "strings"
+
+// Width returns the number of terminal columns s occupies. CJK characters and
+// emoji take two columns, ANSI escape sequences none, everything else one.
+func Width(s string) int {
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		if skipEscape(r, &inEscape) {
+			continue
+		}
+		n += runeWidth(r)
+	}
+	return n
+}
+
+func runeWidth(r rune) int {
+	if r >= 0x2E80 {
+		return 2
+	}
+	return 1
+}
+
+// skipEscape tracks whether r is part of an ANSI escape sequence such as
+// "\033[1;33m", which starts with ESC and ends with a letter
+func skipEscape(r rune, inEscape *bool) bool {
+	switch {
+	case r == '\033':
+		*inEscape = true
+	case *inEscape:
+		if r >= 0x40 && r <= 0x7E && r != '[' {
+			*inEscape = false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// PadRight pads s with spaces to width columns, longer strings are returned as is
+func PadRight(s string, width int) string {
+	if n := Width(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// PadLeft is PadRight with the padding in front
+func PadLeft(s string, width int) string {
+	if n := Width(s); n < width {
+		return strings.Repeat(" ", width-n) + s
+	}
+	return s
+}
+
+// Truncate shortens s to at most width columns, replacing the cut off part
+// with "...". It never splits a character or an escape sequence, and resets
+// the colors if it cuts a colored string.
+func Truncate(s string, width int) string {
+	if Width(s) <= width {
+		return s
+	}
+	ellipsis := "..."
+	if width < len(ellipsis) {
+		ellipsis = ""
+	}
+	limit := width - len(ellipsis)
+	var b strings.Builder
+	n := 0
+	inEscape, colored := false, false
+	for _, r := range s {
+		if skipEscape(r, &inEscape) {
+			b.WriteRune(r)
+			colored = true
+			continue
+		}
+		if n+runeWidth(r) > limit {
+			break
+		}
+		n += runeWidth(r)
+		b.WriteRune(r)
+	}
+	if colored {
+		return b.String() + ellipsis + "\033[0m"
+	}
+	return b.String() + ellipsis
+}
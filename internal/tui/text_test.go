@@ -0,0 +1,79 @@
+package tui
+
+import "testing"
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"中文", 4},
+		{"a中b", 4},
+		{"こんにちは", 10},
+		{"한국어", 6},
+		{"🚀", 2},
+		{"\033[1;33mwarn\033[0m", 4},
+		{"\033[32m中\033[0mx", 3},
+		{"✓ ok", 4},
+	}
+	for _, tt := range tests {
+		if got := Width(tt.s); got != tt.want {
+			t.Errorf("Width(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		s           string
+		width       int
+		left, right string
+	}{
+		{"ab", 4, "  ab", "ab  "},
+		{"中", 4, "  中", "中  "},
+		{"abcdef", 4, "abcdef", "abcdef"},
+		{"\033[31mab\033[0m", 3, " \033[31mab\033[0m", "\033[31mab\033[0m "},
+		{"", 2, "  ", "  "},
+	}
+	for _, tt := range tests {
+		if got := PadLeft(tt.s, tt.width); got != tt.left {
+			t.Errorf("PadLeft(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.left)
+		}
+		if got := PadRight(tt.s, tt.width); got != tt.right {
+			t.Errorf("PadRight(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.right)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"a longer value", 10, "a longe..."},
+		{"abcdef", 2, "ab"},
+		{"abcdef", 0, ""},
+		// wide characters are never split, the cut may leave the result a column short
+		{"中文字符串", 8, "中文..."},
+		{"中文字符串", 7, "中文..."},
+		{"a中文字符串", 8, "a中文..."},
+		{"a中文字符串", 7, "a中..."},
+		// escape sequences are kept whole and colors are reset after the cut
+		{"\033[31mred text here\033[0m", 6, "\033[31mred...\033[0m"},
+		{"\033[31mred\033[0m", 6, "\033[31mred\033[0m"},
+	}
+	for _, tt := range tests {
+		got := Truncate(tt.s, tt.width)
+		if got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+		if Width(got) > tt.width {
+			t.Errorf("Truncate(%q, %d) is %d columns wide", tt.s, tt.width, Width(got))
+		}
+	}
+}
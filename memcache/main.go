@@ -0,0 +1,12 @@
+// memcc is a command line client for Memcached, see package memcc
+package main
+
+import (
+	"os"
+
+	"github.com/ushell/tools/memcache/memcc"
+)
+
+func main() {
+	os.Exit(memcc.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,308 @@
+package memcc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Servers that require SASL authentication only speak the binary protocol,
+// so a client with a username sends the commands below as binary packets.
+// Commands that have no binary form, such as the key listing, fail with
+// ErrBinaryProtocol on those servers.
+
+// Magic bytes and opcodes of the binary protocol
+const (
+	binaryRequest  = 0x80
+	binaryResponse = 0x81
+
+	opGet       = 0x00
+	opSet       = 0x01
+	opAdd       = 0x02
+	opReplace   = 0x03
+	opDelete    = 0x04
+	opIncrement = 0x05
+	opDecrement = 0x06
+	opFlush     = 0x08
+	opVersion   = 0x0b
+	opAppend    = 0x0e
+	opPrepend   = 0x0f
+	opStat      = 0x10
+	opTouch     = 0x1c
+	opSASLAuth  = 0x21
+)
+
+// Response status codes of the binary protocol
+const (
+	statusOK          = 0x0000
+	statusNotFound    = 0x0001
+	statusExists      = 0x0002
+	statusNotStored   = 0x0005
+	statusNonNumeric  = 0x0006
+	statusAuthError   = 0x0020
+	statusUnknownCmd  = 0x0081
+	binaryHeaderBytes = 24
+)
+
+var (
+	// ErrAuthFailed means the server rejected the username or password
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrBinaryProtocol means the command exists only in the text protocol,
+	// which servers requiring authentication do not accept
+	ErrBinaryProtocol = errors.New("not available with authentication (binary protocol)")
+)
+
+// binaryPacket is a request or response of the binary protocol. status is
+// the vbucket field in requests, which this client leaves at 0.
+type binaryPacket struct {
+	opcode byte
+	status uint16
+	cas    uint64
+	extras []byte
+	key    []byte
+	value  []byte
+}
+
+// encode returns the packet as a request
+func (p binaryPacket) encode() []byte {
+	body := len(p.extras) + len(p.key) + len(p.value)
+	buf := make([]byte, binaryHeaderBytes, binaryHeaderBytes+body)
+	buf[0] = binaryRequest
+	buf[1] = p.opcode
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(p.key)))
+	buf[4] = byte(len(p.extras))
+	binary.BigEndian.PutUint16(buf[6:], p.status)
+	binary.BigEndian.PutUint32(buf[8:], uint32(body))
+	binary.BigEndian.PutUint64(buf[16:], p.cas)
+	buf = append(buf, p.extras...)
+	buf = append(buf, p.key...)
+	return append(buf, p.value...)
+}
+
+// readBinaryPacket reads one response packet
+func readBinaryPacket(r io.Reader) (binaryPacket, error) {
+	var header [binaryHeaderBytes]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return binaryPacket{}, err
+	}
+	if header[0] != binaryResponse {
+		return binaryPacket{}, fmt.Errorf("invalid response magic 0x%02x", header[0])
+	}
+	keyLen := int(binary.BigEndian.Uint16(header[2:]))
+	extrasLen := int(header[4])
+	bodyLen := int(binary.BigEndian.Uint32(header[8:]))
+	if keyLen+extrasLen > bodyLen {
+		return binaryPacket{}, fmt.Errorf("invalid response lengths")
+	}
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return binaryPacket{}, err
+	}
+	return binaryPacket{
+		opcode: header[1],
+		status: binary.BigEndian.Uint16(header[6:]),
+		cas:    binary.BigEndian.Uint64(header[16:]),
+		extras: body[:extrasLen],
+		key:    body[extrasLen : extrasLen+keyLen],
+		value:  body[extrasLen+keyLen:],
+	}, nil
+}
+
+// statusError maps a response status to the errors of the text protocol
+// commands
+func statusError(p binaryPacket) error {
+	switch p.status {
+	case statusOK:
+		return nil
+	case statusNotFound:
+		return ErrNotFound
+	case statusExists:
+		return ErrCasConflict
+	case statusNotStored:
+		return ErrNotStored
+	case statusNonNumeric:
+		return ErrNotNumeric
+	case statusAuthError:
+		return ErrAuthFailed
+	case statusUnknownCmd:
+		return fmt.Errorf("command not supported by the server")
+	}
+	return fmt.Errorf("server error 0x%04x: %s", p.status, p.value)
+}
+
+// roundTrip sends a request and reads its response
+func (c *MemcachedClient) roundTrip(req binaryPacket) (binaryPacket, error) {
+	if err := c.transmit(string(req.encode())); err != nil {
+		return binaryPacket{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	resp, err := readBinaryPacket(c.reader)
+	if err != nil {
+		return binaryPacket{}, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp, nil
+}
+
+// authenticate logs in with SASL PLAIN on a new connection. It is part of
+// dialing, so it sends without reconnecting.
+func (c *MemcachedClient) authenticate() error {
+	req := binaryPacket{
+		opcode: opSASLAuth,
+		key:    []byte("PLAIN"),
+		value:  []byte("\x00" + c.username + "\x00" + c.password),
+	}
+	if err := c.sendOnce(string(req.encode())); err != nil {
+		return fmt.Errorf("failed to send authentication: %w", err)
+	}
+	resp, err := readBinaryPacket(c.reader)
+	if err != nil {
+		return fmt.Errorf("failed to read authentication response: %w", err)
+	}
+	switch resp.status {
+	case statusOK:
+		return nil
+	case statusAuthError:
+		return fmt.Errorf("%w for user '%s'", ErrAuthFailed, c.username)
+	case statusUnknownCmd:
+		return fmt.Errorf("server does not support SASL authentication")
+	}
+	return fmt.Errorf("authentication: %v", statusError(resp))
+}
+
+// binaryGet fetches key with its flags and CAS token
+func (c *MemcachedClient) binaryGet(key string) ([]byte, uint32, uint64, bool, error) {
+	resp, err := c.roundTrip(binaryPacket{opcode: opGet, key: []byte(key)})
+	if err != nil {
+		return nil, 0, 0, false, err
+	}
+	if resp.status == statusNotFound {
+		return nil, 0, 0, false, nil
+	}
+	if err := statusError(resp); err != nil {
+		return nil, 0, 0, false, err
+	}
+	var flags uint32
+	if len(resp.extras) >= 4 {
+		flags = binary.BigEndian.Uint32(resp.extras)
+	}
+	return resp.value, flags, resp.cas, true, nil
+}
+
+// binaryStore sends set, add, replace (with flags and expiry) or append
+// and prepend (without). A non-zero cas makes the write conditional.
+func (c *MemcachedClient) binaryStore(opcode byte, key, value string, flags uint32, expTime int, cas uint64) error {
+	req := binaryPacket{opcode: opcode, cas: cas, key: []byte(key), value: []byte(value)}
+	if opcode != opAppend && opcode != opPrepend {
+		req.extras = make([]byte, 8)
+		binary.BigEndian.PutUint32(req.extras, flags)
+		binary.BigEndian.PutUint32(req.extras[4:], uint32(expTime))
+	}
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	err = statusError(resp)
+	if opcode == opAdd && errors.Is(err, ErrCasConflict) {
+		// add reports an existing key as "exists"
+		return ErrNotStored
+	}
+	return err
+}
+
+// binaryStoreOpcodes maps the storage commands to their opcodes
+var binaryStoreOpcodes = map[string]byte{
+	"set":     opSet,
+	"add":     opAdd,
+	"replace": opReplace,
+	"append":  opAppend,
+	"prepend": opPrepend,
+}
+
+// binaryDelete removes key
+func (c *MemcachedClient) binaryDelete(key string) error {
+	resp, err := c.roundTrip(binaryPacket{opcode: opDelete, key: []byte(key)})
+	if err != nil {
+		return err
+	}
+	return statusError(resp)
+}
+
+// binaryIncrDecr changes a counter without creating it when missing
+func (c *MemcachedClient) binaryIncrDecr(command, key string, delta uint64) (uint64, error) {
+	opcode := byte(opIncrement)
+	if command == "decr" {
+		opcode = opDecrement
+	}
+	extras := make([]byte, 20)
+	binary.BigEndian.PutUint64(extras, delta)
+	// An expiration of all ones makes a missing key an error
+	binary.BigEndian.PutUint32(extras[16:], 0xffffffff)
+	resp, err := c.roundTrip(binaryPacket{opcode: opcode, extras: extras, key: []byte(key)})
+	if err != nil {
+		return 0, err
+	}
+	if err := statusError(resp); err != nil {
+		return 0, err
+	}
+	if len(resp.value) != 8 {
+		return 0, fmt.Errorf("invalid counter value of %d bytes", len(resp.value))
+	}
+	return binary.BigEndian.Uint64(resp.value), nil
+}
+
+// binaryTouch sets a new expiry on key
+func (c *MemcachedClient) binaryTouch(key string, expTime int) error {
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, uint32(expTime))
+	resp, err := c.roundTrip(binaryPacket{opcode: opTouch, extras: extras, key: []byte(key)})
+	if err != nil {
+		return err
+	}
+	return statusError(resp)
+}
+
+// binaryFlush invalidates all items after delay seconds
+func (c *MemcachedClient) binaryFlush(delay int) error {
+	req := binaryPacket{opcode: opFlush}
+	if delay > 0 {
+		req.extras = make([]byte, 4)
+		binary.BigEndian.PutUint32(req.extras, uint32(delay))
+	}
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	return statusError(resp)
+}
+
+// binaryVersion returns the server version
+func (c *MemcachedClient) binaryVersion() (string, error) {
+	resp, err := c.roundTrip(binaryPacket{opcode: opVersion})
+	if err != nil {
+		return "", err
+	}
+	if err := statusError(resp); err != nil {
+		return "", err
+	}
+	return string(resp.value), nil
+}
+
+// binaryStatistics returns the statistics of statType. The server answers
+// with one packet per statistic and an empty key at the end.
+func (c *MemcachedClient) binaryStatistics(statType string) (map[string]string, error) {
+	resp, err := c.roundTrip(binaryPacket{opcode: opStat, key: []byte(statType)})
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]string)
+	for len(resp.key) > 0 || resp.status != statusOK {
+		if err := statusError(resp); err != nil {
+			return nil, err
+		}
+		stats[string(resp.key)] = string(resp.value)
+		if resp, err = readBinaryPacket(c.reader); err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,133 @@
+package memcc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// packet decodes a hex dump such as "80 00 0005", spaces being ignored
+func packet(t *testing.T, dump string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(dump, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Requests compared with the examples of the binary protocol specification.
+// The header fields are magic, opcode, key length, extras length, data type,
+// vbucket, body length, opaque and CAS
+func TestBinaryEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		p    binaryPacket
+		want string
+	}{
+		{"get", binaryPacket{opcode: opGet, key: []byte("Hello")},
+			"80 00 0005 00 00 0000 00000005 00000000 0000000000000000 48656c6c6f"},
+		{"set", binaryPacket{opcode: opSet, extras: []byte{0xde, 0xad, 0xbe, 0xef, 0, 0, 0x0e, 0x10}, key: []byte("Hello"), value: []byte("World")},
+			"80 01 0005 08 00 0000 00000012 00000000 0000000000000000 deadbeef00000e10 48656c6c6f 576f726c64"},
+		{"append with cas", binaryPacket{opcode: opAppend, cas: 0x0102030405060708, key: []byte("k"), value: []byte("\r\n\x00")},
+			"80 0e 0001 00 00 0000 00000004 00000000 0102030405060708 6b 0d0a00"},
+		{"sasl plain", binaryPacket{opcode: opSASLAuth, key: []byte("PLAIN"), value: []byte("\x00user\x00secret")},
+			"80 21 0005 00 00 0000 00000011 00000000 0000000000000000 504c41494e 00 75736572 00 736563726574"},
+	}
+	for _, tt := range tests {
+		if got, want := tt.p.encode(), packet(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("%s: encode() = % x\nwant            % x", tt.name, got, want)
+		}
+	}
+}
+
+func TestReadBinaryPacket(t *testing.T) {
+	// the get response of the specification, flags 0xdeadbeef and value World
+	p, err := readBinaryPacket(bytes.NewReader(packet(t,
+		"81 00 0000 04 00 0000 00000009 00000000 0000000000000001 deadbeef 576f726c64")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.opcode != opGet || p.status != statusOK || p.cas != 1 ||
+		!bytes.Equal(p.extras, []byte{0xde, 0xad, 0xbe, 0xef}) || len(p.key) != 0 || string(p.value) != "World" {
+		t.Errorf("get response = %+v", p)
+	}
+
+	// the specification's "Not found" error of a get
+	p, err = readBinaryPacket(bytes.NewReader(packet(t,
+		"81 00 0000 00 00 0001 00000009 00000000 0000000000000000 4e6f7420666f756e64")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.status != statusNotFound || string(p.value) != "Not found" || !errors.Is(statusError(p), ErrNotFound) {
+		t.Errorf("not found response = %+v", p)
+	}
+
+	bad := []struct {
+		name, dump string
+		want       string
+	}{
+		{"request magic", "80 00 0000 00 00 0000 00000000 00000000 0000000000000000", "invalid response magic 0x80"},
+		{"key longer than body", "81 00 0005 00 00 0000 00000002 00000000 0000000000000000 0000", "invalid response lengths"},
+		{"short body", "81 00 0000 00 00 0000 00000005 00000000 0000000000000000 0000", io.ErrUnexpectedEOF.Error()},
+		{"short header", "81 00 0000", io.ErrUnexpectedEOF.Error()},
+	}
+	for _, tt := range bad {
+		_, err := readBinaryPacket(bytes.NewReader(packet(t, tt.dump)))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status uint16
+		want   error
+	}{
+		{statusOK, nil},
+		{statusNotFound, ErrNotFound},
+		{statusExists, ErrCasConflict},
+		{statusNotStored, ErrNotStored},
+		{statusNonNumeric, ErrNotNumeric},
+		{statusAuthError, ErrAuthFailed},
+	}
+	for _, tt := range tests {
+		if err := statusError(binaryPacket{status: tt.status}); err != tt.want {
+			t.Errorf("statusError(0x%04x) = %v, want %v", tt.status, err, tt.want)
+		}
+	}
+	err := statusError(binaryPacket{status: 0x0084, value: []byte("Out of memory")})
+	if err == nil || err.Error() != "server error 0x0084: Out of memory" {
+		t.Errorf("statusError(0x0084) = %v", err)
+	}
+}
+
+// The client logs in with the SASL PLAIN frame and then sends binary requests
+func TestBinaryAuthenticate(t *testing.T) {
+	login := string(packet(t, "80 21 0005 00 00 0000 00000009 00000000 0000000000000000 504c41494e 00 75 00 70"))
+	c := pipeClient(t, scripted(t,
+		exchange{login, string(packet(t, "81 21 0000 00 00 0000 0000000d 00000000 0000000000000000")) + "Authenticated"},
+		exchange{string(packet(t, "80 00 0001 00 00 0000 00000001 00000000 0000000000000000 6b")),
+			string(packet(t, "81 00 0000 04 00 0000 00000005 00000000 0000000000000007 00000000 76"))},
+	))
+	c.username, c.password, c.binary = "u", "p", true
+	if err := c.authenticate(); err != nil {
+		t.Fatal(err)
+	}
+	value, _, casToken, err := c.Gets("k")
+	if err != nil || value != "v" || casToken != 7 {
+		t.Errorf("Gets after login = %q, cas %d, %v; want v, cas 7", value, casToken, err)
+	}
+
+	c = pipeClient(t, scripted(t,
+		exchange{login, string(packet(t, "81 21 0000 00 00 0020 0000000c 00000000 0000000000000000")) + "Auth failure"},
+	))
+	c.username, c.password, c.binary = "u", "p", true
+	if err := c.authenticate(); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("authenticate with a wrong password = %v, want ErrAuthFailed", err)
+	}
+}
@@ -0,0 +1,598 @@
+package memcc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/internal/tui"
+)
+
+// serverList collects -s/--server values. Each value may hold several
+// comma separated addresses and the flag may be repeated.
+type serverList []string
+
+func (l *serverList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *serverList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// clusterTotals are the stats summed over all servers for the cluster
+// summary
+var clusterTotals = []string{
+	"curr_items", "total_items", "bytes", "limit_maxbytes", "curr_connections",
+	"get_hits", "get_misses", "evictions", "cmd_get", "cmd_set",
+}
+
+// clusterNode is one server of a cluster. client is nil until the node is
+// connected, or if the connection failed.
+type clusterNode struct {
+	address string
+	client  *MemcachedClient
+	err     error
+}
+
+// MemcachedCluster is a set of servers sharing the keys between them the
+// way memcached clients do: each key lives on the server clientFor picks.
+// Servers are connected when first used.
+type MemcachedCluster struct {
+	cfg   Config
+	nodes []clusterNode
+}
+
+// NewMemcachedCluster returns the cluster of cfg.Servers without connecting
+// to them
+func NewMemcachedCluster(cfg Config) *MemcachedCluster {
+	m := &MemcachedCluster{cfg: cfg, nodes: make([]clusterNode, len(cfg.Servers))}
+	for i, address := range cfg.Servers {
+		m.nodes[i].address = address
+	}
+	return m
+}
+
+// connect connects node, unless that was tried before
+func (m *MemcachedCluster) connect(node *clusterNode) {
+	if node.client != nil || node.err != nil {
+		return
+	}
+	host, portStr, err := net.SplitHostPort(node.address)
+	if err != nil {
+		node.err = err
+		return
+	}
+	nodeCfg := m.cfg
+	nodeCfg.Host = host
+	if nodeCfg.Port, err = strconv.Atoi(portStr); err != nil {
+		node.err = fmt.Errorf("invalid port: %s", portStr)
+		return
+	}
+	node.client, node.err = Connect(nodeCfg)
+}
+
+// connectAll connects to every server at once. Failures are reported and
+// kept in the node, it returns their number.
+func (m *MemcachedCluster) connectAll() int {
+	var wg sync.WaitGroup
+	for i := range m.nodes {
+		wg.Add(1)
+		go func(node *clusterNode) {
+			defer wg.Done()
+			m.connect(node)
+		}(&m.nodes[i])
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, node := range m.nodes {
+		if node.err != nil {
+			ui.Error(fmt.Sprintf("%s: %v", node.address, node.err))
+			failed++
+		}
+	}
+	return failed
+}
+
+// nodeFor returns the index of the server of key: the CRC-32 of the key
+// modulo the number of servers, as gomemcache and most other clients do by
+// default. It only depends on the server list, so the keys of a server that
+// is down do not move to the others.
+func (m *MemcachedCluster) nodeFor(key string) int {
+	return int(crc32.ChecksumIEEE([]byte(key)) % uint32(len(m.nodes)))
+}
+
+// clientFor returns the client of the server holding key, connecting to it
+// if needed
+func (m *MemcachedCluster) clientFor(key string) (*MemcachedClient, error) {
+	node := &m.nodes[m.nodeFor(key)]
+	m.connect(node)
+	if node.err != nil {
+		return nil, fmt.Errorf("%s: %w", node.address, node.err)
+	}
+	return node.client, nil
+}
+
+// Close closes the connections to the servers
+func (m *MemcachedCluster) Close() {
+	for _, node := range m.nodes {
+		if node.client != nil {
+			node.client.Close()
+		}
+	}
+}
+
+// eachNode calls fn for every connected node at once and waits for all of
+// them. fn must only write to its own result slot.
+func eachNode(nodes []clusterNode, fn func(i int, client *MemcachedClient)) {
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		if node.client == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, client *MemcachedClient) {
+			defer wg.Done()
+			fn(i, client)
+		}(i, node.client)
+	}
+	wg.Wait()
+}
+
+// runMulti runs command on the servers of cfg.Servers. Commands on a key go
+// to the server of the key, except get, set and delete with --all, which run
+// on each server in turn. stats, slabs and keys are merged into one report
+// of every server. A server that cannot be reached is reported without
+// stopping the others, but makes the exit status 1.
+func runMulti(cfg Config, command string, args []string) {
+	cluster := NewMemcachedCluster(cfg)
+	defer cluster.Close()
+
+	switch command {
+	case "stats", "slabs", "keys":
+	case "get", "set", "delete", "del", "rm":
+		if !hasFlag(args, "all") {
+			if runRouted(cluster, cfg, command, args) > 0 {
+				cli.Exit(cli.ExitError)
+			}
+			return
+		}
+	case "mget", "gets", "cas", "add", "replace", "append", "prepend", "incr", "decr", "touch":
+		if runRouted(cluster, cfg, command, args) > 0 {
+			cli.Exit(cli.ExitError)
+		}
+		return
+	default:
+		ui.Error(fmt.Sprintf("%s works on one server, pick it with -s host:port", command))
+		cli.Exit(cli.ExitError)
+	}
+
+	failed := cluster.connectAll()
+	nodes := cluster.nodes
+	if failed == len(nodes) {
+		ui.Error("No server reachable")
+		cli.Exit(cli.ExitError)
+	}
+	ui.Info(fmt.Sprintf("Connected to %d of %d servers", len(nodes)-failed, len(nodes)))
+	if cfg.DryRun {
+		ui.Warning("Dry run: write operations will not be sent to the server")
+	}
+
+	var errs int
+	switch command {
+	case "stats":
+		errs = multiStats(nodes, args)
+	case "slabs":
+		errs = multiSlabs(nodes)
+	case "keys":
+		errs = multiKeys(nodes, cfg, args)
+	default:
+		errs = multiEach(nodes, cfg, command, args)
+	}
+	if failed+errs > 0 {
+		cli.Exit(cli.ExitError)
+	}
+}
+
+// keyValueFlags are the flags of the key commands that take a value
+var keyValueFlags = map[string]bool{
+	"default": true, "on-miss": true, "ttl": true, "output": true, "out-file": true, "from-file": true, "flags": true,
+}
+
+// splitKeyArgs separates the flags of a key command, with their values, from
+// its positional arguments, the way cli.ParseInterspersed reads them
+func splitKeyArgs(args []string) (flags, positional []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			if i+1 < len(args) {
+				i++
+				positional = append(positional, args[i])
+			}
+		case len(arg) > 1 && arg[0] == '-':
+			flags = append(flags, arg)
+			name := strings.TrimLeft(arg, "-")
+			if !strings.Contains(name, "=") && keyValueFlags[name] && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	return flags, positional
+}
+
+// runRouted runs a key command on the server of its key. get and mget with
+// keys on several servers run once on each of them with the keys it holds,
+// under a header naming the server. It returns the number of servers on
+// which the command failed.
+func runRouted(cluster *MemcachedCluster, cfg Config, command string, args []string) int {
+	flags, keys := splitKeyArgs(args)
+	if len(keys) == 0 {
+		// The command reports the missing key before using the client
+		runCommand(nil, cfg, command, args)
+		return 0
+	}
+	if command != "get" && command != "mget" {
+		keys = keys[:1]
+	}
+
+	groups := map[int][]string{}
+	var order []int
+	for _, key := range keys {
+		i := cluster.nodeFor(key)
+		if _, ok := groups[i]; !ok {
+			order = append(order, i)
+		}
+		groups[i] = append(groups[i], key)
+	}
+
+	if len(order) == 1 {
+		client, err := cluster.clientFor(keys[0])
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to connect: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if !rawOutput(command, args) {
+			ui.Info(fmt.Sprintf("Connected to %s, the server of '%s'", cluster.nodes[order[0]].address, keys[0]))
+			if cfg.DryRun {
+				ui.Warning("Dry run: write operations will not be sent to the server")
+			}
+		}
+		runCommand(client, cfg, command, args)
+		return 0
+	}
+
+	var nodes []clusterNode
+	nodeArgs := map[string][]string{}
+	errs := 0
+	for _, i := range order {
+		if _, err := cluster.clientFor(groups[i][0]); err != nil {
+			ui.Error(err.Error())
+			errs++
+			continue
+		}
+		node := cluster.nodes[i]
+		nodes = append(nodes, node)
+		nodeArgs[node.address] = append(append([]string{}, flags...), groups[i]...)
+	}
+	if len(nodes) > 0 {
+		ui.Info(fmt.Sprintf("Keys on %d servers, connected to %d", len(order), len(nodes)))
+	}
+	return errs + runInTurn(nodes, cfg, command, nodeArgs)
+}
+
+// hasFlag reports whether args contain --name or -name before a "--"
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "-"+name || arg == "--"+name {
+			return true
+		}
+	}
+	return false
+}
+
+// multiEach runs command with --all removed on each connected node in
+// turn. It returns the number of servers on which the command failed.
+func multiEach(nodes []clusterNode, cfg Config, command string, args []string) int {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if arg != "-all" && arg != "--all" {
+			rest = append(rest, arg)
+		}
+	}
+	nodeArgs := map[string][]string{}
+	for _, node := range nodes {
+		nodeArgs[node.address] = rest
+	}
+	return runInTurn(nodes, cfg, command, nodeArgs)
+}
+
+// runInTurn runs command on each connected node in turn with the arguments
+// of its address, under a header naming the server. With JSON or CSV output
+// the results are collected as JSON into one object keyed by server, which
+// is printed in the chosen format. It returns the number of servers on
+// which the command failed.
+func runInTurn(nodes []clusterNode, cfg Config, command string, nodeArgs map[string][]string) int {
+	results := map[string]json.RawMessage{}
+	saved, savedCSV := resultOut, resultCSV
+	defer func() { resultOut, resultCSV = saved, savedCSV }()
+	resultCSV = false
+	errs := 0
+	for _, node := range nodes {
+		if node.client == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if saved != nil {
+			resultOut = &buf
+		} else {
+			ui.Header(node.address)
+		}
+		if catchExit(func() { runCommand(node.client, cfg, command, nodeArgs[node.address]) }) != cli.ExitOK {
+			errs++
+		}
+		if saved != nil && buf.Len() > 0 {
+			results[node.address] = json.RawMessage(buf.Bytes())
+		}
+	}
+	if saved != nil {
+		resultOut, resultCSV = saved, savedCSV
+		printResult(results)
+	}
+	return errs
+}
+
+// multiStats implements stats on several servers. Without a type it prints
+// one summary row per server and the cluster totals, with a type every
+// metric prefixed by its server. --watch and --output prometheus need a
+// single server.
+func multiStats(nodes []clusterNode, args []string) int {
+	fs := newFlagSet("stats")
+	watchSpec := fs.String("watch", "", "Redraw the statistics every interval, e.g. 2s")
+	fs.StringVar(watchSpec, "w", "", "Shorthand for --watch")
+	output := fs.String("output", "", "prometheus: print the stats in the Prometheus text format")
+	fs.StringVar(output, "o", "", "Shorthand for --output")
+	rest, err := cli.ParseInterspersed(fs, args)
+	if err != nil {
+		cli.Exit(cli.ExitError)
+	}
+	switch {
+	case *watchSpec != "":
+		ui.Error("stats --watch is not supported with several servers, pick one with -s host:port")
+		cli.Exit(cli.ExitError)
+	case *output == "prometheus":
+		ui.Error("stats --output prometheus is not supported with several servers, scrape each with -s host:port")
+		cli.Exit(cli.ExitError)
+	case *output != "" && *output != "text":
+		ui.Error(fmt.Sprintf("Invalid stats output format: %s (use prometheus; the global -o json or -o csv goes before the command)", *output))
+		cli.Exit(cli.ExitError)
+	}
+	statType := ""
+	if len(rest) > 0 {
+		statType = rest[0]
+	}
+
+	stats := make([]map[string]string, len(nodes))
+	fetchErrs := make([]error, len(nodes))
+	eachNode(nodes, func(i int, client *MemcachedClient) {
+		stats[i], fetchErrs[i] = client.Statistics(statType)
+	})
+	errs := 0
+	byServer := map[string]map[string]string{}
+	for i, node := range nodes {
+		if fetchErrs[i] != nil {
+			ui.Error(fmt.Sprintf("%s: failed to get statistics: %v", node.address, fetchErrs[i]))
+			errs++
+		} else if stats[i] != nil {
+			byServer[node.address] = stats[i]
+		}
+	}
+
+	if statType != "" {
+		if resultOut != nil {
+			printResult(byServer)
+			return errs
+		}
+		printClusterStatistics(nodes, stats)
+		return errs
+	}
+
+	totals := map[string]int64{}
+	for _, s := range stats {
+		for _, name := range clusterTotals {
+			n, _ := strconv.ParseInt(s[name], 10, 64)
+			totals[name] += n
+		}
+	}
+	if resultCSV {
+		// One row per server, and one for the totals
+		rows := map[string]interface{}{"total": totals}
+		for address, s := range byServer {
+			rows[address] = s
+		}
+		printResult(rows)
+		return errs
+	}
+	if resultOut != nil {
+		printResult(struct {
+			Servers map[string]map[string]string `json:"servers"`
+			Total   map[string]int64             `json:"total"`
+		}{byServer, totals})
+		return errs
+	}
+
+	ui.Header(fmt.Sprintf("Cluster Statistics (%d servers)", len(byServer)))
+	widths := []int{24, 10, 12, 14, 9, 10, 6}
+	ui.TableHeader([]string{"Server", "Version", "Items", "Bytes", "Hit rate", "Evictions", "Conns"}, widths)
+	for i, node := range nodes {
+		if stats[i] == nil {
+			continue
+		}
+		s := stats[i]
+		ui.TableRow([]string{node.address, s["version"], s["curr_items"], s["bytes"], formatHitRate(s), s["evictions"], s["curr_connections"]}, widths)
+	}
+	total := map[string]string{}
+	for name, n := range totals {
+		total[name] = strconv.FormatInt(n, 10)
+	}
+	ui.TableRow([]string{tui.Bold + "TOTAL" + tui.Reset, "", total["curr_items"], total["bytes"], formatHitRate(total), total["evictions"], total["curr_connections"]}, widths)
+	ui.TableFooter(widths)
+	return errs
+}
+
+// formatHitRate formats the hit rate of stats, or "-" without any gets
+func formatHitRate(stats map[string]string) string {
+	if rate, ok := hitRate(stats, nil); ok {
+		return fmt.Sprintf("%.2f%%", rate)
+	}
+	return "-"
+}
+
+// printClusterStatistics prints the statistics of every server in one
+// table, sorted by metric and then by server
+func printClusterStatistics(nodes []clusterNode, stats []map[string]string) {
+	type row struct{ metric, server, value string }
+	var rows []row
+	for i, node := range nodes {
+		for k, v := range stats[i] {
+			rows = append(rows, row{k, node.address, v})
+		}
+	}
+	if len(rows) == 0 {
+		ui.Warning("No statistics available")
+		return
+	}
+	sort.SliceStable(rows, func(a, b int) bool { return rows[a].metric < rows[b].metric })
+
+	ui.Header("Server Statistics")
+	widths := []int{24, 30, 25}
+	ui.TableHeader([]string{"Server", "Metric", "Value"}, widths)
+	for _, r := range rows {
+		ui.TableRow([]string{r.server, r.metric, r.value}, widths)
+	}
+	ui.TableFooter(widths)
+}
+
+// multiSlabs lists the slab IDs of each server
+func multiSlabs(nodes []clusterNode) int {
+	slabs := make([][]string, len(nodes))
+	fetchErrs := make([]error, len(nodes))
+	eachNode(nodes, func(i int, client *MemcachedClient) {
+		slabs[i], fetchErrs[i] = client.GetAllSlabs()
+	})
+
+	errs := 0
+	byServer := map[string][]string{}
+	for i, node := range nodes {
+		if fetchErrs[i] != nil {
+			ui.Error(fmt.Sprintf("%s: failed to get slab IDs: %v", node.address, fetchErrs[i]))
+			errs++
+		} else if node.client != nil {
+			byServer[node.address] = append([]string{}, slabs[i]...)
+		}
+	}
+	if resultOut != nil {
+		printResult(byServer)
+		return errs
+	}
+
+	ui.Header("Slab IDs")
+	total := 0
+	for i, node := range nodes {
+		if _, ok := byServer[node.address]; !ok {
+			continue
+		}
+		total += len(slabs[i])
+		ids := strings.Join(slabs[i], " ")
+		if ids == "" {
+			ids = tui.Dim + "(none)" + tui.Reset
+		}
+		fmt.Fprintf(stdout, "  %s%-24s%s %s%s%s\n", tui.Dim, node.address, tui.Reset, tui.Green, ids, tui.Reset)
+	}
+	fmt.Fprintf(stdout, "\n%s%s Total: %d slabs on %d servers%s\n", tui.Dim, tui.Cyan, total, len(byServer), tui.Reset)
+	return errs
+}
+
+// multiKeys lists the keys matching a pattern on each server, prefixed by
+// the server. With --values the keys command runs on each server in turn.
+func multiKeys(nodes []clusterNode, cfg Config, args []string) int {
+	fs := newFlagSet("keys")
+	withValues := fs.Bool("values", false, "Show the value of each key")
+	fs.Bool("redact", false, "Show value length and hash instead of the value")
+	rest, err := cli.ParseInterspersed(fs, args)
+	if err != nil {
+		cli.Exit(cli.ExitError)
+	}
+	if len(rest) < 1 {
+		ui.Error("Missing pattern argument")
+		fmt.Fprintf(stdout, "\n%sUsage: %s [options] keys <pattern> [--values [--redact]]%s\n", tui.Dim, AppName, tui.Reset)
+		cli.Exit(cli.ExitError)
+	}
+	if *withValues {
+		return multiEach(nodes, cfg, "keys", args)
+	}
+	pattern := rest[0]
+
+	keys := make([][]string, len(nodes))
+	fetchErrs := make([]error, len(nodes))
+	eachNode(nodes, func(i int, client *MemcachedClient) {
+		keys[i], fetchErrs[i] = client.GetKeys(pattern)
+	})
+
+	errs := 0
+	byServer := map[string][]string{}
+	for i, node := range nodes {
+		if fetchErrs[i] != nil {
+			ui.Error(fmt.Sprintf("%s: failed to get keys: %v", node.address, fetchErrs[i]))
+			errs++
+		} else if node.client != nil {
+			byServer[node.address] = append([]string{}, keys[i]...)
+		}
+	}
+	if resultOut != nil {
+		printResult(byServer)
+		return errs
+	}
+
+	total := 0
+	for _, k := range byServer {
+		total += len(k)
+	}
+	if total == 0 {
+		ui.Warning("No matching keys found")
+		return errs
+	}
+	ui.Header(fmt.Sprintf("Keys matching '%s'", pattern))
+	n := 0
+	for i, node := range nodes {
+		for _, key := range keys[i] {
+			n++
+			fmt.Fprintf(stdout, "  %s%3d.%s %s%-24s%s %s\n", tui.Dim, n, tui.Reset, tui.Dim, node.address, tui.Reset, key)
+		}
+	}
+	fmt.Fprintf(stdout, "\n%s%s Total: %d keys on %d servers%s\n", tui.Dim, tui.Cyan, total, len(byServer), tui.Reset)
+	return errs
+}
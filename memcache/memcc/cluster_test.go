@@ -0,0 +1,102 @@
+package memcc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ushell/tools/internal/memcachetest"
+)
+
+// The server of a key is the CRC-32 of the key modulo the number of servers
+func TestNodeFor(t *testing.T) {
+	tests := []struct {
+		key     string
+		servers int
+		want    int
+	}{
+		{"foo", 1, 0},
+		{"foo", 2, 1},
+		{"foo", 3, 2},
+		{"bar", 2, 0},
+		{"user:1", 3, 0},
+		{"user:2", 3, 1},
+	}
+	for _, tt := range tests {
+		m := NewMemcachedCluster(Config{Servers: make([]string, tt.servers)})
+		if got := m.nodeFor(tt.key); got != tt.want {
+			t.Errorf("nodeFor(%q) on %d servers = %d, want %d", tt.key, tt.servers, got, tt.want)
+		}
+	}
+}
+
+func TestSplitKeyArgs(t *testing.T) {
+	tests := []struct {
+		args              []string
+		flags, positional []string
+	}{
+		{[]string{"k"}, nil, []string{"k"}},
+		{[]string{"a", "b", "--json"}, []string{"--json"}, []string{"a", "b"}},
+		{[]string{"k", "--default", "x", "--on-miss=set"}, []string{"--default", "x", "--on-miss=set"}, []string{"k"}},
+		{[]string{"--ttl", "60", "k"}, []string{"--ttl", "60"}, []string{"k"}},
+		{[]string{"k", "--", "-v"}, nil, []string{"k", "-v"}},
+		{[]string{"k", "-"}, nil, []string{"k", "-"}},
+	}
+	for _, tt := range tests {
+		flags, positional := splitKeyArgs(tt.args)
+		if !reflect.DeepEqual(flags, tt.flags) || !reflect.DeepEqual(positional, tt.positional) {
+			t.Errorf("splitKeyArgs(%q) = %q, %q; want %q, %q", tt.args, flags, positional, tt.flags, tt.positional)
+		}
+	}
+}
+
+// Keys are stored on the server nodeFor picks, and the merged commands take
+// the flags of their single server form
+func TestClusterRouting(t *testing.T) {
+	var servers []*memcachetest.Server
+	for i := 0; i < 2; i++ {
+		srv, err := memcachetest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+		servers = append(servers, srv)
+	}
+	list := servers[0].Addr() + "," + servers[1].Addr()
+	memcc := func(args ...string) (int, string) {
+		var out bytes.Buffer
+		code := Run(append([]string{"-s", list, "--no-color"}, args...), &out, io.Discard)
+		return code, out.String()
+	}
+
+	// foo belongs to the second server, bar to the first
+	for _, key := range []string{"foo", "bar"} {
+		if code, out := memcc("set", key, "v-"+key); code != 0 {
+			t.Fatalf("set %s exited with %d:\n%s", key, code, out)
+		}
+	}
+	if _, found := servers[1].Get("foo"); !found {
+		t.Errorf("foo is not on %s: %q and %q", servers[1].Addr(), servers[0].Keys(), servers[1].Keys())
+	}
+	if _, found := servers[0].Get("bar"); !found {
+		t.Errorf("bar is not on %s: %q and %q", servers[0].Addr(), servers[0].Keys(), servers[1].Keys())
+	}
+
+	code, out := memcc("keys", "o", "--values")
+	if code != 0 || !strings.Contains(out, "v-foo") {
+		t.Errorf("keys --values exited with %d:\n%s", code, out)
+	}
+	code, out = memcc("keys", "a", "--values", "--redact")
+	if code != 0 || strings.Contains(out, "v-bar") || !strings.Contains(out, "redacted 5 bytes") {
+		t.Errorf("keys --values --redact exited with %d:\n%s", code, out)
+	}
+
+	for _, args := range [][]string{{"stats", "--watch", "1s"}, {"stats", "-o", "prometheus"}} {
+		code, out := memcc(args...)
+		if code == 0 || !strings.Contains(out, "not supported with several servers") {
+			t.Errorf("%q exited with %d:\n%s", args, code, out)
+		}
+	}
+}
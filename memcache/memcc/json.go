@@ -0,0 +1,166 @@
+package memcc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ushell/tools/internal/cli"
+)
+
+// resultOut receives the result of a command with --output json or csv, nil
+// otherwise. stdout is discarded in those modes so that nothing else ends up
+// next to the result.
+var resultOut io.Writer
+
+// resultCSV writes results as CSV rather than JSON, see printResult
+var resultCSV bool
+
+// textOnlyCommands have no JSON or CSV form and are refused with those
+// outputs: config-dump already prints a script, shell is interactive
+var textOnlyCommands = map[string]bool{
+	"config-dump": true,
+	"shell":       true,
+}
+
+// getResult is the JSON form of a retrieved key. Binary values are base64
+// encoded, as JSON strings can only hold valid UTF-8.
+type getResult struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+	Found    bool   `json:"found"`
+	Bytes    int    `json:"bytes"`
+}
+
+// newGetResult builds the result for key, with the value replaced by its
+// length and hash if redact is set
+func newGetResult(key, value string, found, redact bool) getResult {
+	r := getResult{Key: key, Value: value, Found: found, Bytes: len(value)}
+	switch {
+	case !found:
+	case redact:
+		r.Value = redactValue(value)
+	case isBinary(value):
+		r.Value, r.Encoding = base64.StdEncoding.EncodeToString([]byte(value)), "base64"
+	}
+	return r
+}
+
+// printWriteResult reports a successful write of key, which may be empty for
+// commands that do not name one
+func printWriteResult(command, key string, dryRun bool) {
+	printResult(writeResult{Command: command, Key: key, OK: true, DryRun: dryRun})
+}
+
+// getsResult adds the fields returned by gets
+type getsResult struct {
+	getResult
+	Flags uint32 `json:"flags"`
+	CAS   uint64 `json:"cas"`
+}
+
+// writeResult is the JSON form of a write or admin command. OK is false when
+// the server declined a conditional write, such as add on an existing key.
+type writeResult struct {
+	Command   string  `json:"command"`
+	Key       string  `json:"key,omitempty"`
+	OK        bool    `json:"ok"`
+	Unchanged bool    `json:"unchanged,omitempty"`
+	Value     *uint64 `json:"value,omitempty"`
+	DryRun    bool    `json:"dry_run,omitempty"`
+}
+
+// checkJSON is the JSON form of a checkResult
+type checkJSON struct {
+	Node      string  `json:"node"`
+	Up        bool    `json:"up"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	Version   string  `json:"version,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func newCheckJSON(r checkResult) checkJSON {
+	if r.Err != nil {
+		return checkJSON{Node: r.Node, Error: r.Err.Error()}
+	}
+	return checkJSON{Node: r.Node, Up: true, LatencyMs: float64(r.Latency) / float64(time.Millisecond), Version: r.Version}
+}
+
+// balanceJSON is the JSON form of the balance command
+type balanceJSON struct {
+	Slabs      []slabUsage `json:"slabs"`
+	Full       []int       `json:"full"`
+	Idle       []int       `json:"idle"`
+	FreePages  int64       `json:"free_pages"`
+	FreeBytes  int64       `json:"free_bytes"`
+	Imbalanced bool        `json:"imbalanced"`
+}
+
+func newBalanceJSON(usage []slabUsage, b slabBalance) balanceJSON {
+	r := balanceJSON{Slabs: usage, Full: []int{}, Idle: []int{}, FreePages: b.FreePages, FreeBytes: b.FreeBytes, Imbalanced: b.Imbalanced()}
+	for _, s := range b.Full {
+		r.Full = append(r.Full, s.ID)
+	}
+	for _, s := range b.Idle {
+		r.Idle = append(r.Idle, s.ID)
+	}
+	return r
+}
+
+// capabilitiesJSON is the JSON form of Capabilities, with each known
+// feature mapped to whether the server supports it
+type capabilitiesJSON struct {
+	Version  string          `json:"version"`
+	Known    bool            `json:"known"`
+	Features map[string]bool `json:"features"`
+}
+
+func newCapabilitiesJSON(caps Capabilities) capabilitiesJSON {
+	r := capabilitiesJSON{Version: caps.Version, Known: caps.Known, Features: map[string]bool{}}
+	for _, f := range featureMinVersions {
+		r.Features[f.feature] = caps.Supports(f.feature)
+	}
+	return r
+}
+
+// countResult is the JSON form of commands that process many keys, such as
+// load and dump-tree
+type countResult struct {
+	Command string `json:"command"`
+	Source  string `json:"source,omitempty"`
+	Dir     string `json:"dir,omitempty"`
+	Written int    `json:"written"`
+	Bytes   int64  `json:"bytes,omitempty"`
+	Missing int    `json:"missing,omitempty"`
+	Failed  int    `json:"failed"`
+}
+
+// printMultiGetJSON prints one getResult per requested key, in order
+func printMultiGetJSON(keys []string, values map[string]string, redact bool) {
+	results := make([]getResult, 0, len(keys))
+	for _, key := range keys {
+		value, found := values[key]
+		results = append(results, newGetResult(key, value, found, redact))
+	}
+	printResult(results)
+}
+
+// printResult writes v to resultOut as indented JSON, or with --output csv as
+// CSV made from the same JSON form (see cli.WriteCSV)
+func printResult(v interface{}) {
+	if resultCSV {
+		if err := cli.WriteCSV(resultOut, v); err != nil {
+			ui.Error(fmt.Sprintf("Failed to write CSV: %v", err))
+		}
+		return
+	}
+	enc := json.NewEncoder(resultOut)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		ui.Error(fmt.Sprintf("Failed to write JSON: %v", err))
+	}
+}
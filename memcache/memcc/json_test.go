@@ -0,0 +1,101 @@
+package memcc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/ushell/tools/internal/memcachetest"
+)
+
+// runJSON runs memcc against srv with --output json and decodes its stdout,
+// which must be a single JSON document, into v
+func runJSON(t *testing.T, srv *memcachetest.Server, v interface{}, args ...string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	args = append([]string{"-s", srv.Addr(), "-o", "json"}, args...)
+	if code := Run(args, &out, &errOut); code != 0 {
+		t.Fatalf("memcc %q exited with %d: %s", args, code, errOut.String())
+	}
+	if err := json.Unmarshal(out.Bytes(), v); err != nil {
+		t.Fatalf("memcc %q printed invalid JSON: %v\n%s", args, err, out.String())
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	srv, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.Set("name", "alice")
+	srv.Set("blob", "\x00\xff\r\n")
+
+	var one getResult
+	runJSON(t, srv, &one, "get", "name")
+	if one != (getResult{Key: "name", Value: "alice", Found: true, Bytes: 5}) {
+		t.Errorf("get name = %+v", one)
+	}
+
+	runJSON(t, srv, &one, "get", "blob")
+	value, err := base64.StdEncoding.DecodeString(one.Value)
+	if one.Encoding != "base64" || err != nil || string(value) != "\x00\xff\r\n" || one.Bytes != 4 {
+		t.Errorf("get blob = %+v, want the value base64 encoded", one)
+	}
+
+	var many []getResult
+	runJSON(t, srv, &many, "get", "name", "missing")
+	want := []getResult{{Key: "name", Value: "alice", Found: true, Bytes: 5}, {Key: "missing"}}
+	if len(many) != 2 || many[0] != want[0] || many[1] != want[1] {
+		t.Errorf("get name missing = %+v, want %+v", many, want)
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	srv, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.Set("a", "1")
+	srv.Set("b", "2")
+
+	var stats map[string]string
+	runJSON(t, srv, &stats, "stats")
+	if stats["version"] != memcachetest.Version || stats["curr_items"] != "2" {
+		t.Errorf("stats = %v, want version %s and 2 items", stats, memcachetest.Version)
+	}
+}
+
+func TestKeysJSON(t *testing.T) {
+	srv, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.Set("user:1", "alice")
+	srv.Set("user:2", "bob")
+	srv.Set("session:1", "x")
+
+	var keys []string
+	runJSON(t, srv, &keys, "keys", "user")
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "user:1" || keys[1] != "user:2" {
+		t.Errorf("keys user = %q", keys)
+	}
+
+	// no match is an empty list, not null
+	keys = nil
+	runJSON(t, srv, &keys, "keys", "nobody")
+	if keys == nil || len(keys) != 0 {
+		t.Errorf("keys nobody = %#v, want []", keys)
+	}
+
+	var values []getResult
+	runJSON(t, srv, &values, "keys", "session", "--values")
+	if len(values) != 1 || values[0] != (getResult{Key: "session:1", Value: "x", Found: true, Bytes: 1}) {
+		t.Errorf("keys session --values = %+v", values)
+	}
+}
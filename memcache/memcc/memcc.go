@@ -0,0 +1,3610 @@
+package memcc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/internal/tui"
+)
+
+// Version information
+const (
+	Version = cli.Version
+	AppName = "memcc"
+	Author  = "ushell"
+	RepoURL = "https://github.com/ushell/tools/memcache/memcc"
+)
+
+// Output of the running command, set by Run. ui renders messages, headers
+// and tables to stdout. stdin is read for confirmation prompts.
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+	ui               = tui.NewPrinter(stdout)
+)
+
+// confirm asks a yes/no question on stdin, anything but y or yes is a no.
+// In the shell stdin is already a *bufio.Reader, which bufio.NewReader
+// returns as is, so no typed-ahead input is lost.
+func confirm(question string) bool {
+	fmt.Fprintf(stdout, "%s%s [y/N] %s", tui.Yellow, question, tui.Reset)
+	answer, _ := bufio.NewReader(stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// newFlagSet creates the flag set of a subcommand, reporting errors to stderr
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// MemcachedClient is a simple Memcached client
+type MemcachedClient struct {
+	conn net.Conn
+	host string
+	port int
+
+	// reader buffers all responses on conn. A new bufio.Reader per command
+	// would drop whatever the previous one had read ahead
+	reader *bufio.Reader
+
+	// caps is detected once at connect and shared by all commands
+	caps Capabilities
+
+	// dryRun makes write operations print what they would do instead of
+	// sending the command to the server
+	dryRun bool
+
+	// timeout bounds connecting, readTimeout every read and write.
+	// maxRetries is the number of reconnect attempts after the server
+	// closed the connection, 0 to fail at once
+	timeout     time.Duration
+	readTimeout time.Duration
+	maxRetries  int
+
+	// tlsConfig encrypts the connection when set
+	tlsConfig *tls.Config
+
+	// With a username the client authenticates with SASL after connecting
+	// and speaks the binary protocol
+	username, password string
+	binary             bool
+}
+
+// DefaultTimeout bounds connecting and, unless set separately, each read or
+// write on the connection
+const DefaultTimeout = 10 * time.Second
+
+// NewMemcachedClient creates a new Memcached client connection. timeout
+// bounds the connect and readTimeout every read and write, so a stalled
+// server makes commands fail instead of hanging.
+func NewMemcachedClient(host string, port int, timeout, readTimeout time.Duration) (*MemcachedClient, error) {
+	return Connect(Config{Host: host, Port: port, Timeout: timeout, ReadTimeout: readTimeout})
+}
+
+// Connect creates a client for the server in cfg, with the timeouts,
+// reconnect attempts, dry-run mode and TLS settings given there. A zero
+// ReadTimeout means the same as Timeout.
+func Connect(cfg Config) (*MemcachedClient, error) {
+	return connect(context.Background(), cfg)
+}
+
+// ConnectContext is Connect bounded by ctx: connecting stops when ctx is
+// done, and neither the connect nor any later read or write of the client
+// may take longer than the time left before the deadline of ctx.
+func ConnectContext(ctx context.Context, cfg Config) (*MemcachedClient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if cfg.ReadTimeout == 0 {
+			cfg.ReadTimeout = cfg.Timeout
+		}
+		if cfg.Timeout == 0 || cfg.Timeout > left {
+			cfg.Timeout = left
+		}
+		if cfg.ReadTimeout == 0 || cfg.ReadTimeout > left {
+			cfg.ReadTimeout = left
+		}
+	}
+	return connect(ctx, cfg)
+}
+
+func connect(ctx context.Context, cfg Config) (*MemcachedClient, error) {
+	client := &MemcachedClient{
+		host:        cfg.Host,
+		port:        cfg.Port,
+		timeout:     cfg.Timeout,
+		readTimeout: cfg.ReadTimeout,
+		maxRetries:  cfg.MaxRetries,
+		dryRun:      cfg.DryRun,
+		tlsConfig:   cfg.TLS,
+		username:    cfg.Username,
+		password:    cfg.Password,
+		binary:      cfg.Username != "",
+	}
+	if client.readTimeout == 0 {
+		client.readTimeout = client.timeout
+	}
+	if err := client.dial(ctx); err != nil {
+		return nil, err
+	}
+	// The version is also the first sign of a server that accepts
+	// connections but does not answer
+	version, err := client.Version()
+	if errors.Is(err, ErrTimeout) {
+		client.Close()
+		return nil, err
+	}
+	client.caps = newCapabilities(version, err)
+	return client, nil
+}
+
+// dial opens a new connection to the client's server, giving up when ctx
+// is done
+func (c *MemcachedClient) dial(ctx context.Context) error {
+	address := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+	conn, err := dialServer(ctx, address, c.timeout, c.tlsConfig)
+	if errors.Is(err, errHandshake) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to Memcached server: %w", err)
+	}
+	c.conn = &deadlineConn{Conn: conn, timeout: c.readTimeout}
+	c.reader = bufio.NewReader(c.conn)
+	if c.username != "" {
+		if err := c.authenticate(); err != nil {
+			c.conn.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultMaxRetries is the number of reconnect attempts after the server
+// closed the connection
+const DefaultMaxRetries = 3
+
+// reconnectBackoff is the wait before the first reconnect attempt. It
+// doubles after each failed one.
+const reconnectBackoff = 500 * time.Millisecond
+
+// send writes a complete text protocol command, see transmit
+func (c *MemcachedClient) send(cmd string) error {
+	if c.binary {
+		return ErrBinaryProtocol
+	}
+	return c.transmit(cmd)
+}
+
+// transmit writes a complete request and waits for the start of the reply.
+// If the connection turns out to be closed before any reply, as after a
+// server restart, it reconnects and sends the request again. The server
+// cannot have answered the request in that case, and a restarted memcached
+// has lost any effect it had, so commands are never applied twice.
+func (c *MemcachedClient) transmit(cmd string) error {
+	err := c.sendOnce(cmd)
+	if err == nil || c.maxRetries == 0 || !connectionLost(err) {
+		return err
+	}
+	if err := c.reconnect(); err != nil {
+		return err
+	}
+	return c.sendOnce(cmd)
+}
+
+func (c *MemcachedClient) sendOnce(cmd string) error {
+	if _, err := c.conn.Write([]byte(cmd)); err != nil {
+		return err
+	}
+	_, err := c.reader.Peek(1)
+	return err
+}
+
+// reconnect replaces a lost connection, making up to maxRetries attempts
+func (c *MemcachedClient) reconnect() error {
+	c.conn.Close()
+	wait := reconnectBackoff
+	var err error
+	for attempt := 1; attempt <= c.maxRetries; attempt++ {
+		ui.Warning(fmt.Sprintf("Connection to %s lost, reconnecting in %s (attempt %d of %d)",
+			net.JoinHostPort(c.host, strconv.Itoa(c.port)), wait, attempt, c.maxRetries))
+		time.Sleep(wait)
+		if err = c.dial(context.Background()); err == nil {
+			return nil
+		}
+		wait *= 2
+	}
+	return fmt.Errorf("connection lost and %d reconnect attempts failed: %v", c.maxRetries, err)
+}
+
+// connectionLost reports whether err means the connection was closed or
+// reset, as opposed to a server that is slow to answer
+func connectionLost(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+	return errors.Is(err, io.EOF)
+}
+
+// ErrTimeout means the server did not answer within the client's timeout.
+// It also matches context.DeadlineExceeded, as an expired deadline should.
+var ErrTimeout error = noResponseError{}
+
+type noResponseError struct{}
+
+func (noResponseError) Error() string        { return "no response from server" }
+func (noResponseError) Timeout() bool        { return true }
+func (noResponseError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+// deadlineConn sets a deadline before every read and write on the
+// connection, so each one may take up to timeout
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	if err := c.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(p)
+	return n, c.timeoutError(err)
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	if err := c.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Write(p)
+	return n, c.timeoutError(err)
+}
+
+// timeoutError replaces an expired deadline with ErrTimeout
+func (c *deadlineConn) timeoutError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w within %s (raise --read-timeout for slow servers)", ErrTimeout, c.timeout)
+	}
+	return err
+}
+
+// Close closes the connection to Memcached server
+func (c *MemcachedClient) Close() error {
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// logDryRun reports a write operation skipped because of dry-run mode. It goes
+// to stderr so stdout stays the command's output, e.g. `$(memcc get k --default v)`
+func (c *MemcachedClient) logDryRun(operation, key, value string) {
+	msg := fmt.Sprintf("[DRY RUN] would %s key '%s'", operation, key)
+	if value != "" {
+		msg += fmt.Sprintf(" value '%s'", value)
+	}
+	fmt.Fprintln(stderr, msg)
+}
+
+// Get retrieves the value for a given key from Memcached
+func (c *MemcachedClient) Get(key string) (string, error) {
+	value, _, err := c.Lookup(key)
+	return value, err
+}
+
+// Lookup retrieves a value and reports whether the key exists, so an
+// empty value can be told apart from a miss
+func (c *MemcachedClient) Lookup(key string) (string, bool, error) {
+	value, found, err := c.LookupBytes(key)
+	return string(value), found, err
+}
+
+// GetBytes retrieves the raw bytes stored under key, nil on a miss
+func (c *MemcachedClient) GetBytes(key string) ([]byte, error) {
+	value, _, err := c.LookupBytes(key)
+	return value, err
+}
+
+// LookupBytes is Lookup returning the value as stored. Values may hold any
+// bytes, including \r\n and NUL, since the data block is read by length
+func (c *MemcachedClient) LookupBytes(key string) ([]byte, bool, error) {
+	if c.conn == nil {
+		return nil, false, fmt.Errorf("client not connected")
+	}
+	if c.binary {
+		value, _, _, found, err := c.binaryGet(key)
+		return value, found, err
+	}
+
+	cmd := fmt.Sprintf("get %s\r\n", key)
+	err := c.send(cmd)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to send get command: %w", err)
+	}
+
+	reader := c.reader
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if strings.HasPrefix(line, "END") {
+		return nil, false, nil
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) != 4 || parts[0] != "VALUE" {
+		return nil, false, fmt.Errorf("invalid response format: %s", line)
+	}
+
+	valueLength, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid value length: %v", err)
+	}
+
+	// A single Read may return only part of a large value
+	valueBytes := make([]byte, valueLength)
+	_, err = io.ReadFull(reader, valueBytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read value: %w", err)
+	}
+
+	_, err = reader.ReadString('\n')
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read newline: %w", err)
+	}
+
+	endLine, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read end marker: %w", err)
+	}
+
+	if !strings.HasPrefix(endLine, "END") {
+		return nil, false, fmt.Errorf("end marker not found: %s", endLine)
+	}
+
+	return valueBytes, true, nil
+}
+
+// GetMulti retrieves several keys with a single "get" command. Keys that
+// are not cached are absent from the returned map.
+func (c *MemcachedClient) GetMulti(keys []string) (map[string]string, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+	values := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	if c.binary {
+		// One request per key, the binary protocol has no multi-key get
+		for _, key := range keys {
+			value, _, _, found, err := c.binaryGet(key)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				values[key] = string(value)
+			}
+		}
+		return values, nil
+	}
+
+	cmd := fmt.Sprintf("get %s\r\n", strings.Join(keys, " "))
+	if err := c.send(cmd); err != nil {
+		return nil, fmt.Errorf("failed to send get command: %w", err)
+	}
+
+	reader := c.reader
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if strings.HasPrefix(line, "END") {
+			return values, nil
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 4 || parts[0] != "VALUE" {
+			return nil, fmt.Errorf("invalid response format: %s", line)
+		}
+		valueLength, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value length: %v", err)
+		}
+
+		// The data block is followed by \r\n
+		data := make([]byte, valueLength+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("failed to read value: %w", err)
+		}
+		values[parts[1]] = string(data[:valueLength])
+	}
+}
+
+// Errors returned by the conditional commands (Gets, Cas, Add, Replace,
+// Append, Prepend, Increment, Decrement and Touch), to be compared with errors.Is
+var (
+	// ErrNotFound means the key does not exist (or has expired)
+	ErrNotFound = errors.New("key not found")
+	// ErrKeyNotFound is another name of ErrNotFound
+	ErrKeyNotFound = ErrNotFound
+	// ErrCasConflict means the item was modified since its CAS token was read
+	ErrCasConflict = errors.New("value was modified since gets")
+	// ErrNotStored means the condition of add (key missing) or of append
+	// and prepend (key present) was not met
+	ErrNotStored = errors.New("item not stored")
+	// ErrNotNumeric means incr or decr was used on a value that is not a
+	// decimal number
+	ErrNotNumeric = errors.New("cannot increment or decrement non-numeric value")
+)
+
+// Gets retrieves a value together with its client flags and CAS token, the
+// latter to be passed to Cas
+func (c *MemcachedClient) Gets(key string) (string, uint32, uint64, error) {
+	if c.conn == nil {
+		return "", 0, 0, fmt.Errorf("client not connected")
+	}
+	if c.binary {
+		value, flags, casToken, found, err := c.binaryGet(key)
+		if err == nil && !found {
+			err = ErrNotFound
+		}
+		return string(value), flags, casToken, err
+	}
+
+	cmd := fmt.Sprintf("gets %s\r\n", key)
+	if err := c.send(cmd); err != nil {
+		return "", 0, 0, fmt.Errorf("failed to send gets command: %w", err)
+	}
+
+	reader := c.reader
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	if strings.HasPrefix(line, "END") {
+		return "", 0, 0, ErrNotFound
+	}
+
+	// VALUE <key> <flags> <bytes> <cas unique>
+	parts := strings.Fields(line)
+	if len(parts) != 5 || parts[0] != "VALUE" {
+		return "", 0, 0, fmt.Errorf("invalid response format: %s", line)
+	}
+	flags, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid flags: %v", err)
+	}
+	valueLength, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid value length: %v", err)
+	}
+	casToken, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid cas token: %v", err)
+	}
+
+	data := make([]byte, valueLength+2)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return "", 0, 0, fmt.Errorf("failed to read value: %w", err)
+	}
+	endLine, err := reader.ReadString('\n')
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to read end marker: %w", err)
+	}
+	if !strings.HasPrefix(endLine, "END") {
+		return "", 0, 0, fmt.Errorf("end marker not found: %s", endLine)
+	}
+
+	return string(data[:valueLength]), uint32(flags), casToken, nil
+}
+
+// Cas stores the value with the given client flags only if the item has not
+// been modified since Gets returned casToken. It returns ErrCasConflict if it
+// has and ErrNotFound if the key no longer exists
+func (c *MemcachedClient) Cas(key, value string, flags uint32, expTime int, casToken uint64) error {
+	if c.conn == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if c.dryRun {
+		c.logDryRun("cas", key, value)
+		return nil
+	}
+	if c.binary {
+		return c.binaryStore(opSet, key, value, flags, expTime, casToken)
+	}
+
+	cmd := fmt.Sprintf("cas %s %d %d %d %d\r\n%s\r\n", key, flags, expTime, len(value), casToken, value)
+	if err := c.send(cmd); err != nil {
+		return fmt.Errorf("failed to send cas command: %w", err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch {
+	case strings.HasPrefix(response, "STORED"):
+		return nil
+	case strings.HasPrefix(response, "EXISTS"):
+		return ErrCasConflict
+	case strings.HasPrefix(response, "NOT_FOUND"):
+		return ErrNotFound
+	}
+	return fmt.Errorf("failed to cas value: %s", strings.TrimSpace(response))
+}
+
+// Set stores a key-value pair in Memcached
+func (c *MemcachedClient) Set(key string, value string, expTime int) error {
+	if c.conn == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if c.dryRun {
+		c.logDryRun("set", key, value)
+		return nil
+	}
+	if c.binary {
+		return c.binaryStore(opSet, key, value, 0, expTime, 0)
+	}
+
+	cmd := fmt.Sprintf("set %s 0 %d %d\r\n%s\r\n", key, expTime, len(value), value)
+	err := c.send(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to send set command: %w", err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if !strings.HasPrefix(response, "STORED") {
+		return fmt.Errorf("failed to set value: %s", strings.TrimSpace(response))
+	}
+
+	return nil
+}
+
+// Add stores the value only if the key does not exist yet. It returns
+// ErrNotStored if it does
+func (c *MemcachedClient) Add(key string, value string, expTime int) error {
+	return c.store("add", key, value, expTime)
+}
+
+// Replace stores the value only if the key already exists. It returns
+// ErrNotFound if it does not
+func (c *MemcachedClient) Replace(key string, value string, expTime int) error {
+	err := c.store("replace", key, value, expTime)
+	if errors.Is(err, ErrNotStored) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Append adds value to the end of an existing item. It returns ErrNotStored
+// if the key does not exist; the item's flags and TTL are left unchanged
+func (c *MemcachedClient) Append(key, value string) error {
+	return c.store("append", key, value, 0)
+}
+
+// Prepend adds value to the start of an existing item, see Append
+func (c *MemcachedClient) Prepend(key, value string) error {
+	return c.store("prepend", key, value, 0)
+}
+
+// store sends a conditional storage command ("add", "replace", "append" or
+// "prepend") and maps the reply to ErrNotStored or ErrNotFound. The server
+// ignores the expiry of append and prepend.
+func (c *MemcachedClient) store(command, key, value string, expTime int) error {
+	if c.conn == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if c.dryRun {
+		c.logDryRun(command, key, value)
+		return nil
+	}
+	if c.binary {
+		return c.binaryStore(binaryStoreOpcodes[command], key, value, 0, expTime, 0)
+	}
+
+	cmd := fmt.Sprintf("%s %s 0 %d %d\r\n%s\r\n", command, key, expTime, len(value), value)
+	if err := c.send(cmd); err != nil {
+		return fmt.Errorf("failed to send %s command: %w", command, err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch {
+	case strings.HasPrefix(response, "STORED"):
+		return nil
+	case strings.HasPrefix(response, "NOT_STORED"):
+		return ErrNotStored
+	case strings.HasPrefix(response, "NOT_FOUND"):
+		return ErrNotFound
+	}
+	return fmt.Errorf("unexpected response: %s", strings.TrimSpace(response))
+}
+
+// SetIfChanged stores the value only if the key is missing or holds a
+// different value, and reports whether a write happened. Skipping the write
+// leaves the item's TTL untouched
+func (c *MemcachedClient) SetIfChanged(key string, value string, expTime int) (bool, error) {
+	current, found, err := c.Lookup(key)
+	if err != nil {
+		return false, err
+	}
+	if found && current == value {
+		return false, nil
+	}
+	return true, c.Set(key, value, expTime)
+}
+
+// Delete removes a key from Memcached
+func (c *MemcachedClient) Delete(key string) error {
+	if c.conn == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if c.dryRun {
+		c.logDryRun("delete", key, "")
+		return nil
+	}
+	if c.binary {
+		return c.binaryDelete(key)
+	}
+
+	cmd := fmt.Sprintf("delete %s\r\n", key)
+	err := c.send(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to send delete command: %w", err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if !strings.HasPrefix(response, "DELETED") {
+		if strings.HasPrefix(response, "NOT_FOUND") {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete key: %s", strings.TrimSpace(response))
+	}
+
+	return nil
+}
+
+// Increment adds delta to the numeric value of key and returns the new value
+func (c *MemcachedClient) Increment(key string, delta uint64) (uint64, error) {
+	return c.incrDecr("incr", key, delta)
+}
+
+// Decrement subtracts delta from the numeric value of key and returns the new
+// value. Memcached stops at 0 instead of going negative
+func (c *MemcachedClient) Decrement(key string, delta uint64) (uint64, error) {
+	return c.incrDecr("decr", key, delta)
+}
+
+// Incr is Increment, under the name of the memcached command
+func (c *MemcachedClient) Incr(key string, delta uint64) (uint64, error) {
+	return c.Increment(key, delta)
+}
+
+// Decr is Decrement, under the name of the memcached command
+func (c *MemcachedClient) Decr(key string, delta uint64) (uint64, error) {
+	return c.Decrement(key, delta)
+}
+
+// incrDecr sends an "incr" or "decr" command. A missing key returns
+// ErrNotFound, a value that is not a number ErrNotNumeric
+func (c *MemcachedClient) incrDecr(command, key string, delta uint64) (uint64, error) {
+	if c.conn == nil {
+		return 0, fmt.Errorf("client not connected")
+	}
+	if c.dryRun {
+		c.logDryRun(command, key, strconv.FormatUint(delta, 10))
+		return 0, nil
+	}
+	if c.binary {
+		return c.binaryIncrDecr(command, key, delta)
+	}
+
+	cmd := fmt.Sprintf("%s %s %d\r\n", command, key, delta)
+	if err := c.send(cmd); err != nil {
+		return 0, fmt.Errorf("failed to send %s command: %w", command, err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	response = strings.TrimSpace(response)
+	if strings.HasPrefix(response, "NOT_FOUND") {
+		return 0, ErrNotFound
+	}
+	if strings.Contains(response, "non-numeric value") {
+		return 0, ErrNotNumeric
+	}
+	value, err := strconv.ParseUint(response, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected response: %s", response)
+	}
+	return value, nil
+}
+
+// Touch sets a new expiration time on an existing item without fetching it.
+// A missing key returns ErrNotFound
+func (c *MemcachedClient) Touch(key string, expTime int) error {
+	if err := c.caps.Require(FeatureTouch); err != nil {
+		return err
+	}
+	if c.conn == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if c.dryRun {
+		c.logDryRun("touch", key, strconv.Itoa(expTime))
+		return nil
+	}
+	if c.binary {
+		return c.binaryTouch(key, expTime)
+	}
+
+	cmd := fmt.Sprintf("touch %s %d\r\n", key, expTime)
+	if err := c.send(cmd); err != nil {
+		return fmt.Errorf("failed to send touch command: %w", err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	switch {
+	case strings.HasPrefix(response, "TOUCHED"):
+		return nil
+	case strings.HasPrefix(response, "NOT_FOUND"):
+		return ErrNotFound
+	}
+	return fmt.Errorf("unexpected response: %s", strings.TrimSpace(response))
+}
+
+// TTL returns the seconds left before key expires, -1 for an item that
+// never expires, and whether the key exists. It uses the meta protocol of
+// memcached 1.6, the text protocol has no other way to read an item's TTL.
+func (c *MemcachedClient) TTL(key string) (int, bool, error) {
+	if c.conn == nil {
+		return 0, false, fmt.Errorf("client not connected")
+	}
+	if err := c.caps.Require(FeatureMetaProtocol); err != nil {
+		return 0, false, err
+	}
+
+	cmd := fmt.Sprintf("mg %s t\r\n", key)
+	if err := c.send(cmd); err != nil {
+		return 0, false, fmt.Errorf("failed to send mg command: %w", err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read response: %w", err)
+	}
+	fields := strings.Fields(response)
+	switch {
+	case len(fields) > 0 && fields[0] == "EN":
+		return 0, false, nil
+	case len(fields) > 0 && fields[0] == "HD":
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "t") {
+				ttl, err := strconv.Atoi(f[1:])
+				if err != nil {
+					break
+				}
+				return ttl, true, nil
+			}
+		}
+	}
+	return 0, false, fmt.Errorf("unexpected response: %s", strings.TrimSpace(response))
+}
+
+// maxRelativeExpiry is the largest expiry memcached takes as seconds from
+// now, larger ones are Unix timestamps
+const maxRelativeExpiry = 30 * 24 * 3600
+
+// keptExpiry returns the expiry that writes key again with the TTL it has
+// left, 0 (no expiry) for a missing key or one that never expires
+func (c *MemcachedClient) keptExpiry(key string) (int, error) {
+	ttl, found, err := c.TTL(key)
+	switch {
+	case err != nil:
+		return 0, err
+	case !found || ttl < 0:
+		return 0, nil
+	case ttl == 0:
+		// expiring within the second, 0 would make it permanent
+		return 1, nil
+	case ttl > maxRelativeExpiry:
+		return int(time.Now().Unix()) + ttl, nil
+	}
+	return ttl, nil
+}
+
+// GetKeys retrieves all keys matching the given pattern
+func (c *MemcachedClient) GetKeys(pattern string) ([]string, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+
+	cmd := "stats items\r\n"
+	err := c.send(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send stats items command: %w", err)
+	}
+
+	reader := c.reader
+	slabIDs := make(map[string]bool)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if strings.HasPrefix(line, "END") {
+			break
+		}
+
+		if strings.HasPrefix(line, "STAT items:") {
+			parts := strings.Split(line, ":")
+			if len(parts) > 1 {
+				slabIDs[parts[1]] = true
+			}
+		}
+	}
+
+	var keys []string
+	for slabID := range slabIDs {
+		cmd = fmt.Sprintf("stats cachedump %s 0\r\n", slabID)
+		err = c.send(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send stats cachedump command: %w", err)
+		}
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("failed to read response: %w", err)
+			}
+
+			if strings.HasPrefix(line, "END") {
+				break
+			}
+
+			if strings.HasPrefix(line, "ITEM ") {
+				parts := strings.Fields(line)
+				if len(parts) > 1 {
+					key := parts[1]
+					if pattern == "*" || strings.Contains(key, strings.Replace(pattern, "*", "", -1)) {
+						keys = append(keys, key)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// CacheItem represents a cached item with metadata
+type CacheItem struct {
+	Key    string `json:"key"`
+	Size   string `json:"size"`
+	Expiry string `json:"expiry"`
+}
+
+// CacheDump retrieves cached items from a specific slab
+func (c *MemcachedClient) CacheDump(slabID string, limit int) ([]CacheItem, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+
+	cmd := fmt.Sprintf("stats cachedump %s %d\r\n", slabID, limit)
+	err := c.send(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send stats cachedump command: %w", err)
+	}
+
+	reader := c.reader
+	var items []CacheItem
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if strings.HasPrefix(line, "END") {
+			break
+		}
+
+		if item, ok := parseCacheDumpItem(line); ok {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// parseCacheDumpItem parses a "ITEM <key> [<size> b; <exptime> s]" line
+func parseCacheDumpItem(line string) (CacheItem, bool) {
+	if !strings.HasPrefix(line, "ITEM ") {
+		return CacheItem{}, false
+	}
+	parts := strings.Fields(line)
+	if len(parts) < 5 {
+		return CacheItem{}, false
+	}
+	return CacheItem{
+		Key:    parts[1],
+		Size:   strings.Trim(parts[2], "[]"),
+		Expiry: parts[4],
+	}, true
+}
+
+// ItemMeta holds the metadata reported for a single item by the LRU crawler
+type ItemMeta struct {
+	Key    string
+	Size   int
+	Expiry int64 // absolute unix time, -1 when the item never expires
+}
+
+// MetaDump retrieves the metadata of every item via "lru_crawler metadump all".
+// Servers older than 1.4.31 (or with the crawler disabled) reply with an error.
+func (c *MemcachedClient) MetaDump() ([]ItemMeta, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+
+	err := c.send("lru_crawler metadump all\r\n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send lru_crawler metadump command: %w", err)
+	}
+
+	reader := c.reader
+	var items []ItemMeta
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if strings.HasPrefix(line, "END") {
+			break
+		}
+		if strings.HasPrefix(line, "ERROR") || strings.HasPrefix(line, "CLIENT_ERROR") ||
+			strings.HasPrefix(line, "BUSY") {
+			return nil, fmt.Errorf("metadump not available: %s", strings.TrimSpace(line))
+		}
+
+		var item ItemMeta
+		for _, field := range strings.Fields(line) {
+			name, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			switch name {
+			case "key":
+				item.Key = value
+			case "exp":
+				item.Expiry, _ = strconv.ParseInt(value, 10, 64)
+			case "size":
+				item.Size, _ = strconv.Atoi(value)
+			}
+		}
+		if item.Key != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// GetAllSlabs retrieves all slab IDs
+func (c *MemcachedClient) GetAllSlabs() ([]string, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+
+	cmd := "stats items\r\n"
+	err := c.send(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send stats items command: %w", err)
+	}
+
+	reader := c.reader
+	slabIDs := make(map[string]bool)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if strings.HasPrefix(line, "END") {
+			break
+		}
+
+		if strings.HasPrefix(line, "STAT items:") {
+			parts := strings.Split(line, ":")
+			if len(parts) > 1 {
+				slabIDs[parts[1]] = true
+			}
+		}
+	}
+
+	result := make([]string, 0, len(slabIDs))
+	for slabID := range slabIDs {
+		result = append(result, slabID)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// Statistics retrieves server statistics
+func (c *MemcachedClient) Statistics(statType string) (map[string]string, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+	if c.binary {
+		return c.binaryStatistics(statType)
+	}
+
+	cmd := "stats"
+	if statType != "" {
+		cmd = fmt.Sprintf("stats %s", statType)
+	}
+	cmd += "\r\n"
+
+	err := c.send(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send stats command: %w", err)
+	}
+
+	reader := c.reader
+	stats := make(map[string]string)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if strings.HasPrefix(line, "END") {
+			break
+		}
+
+		if strings.HasPrefix(line, "STAT ") {
+			parts := strings.Fields(line)
+			if len(parts) >= 3 {
+				key := parts[1]
+				value := strings.Join(parts[2:], " ")
+				stats[key] = value
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// Feature names used for capability checks
+const (
+	FeatureTouch         = "touch"
+	FeatureLRUCrawler    = "lru_crawler"
+	FeatureMetadump      = "lru_crawler metadump"
+	FeatureCacheMemlimit = "cache_memlimit"
+	FeatureMetaProtocol  = "meta protocol"
+)
+
+// featureMinVersions lists the first server release supporting each feature
+var featureMinVersions = []struct {
+	feature string
+	version [3]int
+}{
+	{FeatureTouch, [3]int{1, 4, 8}},
+	{FeatureLRUCrawler, [3]int{1, 4, 24}},
+	{FeatureCacheMemlimit, [3]int{1, 4, 29}},
+	{FeatureMetadump, [3]int{1, 4, 31}},
+	{FeatureMetaProtocol, [3]int{1, 6, 0}},
+}
+
+// Capabilities describes which optional features a server supports
+type Capabilities struct {
+	Version string
+	Known   bool // false when the version could not be determined
+	Numbers [3]int
+}
+
+// Supports reports whether the server supports feature. When the version is
+// unknown every feature is assumed to be available and the server decides.
+func (c Capabilities) Supports(feature string) bool {
+	if !c.Known {
+		return true
+	}
+	for _, f := range featureMinVersions {
+		if f.feature != feature {
+			continue
+		}
+		for i := 0; i < 3; i++ {
+			if c.Numbers[i] != f.version[i] {
+				return c.Numbers[i] > f.version[i]
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// Require returns a descriptive error when feature is not supported
+func (c Capabilities) Require(feature string) error {
+	if c.Supports(feature) {
+		return nil
+	}
+	return fmt.Errorf("this server (v%s) does not support %s", c.Version, feature)
+}
+
+// parseVersion extracts the numeric part of versions such as "1.6.21" or "1.4.5-dirty"
+func parseVersion(version string) ([3]int, bool) {
+	var numbers [3]int
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return numbers, false
+	}
+	for i, part := range parts {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		n, err := strconv.Atoi(part[:end])
+		if err != nil {
+			return numbers, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
+
+// Version returns the server version string
+func (c *MemcachedClient) Version() (string, error) {
+	if c.conn == nil {
+		return "", fmt.Errorf("client not connected")
+	}
+	if c.binary {
+		return c.binaryVersion()
+	}
+
+	err := c.send("version\r\n")
+	if err != nil {
+		return "", fmt.Errorf("failed to send version command: %w", err)
+	}
+
+	reader := c.reader
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if !strings.HasPrefix(line, "VERSION ") {
+		return "", fmt.Errorf("invalid response format: %s", strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "VERSION ")), nil
+}
+
+// DetectCapabilities determines the supported features from the server version
+func (c *MemcachedClient) DetectCapabilities() Capabilities {
+	return newCapabilities(c.Version())
+}
+
+// newCapabilities builds the Capabilities for the result of Version
+func newCapabilities(version string, err error) Capabilities {
+	if err != nil {
+		return Capabilities{Version: "unknown"}
+	}
+	numbers, ok := parseVersion(version)
+	return Capabilities{Version: version, Known: ok, Numbers: numbers}
+}
+
+// Capabilities returns the features detected at connect
+func (c *MemcachedClient) Capabilities() Capabilities {
+	return c.caps
+}
+
+// adminCommand sends a runtime tuning or maintenance command and expects an OK reply
+func (c *MemcachedClient) adminCommand(cmd string) error {
+	if c.conn == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if c.dryRun {
+		fmt.Fprintf(stderr, "[DRY RUN] would send '%s'\n", cmd)
+		return nil
+	}
+
+	err := c.send(cmd + "\r\n")
+	if err != nil {
+		return fmt.Errorf("failed to send %s command: %v", strings.Fields(cmd)[0], err)
+	}
+
+	reader := c.reader
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if !strings.HasPrefix(response, "OK") {
+		return fmt.Errorf("server rejected '%s': %s", cmd, strings.TrimSpace(response))
+	}
+	return nil
+}
+
+// FlushAll invalidates every item on the server, after delay seconds if
+// delay is positive
+func (c *MemcachedClient) FlushAll(delay int) error {
+	if c.binary && !c.dryRun {
+		return c.binaryFlush(delay)
+	}
+	if delay > 0 {
+		return c.adminCommand(fmt.Sprintf("flush_all %d", delay))
+	}
+	return c.adminCommand("flush_all")
+}
+
+// SetMemLimit changes the cache memory limit (in megabytes) at runtime
+func (c *MemcachedClient) SetMemLimit(megabytes int) error {
+	if err := c.caps.Require(FeatureCacheMemlimit); err != nil {
+		return err
+	}
+	return c.adminCommand(fmt.Sprintf("cache_memlimit %d", megabytes))
+}
+
+// SetVerbosity changes the server logging verbosity
+func (c *MemcachedClient) SetVerbosity(level int) error {
+	return c.adminCommand(fmt.Sprintf("verbosity %d", level))
+}
+
+// SetSlabAutomove changes the slab rebalancing mode (0 off, 1 background, 2 aggressive)
+func (c *MemcachedClient) SetSlabAutomove(mode int) error {
+	return c.adminCommand(fmt.Sprintf("slabs automove %d", mode))
+}
+
+// LRUCrawler sends an "lru_crawler" subcommand such as "enable" or "sleep 100"
+func (c *MemcachedClient) LRUCrawler(args ...string) error {
+	if err := c.caps.Require(FeatureLRUCrawler); err != nil {
+		return err
+	}
+	return c.adminCommand("lru_crawler " + strings.Join(args, " "))
+}
+
+// rawOutput reports whether a command's stdout is meant to be consumed by
+// a script, in which case the connection banner is suppressed
+func rawOutput(command string, args []string) bool {
+	switch command {
+	case "config-dump":
+		return true
+	case "get":
+		for _, arg := range args {
+			if arg == "--" {
+				break
+			}
+			if name := strings.TrimLeft(arg, "-"); arg != name && (name == "default" || strings.HasPrefix(name, "default=")) {
+				return true
+			}
+		}
+	case "stats":
+		for i, arg := range args {
+			if arg == "--" {
+				break
+			}
+			switch arg {
+			case "-o=prometheus", "--o=prometheus", "-output=prometheus", "--output=prometheus":
+				return true
+			case "-o", "--o", "-output", "--output":
+				if i+1 < len(args) && args[i+1] == "prometheus" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// runtimeSettings maps "stats settings" names to the memcc command that
+// re-applies them on a running server
+var runtimeSettings = map[string]func(value string) (string, bool){
+	"maxbytes": func(v string) (string, bool) {
+		n, err := strconv.ParseInt(v, 10, 64)
+		return fmt.Sprintf("memlimit %d", n/(1024*1024)), err == nil
+	},
+	"verbosity": func(v string) (string, bool) {
+		_, err := strconv.Atoi(v)
+		return "verbosity " + v, err == nil
+	},
+	"slab_automove": func(v string) (string, bool) {
+		_, err := strconv.Atoi(v)
+		return "automove " + v, err == nil
+	},
+	"lru_crawler": func(v string) (string, bool) {
+		if v == "yes" {
+			return "lru-crawler enable", true
+		}
+		return "lru-crawler disable", v == "no"
+	},
+	"lru_crawler_sleep": func(v string) (string, bool) {
+		_, err := strconv.Atoi(v)
+		return "lru-crawler sleep " + v, err == nil
+	},
+	"lru_crawler_tocrawl": func(v string) (string, bool) {
+		_, err := strconv.Atoi(v)
+		return "lru-crawler tocrawl " + v, err == nil
+	},
+}
+
+// configScript renders "stats settings" as a shell script of memcc commands.
+// Settings that can only be changed at startup are kept as comments.
+func configScript(settings map[string]string, source string, caps Capabilities) string {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Runtime settings of %s (memcached %s), dumped by %s v%s on %s\n",
+		source, caps.Version, AppName, Version, time.Now().Format(time.RFC3339))
+	b.WriteString("# Usage: sh this-script.sh -s <host:port>\n")
+	b.WriteString("set -e\n\n")
+
+	var fixed []string
+	for _, name := range names {
+		convert, ok := runtimeSettings[name]
+		if !ok {
+			fixed = append(fixed, name)
+			continue
+		}
+		cmd, ok := convert(settings[name])
+		if !ok {
+			fixed = append(fixed, name)
+			continue
+		}
+		fmt.Fprintf(&b, "%s \"$@\" %s\n", AppName, cmd)
+	}
+
+	if len(fixed) > 0 {
+		b.WriteString("\n# Not adjustable at runtime, set via startup options:\n")
+		for _, name := range fixed {
+			fmt.Fprintf(&b, "#   %s %s\n", name, settings[name])
+		}
+	}
+	return b.String()
+}
+
+// loadEntry is a single key-value pair read by the load command
+type loadEntry struct {
+	Key   string
+	Value string
+}
+
+// readValue reads a value to store from a file, or from stdin for "-". The
+// bytes are kept as read, including any trailing newline.
+func readValue(source string) (string, error) {
+	if source == "-" {
+		data, err := io.ReadAll(stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(source)
+	return string(data), err
+}
+
+// valueSourceName describes the source given to readValue
+func valueSourceName(source string) string {
+	if source == "-" {
+		return "stdin"
+	}
+	return source
+}
+
+// validKey reports whether key can be sent over the text protocol
+func validKey(key string) bool {
+	if key == "" || len(key) > 250 {
+		return false
+	}
+	for _, r := range key {
+		if r <= ' ' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// readTSVEntries reads "key<TAB>value" lines, skipping blank lines and # comments
+func readTSVEntries(path string) ([]loadEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []loadEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key<TAB>value", lineNo)
+		}
+		if !validKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", lineNo, key)
+		}
+		entries = append(entries, loadEntry{Key: key, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// readJSONEntries reads a JSON object whose top-level keys become cache keys
+// and whose values are stored re-serialized as compact JSON
+func readJSONEntries(path string) ([]loadEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %v", err)
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		if !validKey(key) {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]loadEntry, 0, len(keys))
+	for _, key := range keys {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, object[key]); err != nil {
+			return nil, fmt.Errorf("invalid value for key %q: %v", key, err)
+		}
+		entries = append(entries, loadEntry{Key: key, Value: buf.String()})
+	}
+	return entries, nil
+}
+
+// keyPath maps a key to a file path under dir, turning ':' into a directory
+// separator. Path components that are empty, "." or ".." and characters that
+// are unsafe in file names are percent-encoded, so no key can escape dir.
+func keyPath(dir, key string) (string, error) {
+	parts := strings.Split(strings.ReplaceAll(key, "/", ":"), ":")
+	for i, part := range parts {
+		var b strings.Builder
+		for j := 0; j < len(part); j++ {
+			ch := part[j]
+			if ch == '%' || ch == '\\' || ch < ' ' || ch == 0x7f {
+				fmt.Fprintf(&b, "%%%02X", ch)
+			} else {
+				b.WriteByte(ch)
+			}
+		}
+		escaped := b.String()
+		switch escaped {
+		case "":
+			escaped = "%"
+		case ".", "..":
+			escaped = strings.ReplaceAll(escaped, ".", "%2E")
+		}
+		parts[i] = escaped
+	}
+
+	path := filepath.Join(append([]string{dir}, parts...)...)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("key '%s' maps outside %s", key, dir)
+	}
+	return path, nil
+}
+
+// parseByteSize parses a size such as "512", "100KB" or "1MB"
+func parseByteSize(s string) (int, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1
+	for _, unit := range []struct {
+		suffix string
+		factor int
+	}{{"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			multiplier = unit.factor
+			break
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(upper))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// probeResult holds the outcome of a single set/get round-trip
+type probeResult struct {
+	Key     string        `json:"key"`
+	Size    int           `json:"size"`
+	SetTime time.Duration `json:"set_ns"`
+	GetTime time.Duration `json:"get_ns"`
+	Intact  bool          `json:"intact"`
+}
+
+// probe stores and reads back size bytes of random data under a unique key,
+// measuring each step, and deletes the key afterwards
+func probe(client *MemcachedClient, size int) (probeResult, error) {
+	suffix := make([]byte, 8)
+	payload := make([]byte, size)
+	if _, err := rand.Read(suffix); err != nil {
+		return probeResult{}, err
+	}
+	if _, err := rand.Read(payload); err != nil {
+		return probeResult{}, err
+	}
+
+	result := probeResult{
+		Key:  fmt.Sprintf("%s:probe:%d:%s", AppName, os.Getpid(), hex.EncodeToString(suffix)),
+		Size: size,
+	}
+	value := string(payload)
+
+	start := time.Now()
+	if err := client.Set(result.Key, value, 60); err != nil {
+		return result, err
+	}
+	result.SetTime = time.Since(start)
+	defer client.Delete(result.Key)
+
+	start = time.Now()
+	got, err := client.Get(result.Key)
+	if err != nil {
+		return result, err
+	}
+	result.GetTime = time.Since(start)
+	result.Intact = got == value
+
+	return result, nil
+}
+
+// redactValue replaces a value with its length and the first 16 hex digits
+// of its SHA-256, e.g. "[redacted 42 bytes sha256:9f86d081884c7d65]". The
+// hash tells whether two values are equal without showing either; short or
+// guessable values can still be recovered by brute force
+func redactValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("[redacted %d bytes sha256:%s]", len(value), hex.EncodeToString(sum[:8]))
+}
+
+// isBinary reports whether printing value would garble a terminal: it is
+// not valid UTF-8 or holds control characters other than tab and line breaks
+func isBinary(value string) bool {
+	if !utf8.ValidString(value) {
+		return true
+	}
+	for _, r := range value {
+		if (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResult is the outcome of a health check against one node
+type checkResult struct {
+	Node    string
+	Err     error
+	Latency time.Duration
+	Version string
+}
+
+// readServerList reads one host[:port] per line, skipping blank lines and # comments
+func readServerList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			servers = append(servers, line)
+		}
+	}
+	return servers, nil
+}
+
+// serverAddress adds defaultPort to a node given without one
+func serverAddress(node string, defaultPort int) string {
+	if _, _, err := net.SplitHostPort(node); err == nil {
+		return node
+	}
+	return net.JoinHostPort(strings.Trim(node, "[]"), strconv.Itoa(defaultPort))
+}
+
+// checkServer connects to a node and times a version round-trip. The whole
+// check, including the connect, is bounded by timeout
+func checkServer(address string, timeout time.Duration, tlsConfig *tls.Config) checkResult {
+	result := checkResult{Node: address}
+	deadline := time.Now().Add(timeout)
+	conn, err := dialServer(context.Background(), address, timeout, tlsConfig)
+	if errors.Is(err, errHandshake) {
+		result.Err = err
+		return result
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("failed to connect: %v", err)
+		return result
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	client := &MemcachedClient{conn: conn, reader: bufio.NewReader(conn)}
+	start := time.Now()
+	result.Version, result.Err = client.Version()
+	result.Latency = time.Since(start)
+	return result
+}
+
+// checkServers checks all nodes with at most workers checks in flight and
+// returns the results in the order the nodes were given
+func checkServers(addresses []string, timeout time.Duration, workers int, tlsConfig *tls.Config) []checkResult {
+	results := make([]checkResult, len(addresses))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, address string) {
+			defer wg.Done()
+			results[i] = checkServer(address, timeout, tlsConfig)
+			<-sem
+		}(i, address)
+	}
+	wg.Wait()
+	return results
+}
+
+// runCheck implements the check command. It runs without the default
+// connection and exits non-zero if any node is unreachable
+func runCheck(cfg Config, args []string) {
+	fs := newFlagSet("check")
+	serversFile := fs.String("servers-file", "", "Read nodes from a file, one host[:port] per line")
+	timeout := fs.Duration("timeout", 2*time.Second, "Per-node timeout for connect and version")
+	concurrency := fs.Int("concurrency", 16, "Maximum number of nodes checked at once")
+	nodes, err := cli.ParseInterspersed(fs, args)
+	if err != nil {
+		cli.Exit(cli.ExitError)
+	}
+	if *serversFile != "" {
+		listed, err := readServerList(*serversFile)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to read %s: %v", *serversFile, err))
+			cli.Exit(cli.ExitError)
+		}
+		nodes = append(nodes, listed...)
+	}
+	if len(nodes) == 0 {
+		nodes = cfg.Servers
+	}
+	if len(nodes) == 0 {
+		ui.Error("No servers to check")
+		fmt.Fprintf(stdout, "\n%sUsage: %s [options] check <host[:port]...> [--servers-file FILE]%s\n", tui.Dim, AppName, tui.Reset)
+		cli.Exit(cli.ExitError)
+	}
+	if *timeout <= 0 || *concurrency <= 0 {
+		ui.Error("--timeout and --concurrency must be positive")
+		cli.Exit(cli.ExitError)
+	}
+
+	addresses := make([]string, len(nodes))
+	for i, node := range nodes {
+		addresses[i] = serverAddress(node, cfg.Port)
+	}
+	results := checkServers(addresses, *timeout, *concurrency, cfg.TLS)
+	if resultOut != nil {
+		checks := make([]checkJSON, len(results))
+		for i, r := range results {
+			checks[i] = newCheckJSON(r)
+		}
+		printResult(checks)
+	}
+
+	ui.Header(fmt.Sprintf("Health check (%d nodes)", len(results)))
+	widths := []int{24, 6, 10, 40}
+	ui.TableHeader([]string{"Node", "Status", "Latency", "Version / Error"}, widths)
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			ui.TableRow([]string{r.Node, "DOWN", "-", r.Err.Error()}, widths)
+			continue
+		}
+		ui.TableRow([]string{r.Node, "UP", r.Latency.Round(10 * time.Microsecond).String(), r.Version}, widths)
+	}
+	ui.TableFooter(widths)
+
+	if failed > 0 {
+		ui.Error(fmt.Sprintf("%d of %d nodes unreachable", failed, len(results)))
+		cli.Exit(cli.ExitError)
+	}
+	ui.Success(fmt.Sprintf("All %d nodes reachable", len(results)))
+}
+
+// slabUsage is the chunk usage of one slab class, from "stats slabs" and
+// the eviction counter from "stats items"
+type slabUsage struct {
+	ID            int   `json:"id"`
+	ChunkSize     int64 `json:"chunk_size"`
+	ChunksPerPage int64 `json:"chunks_per_page"`
+	TotalPages    int64 `json:"total_pages"`
+	TotalChunks   int64 `json:"total_chunks"`
+	UsedChunks    int64 `json:"used_chunks"`
+	Evicted       int64 `json:"evicted"`
+}
+
+// Usage is the fraction of allocated chunks that hold an item
+func (s slabUsage) Usage() float64 {
+	if s.TotalChunks == 0 {
+		return 0
+	}
+	return float64(s.UsedChunks) / float64(s.TotalChunks)
+}
+
+// FreePages is the number of whole pages the free chunks add up to, i.e.
+// what slab rebalancing could hand to another class
+func (s slabUsage) FreePages() int64 {
+	if s.ChunksPerPage == 0 {
+		return 0
+	}
+	return (s.TotalChunks - s.UsedChunks) / s.ChunksPerPage
+}
+
+// parseSlabUsage collects per-class counters from "stats slabs" and
+// "stats items", ordered by slab ID. Classes without pages are skipped
+func parseSlabUsage(slabs, items map[string]string) []slabUsage {
+	byID := make(map[int]*slabUsage)
+	for name, value := range slabs {
+		parts := strings.SplitN(name, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		s, ok := byID[id]
+		if !ok {
+			s = &slabUsage{ID: id}
+			byID[id] = s
+		}
+		switch parts[1] {
+		case "chunk_size":
+			s.ChunkSize = n
+		case "chunks_per_page":
+			s.ChunksPerPage = n
+		case "total_pages":
+			s.TotalPages = n
+		case "total_chunks":
+			s.TotalChunks = n
+		case "used_chunks":
+			s.UsedChunks = n
+		}
+	}
+
+	var usage []slabUsage
+	for id, s := range byID {
+		if s.TotalPages == 0 || s.TotalChunks == 0 {
+			continue
+		}
+		if s.ChunksPerPage == 0 {
+			s.ChunksPerPage = s.TotalChunks / s.TotalPages
+		}
+		s.Evicted, _ = strconv.ParseInt(items[fmt.Sprintf("items:%d:evicted", id)], 10, 64)
+		usage = append(usage, *s)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].ID < usage[j].ID
+	})
+	return usage
+}
+
+// State classifies the slab as "FULL" at or above fullRatio, "IDLE" below
+// idleRatio with at least one free page, and "ok" otherwise
+func (s slabUsage) State(fullRatio, idleRatio float64) string {
+	switch {
+	case s.Usage() >= fullRatio:
+		return "FULL"
+	case s.Usage() < idleRatio && s.FreePages() > 0:
+		return "IDLE"
+	}
+	return "ok"
+}
+
+// slabBalance is the result of the calcification heuristic: classes whose
+// chunks are nearly all in use next to classes holding whole free pages.
+// Memcached never takes a page back from a class on its own, so once memory
+// is fully assigned the full classes evict while the idle ones sit empty
+type slabBalance struct {
+	Full      []slabUsage
+	Idle      []slabUsage
+	FreePages int64
+	FreeBytes int64
+}
+
+// Imbalanced reports whether moving pages between classes would help:
+// at least one class is full and another has a whole page to give
+func (b slabBalance) Imbalanced() bool {
+	return len(b.Full) > 0 && b.FreePages > 0
+}
+
+// checkSlabBalance groups the full and idle classes, see slabUsage.State
+func checkSlabBalance(usage []slabUsage, fullRatio, idleRatio float64) slabBalance {
+	var b slabBalance
+	for _, s := range usage {
+		switch s.State(fullRatio, idleRatio) {
+		case "FULL":
+			b.Full = append(b.Full, s)
+		case "IDLE":
+			b.Idle = append(b.Idle, s)
+			b.FreePages += s.FreePages()
+			b.FreeBytes += s.FreePages() * s.ChunksPerPage * s.ChunkSize
+		}
+	}
+	return b
+}
+
+// ═══════════════════════════════════════════════════════════════════════════
+// UI Helper Functions
+// ═══════════════════════════════════════════════════════════════════════════
+
+func printBanner() {
+	banner := `
+    ┌──────────────────────────────────────────────────┐
+    │                                                  │
+    │   ███╗   ███╗███████╗███╗   ███╗ ██████╗ ██████╗ │
+    │   ████╗ ████║██╔════╝████╗ ████║██╔════╝██╔════╝ │
+    │   ██╔████╔██║█████╗  ██╔████╔██║██║     ██║      │
+    │   ██║╚██╔╝██║██╔══╝  ██║╚██╔╝██║██║     ██║      │
+    │   ██║ ╚═╝ ██║███████╗██║ ╚═╝ ██║╚██████╗╚██████╗ │
+    │   ╚═╝     ╚═╝╚══════╝╚═╝     ╚═╝ ╚═════╝ ╚═════╝ │
+    │                                                  │
+    │            Memcached CLI Client                  │
+    └──────────────────────────────────────────────────┘`
+	fmt.Fprintln(stdout, tui.Cyan+banner+tui.Reset)
+	fmt.Fprintf(stdout, "    %sVersion %s%s\n\n", tui.Dim, Version, tui.Reset)
+}
+
+func printCacheDump(items []CacheItem) {
+	if len(items) == 0 {
+		ui.Warning("No cached items found")
+		return
+	}
+
+	ui.Header("Cache Dump")
+
+	columns := []string{"Key", "Size (bytes)", "Expiry"}
+	widths := []int{35, 12, 15}
+
+	ui.TableHeader(columns, widths)
+	for _, item := range items {
+		ui.TableRow([]string{item.Key, item.Size, item.Expiry}, widths)
+	}
+	ui.TableFooter(widths)
+
+	fmt.Fprintf(stdout, "\n%s%s Total: %d items%s\n", tui.Dim, tui.Cyan, len(items), tui.Reset)
+}
+
+// printMultiGet shows the hits of GetMulti as a table in the order the keys
+// were requested, followed by the list of keys that were missing
+func printMultiGet(keys []string, values map[string]string) {
+	ui.Header("Multi Get")
+
+	columns := []string{"Key", "Size (bytes)", "Value"}
+	widths := []int{30, 12, 40}
+
+	var missing []string
+	found := 0
+	for _, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		if found == 0 {
+			ui.TableHeader(columns, widths)
+		}
+		found++
+		// Keep multi-line values on one table row
+		display := strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(value)
+		if isBinary(value) {
+			display = "(binary)"
+		}
+		ui.TableRow([]string{key, strconv.Itoa(len(value)), display}, widths)
+	}
+	if found > 0 {
+		ui.TableFooter(widths)
+	}
+
+	if len(missing) > 0 {
+		fmt.Fprintln(stdout)
+		ui.Warning(fmt.Sprintf("Missing keys (%d):", len(missing)))
+		for _, key := range missing {
+			fmt.Fprintf(stdout, "  %s-%s %s\n", tui.Dim, tui.Reset, key)
+		}
+	}
+
+	fmt.Fprintf(stdout, "\n%s%s Total: %d found, %d missing%s\n", tui.Dim, tui.Cyan, found, len(missing), tui.Reset)
+}
+
+func printStatistics(stats map[string]string) {
+	if len(stats) == 0 {
+		ui.Warning("No statistics available")
+		return
+	}
+
+	ui.Header("Server Statistics")
+
+	// Sort keys
+	keys := make([]string, 0, len(stats))
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	columns := []string{"Metric", "Value"}
+	widths := []int{30, 25}
+
+	ui.TableHeader(columns, widths)
+	for _, k := range keys {
+		ui.TableRow([]string{k, stats[k]}, widths)
+	}
+	ui.TableFooter(widths)
+
+	fmt.Fprintf(stdout, "\n%s%s Total: %d metrics%s\n", tui.Dim, tui.Cyan, len(stats), tui.Reset)
+}
+
+// expiryBucket is one row of the key expiry histogram
+type expiryBucket struct {
+	Label string        `json:"label"`
+	Limit time.Duration `json:"-"` // upper bound of remaining TTL, 0 for special rows
+	Count int           `json:"count"`
+}
+
+// parseExpiryBuckets parses a comma separated list of durations such as
+// "1m,5m,30m,1h,6h,24h,inf" into histogram rows. Items beyond the last
+// bound always get their own row, "inf" is accepted to make that explicit.
+func parseExpiryBuckets(spec string) ([]expiryBucket, error) {
+	buckets := []expiryBucket{{Label: "expired"}}
+	var prev time.Duration
+	last := ""
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "inf" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %v", part, err)
+		}
+		if d <= prev {
+			return nil, fmt.Errorf("buckets must be increasing: %s", part)
+		}
+		buckets = append(buckets, expiryBucket{Label: "<= " + part, Limit: d})
+		prev = d
+		last = part
+	}
+	if last == "" {
+		return nil, fmt.Errorf("no buckets given")
+	}
+
+	return append(buckets,
+		expiryBucket{Label: "> " + last},
+		expiryBucket{Label: "never"},
+	), nil
+}
+
+// binExpiry places an item with the given absolute expiry into its bucket
+func binExpiry(buckets []expiryBucket, expiry, now int64) {
+	never := len(buckets) - 1
+	if expiry <= 0 {
+		buckets[never].Count++
+		return
+	}
+
+	remaining := time.Duration(expiry-now) * time.Second
+	if remaining <= 0 {
+		buckets[0].Count++
+		return
+	}
+	for i := 1; i < never-1; i++ {
+		if remaining <= buckets[i].Limit {
+			buckets[i].Count++
+			return
+		}
+	}
+	buckets[never-1].Count++
+}
+
+func printExpiryHistogram(buckets []expiryBucket, source string) {
+	total := 0
+	labels := make([]string, len(buckets))
+	counts := make([]int, len(buckets))
+	for i, b := range buckets {
+		labels[i] = b.Label
+		counts[i] = b.Count
+		total += b.Count
+	}
+	if total == 0 {
+		ui.Warning("No cached items found")
+		return
+	}
+
+	ui.Header("Key Expiry Histogram")
+	fmt.Fprintln(stdout)
+	ui.BarChart(labels, counts)
+	fmt.Fprintf(stdout, "\n%s%s Total: %d items (source: %s)%s\n", tui.Dim, tui.Cyan, total, source, tui.Reset)
+}
+
+func printCapabilities(caps Capabilities) {
+	ui.Header(fmt.Sprintf("Server Capabilities (v%s)", caps.Version))
+	if !caps.Known {
+		ui.Warning("Server version unknown, features are assumed to be available")
+	}
+
+	widths := []int{25, 12, 10}
+	ui.TableHeader([]string{"Feature", "Since", "Supported"}, widths)
+	for _, f := range featureMinVersions {
+		supported := "no"
+		if caps.Supports(f.feature) {
+			supported = "yes"
+		}
+		since := fmt.Sprintf("%d.%d.%d", f.version[0], f.version[1], f.version[2])
+		ui.TableRow([]string{f.feature, since, supported}, widths)
+	}
+	ui.TableFooter(widths)
+}
+
+func printUsage() {
+	printBanner()
+
+	fmt.Fprintf(stdout, "%s%sUSAGE%s\n", tui.Bold, tui.Yellow, tui.Reset)
+	fmt.Fprintf(stdout, "    %s <command> [arguments]\n\n", AppName)
+
+	fmt.Fprintf(stdout, "%s%sCOMMANDS%s\n", tui.Bold, tui.Yellow, tui.Reset)
+
+	commands := []struct {
+		cmd  string
+		desc string
+		args string
+	}{
+		{"keys", "List keys matching pattern", "<pattern> [--values [--redact]]"},
+		{"get", "Get value for one or more keys", "<key...> [--redact] [--out-file FILE] [--default V [--on-miss set]]"},
+		{"set", "Set a key-value pair, value '-' reads stdin", "<key> <value|-> [expiry|--keep-ttl] [--if-changed] [--from-file F]"},
+		{"mget", "Get several keys in one request, as a table", "<key...>"},
+		{"incr", "Increment a numeric value (delta defaults to 1)", "<key> [delta]"},
+		{"decr", "Decrement a numeric value (stops at 0)", "<key> [delta]"},
+		{"gets", "Get value and CAS token for a key", "<key>"},
+		{"cas", "Set a key only if unchanged since gets", "<key> <value> <cas_token> [expiry] [--flags N]"},
+		{"add", "Set a key only if it does not exist", "<key> <value> [expiry]"},
+		{"replace", "Set a key only if it already exists", "<key> <value> [expiry]"},
+		{"append", "Add data to the end of an existing value", "<key> <value>"},
+		{"prepend", "Add data to the start of an existing value", "<key> <value>"},
+		{"touch", "Set a new expiry on a key without fetching it", "<key> <expiry>"},
+		{"delete", "Delete a key", "<key>"},
+		{"purge", "Delete every key matching a pattern", "<pattern> [--dry-run] [--concurrency N]"},
+		{"flush", "Invalidate all items, after an optional delay", "[delay] [-y|--yes]"},
+		{"stats", "Show server statistics", "[type] [-w interval] [-o prometheus]"},
+		{"cachedump", "Dump cache from slab", "<slab_id> [limit]"},
+		{"slabs", "List all slab IDs", ""},
+		{"balance", "Diagnose slab calcification", "[--full R] [--idle R]"},
+		{"load", "Bulk load keys from TSV or JSON", "<file> | --from-json <file>"},
+		{"dump-tree", "Write matching values to files under a directory", "<pattern> <dir> [--max-keys N]"},
+		{"check", "Health-check a list of servers", "<host[:port]...> [--servers-file F]"},
+		{"probe", "Measure set/get latency of a payload", "--size <bytes>"},
+		{"key-expiry-histogram", "Show TTL distribution of items", "[--buckets list]"},
+		{"capabilities", "Show features supported by the server", ""},
+		{"config-dump", "Print runtime settings as a memcc script", ""},
+		{"memlimit", "Set cache memory limit", "<megabytes>"},
+		{"verbosity", "Set server log verbosity", "<level>"},
+		{"automove", "Set slab automove mode", "<0|1|2>"},
+		{"lru-crawler", "Control the LRU crawler", "<enable|disable|sleep N|tocrawl N>"},
+		{"watch", "Redraw statistics periodically, highlighting changes", "[type] [--interval 2s]"},
+		{"shell", "Run commands interactively on one connection", ""},
+		{"version", "Show version info", ""},
+		{"help", "Show this help message", ""},
+	}
+
+	for _, c := range commands {
+		fmt.Fprintf(stdout, "    %s%-12s%s %-25s %s%s%s\n",
+			tui.Green, c.cmd, tui.Reset,
+			c.args,
+			tui.Dim, c.desc, tui.Reset)
+	}
+
+	fmt.Fprintf(stdout, "\n%s%sEXAMPLES%s\n", tui.Bold, tui.Yellow, tui.Reset)
+
+	examples := []struct {
+		cmd  string
+		desc string
+	}{
+		{AppName + " keys *", "List all keys"},
+		{AppName + " get mykey", "Get value of 'mykey'"},
+		{AppName + " get user:1 user:2 user:3", "Get several keys in one round trip, marking misses"},
+		{AppName + " get thumbnail --out-file thumb.png", "Save a binary value to a file (binary values are otherwise shown as a hex dump)"},
+		{AppName + " keys 'session:*' --values --redact", "Show length and SHA-256 prefix of each value, never the value itself"},
+		{"VAL=$(" + AppName + " get mykey --default none)", "Print the raw value, or 'none' on a miss"},
+		{AppName + " set mykey hello 3600", "Set 'mykey' to 'hello' with 1h TTL"},
+		{"cat payload.json | " + AppName + " set mykey - 3600", "Store stdin byte for byte, or use --from-file payload.json"},
+		{AppName + " set mykey hello 3600 --if-changed", "Write only if 'mykey' is missing or differs, keeping the TTL otherwise"},
+		{AppName + " set mykey hello --keep-ttl", "Replace the value of 'mykey' without resetting its TTL"},
+		{AppName + " incr page:views", "Atomically add 1 to the counter 'page:views'"},
+		{AppName + " gets mykey", "Show the value and CAS token of 'mykey'"},
+		{AppName + " cas mykey new 42", "Write 'new' only if 'mykey' still has CAS token 42"},
+		{AppName + " add lock:job 1 60", "Take 'lock:job' for 60s, exit status 3 if it is already held"},
+		{AppName + " delete mykey", "Delete 'mykey'"},
+		{AppName + " purge 'session:*' --concurrency 8", "Delete all session keys over 8 connections (--dry-run lists them first)"},
+		{AppName + " flush 30 --yes", "Invalidate all items in 30 seconds without asking"},
+		{AppName + " stats", "Show all statistics"},
+		{AppName + " stats items", "Show item statistics"},
+		{AppName + " stats --output prometheus > /var/lib/node_exporter/memcached.prom", "Export the numeric stats for the node-exporter textfile collector"},
+		{AppName + " stats -w 5", "Redraw the statistics every 5 seconds with the hit rate, until Ctrl-C"},
+		{AppName + " cachedump 1 10", "Dump first 10 items from slab 1"},
+		{AppName + " slabs", "List all slab IDs"},
+		{AppName + " balance", "Find full slab classes next to underused ones and suggest automove"},
+		{AppName + " load --from-json seed.json --ttl 600", "Load each top-level JSON key with a 10m TTL"},
+		{AppName + " dump-tree 'user:*' ./cache", "Write user:42:profile to ./cache/user/42/profile"},
+		{AppName + " -s my-cache.example.com:11211 --tls stats", "Connect over TLS, as ElastiCache with in-transit encryption requires"},
+		{"MEMCACHED_USERNAME=app MEMCACHED_PASSWORD=secret " + AppName + " get mykey", "Log in with SASL; get, set, delete, counters and stats then use the binary protocol"},
+		{AppName + " -s cache1:11211 shell", "Explore a server interactively, type help for commands"},
+		{AppName + " -s cache1,cache2,cache3 stats", "Show items, memory and hit rate of each server and of the whole cluster"},
+		{AppName + " -s cache1,cache2 set user:1 alice", "Store 'user:1' on the server its key hashes to, as clients of the cluster do"},
+		{AppName + " -s cache1,cache2 delete mykey --all", "Delete 'mykey' on every server"},
+		{AppName + " check cache1 cache2:11212 --timeout 1s", "Check each node's reachability, latency and version"},
+		{AppName + " probe --size 100KB", "Time a single set and get of 100KB"},
+		{AppName + " key-expiry-histogram --buckets 1m,1h,inf", "Show how many keys expire within 1m, 1h or later"},
+	}
+
+	for _, e := range examples {
+		fmt.Fprintf(stdout, "    %s%s%s\n        %s%s%s\n",
+			tui.Cyan, e.cmd, tui.Reset,
+			tui.Dim, e.desc, tui.Reset)
+	}
+
+	fmt.Fprintf(stdout, "\n%s%sGLOBAL OPTIONS%s %s(before the command: %s -o json get k, not %s get k -o json)%s\n", tui.Bold, tui.Yellow, tui.Reset, tui.Dim, AppName, AppName, tui.Reset)
+	fmt.Fprintf(stdout, "    %s-H, --host%s      Memcached server host (default: localhost)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s-P, --port%s      Memcached server port (default: 11211)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s-s, --server%s    Server address as host:port; several (comma separated or repeated) form a cluster: key commands go to the server of the key by CRC-32, stats, slabs and keys show every server\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s-t, --timeout%s   Timeout for connecting (default: 10s)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --read-timeout%s Timeout for each read or write (default: same as --timeout)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --max-retries%s Also --retries. Reconnect attempts when the server closes the connection, 500ms apart and doubling (default: 3)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --username%s  SASL username; switches to the binary protocol, which has no keys/cachedump/slabs\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --password%s  SASL password (prefer MEMCACHED_PASSWORD)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --tls%s       Connect over TLS, verifying the server against the system roots\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --tls-ca%s    CA bundle (PEM) to verify the server with instead\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --tls-cert%s  Client certificate (PEM), with --tls-key for its private key\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --tls-insecure%s Skip verifying the server certificate (self-signed test setups only), also --tls-skip-verify\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --dry-run%s   Print write operations instead of executing them\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s-o, --output%s    table (default, also text), json or csv: results as JSON or CSV, errors as JSON on stderr\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --json%s      Same as --output json\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --no-color%s  Disable colors (also off when not writing to a terminal or NO_COLOR is set)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s-i%s              Open an interactive shell (also --interactive)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --help%s      Show this help message\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %s    --version%s   Show version information\n\n", tui.Green, tui.Reset)
+
+	fmt.Fprintf(stdout, "%s%sENVIRONMENT VARIABLES%s\n", tui.Bold, tui.Yellow, tui.Reset)
+	fmt.Fprintf(stdout, "    %sMEMCACHED_HOST%s  Server host (overridden by -H)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %sMEMCACHED_PORT%s  Server port (overridden by -P)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %sMEMCACHED_USERNAME%s  SASL username (overridden by --username)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %sMEMCACHED_PASSWORD%s  SASL password (overridden by --password)\n", tui.Green, tui.Reset)
+	fmt.Fprintf(stdout, "    %sNO_COLOR%s        Disable colors when set to any value\n\n", tui.Green, tui.Reset)
+
+	fmt.Fprintf(stdout, "%sExit status: %d success, %d error, %d precondition not met (add on an existing key)%s\n",
+		tui.Dim, cli.ExitOK, cli.ExitError, cli.ExitPrecondition, tui.Reset)
+	fmt.Fprintf(stdout, "%sDefault connection: localhost:11211%s\n\n", tui.Dim, tui.Reset)
+}
+
+func printVersion() {
+	fmt.Fprintf(stdout, "\n%s%s%s v%s%s\n", tui.Bold, tui.Cyan, AppName, Version, tui.Reset)
+	fmt.Fprintf(stdout, "%sA fast and simple Memcached CLI client%s\n\n", tui.Dim, tui.Reset)
+	fmt.Fprintf(stdout, "  Author:  %s\n", Author)
+	fmt.Fprintf(stdout, "  Repo:    %s%s%s\n\n", tui.Blue, RepoURL, tui.Reset)
+}
+
+// Config holds the connection configuration
+type Config struct {
+	Host        string
+	Port        int
+	Servers     []string      // host:port of each server when -s names more than one
+	Timeout     time.Duration // connect
+	ReadTimeout time.Duration // each read and write
+	MaxRetries  int           // reconnect attempts when the server closes the connection
+	DryRun      bool
+	Output      string // cli.OutputTable, cli.OutputJSON or cli.OutputCSV
+	NoColor     bool
+	Username    string // SASL login, switches to the binary protocol
+	Password    string
+	// TLS encrypts the connection when set. The --tls flags fill it in,
+	// programs using the client can supply their own.
+	TLS *tls.Config
+}
+
+// getDefaultConfig returns default configuration with environment variable overrides
+func getDefaultConfig() Config {
+	cfg := Config{
+		Host:       "localhost",
+		Port:       11211,
+		Timeout:    DefaultTimeout,
+		MaxRetries: DefaultMaxRetries,
+	}
+
+	// Check environment variables
+	if envHost := os.Getenv("MEMCACHED_HOST"); envHost != "" {
+		cfg.Host = envHost
+	}
+	if envPort := os.Getenv("MEMCACHED_PORT"); envPort != "" {
+		if p, err := strconv.Atoi(envPort); err == nil {
+			cfg.Port = p
+		}
+	}
+	cfg.Username = os.Getenv("MEMCACHED_USERNAME")
+	cfg.Password = os.Getenv("MEMCACHED_PASSWORD")
+
+	return cfg
+}
+
+// parseArgs parses command line arguments and returns config, command, and remaining args.
+// argv starts with the program name, like os.Args
+func parseArgs(argv []string) (Config, string, []string) {
+	cfg := getDefaultConfig()
+
+	// Define flags
+	fs := flag.NewFlagSet(AppName, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	// Connection flags
+	hostFlag := fs.String("H", "", "Memcached server host")
+	hostLongFlag := fs.String("host", "", "Memcached server host")
+	portFlag := fs.Int("P", 0, "Memcached server port")
+	portLongFlag := fs.Int("port", 0, "Memcached server port")
+	var servers serverList
+	fs.Var(&servers, "s", "Server address as host:port, several separated by commas")
+	fs.Var(&servers, "server", "Server address as host:port, several separated by commas")
+	timeoutFlag := fs.Duration("timeout", cfg.Timeout, "Timeout for connecting")
+	fs.DurationVar(timeoutFlag, "t", cfg.Timeout, "Shorthand for --timeout")
+	readTimeoutFlag := fs.Duration("read-timeout", 0, "Timeout for each read or write (default: same as --timeout)")
+	maxRetriesFlag := fs.Int("max-retries", cfg.MaxRetries, "Reconnect attempts when the server closes the connection")
+	fs.IntVar(maxRetriesFlag, "retries", cfg.MaxRetries, "Same as --max-retries")
+	usernameFlag := fs.String("username", cfg.Username, "SASL username, uses the binary protocol")
+	passwordFlag := fs.String("password", cfg.Password, "SASL password (prefer MEMCACHED_PASSWORD, arguments are visible to other users)")
+	tlsFlag := fs.Bool("tls", false, "Connect over TLS")
+	tlsCertFlag := fs.String("tls-cert", "", "Client certificate file (PEM), implies --tls")
+	tlsKeyFlag := fs.String("tls-key", "", "Client private key file (PEM), implies --tls")
+	tlsCAFlag := fs.String("tls-ca", "", "CA bundle to verify the server instead of the system roots, implies --tls")
+	tlsInsecureFlag := fs.Bool("tls-insecure", false, "Do not verify the server certificate, implies --tls")
+	fs.BoolVar(tlsInsecureFlag, "tls-skip-verify", false, "Same as --tls-insecure")
+	dryRunFlag := fs.Bool("dry-run", false, "Print write operations instead of executing them")
+	outputFlag := fs.String("output", cli.OutputTable, "Output format: table, json or csv")
+	fs.StringVar(outputFlag, "o", cli.OutputTable, "Shorthand for --output")
+	jsonFlag := fs.Bool("json", false, "Same as --output json")
+	noColorFlag := fs.Bool("no-color", false, "Disable colored output")
+	interactiveFlag := fs.Bool("i", false, "Open an interactive shell")
+	interactiveLongFlag := fs.Bool("interactive", false, "Open an interactive shell")
+
+	// Help/version flags
+	helpFlag := fs.Bool("help", false, "Show help message")
+	versionFlag := fs.Bool("version", false, "Show version")
+
+	// Find the first non-flag argument (command)
+	var commandIdx int
+	for i := 1; i < len(argv); i++ {
+		arg := argv[i]
+		if !strings.HasPrefix(arg, "-") {
+			commandIdx = i
+			break
+		}
+		// Skip the value of flags that take arguments
+		if arg == "-H" || arg == "-P" || arg == "-s" || arg == "-o" || arg == "-t" ||
+			arg == "--host" || arg == "--port" || arg == "--server" || arg == "--output" || arg == "--timeout" ||
+			arg == "--read-timeout" || arg == "--max-retries" || arg == "--retries" ||
+			arg == "--tls-cert" || arg == "--tls-key" || arg == "--tls-ca" ||
+			arg == "--username" || arg == "--password" {
+			i++ // skip next argument (the value)
+		}
+	}
+
+	// Parse flags before the command
+	if commandIdx > 1 {
+		if err := fs.Parse(argv[1:commandIdx]); err != nil {
+			if err == flag.ErrHelp {
+				printUsage()
+				cli.Exit(cli.ExitOK)
+			}
+			cli.Exit(cli.ExitError)
+		}
+	} else if commandIdx == 0 {
+		// No command found, parse all args as flags
+		if err := fs.Parse(argv[1:]); err != nil {
+			if err == flag.ErrHelp {
+				printUsage()
+				cli.Exit(cli.ExitOK)
+			}
+			cli.Exit(cli.ExitError)
+		}
+	}
+
+	// Check help/version flags
+	if *helpFlag {
+		printUsage()
+		cli.Exit(cli.ExitOK)
+	}
+	if *versionFlag {
+		printVersion()
+		cli.Exit(cli.ExitOK)
+	}
+
+	// Apply server flag (host:port combined)
+	if len(servers) == 1 {
+		serverAddr := servers[0]
+		host, portStr, err := net.SplitHostPort(serverAddr)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Invalid server address: %s", serverAddr))
+			cli.Exit(cli.ExitError)
+		}
+		cfg.Host = host
+		if p, err := strconv.Atoi(portStr); err == nil {
+			cfg.Port = p
+		}
+	}
+
+	// Apply individual host/port flags (override server flag)
+	if *hostFlag != "" {
+		cfg.Host = *hostFlag
+	}
+	if *hostLongFlag != "" {
+		cfg.Host = *hostLongFlag
+	}
+	if *portFlag != 0 {
+		cfg.Port = *portFlag
+	}
+	if *portLongFlag != 0 {
+		cfg.Port = *portLongFlag
+	}
+	if len(servers) > 1 {
+		for _, node := range servers {
+			cfg.Servers = append(cfg.Servers, serverAddress(node, cfg.Port))
+		}
+	}
+
+	if *timeoutFlag <= 0 {
+		ui.Error(fmt.Sprintf("Invalid timeout: %s (must be positive)", *timeoutFlag))
+		cli.Exit(cli.ExitError)
+	}
+	cfg.Timeout = *timeoutFlag
+	cfg.ReadTimeout = *readTimeoutFlag
+	if cfg.ReadTimeout < 0 {
+		ui.Error(fmt.Sprintf("Invalid read timeout: %s (must be positive)", cfg.ReadTimeout))
+		cli.Exit(cli.ExitError)
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = cfg.Timeout
+	}
+	if *maxRetriesFlag < 0 {
+		ui.Error(fmt.Sprintf("Invalid --max-retries: %d (use 0 to disable reconnecting)", *maxRetriesFlag))
+		cli.Exit(cli.ExitError)
+	}
+	cfg.MaxRetries = *maxRetriesFlag
+	cfg.Username, cfg.Password = *usernameFlag, *passwordFlag
+	if *tlsFlag || *tlsCertFlag != "" || *tlsKeyFlag != "" || *tlsCAFlag != "" || *tlsInsecureFlag {
+		tlsConfig, err := loadTLSConfig(*tlsCertFlag, *tlsKeyFlag, *tlsCAFlag, *tlsInsecureFlag)
+		if err != nil {
+			ui.Error(err.Error())
+			cli.Exit(cli.ExitError)
+		}
+		cfg.TLS = tlsConfig
+	}
+	cfg.DryRun = *dryRunFlag
+	cfg.NoColor = *noColorFlag
+	output, err := cli.ParseOutput(*outputFlag)
+	if err != nil {
+		ui.Error(err.Error())
+		cli.Exit(cli.ExitError)
+	}
+	if *jsonFlag && output == cli.OutputTable {
+		output = cli.OutputJSON
+	}
+	cfg.Output = output
+
+	// Get command and remaining args
+	var command string
+	var args []string
+	if commandIdx > 0 && commandIdx < len(argv) {
+		command = argv[commandIdx]
+		args = argv[commandIdx+1:]
+	}
+	if command == "" && (*interactiveFlag || *interactiveLongFlag) {
+		command = "shell"
+	}
+
+	return cfg, command, args
+}
+
+// Run executes memcc with the command line args (without the program name),
+// writing to stdout and stderr, and returns the exit code
+func Run(args []string, out, errOut io.Writer) (code int) {
+	defer cli.Recover(&code)
+	stdout, stderr = out, errOut
+	resultOut, resultCSV = nil, false
+	ui = tui.NewPrinter(stdout)
+	tui.SetColor(tui.ColorSupported(stdout))
+
+	cfg, command, args := parseArgs(append([]string{AppName}, args...))
+	if cfg.NoColor {
+		tui.SetColor(false)
+	}
+
+	// Handle no command
+	if command == "" {
+		printUsage()
+		return
+	}
+
+	// Handle help and version commands
+	switch command {
+	case "help":
+		printUsage()
+		return
+	case "version":
+		printVersion()
+		return
+	}
+
+	// With JSON or CSV output only the result goes to stdout, errors go to
+	// stderr as JSON
+	if cfg.Output != cli.OutputTable {
+		resultOut, stdout = stdout, io.Discard
+		resultCSV = cfg.Output == cli.OutputCSV
+		ui = tui.NewJSONPrinter(stderr)
+		tui.SetColor(false)
+		if textOnlyCommands[command] {
+			ui.Error(fmt.Sprintf("%s has no %s output", command, strings.ToUpper(cfg.Output)))
+			cli.Exit(cli.ExitError)
+		}
+	}
+
+	if command == "check" {
+		runCheck(cfg, args)
+		return
+	}
+	if len(cfg.Servers) > 1 {
+		runMulti(cfg, command, args)
+		return
+	}
+
+	// Create Memcached client
+	client, err := Connect(cfg)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Failed to connect: %v", err))
+		cli.Exit(cli.ExitError)
+	}
+	defer client.Close()
+
+	// Commands used from shell scripts write raw output, keep it free of status lines
+	if !rawOutput(command, args) {
+		ui.Info(fmt.Sprintf("Connected to %s:%d", client.host, client.port))
+		if cfg.DryRun {
+			ui.Warning("Dry run: write operations will not be sent to the server")
+		}
+	}
+
+	if command == "shell" {
+		runShell(client, cfg)
+		return
+	}
+	runCommand(client, cfg, command, args)
+	return cli.ExitOK
+}
+
+// runCommand executes one command on an open connection. Failures are
+// reported through cli.Exit.
+func runCommand(client *MemcachedClient, cfg Config, command string, args []string) {
+	switch command {
+	case "keys":
+		fs := newFlagSet(command)
+		withValues := fs.Bool("values", false, "Show the value of each key")
+		redact := fs.Bool("redact", false, "Show value length and hash instead of the value")
+		rest, err := cli.ParseInterspersed(fs, args)
+		if err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		if len(rest) < 1 {
+			ui.Error("Missing pattern argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] keys <pattern> [--values [--redact]]%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		pattern := rest[0]
+		keys, err := client.GetKeys(pattern)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get keys: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			if !*withValues {
+				printResult(append([]string{}, keys...))
+				break
+			}
+			results := []getResult{}
+			for _, key := range keys {
+				value, found, err := client.Lookup(key)
+				if err != nil {
+					ui.Error(fmt.Sprintf("Failed to get '%s': %v", key, err))
+					cli.Exit(cli.ExitError)
+				}
+				results = append(results, newGetResult(key, value, found, *redact))
+			}
+			printResult(results)
+			break
+		}
+		if len(keys) == 0 {
+			ui.Warning("No matching keys found")
+		} else {
+			ui.Header(fmt.Sprintf("Keys matching '%s'", pattern))
+			for i, key := range keys {
+				if !*withValues {
+					fmt.Fprintf(stdout, "  %s%3d.%s %s\n", tui.Dim, i+1, tui.Reset, key)
+					continue
+				}
+				value, found, err := client.Lookup(key)
+				switch {
+				case err != nil:
+					value = fmt.Sprintf("%s(error: %v)%s", tui.Red, err, tui.Reset)
+				case !found:
+					value = tui.Dim + "(expired)" + tui.Reset
+				case *redact:
+					value = redactValue(value)
+				}
+				fmt.Fprintf(stdout, "  %s%3d.%s %s %s=%s %s\n", tui.Dim, i+1, tui.Reset, key, tui.Dim, tui.Reset, value)
+			}
+			fmt.Fprintf(stdout, "\n%s%s Total: %d keys%s\n", tui.Dim, tui.Cyan, len(keys), tui.Reset)
+		}
+
+	case "dump-tree":
+		fs := newFlagSet(command)
+		maxKeys := fs.Int("max-keys", 10000, "Maximum number of keys to write (0 for no limit)")
+		rest, err := cli.ParseInterspersed(fs, args)
+		if err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		if len(rest) < 2 {
+			ui.Error("Missing pattern or directory argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] dump-tree <pattern> <dir> [--max-keys N]%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		pattern, dir := rest[0], filepath.Clean(rest[1])
+
+		keys, err := client.GetKeys(pattern)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get keys: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		sort.Strings(keys)
+		if *maxKeys > 0 && len(keys) > *maxKeys {
+			ui.Warning(fmt.Sprintf("%d keys match, writing only the first %d (--max-keys)", len(keys), *maxKeys))
+			keys = keys[:*maxKeys]
+		}
+
+		written, missing, failed := 0, 0, 0
+		var totalBytes int64
+		for _, key := range keys {
+			path, err := keyPath(dir, key)
+			if err == nil {
+				var value string
+				var found bool
+				value, found, err = client.Lookup(key)
+				if err == nil && !found {
+					// expired or evicted since the key listing
+					missing++
+					continue
+				}
+				if err == nil {
+					err = os.MkdirAll(filepath.Dir(path), 0755)
+				}
+				if err == nil {
+					err = os.WriteFile(path, []byte(value), 0644)
+				}
+				if err == nil {
+					written++
+					totalBytes += int64(len(value))
+					continue
+				}
+			}
+			ui.Error(fmt.Sprintf("Failed to dump '%s': %v", key, err))
+			failed++
+		}
+
+		if resultOut != nil {
+			printResult(countResult{Command: command, Dir: dir, Written: written, Bytes: totalBytes, Missing: missing, Failed: failed})
+		}
+		ui.Success(fmt.Sprintf("Wrote %d files (%d bytes) under %s", written, totalBytes, dir))
+		if missing > 0 {
+			ui.Warning(fmt.Sprintf("%d keys disappeared before they could be read", missing))
+		}
+		if failed > 0 {
+			cli.Exit(cli.ExitError)
+		}
+
+	case "get":
+		fs := newFlagSet(command)
+		defaultValue := fs.String("default", "", "Print this value (raw) instead of failing on a miss")
+		onMiss := fs.String("on-miss", "", "Action on a miss: 'set' stores the --default value")
+		ttl := fs.Int("ttl", 0, "Expiry in seconds for the value stored by --on-miss set")
+		redact := fs.Bool("redact", false, "Show value length and hash instead of the value")
+		outputFile := fs.String("out-file", "", "Write the raw value to this file instead of printing it")
+		fs.StringVar(outputFile, "output", "", "Same as --out-file, kept for older scripts")
+		rest, err := cli.ParseInterspersed(fs, args)
+		if err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		// "get k --output json" meant the global flag, which goes before
+		// the command: do not write a file named json
+		if _, err := cli.ParseOutput(*outputFile); err == nil && cli.FlagPassed(fs, "output") {
+			ui.Error(fmt.Sprintf("get --output %s would write a file named %s: put the global -o %s before the command, or use --out-file", *outputFile, *outputFile, *outputFile))
+			cli.Exit(cli.ExitError)
+		}
+		if len(rest) < 1 {
+			ui.Error("Missing key argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] get <key...> [--default V [--on-miss set [--ttl N]]]%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		hasDefault := cli.FlagPassed(fs, "default")
+		if *onMiss != "" && (*onMiss != "set" || !hasDefault) {
+			ui.Error("--on-miss only supports 'set' and requires --default")
+			cli.Exit(cli.ExitError)
+		}
+		if hasDefault && len(rest) > 1 {
+			ui.Error("--default only works with a single key")
+			cli.Exit(cli.ExitError)
+		}
+		if *outputFile != "" && (hasDefault || len(rest) > 1) {
+			ui.Error("--out-file only works with a single key and without --default")
+			cli.Exit(cli.ExitError)
+		}
+
+		if len(rest) > 1 {
+			values, err := client.GetMulti(rest)
+			if err != nil {
+				ui.Error(fmt.Sprintf("Failed to get values: %v", err))
+				cli.Exit(cli.ExitError)
+			}
+			if resultOut != nil {
+				printMultiGetJSON(rest, values, *redact)
+				break
+			}
+			ui.Header(fmt.Sprintf("Values for %d keys", len(rest)))
+			missing := 0
+			for i, key := range rest {
+				value, found := values[key]
+				switch {
+				case !found:
+					missing++
+					value = tui.Yellow + "(miss)" + tui.Reset
+				case *redact:
+					value = redactValue(value)
+				case isBinary(value):
+					value = fmt.Sprintf("%s(binary, %d bytes)%s", tui.Dim, len(value), tui.Reset)
+				}
+				fmt.Fprintf(stdout, "  %s%3d.%s %s %s=%s %s\n", tui.Dim, i+1, tui.Reset, key, tui.Dim, tui.Reset, value)
+			}
+			fmt.Fprintf(stdout, "\n%s%s Total: %d found, %d missing%s\n", tui.Dim, tui.Cyan, len(rest)-missing, missing, tui.Reset)
+			break
+		}
+
+		key := rest[0]
+		value, found, err := client.Lookup(key)
+		if err != nil {
+			if hasDefault {
+				fmt.Fprintf(stderr, "%s: failed to get value: %v\n", AppName, err)
+			} else {
+				ui.Error(fmt.Sprintf("Failed to get value: %v", err))
+			}
+			cli.Exit(cli.ExitError)
+		}
+
+		// With --default the output is the bare value, suitable for $(...)
+		if hasDefault {
+			if !found {
+				value = *defaultValue
+				if *onMiss == "set" {
+					if err := client.Set(key, value, *ttl); err != nil {
+						fmt.Fprintf(stderr, "%s: failed to store default: %v\n", AppName, err)
+					}
+				}
+			}
+			if resultOut != nil {
+				// On a miss the value is the --default one
+				printResult(newGetResult(key, value, found, *redact))
+				break
+			}
+			if found && *redact {
+				value = redactValue(value)
+			}
+			fmt.Fprintln(stdout, value)
+			break
+		}
+
+		switch {
+		case !found:
+			ui.Warning(fmt.Sprintf("Key '%s' not found", key))
+		case *outputFile != "":
+			if err := os.WriteFile(*outputFile, []byte(value), 0644); err != nil {
+				ui.Error(fmt.Sprintf("Failed to write %s: %v", *outputFile, err))
+				cli.Exit(cli.ExitError)
+			}
+			ui.Success(fmt.Sprintf("Wrote %d bytes to %s", len(value), *outputFile))
+		case *redact:
+			ui.Header(fmt.Sprintf("Value for '%s'", key))
+			fmt.Fprintf(stdout, "\n%s\n\n", redactValue(value))
+			ui.Success(fmt.Sprintf("Retrieved %d bytes", len(value)))
+		case isBinary(value):
+			// Raw control bytes would garble the terminal
+			ui.Header(fmt.Sprintf("Value for '%s' (hex dump)", key))
+			fmt.Fprintf(stdout, "\n%s\n", hex.Dump([]byte(value)))
+			ui.Success(fmt.Sprintf("Retrieved %d bytes of binary data, use --out-file <file> to save them", len(value)))
+		default:
+			ui.Header(fmt.Sprintf("Value for '%s'", key))
+			fmt.Fprintf(stdout, "\n%s\n\n", value)
+			ui.Success(fmt.Sprintf("Retrieved %d bytes", len(value)))
+		}
+		if resultOut != nil {
+			printResult(newGetResult(key, value, found, *redact))
+		}
+
+	case "set":
+		fs := newFlagSet(command)
+		ifChanged := fs.Bool("if-changed", false, "Skip the write if the key already holds this value")
+		fromFile := fs.String("from-file", "", "Read the value from a file instead of the command line")
+		keepTTL := fs.Bool("keep-ttl", false, "Keep the TTL the key has left (memcached 1.6+)")
+		// Values may start with "-", e.g. "set k -5"
+		args, err := cli.ParseInterspersedValues(fs, args)
+		if err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		// The value is the second argument unless it comes from a file
+		valueArgs := 2
+		if *fromFile != "" {
+			valueArgs = 1
+		}
+		if len(args) < valueArgs {
+			ui.Error("Missing key or value argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] set <key> <value|-> [expiry|--keep-ttl] [--if-changed] [--from-file F]%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		key := args[0]
+		source := *fromFile
+		if source == "" && args[1] == "-" {
+			source = "-"
+		}
+		var value string
+		if source == "" {
+			value = args[1]
+		} else if value, err = readValue(source); err != nil {
+			ui.Error(fmt.Sprintf("Failed to read value: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		expTime := 0
+		if len(args) > valueArgs {
+			if *keepTTL {
+				ui.Error("--keep-ttl cannot be combined with an expiry")
+				cli.Exit(cli.ExitError)
+			}
+			expTime, _ = strconv.Atoi(args[valueArgs])
+		}
+		if *keepTTL {
+			if expTime, err = client.keptExpiry(key); err != nil {
+				ui.Error(fmt.Sprintf("Failed to read the TTL of '%s': %v", key, err))
+				cli.Exit(cli.ExitError)
+			}
+		}
+		written := true
+		if *ifChanged {
+			written, err = client.SetIfChanged(key, value, expTime)
+		} else {
+			err = client.Set(key, value, expTime)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to set value: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printResult(writeResult{Command: command, Key: key, OK: true, Unchanged: !written, DryRun: cfg.DryRun})
+			break
+		}
+		if !written {
+			ui.Info(fmt.Sprintf("Unchanged '%s' (value already matches, not written, TTL kept)", key))
+			break
+		}
+		ttlMsg := "no expiration"
+		switch {
+		case *keepTTL && expTime > 0:
+			ttlMsg = "TTL kept"
+		case expTime > 0:
+			ttlMsg = fmt.Sprintf("TTL: %ds", expTime)
+		}
+		if source != "" {
+			ui.Success(fmt.Sprintf("Set '%s' to %d bytes from %s (%s)", key, len(value), valueSourceName(source), ttlMsg))
+			break
+		}
+		ui.Success(fmt.Sprintf("Set '%s' = '%s' (%s)", key, value, ttlMsg))
+
+	case "gets":
+		if len(args) < 1 {
+			ui.Error("Missing key argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] gets <key>%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		key := args[0]
+		value, flags, casToken, err := client.Gets(key)
+		if errors.Is(err, ErrNotFound) {
+			ui.Warning(fmt.Sprintf("Key '%s' not found", key))
+			if resultOut != nil {
+				printResult(getsResult{getResult: newGetResult(key, "", false, false)})
+			}
+			break
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get value: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printResult(getsResult{getResult: newGetResult(key, value, true, false), Flags: flags, CAS: casToken})
+			break
+		}
+		ui.Header(fmt.Sprintf("Value for '%s'", key))
+		fmt.Fprintf(stdout, "\n%s\n\n", value)
+		ui.Success(fmt.Sprintf("Retrieved %d bytes, flags %d, CAS token %d", len(value), flags, casToken))
+
+	case "cas":
+		fs := newFlagSet(command)
+		flags := fs.Uint("flags", 0, "Client flags to store with the value")
+		args, err := cli.ParseInterspersed(fs, args)
+		if err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		if len(args) < 3 {
+			ui.Error("Missing key, value or CAS token argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] cas <key> <value> <cas_token> [expiry] [--flags N]%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		if *flags > math.MaxUint32 {
+			ui.Error(fmt.Sprintf("Invalid flags: %d (must fit in 32 bits)", *flags))
+			cli.Exit(cli.ExitError)
+		}
+		key, value := args[0], args[1]
+		casToken, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Invalid CAS token: %s", args[2]))
+			cli.Exit(cli.ExitError)
+		}
+		expTime := 0
+		if len(args) > 3 {
+			expTime, _ = strconv.Atoi(args[3])
+		}
+		switch err := client.Cas(key, value, uint32(*flags), expTime, casToken); {
+		case errors.Is(err, ErrCasConflict):
+			ui.Error(fmt.Sprintf("Key '%s' not written: value was modified since the CAS token was read", key))
+			cli.Exit(cli.ExitError)
+		case errors.Is(err, ErrNotFound):
+			ui.Error(fmt.Sprintf("Key '%s' not found", key))
+			cli.Exit(cli.ExitError)
+		case err != nil:
+			ui.Error(fmt.Sprintf("Failed to cas value: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult(command, key, cfg.DryRun)
+			break
+		}
+		ui.Success(fmt.Sprintf("Set '%s' = '%s' (CAS token matched)", key, value))
+
+	case "purge":
+		runPurge(client, cfg, args)
+
+	case "flush":
+		fs := newFlagSet(command)
+		yes := fs.Bool("yes", false, "Do not ask for confirmation")
+		fs.BoolVar(yes, "y", false, "Shorthand for --yes")
+		args, err := cli.ParseInterspersed(fs, args)
+		if err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		delay := 0
+		if len(args) > 0 {
+			if delay, err = strconv.Atoi(args[0]); err != nil || delay < 0 {
+				ui.Error(fmt.Sprintf("Invalid delay: %s (must be a number of seconds)", args[0]))
+				cli.Exit(cli.ExitError)
+			}
+		}
+		target := fmt.Sprintf("%s:%d", client.host, client.port)
+		if resultOut != nil && !*yes && !cfg.DryRun {
+			ui.Error(fmt.Sprintf("flush with --output %s needs --yes, the confirmation prompt is not shown", cfg.Output))
+			cli.Exit(cli.ExitError)
+		}
+		if !*yes && !cfg.DryRun {
+			when := "now"
+			if delay > 0 {
+				when = fmt.Sprintf("in %ds", delay)
+			}
+			ui.Warning(fmt.Sprintf("This will invalidate every item on %s %s", target, when))
+			if !confirm("Are you sure?") {
+				ui.Info("Aborted, nothing flushed")
+				cli.Exit(cli.ExitError)
+			}
+		}
+		if err := client.FlushAll(delay); err != nil {
+			ui.Error(fmt.Sprintf("Failed to flush: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult(command, "", cfg.DryRun)
+			break
+		}
+		if cfg.DryRun {
+			break
+		}
+		if delay > 0 {
+			ui.Success(fmt.Sprintf("All keys on %s will expire in %ds", target, delay))
+		} else {
+			ui.Success(fmt.Sprintf("Flushed all items on %s", target))
+		}
+
+	case "add", "replace":
+		if len(args) < 2 {
+			ui.Error("Missing key or value argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] %s <key> <value> [expiry]%s\n", tui.Dim, AppName, command, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		key, value := args[0], args[1]
+		expTime := 0
+		if len(args) > 2 {
+			expTime, _ = strconv.Atoi(args[2])
+		}
+		var err error
+		if command == "add" {
+			err = client.Add(key, value, expTime)
+		} else {
+			err = client.Replace(key, value, expTime)
+		}
+		if errors.Is(err, ErrNotStored) {
+			// Not a failure for warm-up scripts, but still tell them apart from a write
+			ui.Warning(fmt.Sprintf("Key '%s' already exists, not added", key))
+			if resultOut != nil {
+				printResult(writeResult{Command: command, Key: key})
+			}
+			cli.Exit(cli.ExitPrecondition)
+		}
+		if errors.Is(err, ErrNotFound) {
+			ui.Error(fmt.Sprintf("Key '%s' not found, nothing to replace", key))
+			cli.Exit(cli.ExitError)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to %s value: %v", command, err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult(command, key, cfg.DryRun)
+			break
+		}
+		if cfg.DryRun {
+			break
+		}
+		ttlMsg := "no expiration"
+		if expTime > 0 {
+			ttlMsg = fmt.Sprintf("TTL: %ds", expTime)
+		}
+		ui.Success(fmt.Sprintf("Set '%s' = '%s' (%s)", key, value, ttlMsg))
+
+	case "append", "prepend":
+		if len(args) < 2 {
+			ui.Error("Missing key or value argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] %s <key> <value>%s\n", tui.Dim, AppName, command, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		if len(args) > 2 {
+			ui.Error(fmt.Sprintf("%s does not take an expiry, the item keeps its TTL", command))
+			cli.Exit(cli.ExitError)
+		}
+		key, value := args[0], args[1]
+		var err error
+		done := "Appended"
+		if command == "append" {
+			err = client.Append(key, value)
+		} else {
+			err = client.Prepend(key, value)
+			done = "Prepended"
+		}
+		if errors.Is(err, ErrNotStored) {
+			ui.Error(fmt.Sprintf("Key '%s' not found, %s only extends an existing value (use set first)", key, command))
+			cli.Exit(cli.ExitError)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to %s value: %v", command, err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult(command, key, cfg.DryRun)
+			break
+		}
+		if !cfg.DryRun {
+			ui.Success(fmt.Sprintf("%s '%s' to '%s'", done, value, key))
+		}
+
+	case "incr", "decr":
+		if len(args) < 1 {
+			ui.Error("Missing key argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] %s <key> [delta]%s\n", tui.Dim, AppName, command, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		key := args[0]
+		delta := uint64(1)
+		if len(args) > 1 {
+			var err error
+			if delta, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				ui.Error(fmt.Sprintf("Invalid delta: %s (must be a non-negative integer)", args[1]))
+				cli.Exit(cli.ExitError)
+			}
+		}
+		var value uint64
+		var err error
+		if command == "incr" {
+			value, err = client.Increment(key, delta)
+		} else {
+			value, err = client.Decrement(key, delta)
+		}
+		if errors.Is(err, ErrNotFound) {
+			ui.Error(fmt.Sprintf("Key '%s' not found", key))
+			cli.Exit(cli.ExitError)
+		}
+		if errors.Is(err, ErrNotNumeric) {
+			ui.Error(fmt.Sprintf("Key '%s' does not hold a number, cannot %s it", key, command))
+			cli.Exit(cli.ExitError)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to %s value: %v", command, err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			result := writeResult{Command: command, Key: key, OK: true, DryRun: cfg.DryRun}
+			if !cfg.DryRun {
+				result.Value = &value
+			}
+			printResult(result)
+			break
+		}
+		if !cfg.DryRun {
+			ui.Success(fmt.Sprintf("'%s' is now %d", key, value))
+		}
+
+	case "touch":
+		if len(args) < 2 {
+			ui.Error("Missing key or expiry argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] touch <key> <expiry>%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		key := args[0]
+		expTime, err := strconv.Atoi(args[1])
+		if err != nil {
+			ui.Error(fmt.Sprintf("Invalid expiry: %s (must be a number of seconds)", args[1]))
+			cli.Exit(cli.ExitError)
+		}
+		err = client.Touch(key, expTime)
+		if errors.Is(err, ErrNotFound) {
+			ui.Error(fmt.Sprintf("Key '%s' not found", key))
+			cli.Exit(cli.ExitError)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to touch key: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult(command, key, cfg.DryRun)
+			break
+		}
+		if cfg.DryRun {
+			break
+		}
+		ttlMsg := "no expiration"
+		if expTime > 0 {
+			ttlMsg = fmt.Sprintf("TTL: %ds", expTime)
+		}
+		ui.Success(fmt.Sprintf("Touched '%s' (%s)", key, ttlMsg))
+
+	case "mget":
+		if len(args) < 1 {
+			ui.Error("Missing key argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] mget <key...>%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		values, err := client.GetMulti(args)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get values: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printMultiGetJSON(args, values, false)
+			break
+		}
+		printMultiGet(args, values)
+
+	case "delete", "del", "rm":
+		if len(args) < 1 {
+			ui.Error("Missing key argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] delete <key>%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		key := args[0]
+		err := client.Delete(key)
+		if errors.Is(err, ErrNotFound) {
+			ui.Error(fmt.Sprintf("Key '%s' not found", key))
+			cli.Exit(cli.ExitError)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to delete key: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult("delete", key, cfg.DryRun)
+			break
+		}
+		ui.Success(fmt.Sprintf("Deleted key '%s'", key))
+
+	case "stats", "watch":
+		fs := newFlagSet(command)
+		watchSpec := fs.String("watch", "", "Redraw the statistics every interval, e.g. 2s")
+		fs.StringVar(watchSpec, "w", "", "Shorthand for --watch")
+		if command == "watch" {
+			fs.StringVar(watchSpec, "interval", "2s", "Poll interval")
+		}
+		output := fs.String("output", "", "prometheus: print the stats in the Prometheus text format")
+		fs.StringVar(output, "o", "", "Shorthand for --output")
+		rest, err := cli.ParseInterspersed(fs, args)
+		if err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		statType := ""
+		if len(rest) > 0 {
+			statType = rest[0]
+		}
+		switch {
+		case *output == "" || *output == "text":
+		case *output != "prometheus":
+			ui.Error(fmt.Sprintf("Invalid stats output format: %s (use prometheus; the global -o json or -o csv goes before the command)", *output))
+			cli.Exit(cli.ExitError)
+		case *watchSpec != "" || resultOut != nil:
+			ui.Error("--output prometheus cannot be combined with --watch or JSON and CSV output")
+			cli.Exit(cli.ExitError)
+		}
+		if *watchSpec != "" && resultCSV {
+			ui.Error("--watch has no CSV output, use --output json for one line of JSON per poll")
+			cli.Exit(cli.ExitError)
+		}
+		if *watchSpec != "" {
+			interval, err := parseInterval(*watchSpec)
+			if err != nil {
+				ui.Error(err.Error())
+				cli.Exit(cli.ExitError)
+			}
+			runWatch(client, statType, interval)
+			break
+		}
+		stats, err := client.Statistics(statType)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get statistics: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printResult(stats)
+			break
+		}
+		if *output == "prometheus" {
+			printPrometheus(stdout, stats)
+			break
+		}
+		printStatistics(stats)
+
+	case "cachedump", "dump":
+		if len(args) < 1 {
+			ui.Error("Missing slab ID argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] cachedump <slab_id> [limit]%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		slabID := args[0]
+		limit := 0
+		if len(args) > 1 {
+			limit, _ = strconv.Atoi(args[1])
+		}
+		items, err := client.CacheDump(slabID, limit)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to dump cache: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printResult(append([]CacheItem{}, items...))
+			break
+		}
+		printCacheDump(items)
+
+	case "probe":
+		fs := newFlagSet(command)
+		sizeSpec := fs.String("size", "1KB", "Payload size in bytes (accepts KB/MB)")
+		if err := fs.Parse(args); err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		size, err := parseByteSize(*sizeSpec)
+		if err != nil {
+			ui.Error(err.Error())
+			cli.Exit(cli.ExitError)
+		}
+		if client.dryRun {
+			client.logDryRun("set", AppName+":probe:<random>", fmt.Sprintf("<%d random bytes>", size))
+			return
+		}
+
+		result, err := probe(client, size)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Probe failed: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printResult(result)
+		}
+
+		ui.Header(fmt.Sprintf("Probe (%d bytes)", result.Size))
+		widths := []int{12, 15}
+		ui.TableHeader([]string{"Operation", "Latency"}, widths)
+		ui.TableRow([]string{"set", result.SetTime.String()}, widths)
+		ui.TableRow([]string{"get", result.GetTime.String()}, widths)
+		ui.TableFooter(widths)
+		fmt.Fprintf(stdout, "\n%s%s Key: %s (deleted)%s\n", tui.Dim, tui.Cyan, result.Key, tui.Reset)
+
+		if !result.Intact {
+			ui.Error("Round-trip integrity check failed: value read back differs from value written")
+			cli.Exit(cli.ExitError)
+		}
+		ui.Success("Round-trip integrity verified")
+
+	case "capabilities", "caps":
+		if resultOut != nil {
+			printResult(newCapabilitiesJSON(client.Capabilities()))
+			break
+		}
+		printCapabilities(client.Capabilities())
+
+	case "config-dump":
+		settings, err := client.Statistics("settings")
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get settings: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		source := net.JoinHostPort(client.host, strconv.Itoa(client.port))
+		fmt.Fprint(stdout, configScript(settings, source, client.Capabilities()))
+
+	case "memlimit", "verbosity", "automove":
+		if len(args) < 1 {
+			ui.Error("Missing value argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] %s <value>%s\n", tui.Dim, AppName, command, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		value, err := strconv.Atoi(args[0])
+		if err != nil || value < 0 {
+			ui.Error(fmt.Sprintf("Invalid value: %s", args[0]))
+			cli.Exit(cli.ExitError)
+		}
+		switch command {
+		case "memlimit":
+			err = client.SetMemLimit(value)
+		case "verbosity":
+			err = client.SetVerbosity(value)
+		case "automove":
+			err = client.SetSlabAutomove(value)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to set %s: %v", command, err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult(command, "", cfg.DryRun)
+			break
+		}
+		ui.Success(fmt.Sprintf("Set %s to %d", command, value))
+
+	case "lru-crawler":
+		if len(args) < 1 {
+			ui.Error("Missing crawler argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] lru-crawler <enable|disable|sleep N|tocrawl N>%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		if err := client.LRUCrawler(args...); err != nil {
+			ui.Error(fmt.Sprintf("Failed to update LRU crawler: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printWriteResult(command, "", cfg.DryRun)
+			break
+		}
+		ui.Success(fmt.Sprintf("LRU crawler: %s", strings.Join(args, " ")))
+
+	case "load":
+		fs := newFlagSet(command)
+		fromJSON := fs.String("from-json", "", "Load keys from a JSON object file")
+		ttl := fs.Int("ttl", 0, "Expiry in seconds for every loaded key")
+		if err := fs.Parse(args); err != nil {
+			cli.Exit(cli.ExitError)
+		}
+
+		var entries []loadEntry
+		var err error
+		source := *fromJSON
+		if source != "" {
+			entries, err = readJSONEntries(source)
+		} else if fs.NArg() > 0 {
+			source = fs.Arg(0)
+			entries, err = readTSVEntries(source)
+		} else {
+			ui.Error("Missing file argument")
+			fmt.Fprintf(stdout, "\n%sUsage: %s [options] load [--ttl N] <file.tsv> | --from-json <file>%s\n", tui.Dim, AppName, tui.Reset)
+			cli.Exit(cli.ExitError)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to read %s: %v", source, err))
+			cli.Exit(cli.ExitError)
+		}
+
+		failed := 0
+		for _, entry := range entries {
+			if err := client.Set(entry.Key, entry.Value, *ttl); err != nil {
+				ui.Error(fmt.Sprintf("Failed to set '%s': %v", entry.Key, err))
+				failed++
+			}
+		}
+		if resultOut != nil {
+			printResult(countResult{Command: command, Source: source, Written: len(entries) - failed, Failed: failed})
+		}
+		if failed > 0 {
+			ui.Warning(fmt.Sprintf("Loaded %d of %d keys from %s", len(entries)-failed, len(entries), source))
+			cli.Exit(cli.ExitError)
+		}
+		ui.Success(fmt.Sprintf("Loaded %d keys from %s", len(entries), source))
+
+	case "slabs":
+		slabs, err := client.GetAllSlabs()
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get slab IDs: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			printResult(append([]string{}, slabs...))
+			break
+		}
+		if len(slabs) == 0 {
+			ui.Warning("No slabs found")
+		} else {
+			ui.Header("Slab IDs")
+			for i, slabID := range slabs {
+				fmt.Fprintf(stdout, "  %s%3d.%s Slab %s%s%s\n", tui.Dim, i+1, tui.Reset, tui.Green, slabID, tui.Reset)
+			}
+			fmt.Fprintf(stdout, "\n%s%s Total: %d slabs%s\n", tui.Dim, tui.Cyan, len(slabs), tui.Reset)
+		}
+
+	case "balance":
+		fs := newFlagSet(command)
+		fullRatio := fs.Float64("full", 0.95, "Chunk usage at or above which a slab class counts as full")
+		idleRatio := fs.Float64("idle", 0.5, "Chunk usage below which a slab class counts as underused")
+		if err := fs.Parse(args); err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		if *idleRatio <= 0 || *idleRatio >= *fullRatio || *fullRatio > 1 {
+			ui.Error("Thresholds must satisfy 0 < --idle < --full <= 1")
+			cli.Exit(cli.ExitError)
+		}
+
+		slabStats, err := client.Statistics("slabs")
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get slab statistics: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		itemStats, err := client.Statistics("items")
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get item statistics: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		usage := parseSlabUsage(slabStats, itemStats)
+		balance := checkSlabBalance(usage, *fullRatio, *idleRatio)
+		if resultOut != nil {
+			printResult(newBalanceJSON(append([]slabUsage{}, usage...), balance))
+			break
+		}
+		if len(usage) == 0 {
+			ui.Warning("No slabs found")
+			return
+		}
+
+		ui.Header("Slab Balance")
+		widths := []int{6, 10, 7, 23, 7, 10, 6}
+		ui.TableHeader([]string{"Slab", "Chunk", "Pages", "Used / Total", "Usage", "Evicted", "State"}, widths)
+		for _, s := range usage {
+			ui.TableRow([]string{
+				strconv.Itoa(s.ID),
+				fmt.Sprintf("%d B", s.ChunkSize),
+				strconv.FormatInt(s.TotalPages, 10),
+				fmt.Sprintf("%d / %d", s.UsedChunks, s.TotalChunks),
+				fmt.Sprintf("%.1f%%", s.Usage()*100),
+				strconv.FormatInt(s.Evicted, 10),
+				s.State(*fullRatio, *idleRatio),
+			}, widths)
+		}
+		ui.TableFooter(widths)
+		fmt.Fprintln(stdout)
+
+		if !balance.Imbalanced() {
+			ui.Success(fmt.Sprintf("No slab imbalance: %d full, %d underused classes", len(balance.Full), len(balance.Idle)))
+			return
+		}
+		full := make([]string, len(balance.Full))
+		for i, s := range balance.Full {
+			full[i] = strconv.Itoa(s.ID)
+		}
+		idle := make([]string, len(balance.Idle))
+		for i, s := range balance.Idle {
+			idle[i] = strconv.Itoa(s.ID)
+		}
+		ui.Warning(fmt.Sprintf("Full slab classes: %s; underused classes %s hold %d free pages (%.1f MB)",
+			strings.Join(full, ", "), strings.Join(idle, ", "), balance.FreePages, float64(balance.FreeBytes)/(1<<20)))
+		ui.Info("Items in the full classes are evicted early although memory is free elsewhere (slab calcification)")
+
+		settings, err := client.Statistics("settings")
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get settings: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if mode := settings["slab_automove"]; mode != "" && mode != "0" {
+			ui.Info(fmt.Sprintf("slab_automove is already enabled (mode %s); pages move gradually as the full classes evict", mode))
+			return
+		}
+		ui.Info(fmt.Sprintf("Recommendation: enable slab rebalancing with '%s automove 1',", AppName))
+		ui.Info("and start memcached with '-o slab_reassign,slab_automove=1' to keep it across restarts")
+
+	case "key-expiry-histogram":
+		fs := newFlagSet(command)
+		bucketSpec := fs.String("buckets", "1m,5m,30m,1h,6h,24h,inf", "Comma separated TTL bucket bounds")
+		if err := fs.Parse(args); err != nil {
+			cli.Exit(cli.ExitError)
+		}
+		buckets, err := parseExpiryBuckets(*bucketSpec)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Invalid buckets: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+
+		// Expiry times are absolute, compare against the server clock
+		stats, err := client.Statistics("")
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get statistics: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		now, _ := strconv.ParseInt(stats["time"], 10, 64)
+		if now == 0 {
+			now = time.Now().Unix()
+		}
+
+		source := "lru_crawler metadump"
+		var items []ItemMeta
+		err = client.Capabilities().Require(FeatureMetadump)
+		if err == nil {
+			items, err = client.MetaDump()
+		}
+		if err == nil {
+			for _, item := range items {
+				binExpiry(buckets, item.Expiry, now)
+			}
+		} else {
+			ui.Warning(fmt.Sprintf("%v, falling back to stats cachedump", err))
+			source = "stats cachedump"
+			slabs, err := client.GetAllSlabs()
+			if err != nil {
+				ui.Error(fmt.Sprintf("Failed to get slab IDs: %v", err))
+				cli.Exit(cli.ExitError)
+			}
+			for _, slabID := range slabs {
+				dump, err := client.CacheDump(slabID, 0)
+				if err != nil {
+					ui.Error(fmt.Sprintf("Failed to dump cache: %v", err))
+					cli.Exit(cli.ExitError)
+				}
+				for _, item := range dump {
+					expiry, _ := strconv.ParseInt(item.Expiry, 10, 64)
+					binExpiry(buckets, expiry, now)
+				}
+			}
+		}
+		if resultOut != nil {
+			printResult(struct {
+				Source  string         `json:"source"`
+				Buckets []expiryBucket `json:"buckets"`
+			}{source, buckets})
+			break
+		}
+		printExpiryHistogram(buckets, source)
+
+	default:
+		ui.Error(fmt.Sprintf("Unknown command: %s", command))
+		fmt.Fprintf(stdout, "\n%sRun '%s help' for usage information%s\n", tui.Dim, AppName, tui.Reset)
+		cli.Exit(cli.ExitError)
+	}
+}
@@ -0,0 +1,516 @@
+package memcc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ushell/tools/internal/memcachetest"
+	"github.com/ushell/tools/internal/tui"
+)
+
+// testTimeout bounds every read and write of the test clients, so a test
+// whose server script goes wrong fails instead of hanging
+const testTimeout = 2 * time.Second
+
+// testServer starts an in-process memcached and returns a client of it
+func testServer(t *testing.T) (*memcachetest.Server, *MemcachedClient) {
+	t.Helper()
+	srv, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	c, err := NewMemcachedClient(srv.Host, srv.Port, testTimeout, testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+// exchange is one request the scripted server expects and its reply
+type exchange struct {
+	request, reply string
+}
+
+// pipeClient returns a client connected through net.Pipe to server, which
+// plays the other end of the connection until it returns
+func pipeClient(t *testing.T, server func(conn net.Conn)) *MemcachedClient {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer serverConn.Close()
+		server(serverConn)
+	}()
+
+	c := &MemcachedClient{
+		conn:        &deadlineConn{Conn: clientConn, timeout: testTimeout},
+		host:        "pipe",
+		timeout:     testTimeout,
+		readTimeout: testTimeout,
+	}
+	c.reader = bufio.NewReader(c.conn)
+	t.Cleanup(func() {
+		c.Close()
+		<-done
+	})
+	return c
+}
+
+// scripted returns a server that reads each request in turn and answers it
+// with its reply, reporting a request other than the expected one. An empty
+// reply sends nothing, net.Pipe would block on it until the client reads
+func scripted(t *testing.T, exchanges ...exchange) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		for _, ex := range exchanges {
+			got := make([]byte, len(ex.request))
+			if _, err := io.ReadFull(conn, got); err != nil {
+				t.Errorf("reading %q: %v", ex.request, err)
+				return
+			}
+			if string(got) != ex.request {
+				t.Errorf("server got %q, want %q", got, ex.request)
+				return
+			}
+			if ex.reply == "" {
+				continue
+			}
+			if _, err := io.WriteString(conn, ex.reply); err != nil {
+				t.Errorf("writing reply to %q: %v", ex.request, err)
+				return
+			}
+		}
+	}
+}
+
+// A value larger than the read buffer arrives in several reads, Lookup must
+// collect all of them
+func TestLookupLargeValue(t *testing.T) {
+	value := strings.Repeat("0123456789abcdef", 64*1024/16)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch strings.TrimSpace(line) {
+			case "version":
+				io.WriteString(conn, "VERSION 1.6.21\r\n")
+			case "get big":
+				// Small writes, as a server sending the value over several segments
+				reply := "VALUE big 0 65536\r\n" + value + "\r\nEND\r\n"
+				for reply != "" {
+					n := 1000
+					if n > len(reply) {
+						n = len(reply)
+					}
+					if _, err := io.WriteString(conn, reply[:n]); err != nil {
+						return
+					}
+					reply = reply[n:]
+				}
+			default:
+				io.WriteString(conn, "ERROR\r\n")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	c, err := NewMemcachedClient(addr.IP.String(), addr.Port, time.Second, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got, found, err := c.Lookup("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || got != value {
+		t.Errorf("Lookup returned %d bytes, found=%v; want the %d bytes sent", len(got), found, len(value))
+	}
+}
+
+// Values are binary safe: a few hundred KB holding \r\n, NUL and lines that
+// look like protocol replies come back byte for byte
+func TestBinaryValueRoundTrip(t *testing.T) {
+	srv, c := testServer(t)
+
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 300*1024; i++ {
+		buf.WriteString("line\r\nEND\r\nVALUE k 0 1\r\n\x00\x00")
+		buf.WriteByte(byte(i))
+	}
+	value := buf.Bytes()
+
+	if err := c.Set("blob", string(value), 0); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := srv.Get("blob"); stored != string(value) {
+		t.Fatalf("server stored %d bytes, want %d", len(stored), len(value))
+	}
+	got, err := c.GetBytes("blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(value) {
+		t.Fatalf("GetBytes returned %d bytes, want %d", len(got), len(value))
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf("GetBytes returned different content of the right size")
+	}
+}
+
+// Commands on one connection share its reader. Here the reply to get reaches
+// the client together with the reply to set, so a reader per command would
+// lose it along with whatever else the previous one had buffered
+func TestCommandsShareConnection(t *testing.T) {
+	c := pipeClient(t, scripted(t,
+		exchange{"set k 0 0 5\r\nhello\r\n", "STORED\r\nVALUE k 0 5\r\nhello\r\nEND\r\n"},
+		exchange{"get k\r\n", ""},
+		exchange{"stats\r\n", "STAT pid 42\r\nSTAT curr_items 1\r\nSTAT version 1.6.21\r\nEND\r\n"},
+		exchange{"get missing\r\n", "END\r\n"},
+	))
+
+	if err := c.Set("k", "hello", 0); err != nil {
+		t.Fatal(err)
+	}
+	value, err := c.Get("k")
+	if err != nil || value != "hello" {
+		t.Fatalf("Get = %q, %v; want hello", value, err)
+	}
+	stats, err := c.Statistics("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 3 || stats["curr_items"] != "1" || stats["version"] != "1.6.21" {
+		t.Errorf("Statistics = %v", stats)
+	}
+	if _, found, err := c.Lookup("missing"); found || err != nil {
+		t.Errorf("Lookup(missing) = found %v, %v; want a miss", found, err)
+	}
+}
+
+func TestAppendPrepend(t *testing.T) {
+	c := pipeClient(t, scripted(t,
+		exchange{"append k 0 0 4\r\n-end\r\n", "STORED\r\n"},
+		exchange{"prepend k 0 0 6\r\nstart-\r\n", "STORED\r\n"},
+		exchange{"append missing 0 0 1\r\nx\r\n", "NOT_STORED\r\n"},
+		exchange{"prepend missing 0 0 1\r\nx\r\n", "NOT_STORED\r\n"},
+		exchange{"append k 0 0 1\r\nx\r\n", "SERVER_ERROR out of memory storing object\r\n"},
+	))
+
+	if err := c.Append("k", "-end"); err != nil {
+		t.Errorf("Append = %v", err)
+	}
+	if err := c.Prepend("k", "start-"); err != nil {
+		t.Errorf("Prepend = %v", err)
+	}
+	// append and prepend never create an item
+	if err := c.Append("missing", "x"); err != ErrNotStored {
+		t.Errorf("Append(missing) = %v, want ErrNotStored", err)
+	}
+	if err := c.Prepend("missing", "x"); err != ErrNotStored {
+		t.Errorf("Prepend(missing) = %v, want ErrNotStored", err)
+	}
+	if err := c.Append("k", "x"); err == nil || err == ErrNotStored {
+		t.Errorf("Append on a server error = %v, want the server's error", err)
+	}
+}
+
+// Incr and Decr are Increment and Decrement, decr stopping at 0
+func TestIncrDecr(t *testing.T) {
+	srv, c := testServer(t)
+	srv.Set("n", "5")
+	if n, err := c.Incr("n", 3); n != 8 || err != nil {
+		t.Errorf("Incr(n, 3) = %d, %v; want 8", n, err)
+	}
+	if n, err := c.Decr("n", 10); n != 0 || err != nil {
+		t.Errorf("Decr(n, 10) = %d, %v; want 0", n, err)
+	}
+	if _, err := c.Incr("missing", 1); !errors.Is(err, ErrNotFound) || !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Incr(missing) = %v, want ErrNotFound, also known as ErrKeyNotFound", err)
+	}
+}
+
+// Touch needs memcached 1.4.8, older servers are refused before sending
+func TestTouchRequiresFeature(t *testing.T) {
+	c := pipeClient(t, scripted(t, exchange{"touch k 60\r\n", "TOUCHED\r\n"}))
+	c.caps = newCapabilities("1.4.8", nil)
+	if err := c.Touch("k", 60); err != nil {
+		t.Errorf("Touch on 1.4.8 = %v", err)
+	}
+
+	c = pipeClient(t, func(conn net.Conn) {})
+	c.caps = newCapabilities("1.4.5", nil)
+	err := c.Touch("k", 60)
+	if err == nil || !strings.Contains(err.Error(), "does not support touch") {
+		t.Errorf("Touch on 1.4.5 = %v, want an unsupported feature error", err)
+	}
+}
+
+// silentServer accepts connections and reads from them without ever
+// answering, like a stalled server. It returns the address to dial
+func silentServer(t *testing.T) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// A server that accepts the connection but never answers fails the connect
+// after the read timeout instead of hanging
+func TestConnectTimeout(t *testing.T) {
+	host, port := silentServer(t)
+	const timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	c, err := NewMemcachedClient(host, port, timeout, timeout)
+	elapsed := time.Since(start)
+	if err == nil {
+		c.Close()
+		t.Fatal("connected to a server that never answers")
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("error = %v, want ErrTimeout", err)
+	}
+	if elapsed < timeout || elapsed > timeout+time.Second {
+		t.Errorf("gave up after %s, want about %s", elapsed, timeout)
+	}
+}
+
+// A server that stops answering in the middle of a session fails the command
+func TestCommandTimeout(t *testing.T) {
+	c := pipeClient(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+	const timeout = 100 * time.Millisecond
+	c.conn.(*deadlineConn).timeout = timeout
+
+	start := time.Now()
+	_, err := c.Get("k")
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get = %v, want ErrTimeout matching context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Errorf("Get gave up after %s, want about %s", elapsed, timeout)
+	}
+}
+
+// The deadline of the context bounds the connect and the commands, however
+// long the timeouts of the configuration
+func TestConnectContext(t *testing.T) {
+	host, port := silentServer(t)
+	const timeout = 200 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	c, err := ConnectContext(ctx, Config{Host: host, Port: port, Timeout: time.Minute})
+	elapsed := time.Since(start)
+	if err == nil {
+		c.Close()
+		t.Fatal("connected to a server that never answers")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed > timeout+time.Second {
+		t.Errorf("gave up after %s, want about %s", elapsed, timeout)
+	}
+
+	if _, err := ConnectContext(ctx, Config{Host: host, Port: port}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ConnectContext with an expired context = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// scriptedListener serves the nth connection it accepts with the nth server
+// and closes it once that returns. Further connections are refused
+func scriptedListener(t *testing.T, servers ...func(conn net.Conn)) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		defer ln.Close()
+		for _, server := range servers {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			server(conn)
+			conn.Close()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// The connect timeout and the read timeout are separate: a stalled server is
+// given up on after the read timeout even with a long connect timeout
+func TestReadTimeoutSplit(t *testing.T) {
+	host, port := silentServer(t)
+	const readTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := Connect(Config{Host: host, Port: port, Timeout: 10 * time.Second, ReadTimeout: readTimeout})
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "within 100ms") {
+		t.Errorf("Connect = %v, want ErrTimeout within the read timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > readTimeout+time.Second {
+		t.Errorf("gave up after %s, want about %s", elapsed, readTimeout)
+	}
+
+	srv, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	for _, tt := range []struct {
+		timeout, readTimeout, want time.Duration
+	}{
+		{time.Second, 300 * time.Millisecond, 300 * time.Millisecond},
+		{time.Second, 0, time.Second},
+	} {
+		c, err := Connect(Config{Host: srv.Host, Port: srv.Port, Timeout: tt.timeout, ReadTimeout: tt.readTimeout})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.conn.(*deadlineConn).timeout; got != tt.want {
+			t.Errorf("timeout %s, read timeout %s: reads limited to %s, want %s", tt.timeout, tt.readTimeout, got, tt.want)
+		}
+		c.Close()
+	}
+}
+
+// With retries a command whose connection was closed, as by a server
+// restart, is sent again on a new connection. Without, it fails
+func TestRetries(t *testing.T) {
+	saved := ui
+	ui = tui.NewPrinter(io.Discard)
+	t.Cleanup(func() { ui = saved })
+
+	// the first connection is closed after the get request, unanswered
+	closing := scripted(t,
+		exchange{"version\r\n", "VERSION 1.6.21\r\n"},
+		exchange{"get k\r\n", ""},
+	)
+	answering := scripted(t, exchange{"get k\r\n", "VALUE k 0 1\r\nv\r\nEND\r\n"})
+
+	host, port := scriptedListener(t, closing, answering)
+	c, err := Connect(Config{Host: host, Port: port, Timeout: testTimeout, MaxRetries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if value, err := c.Get("k"); err != nil || value != "v" {
+		t.Errorf("Get with --retries 1 = %q, %v; want v", value, err)
+	}
+
+	host, port = scriptedListener(t, closing, answering)
+	c, err = Connect(Config{Host: host, Port: port, Timeout: testTimeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Get("k"); !errors.Is(err, io.EOF) {
+		t.Errorf("Get with --retries 0 = %v, want the lost connection", err)
+	}
+
+	// every reconnect attempt is refused once the listener is gone
+	host, port = scriptedListener(t, closing)
+	c, err = Connect(Config{Host: host, Port: port, Timeout: testTimeout, MaxRetries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Get("k"); err == nil || !strings.Contains(err.Error(), "1 reconnect attempts failed") {
+		t.Errorf("Get after a failed reconnect = %v", err)
+	}
+}
+
+func TestDeleteMissingKey(t *testing.T) {
+	srv, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.Set("present", "x")
+
+	var out bytes.Buffer
+	if code := Run([]string{"-s", srv.Addr(), "delete", "present"}, &out, io.Discard); code != 0 {
+		t.Errorf("delete present exited with %d:\n%s", code, out.String())
+	}
+	if _, found := srv.Get("present"); found {
+		t.Error("delete left the key in place")
+	}
+
+	out.Reset()
+	code := Run([]string{"-s", srv.Addr(), "delete", "missingkey"}, &out, io.Discard)
+	if code == 0 || !strings.Contains(out.String(), "Key 'missingkey' not found") {
+		t.Errorf("delete missingkey exited with %d:\n%s", code, out.String())
+	}
+}
+
+// Piped input is read line by line, "!!" repeating the previous command
+func TestShellPipedInput(t *testing.T) {
+	srv, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	saved := stdin
+	stdin = strings.NewReader("set k 'two words'\nget k\n!!\nhistory\nexit\n")
+	defer func() { stdin = saved }()
+
+	var out bytes.Buffer
+	if code := Run([]string{"-s", srv.Addr(), "--no-color", "shell"}, &out, io.Discard); code != 0 {
+		t.Fatalf("shell exited with %d:\n%s", code, out.String())
+	}
+	if v, _ := srv.Get("k"); v != "two words" {
+		t.Errorf("server has k = %q, want the quoted value", v)
+	}
+	if n := strings.Count(out.String(), "Retrieved 9 bytes"); n != 2 {
+		t.Errorf("get ran %d times, want 2 with !!:\n%s", n, out.String())
+	}
+	if !strings.Contains(out.String(), "  3  get k") {
+		t.Errorf("history does not list the repeated command:\n%s", out.String())
+	}
+}
@@ -0,0 +1,81 @@
+package memcc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// promMetric describes a stat in the Prometheus text exposition format
+type promMetric struct {
+	kind string // counter or gauge
+	help string
+}
+
+// promMetrics are the general stats with a known meaning. Other numeric
+// stats are exported as untyped.
+var promMetrics = map[string]promMetric{
+	"uptime":            {"counter", "Seconds since the server started"},
+	"curr_items":        {"gauge", "Number of items currently stored"},
+	"total_items":       {"counter", "Number of items stored since the server started"},
+	"bytes":             {"gauge", "Bytes currently used to store items"},
+	"limit_maxbytes":    {"gauge", "Bytes the server may use for storage"},
+	"curr_connections":  {"gauge", "Number of open connections"},
+	"total_connections": {"counter", "Number of connections opened since the server started"},
+	"threads":           {"gauge", "Number of worker threads"},
+	"cmd_get":           {"counter", "Number of get requests"},
+	"cmd_set":           {"counter", "Number of storage requests"},
+	"cmd_flush":         {"counter", "Number of flush_all requests"},
+	"cmd_touch":         {"counter", "Number of touch requests"},
+	"get_hits":          {"counter", "Number of keys requested and found"},
+	"get_misses":        {"counter", "Number of keys requested and not found"},
+	"get_expired":       {"counter", "Number of keys requested that had expired"},
+	"delete_hits":       {"counter", "Number of delete requests for existing keys"},
+	"delete_misses":     {"counter", "Number of delete requests for missing keys"},
+	"incr_hits":         {"counter", "Number of incr requests for existing keys"},
+	"incr_misses":       {"counter", "Number of incr requests for missing keys"},
+	"decr_hits":         {"counter", "Number of decr requests for existing keys"},
+	"decr_misses":       {"counter", "Number of decr requests for missing keys"},
+	"evictions":         {"counter", "Number of valid items removed to free memory for new items"},
+	"reclaimed":         {"counter", "Number of times an expired item's memory was reused"},
+	"bytes_read":        {"counter", "Bytes read from the network"},
+	"bytes_written":     {"counter", "Bytes written to the network"},
+}
+
+// printPrometheus writes the numeric stats as memcached_<stat> metrics, in
+// a form the node-exporter textfile collector and the Pushgateway accept.
+// Stats that are not numbers, such as the version, are left out.
+func printPrometheus(w io.Writer, stats map[string]string) {
+	names := make([]string, 0, len(stats))
+	for k := range stats {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		if _, err := strconv.ParseFloat(stats[k], 64); err != nil {
+			continue
+		}
+		name := "memcached_" + promName(k)
+		if m, ok := promMetrics[k]; ok {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, m.help)
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, m.kind)
+		} else {
+			fmt.Fprintf(w, "# TYPE %s untyped\n", name)
+		}
+		fmt.Fprintf(w, "%s %s\n", name, stats[k])
+	}
+}
+
+// promName replaces the characters not allowed in metric names, such as the
+// colons of "stats slabs", with underscores
+func promName(stat string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, stat)
+}
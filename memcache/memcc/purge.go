@@ -0,0 +1,166 @@
+package memcc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/internal/tui"
+)
+
+// purgeFailure is a key that purge could not delete
+type purgeFailure struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// purgeResult is the JSON form of the purge command. Keys lists the
+// matching keys of a dry run.
+type purgeResult struct {
+	Command string         `json:"command"`
+	Pattern string         `json:"pattern"`
+	Matched int            `json:"matched"`
+	Deleted int            `json:"deleted"`
+	Missing int            `json:"missing,omitempty"`
+	Failed  []purgeFailure `json:"failed"`
+	DryRun  bool           `json:"dry_run,omitempty"`
+	Keys    []string       `json:"keys,omitempty"`
+}
+
+// runPurge implements the purge command: it lists the keys matching a
+// pattern and deletes them, with concurrency workers on connections of
+// their own. Keys that expired in the meantime are counted as missing, any
+// other failure makes the exit status 1.
+func runPurge(client *MemcachedClient, cfg Config, args []string) {
+	fs := newFlagSet("purge")
+	dryRun := fs.Bool("dry-run", false, "List the keys that would be deleted")
+	concurrency := fs.Int("concurrency", 1, "Number of connections deleting in parallel")
+	rest, err := cli.ParseInterspersed(fs, args)
+	if err != nil {
+		cli.Exit(cli.ExitError)
+	}
+	if len(rest) < 1 {
+		ui.Error("Missing pattern argument")
+		fmt.Fprintf(stdout, "\n%sUsage: %s [options] purge <pattern> [--dry-run] [--concurrency N]%s\n", tui.Dim, AppName, tui.Reset)
+		cli.Exit(cli.ExitError)
+	}
+	if *concurrency < 1 {
+		ui.Error("--concurrency must be at least 1")
+		cli.Exit(cli.ExitError)
+	}
+	pattern := rest[0]
+
+	keys, err := client.GetKeys(pattern)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Failed to get keys: %v", err))
+		cli.Exit(cli.ExitError)
+	}
+	result := purgeResult{Command: "purge", Pattern: pattern, Matched: len(keys), Failed: []purgeFailure{}}
+
+	if *dryRun || cfg.DryRun {
+		result.DryRun, result.Keys = true, append([]string{}, keys...)
+		if resultOut != nil {
+			printResult(result)
+			return
+		}
+		if len(keys) == 0 {
+			ui.Warning("No matching keys found")
+			return
+		}
+		ui.Header(fmt.Sprintf("Keys that would be deleted (%s)", pattern))
+		for i, key := range keys {
+			fmt.Fprintf(stdout, "  %s%3d.%s %s\n", tui.Dim, i+1, tui.Reset, key)
+		}
+		fmt.Fprintf(stdout, "\n%s%s Total: %d keys, nothing deleted (dry run)%s\n", tui.Dim, tui.Cyan, len(keys), tui.Reset)
+		return
+	}
+	if len(keys) == 0 {
+		if resultOut != nil {
+			printResult(result)
+			return
+		}
+		ui.Warning("No matching keys found")
+		return
+	}
+
+	purgeKeys(client, cfg, keys, *concurrency, &result)
+	if resultOut != nil {
+		printResult(result)
+	}
+	if len(result.Failed) > 0 {
+		ui.Error(fmt.Sprintf("Failed to delete %d of %d keys matching '%s':", len(result.Failed), len(keys), pattern))
+		// The JSON and CSV results list the failures already
+		if resultOut == nil {
+			for _, f := range result.Failed {
+				fmt.Fprintf(stdout, "  %s-%s %s: %s\n", tui.Red, tui.Reset, f.Key, f.Error)
+			}
+		}
+		cli.Exit(cli.ExitError)
+	}
+	msg := fmt.Sprintf("Deleted %d keys matching '%s'", result.Deleted, pattern)
+	if result.Missing > 0 {
+		msg += fmt.Sprintf(", %d had already expired", result.Missing)
+	}
+	ui.Success(msg)
+}
+
+// purgeKeys deletes keys with workers goroutines. The first uses client,
+// the others open their own connection and are left out if they cannot.
+// Progress is shown on one updating line when stdout is a terminal, unless
+// it gets the JSON or CSV result.
+func purgeKeys(client *MemcachedClient, cfg Config, keys []string, workers int, result *purgeResult) {
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	progress := resultOut == nil && tui.IsTerminal(stdout)
+	jobs := make(chan string)
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			c := client
+			if w > 0 {
+				var err error
+				if c, err = Connect(cfg); err != nil {
+					mu.Lock()
+					ui.Warning(fmt.Sprintf("Worker %d could not connect, continuing without it: %v", w+1, err))
+					mu.Unlock()
+					return
+				}
+				defer c.Close()
+			}
+			for key := range jobs {
+				err := c.Delete(key)
+				mu.Lock()
+				switch {
+				case err == nil:
+					result.Deleted++
+				case errors.Is(err, ErrNotFound):
+					result.Missing++
+				default:
+					result.Failed = append(result.Failed, purgeFailure{Key: key, Error: err.Error()})
+				}
+				done++
+				if progress {
+					fmt.Fprintf(stdout, "\r%sProcessed %d/%d keys…%s", tui.Dim, done, len(keys), tui.Reset)
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	for _, key := range keys {
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+	sort.Slice(result.Failed, func(i, j int) bool { return result.Failed[i].Key < result.Failed[j].Key })
+	if progress {
+		fmt.Fprintln(stdout)
+	}
+}
@@ -0,0 +1,184 @@
+package memcc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/internal/tui"
+	"golang.org/x/term"
+)
+
+// shellHistorySize is the number of commands kept for the history command
+const shellHistorySize = 100
+
+// runShell reads commands from stdin and runs them on client until exit,
+// quit or end of input (Ctrl-D). A failing command ends only itself.
+//
+// On a terminal the line is edited in raw mode, with the arrow keys moving
+// through earlier commands. Piped input is read line by line. In both cases
+// "history" lists recent commands and "!N" or "!!" runs one of them again.
+func runShell(client *MemcachedClient, cfg Config) {
+	prompt := fmt.Sprintf("%s%s%s> %s", tui.Bold, tui.Cyan, AppName, tui.Reset)
+	var readLine func() (string, error)
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		readLine = terminalLineReader(f, prompt)
+	} else {
+		in := bufio.NewReader(stdin)
+		defer func(saved io.Reader) { stdin = saved }(stdin)
+		// Prompts such as flush's confirmation must read from the same buffer
+		stdin = in
+		readLine = func() (string, error) {
+			fmt.Fprint(stdout, prompt)
+			return in.ReadString('\n')
+		}
+	}
+
+	ui.Info("Type 'help' for commands, 'exit' or Ctrl-D to leave")
+	var history []string
+	for {
+		line, err := readLine()
+		if err != nil && line == "" {
+			// Ctrl-D: finish the prompt line before leaving
+			fmt.Fprintln(stdout)
+			return
+		}
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "!") {
+			recalled, ok := recallHistory(history, line)
+			if !ok {
+				ui.Error(fmt.Sprintf("No such history entry: %s", line))
+				continue
+			}
+			fmt.Fprintf(stdout, "%s%s%s\n", tui.Dim, recalled, tui.Reset)
+			line = recalled
+		}
+
+		words, err := splitShellLine(line)
+		if err != nil {
+			ui.Error(err.Error())
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		history = append(history, line)
+		if len(history) > shellHistorySize {
+			history = history[1:]
+		}
+
+		switch command, args := words[0], words[1:]; command {
+		case "exit", "quit":
+			return
+		case "history":
+			for i, h := range history {
+				fmt.Fprintf(stdout, "  %s%3d%s  %s\n", tui.Dim, i+1, tui.Reset, h)
+			}
+		case "help":
+			printUsage()
+		case "version":
+			printVersion()
+		case "check":
+			catchExit(func() { runCheck(cfg, args) })
+		case "shell":
+			ui.Warning("Already in the shell")
+		default:
+			catchExit(func() { runCommand(client, cfg, command, args) })
+		}
+	}
+}
+
+// terminalLineReader returns a function reading one line from the terminal f
+// with golang.org/x/term, which provides line editing and arrow-key history.
+// The terminal is in raw mode only while a line is read, so command output
+// and confirmation prompts see it as usual.
+func terminalLineReader(f *os.File, prompt string) func() (string, error) {
+	fd := int(f.Fd())
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{f, stdout}, prompt)
+	return func() (string, error) {
+		if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+			t.SetSize(width, height)
+		}
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(fd, state)
+		line, err := t.ReadLine()
+		if err == term.ErrPasteIndicator {
+			// a pasted line is run like a typed one
+			err = nil
+		}
+		return line, err
+	}
+}
+
+// catchExit runs fn, turning a cli.Exit into a return of its code so a
+// failing command does not end the shell
+func catchExit(fn func()) (code int) {
+	defer cli.Recover(&code)
+	fn()
+	return cli.ExitOK
+}
+
+// recallHistory resolves "!!" to the last command and "!N" to the Nth entry
+// listed by the history command
+func recallHistory(history []string, ref string) (string, bool) {
+	if ref == "!!" {
+		if len(history) == 0 {
+			return "", false
+		}
+		return history[len(history)-1], true
+	}
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(history) {
+		return "", false
+	}
+	return history[n-1], true
+}
+
+// splitShellLine splits a shell line into words on whitespace. Single or
+// double quotes group words, so values can contain spaces.
+func splitShellLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,72 @@
+package memcc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// errHandshake marks errors of the TLS handshake, which are reported as
+// they are rather than as a failure to connect
+var errHandshake = errors.New("TLS handshake failed")
+
+// dialServer connects to address, over TLS if tlsConfig is set, giving up
+// when ctx is done. With TLS the handshake counts towards timeout as well,
+// and its errors, such as a certificate that does not verify, are reported
+// as such.
+func dialServer(ctx context.Context, address string, timeout time.Duration, tlsConfig *tls.Config) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil || tlsConfig == nil {
+		return conn, err
+	}
+	if tlsConfig.ServerName == "" {
+		// Verify the certificate against the host we were asked to use
+		host, _, _ := net.SplitHostPort(address)
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w with %s: %w", errHandshake, address, err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// loadTLSConfig builds the TLS settings of the --tls flags. certFile and
+// keyFile give a client certificate and must be used together. caFile
+// replaces the system roots for verifying the server; insecure skips the
+// verification altogether.
+func loadTLSConfig(certFile, keyFile, caFile string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
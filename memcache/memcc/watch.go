@@ -0,0 +1,133 @@
+package memcc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/internal/tui"
+)
+
+// runWatch polls the statistics of statType every interval and redraws them
+// until interrupted. Values that changed since the previous poll are
+// highlighted and their change is shown next to them.
+func runWatch(client *MemcachedClient, statType string, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev map[string]string
+	for {
+		stats, err := client.Statistics(statType)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to get statistics: %v", err))
+			cli.Exit(cli.ExitError)
+		}
+		if resultOut != nil {
+			// One line of JSON per poll
+			if err := json.NewEncoder(resultOut).Encode(stats); err != nil {
+				ui.Error(fmt.Sprintf("Failed to write JSON: %v", err))
+			}
+		} else {
+			fmt.Fprint(stdout, "\033[H\033[2J")
+			printWatchedStatistics(stats, prev, interval)
+		}
+		prev = stats
+
+		select {
+		case <-ticker.C:
+		case <-signals:
+			return
+		}
+	}
+}
+
+// parseInterval parses a poll interval given as a duration ("500ms", "1m")
+// or as a number of seconds
+func parseInterval(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		seconds, errSeconds := strconv.Atoi(s)
+		if errSeconds != nil {
+			return 0, fmt.Errorf("invalid interval: %s", s)
+		}
+		d = time.Duration(seconds) * time.Second
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("interval must be positive: %s", s)
+	}
+	return d, nil
+}
+
+// printWatchedStatistics is printStatistics with the hit rate added on top
+// and the changes since prev marked. prev is nil on the first poll.
+func printWatchedStatistics(stats, prev map[string]string, interval time.Duration) {
+	ui.Header(fmt.Sprintf("Server Statistics (every %s, Ctrl-C to stop)", interval))
+	fmt.Fprintf(stdout, "%s%s%s\n\n", tui.Dim, time.Now().Format("2006-01-02 15:04:05"), tui.Reset)
+
+	keys := make([]string, 0, len(stats))
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	widths := []int{30, 25, 14}
+	ui.TableHeader([]string{"Metric", "Value", "Change"}, widths)
+	if rate, ok := hitRate(stats, nil); ok {
+		row := []string{"* hit_rate", fmt.Sprintf("%.2f%%", rate), ""}
+		if recent, ok := hitRate(stats, prev); ok {
+			row[2] = fmt.Sprintf("%.2f%% now", recent)
+		}
+		ui.TableRow(row, widths)
+	}
+	for _, k := range keys {
+		value, change := stats[k], ""
+		if old, seen := prev[k]; seen && old != value {
+			change = statChange(old, value)
+			value = tui.Bold + tui.Yellow + value + tui.Reset
+		}
+		ui.TableRow([]string{k, value, change}, widths)
+	}
+	ui.TableFooter(widths)
+}
+
+// hitRate returns get_hits / (get_hits + get_misses) in percent. With prev it
+// is the rate since that poll, from the difference of the counters.
+func hitRate(stats, prev map[string]string) (float64, bool) {
+	hits, errHits := strconv.ParseFloat(stats["get_hits"], 64)
+	misses, errMisses := strconv.ParseFloat(stats["get_misses"], 64)
+	if errHits != nil || errMisses != nil {
+		return 0, false
+	}
+	if prev != nil {
+		prevHits, errHits := strconv.ParseFloat(prev["get_hits"], 64)
+		prevMisses, errMisses := strconv.ParseFloat(prev["get_misses"], 64)
+		if errHits != nil || errMisses != nil {
+			return 0, false
+		}
+		hits, misses = hits-prevHits, misses-prevMisses
+	}
+	if hits+misses <= 0 {
+		return 0, false
+	}
+	return hits * 100 / (hits + misses), true
+}
+
+// statChange formats the difference between two values of a metric, or
+// "changed" if they are not integers
+func statChange(old, value string) string {
+	a, errOld := strconv.ParseInt(old, 10, 64)
+	b, errNew := strconv.ParseInt(value, 10, 64)
+	if errOld != nil || errNew != nil {
+		return "changed"
+	}
+	return fmt.Sprintf("%+d", b-a)
+}
@@ -0,0 +1,175 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 告警指标的取值类型, 决定阈值的写法: 计数为普通数字, 比例须带 %, 耗时为 2s、500ms 等
+const (
+	alertCount = iota
+	alertPercent
+	alertDuration
+)
+
+type alertMetric struct {
+	kind  int
+	value func(r *Report) float64
+}
+
+// 比例以百分数计, 耗时以秒计
+var alertMetrics = map[string]alertMetric{
+	"requests":    {alertCount, func(r *Report) float64 { return float64(r.Requests) }},
+	"errors":      {alertCount, func(r *Report) float64 { return float64(r.Errors) }},
+	"4xx":         {alertCount, func(r *Report) float64 { return float64(r.statusClass(4)) }},
+	"5xx":         {alertCount, func(r *Report) float64 { return float64(r.statusClass(5)) }},
+	"bytes":       {alertCount, func(r *Report) float64 { return float64(r.Summary.Bytes) }},
+	"rps":         {alertCount, func(r *Report) float64 { return r.Summary.RequestsPerSecond }},
+	"error_rate":  {alertPercent, func(r *Report) float64 { return r.percent(r.Errors) }},
+	"4xx_rate":    {alertPercent, func(r *Report) float64 { return r.percent(r.statusClass(4)) }},
+	"5xx_rate":    {alertPercent, func(r *Report) float64 { return r.percent(r.statusClass(5)) }},
+	"p50_latency": {alertDuration, func(r *Report) float64 { return r.Latency.Overall.P50 }},
+	"p95_latency": {alertDuration, func(r *Report) float64 { return r.Latency.Overall.P95 }},
+	"p99_latency": {alertDuration, func(r *Report) float64 { return r.Latency.Overall.P99 }},
+}
+
+// AlertMetrics 返回可用的告警指标名, 按字母排列
+func AlertMetrics() []string {
+	names := make([]string, 0, len(alertMetrics))
+	for name := range alertMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 长的运算符在前, 避免 >= 被当作 >
+var alertOperators = []string{">=", "<=", ">", "<"}
+
+// AlertRule 为一条告警条件, 如 5xx_rate>1%、p99_latency>2s、requests<1000
+type AlertRule struct {
+	Expr      string
+	Metric    string
+	Op        string
+	Threshold float64
+}
+
+// ParseAlert 解析告警条件 "<指标><运算符><阈值>", 运算符为 > >= < <=.
+// 比例指标 (*_rate) 的阈值须带 %, 耗时指标 (*_latency) 的阈值为 2s、500ms 等, 其余为普通数字
+func ParseAlert(expr string) (AlertRule, error) {
+	rule := AlertRule{Expr: expr}
+	s := strings.ReplaceAll(expr, " ", "")
+	i, op := -1, ""
+	for _, o := range alertOperators {
+		if i = strings.Index(s, o); i >= 0 {
+			op = o
+			break
+		}
+	}
+	if i <= 0 {
+		return rule, fmt.Errorf("%q 不是有效的告警条件, 格式为 <指标><运算符><阈值>, 如 5xx_rate>1%%", expr)
+	}
+	rule.Metric, rule.Op = s[:i], op
+	metric, ok := alertMetrics[rule.Metric]
+	if !ok {
+		return rule, fmt.Errorf("未知的告警指标 %q, 可用指标: %s", rule.Metric, strings.Join(AlertMetrics(), ", "))
+	}
+
+	literal := s[i+len(op):]
+	var err error
+	switch metric.kind {
+	case alertPercent:
+		if !strings.HasSuffix(literal, "%") {
+			return rule, fmt.Errorf("%s 为比例, 阈值须带 %%, 如 %s%s1%%", rule.Metric, rule.Metric, op)
+		}
+		rule.Threshold, err = strconv.ParseFloat(strings.TrimSuffix(literal, "%"), 64)
+	case alertDuration:
+		var d time.Duration
+		if d, err = time.ParseDuration(literal); err == nil {
+			rule.Threshold = d.Seconds()
+		}
+	default:
+		rule.Threshold, err = strconv.ParseFloat(literal, 64)
+	}
+	if err != nil {
+		return rule, fmt.Errorf("告警条件 %q 的阈值 %q 无效", expr, literal)
+	}
+	return rule, nil
+}
+
+// NeedsLatency 表示该条件需要 $request_time 分位数, 即 Options.Latency
+func (a AlertRule) NeedsLatency() bool {
+	return alertMetrics[a.Metric].kind == alertDuration
+}
+
+// AlertResult 为一条告警条件的计算结果, Value 中比例以百分数计、耗时以秒计, Measured 为便于阅读的形式
+type AlertResult struct {
+	Expr     string  `json:"expr"`
+	Metric   string  `json:"metric"`
+	Value    float64 `json:"value"`
+	Measured string  `json:"measured"`
+	Fired    bool    `json:"fired"`
+}
+
+// EvaluateAlerts 逐条计算告警条件, 结果同时保存到 r.Alerts, 返回触发的条数.
+// 报告中没有所需数据的条件 (如未启用 Latency 时的耗时指标) 不触发
+func (r *Report) EvaluateAlerts(rules []AlertRule) int {
+	r.Alerts = make([]AlertResult, 0, len(rules))
+	fired := 0
+	for _, rule := range rules {
+		metric := alertMetrics[rule.Metric]
+		res := AlertResult{Expr: rule.Expr, Metric: rule.Metric}
+		if r.Summary == nil || (metric.kind == alertDuration && r.Latency == nil) {
+			res.Measured = "无数据"
+			r.Alerts = append(r.Alerts, res)
+			continue
+		}
+		res.Value = metric.value(r)
+		switch metric.kind {
+		case alertPercent:
+			res.Measured = strconv.FormatFloat(res.Value, 'f', 2, 64) + "%"
+		case alertDuration:
+			res.Measured = time.Duration(res.Value * float64(time.Second)).Round(time.Millisecond).String()
+		case alertCount:
+			// rps 为小数, 其余计数为整数
+			res.Measured = strconv.FormatFloat(res.Value, 'f', -1, 64)
+			if res.Value != math.Trunc(res.Value) {
+				res.Measured = strconv.FormatFloat(res.Value, 'f', 2, 64)
+			}
+		}
+		switch rule.Op {
+		case ">":
+			res.Fired = res.Value > rule.Threshold
+		case ">=":
+			res.Fired = res.Value >= rule.Threshold
+		case "<":
+			res.Fired = res.Value < rule.Threshold
+		case "<=":
+			res.Fired = res.Value <= rule.Threshold
+		}
+		if res.Fired {
+			fired++
+		}
+		r.Alerts = append(r.Alerts, res)
+	}
+	return fired
+}
+
+// 某类状态码的请求数, class 为 1 至 5
+func (r *Report) statusClass(class int) int {
+	if r.Summary == nil || class < 1 || class > len(r.Summary.StatusClasses) {
+		return 0
+	}
+	return r.Summary.StatusClasses[class-1].Requests
+}
+
+func (r *Report) percent(n int) float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(r.Requests)
+}
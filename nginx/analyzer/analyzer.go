@@ -0,0 +1,691 @@
+// Package analyzer 汇总 nginx 访问日志, 供 nginx_log_analyse 命令行工具及其他程序复用.
+//
+// 用法:
+//
+//	a := analyzer.New(analyzer.Options{URLFilter: analyzer.DefaultURLFilter})
+//	for scanner.Scan() {
+//		if err := a.AddLine(scanner.Text()); err != nil {
+//			log.Println(err)
+//		}
+//	}
+//	rep := a.Report()
+//
+// Report 的各字段可直接序列化为 JSON.
+package analyzer
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/satyrius/gonx"
+)
+
+// DefaultLogFormat 是 Options.LogFormat 为空时使用的日志格式
+const DefaultLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`
+
+const timeLayout = "02/Jan/2006:15:04:05 -0700"
+
+var (
+	// DefaultURLFilter 为命令行工具默认忽略的静态资源, URL 包含其中任一子串即不参与排名
+	DefaultURLFilter = []string{"js", "css", "img", "svg", "webp", "png"}
+
+	// DefaultSpamDomains 为常见的 referer spam 域名
+	DefaultSpamDomains = []string{
+		"semalt.com", "buttons-for-website.com", "darodar.com", "ilovevitaly.com",
+		"priceg.com", "best-seo-offer.com", "social-buttons.com", "free-share-buttons.com",
+		"simple-share-buttons.com", "floating-share-buttons.com", "get-free-traffic-now.com",
+		"trafficmonetize.org", "7makemoneyonline.com", "o-o-6-o-o.com", "hulfingtonpost.com",
+		"buy-cheap-online.info", "blackhatworth.com", "hundejo.com", "econom.co", "100dollars-seo.com",
+	}
+
+	// HealthCheckUserAgents 为常见健康检查 (Kubernetes、负载均衡、拨测服务) 的 UA, 整个 UA 须匹配
+	HealthCheckUserAgents = []string{
+		`kube-probe/.*`, `ELB-HealthChecker/.*`, `GoogleHC/.*`, `Consul Health Check`,
+		`Amazon-Route53-Health-Check-Service.*`, `UptimeRobot/.*`, `Blackbox Exporter/.*`, `Pingdom\.com_bot_version_.*`,
+	}
+
+	// HealthCheckPaths 为常见的健康检查路径, 与请求路径 (不含查询参数) 完全相同才算
+	HealthCheckPaths = []string{"/healthz", "/health", "/livez", "/readyz", "/ready", "/ping", "/_health"}
+
+	// MediaExtensions 为盗链检测关注的静态媒体扩展名
+	MediaExtensions = []string{
+		".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".ico", ".bmp",
+		".mp4", ".webm", ".mov", ".m3u8", ".ts", ".mp3", ".ogg", ".flv",
+	}
+)
+
+// Options 控制启用哪些分析板块. 零值只统计基础排名, 且不过滤任何 URL
+type Options struct {
+	// LogFormat 为 nginx log_format 定义, 为空时使用 DefaultLogFormat
+	LogFormat string
+	// TimeFormat 为 $time_local 或 $time_iso8601 的时间格式, Go 布局或 strftime 均可 (见 TimeLayout),
+	// 为空时在 nginx 的两种默认格式之间自动识别. 无法解析的时间计入 Report.BadTimestamps
+	TimeFormat string
+	// URLFilter 中任一子串出现在 URL 中时, 该请求不参与排名等统计
+	URLFilter []string
+	// ExcludeMethods 中的 HTTP 方法 (大写, 如 OPTIONS/HEAD) 与 URLFilter 一样不参与排名等统计,
+	// 只按方法计入 Report.ExcludedMethods
+	ExcludeMethods []string
+	// ExcludeUserAgents 中任一正则匹配整个 UA 时该请求不参与统计, 计入 Report.ExcludedUserAgents,
+	// 可用 CompileUserAgentPatterns 生成
+	ExcludeUserAgents []*regexp.Regexp
+
+	// NormalizeUserAgents 为 true 时 UA 排名按 NormalizeUserAgent 去掉版本号后统计,
+	// 各项的 Rank.Variants 为合并进该项的不同原始 UA 数. ExcludeUserAgents 仍匹配原始 UA
+	NormalizeUserAgents bool
+	// ExcludeIPs 中的网段包含客户端 IP (按 TrustedProxies 解析 X-Forwarded-For 之后) 时,
+	// 该请求不参与任何统计, 计入 Report.ExcludedIPs; IncludeIPs 中的网段不排除, 用于保留其中的个别网段
+	ExcludeIPs []*net.IPNet
+	IncludeIPs []*net.IPNet
+	// ExcludePaths 中的路径与请求路径 (不含查询参数) 相同时该请求不参与统计, 计入 Report.ExcludedPaths
+	ExcludePaths []string
+
+	// OutlierBytes 或 OutlierTime 大于 0 时, 响应字节数或 $request_time 超过阈值的请求在统计时逐条交给 OnOutlier,
+	// 不在内存中保留, 条数计入 Report.Outliers. 在 ExcludeMethods 等排除规则之后、URLFilter 之前判断,
+	// 因此过大的静态资源同样计入. 并行统计 (AnalyzeFile) 时 OnOutlier 可能被多个 goroutine 同时调用
+	OutlierBytes int64
+	OutlierTime  time.Duration
+	OnOutlier    func(Outlier)
+
+	// StripQuery 为 true 时各项统计去掉 URL 中的查询参数, 只按路径统计
+	StripQuery bool
+	// Params 统计带查询参数的请求中各参数名的出现次数, 以及 ParamValues 中各参数的取值排名, 见 ParamReport.
+	// 参数在 StripQuery 与 URLGroups 之前提取, 不受二者影响
+	Params      bool
+	ParamValues []string
+
+	// URLGroups 在过滤之后、统计之前把匹配的 URL 归入业务分组, 见 URLGroupRule.
+	// 各规则归入的请求数见 Report.URLGroups
+	URLGroups []URLGroupRule
+
+	// MinCount 大于 0 时, 各计数排名 (IP/UA/URL/时间/状态码/CountBy) 去掉请求数低于该值的项,
+	// 并在末尾追加一行 "(other)", 汇总所有未列出的项 (低于阈值及排在前十之外的), 使各行之和等于总数.
+	// 阈值在 URLFilter 过滤之后、取前十之前应用; 衰减计数与求和排名不受影响
+	MinCount int
+
+	// SortBy 为各排名 (基础排名、CountBy 与 SumBy) 的排序方式: SortByCount (默认);
+	// SortByName 仍按请求数 (或分值) 选取前十, 再按键名排列, 便于比对不同报告;
+	// SortByBytes 按 $body_bytes_sent 之和选取并排序, 只适用于计数排名, 衰减计数不支持
+	SortBy string
+
+	// TrustedProxies 非空时, 从 X-Forwarded-For 右侧跳过可信代理确定客户端 IP
+	TrustedProxies []*net.IPNet
+	// IgnoreXFF 为 true 时始终使用 $remote_addr
+	IgnoreXFF bool
+
+	// Decay 为 true 时排名使用指数衰减计数, 每经过 HalfLife 权重减半
+	Decay    bool
+	HalfLife time.Duration
+
+	// Sessions 启用访问(visit)分析, 间隔超过 SessionGap 视为新的访问
+	Sessions           bool
+	SessionGap         time.Duration
+	SessionExcludeBots bool
+
+	// Referers 启用垃圾来源与盗链分析, OwnHost 为空时跳过盗链检测
+	Referers    bool
+	OwnHost     string
+	SpamDomains []string
+	// RefererDomains 启用按可注册域名 (eTLD+1) 汇总的来源排名, 见 RefererDomain
+	RefererDomains bool
+
+	// MethodURL 启用 URL × HTTP 方法交叉统计
+	MethodURL bool
+	// NotFound 启用 404 URL 及来源统计
+	NotFound bool
+	// Redirects 启用重定向统计与跳转链推测
+	Redirects bool
+	// Sizes 启用响应大小分布
+	Sizes bool
+	// Writes 启用写请求 (WriteMethods) 统计. 日志格式包含 $request_length 时统计上行字节数,
+	// 包含 $request_time 时统计耗时 (LatencySketch 同样适用)
+	Writes bool
+
+	// Latency 启用 $request_time 分位数统计, 需要日志格式包含 $request_time.
+	// 默认保存全部耗时以得到精确值; LatencySketch 为 true 时改用对数分桶估算,
+	// 每个 URL 的内存与请求数无关. 只列出请求数最多的 LatencyTop 个且不少于 LatencyMinCount 次的路径
+	Latency         bool
+	LatencySketch   bool
+	LatencyTop      int
+	LatencyMinCount int
+
+	// CountBy 为额外按请求数排名的字段, SumBy 为额外按数值字段求和排名的指标,
+	// 字段名不带 $. 可先用 Validate 检查字段是否存在于日志格式中
+	CountBy []string
+	SumBy   []SumSpec
+
+	// Uniques 启用独立 IP/URL 计数 (总数及每天、每小时的独立 IP).
+	// LowMemory 为 true 时改用 HyperLogLog 估算, 每个计数固定占用 16KB, 标准误差约 0.8%
+	Uniques   bool
+	LowMemory bool
+
+	// Countries 启用按国家/地区的请求数排名, 需要 GeoIP 库, GeoIP 为 nil 时忽略
+	Countries bool
+	GeoIP     *GeoIP
+	// OnlyCountries 非空时只统计来自这些国家/地区 (ISO 3166-1 代码, 如 "DE") 的请求,
+	// ExcludeCountries 中的国家/地区不参与统计. 与 ExcludeIPs 一样在解析 X-Forwarded-For 之后、
+	// 任何统计之前应用, 排除的请求计入 Report.ExcludedCountries; 需要 GeoIP, GeoIP 为 nil 时忽略.
+	// 库中查不到国家的地址 (如内网地址) 在 KeepUnknownCountry 为 true 时保留, 否则排除
+	OnlyCountries      []string
+	ExcludeCountries   []string
+	KeepUnknownCountry bool
+
+	// Spikes 启用每分钟请求数突增检测
+	Spikes      bool
+	SpikeWindow int
+	SpikeSigma  float64
+
+	// Regularity 统计请求数最多的 RegularityTop 个 IP 的请求间隔, 请求数不少于 RegularityMinRequests
+	// 且间隔的变异系数不超过 RegularityMaxCV 的 IP 标为疑似定时抓取, 见 RegularityReport
+	Regularity            bool
+	RegularityTop         int
+	RegularityMinRequests int
+	RegularityMaxCV       float64
+
+	// Bots 统计 UA 自称搜索引擎爬虫 (见 SearchBots) 的请求, 按爬虫与 IP 列出, 可再用 BotVerifier 验证
+	Bots bool
+
+	// SampleRate 在 0 与 1 之间时只统计约该比例的行 (按行内容的哈希抽取, 结果固定),
+	// 报告中的计数按比例放大为估算值, 见 Report.Sample. 为 0 或 1 时统计全部行
+	SampleRate float64
+
+	// Trend 启用每日趋势: 每天的请求数、流量、错误率及较前一天的变化
+	Trend bool
+
+	// MaxLineSize 为 AnalyzeFile 读取的单行上限 (字节), 超过的行跳过并计入 Report.OversizedLines.
+	// 为 0 时使用 DefaultMaxLineSize
+	MaxLineSize int
+
+	// splitBy 为 Splitter 分组的字段, 由 NewSplitter 设置
+	splitBy string
+}
+
+// Analyzer 逐行汇总访问日志. 不能并发调用, 并发场景使用 Stream
+type Analyzer struct {
+	opts   Options
+	parser *gonx.Parser
+
+	lines             int
+	sampledLines      int
+	parseErrors       int
+	oversizedLines    int
+	malformedCount    int
+	malformedExamples []string
+	badTimestamps     int
+	badTimeExamples   []string
+	timeLayout        string
+	excludedMethods   map[string]int
+	excludedUAs       int
+	excludedIPs       int
+	excludedCountries int
+	outliers          int
+	excludedPaths     int
+	urlGroups         *urlGrouper
+
+	ipCounts        *keyCounter
+	urlCounts       *keyCounter
+	userAgentCounts *keyCounter
+	uaVariants      uaVariants
+	hourCounts      *keyCounter
+	statusCounts    *keyCounter
+
+	ipDecay        *decayCounter
+	urlDecay       *decayCounter
+	userAgentDecay *decayCounter
+	statusDecay    *decayCounter
+
+	sessions     *sessionTracker
+	referers     *refererTracker
+	refDomains   *refererDomainTracker
+	methodURLs   map[string]map[string]int
+	notFound     *notFoundTracker
+	redirects    *redirectTracker
+	sizes        *sizeCounter
+	latency      *latencyTracker
+	writes       *writeTracker
+	uniques      *uniqueTracker
+	countries    *countryTracker
+	geo          *countryCache
+	custom       *customCounter
+	minuteCounts map[int64]int
+	trend        *trendTracker
+	bots         botTracker
+	regularity   *regularityTracker
+	params       *paramTracker
+	location     *time.Location
+
+	errors     int
+	start, end time.Time
+	// statusClasses[1] 至 [5] 为 1xx 至 5xx 的请求数, [0] 为无效的状态码
+	statusClasses [6]int
+}
+
+// New 按 opts 创建 Analyzer
+func New(opts Options) *Analyzer {
+	if opts.LogFormat == "" {
+		opts.LogFormat = DefaultLogFormat
+	}
+	if opts.SortBy == "" {
+		opts.SortBy = SortByCount
+	}
+	a := &Analyzer{
+		opts:            opts,
+		parser:          newParser(opts.LogFormat),
+		timeLayout:      timeLayoutOrAuto(opts.TimeFormat),
+		ipCounts:        newKeyCounter(),
+		urlCounts:       newKeyCounter(),
+		userAgentCounts: newKeyCounter(),
+		hourCounts:      newKeyCounter(),
+		statusCounts:    newKeyCounter(),
+		location:        time.Local,
+	}
+	if len(opts.URLGroups) > 0 {
+		a.urlGroups = newURLGrouper(opts.URLGroups)
+	}
+	if opts.Decay {
+		a.ipDecay = newDecayCounter(opts.HalfLife)
+		a.urlDecay = newDecayCounter(opts.HalfLife)
+		a.userAgentDecay = newDecayCounter(opts.HalfLife)
+		a.statusDecay = newDecayCounter(opts.HalfLife)
+	}
+	if opts.Sessions {
+		a.sessions = newSessionTracker(opts.SessionGap, opts.SessionExcludeBots)
+	}
+	if opts.Referers {
+		a.referers = newRefererTracker(opts.OwnHost, opts.SpamDomains)
+	}
+	if opts.RefererDomains {
+		a.refDomains = newRefererDomainTracker()
+	}
+	if opts.MethodURL {
+		a.methodURLs = make(map[string]map[string]int)
+	}
+	if opts.NotFound {
+		a.notFound = newNotFoundTracker(opts.OwnHost)
+	}
+	if opts.Redirects {
+		a.redirects = newRedirectTracker()
+	}
+	if opts.Sizes {
+		a.sizes = newSizeCounter()
+	}
+	if opts.Latency {
+		a.latency = newLatencyTracker(opts.LatencySketch, opts.LatencyTop, opts.LatencyMinCount)
+	}
+	if opts.Uniques {
+		a.uniques = newUniqueTracker(opts.LowMemory)
+	}
+	if opts.GeoIP != nil && (opts.Countries || opts.filterCountries()) {
+		a.geo = newCountryCache(opts.GeoIP)
+	}
+	if opts.Countries && a.geo != nil {
+		a.countries = newCountryTracker(a.geo)
+	}
+	if opts.Writes {
+		a.writes = newWriteTracker(opts.LogFormat, opts.LatencySketch)
+	}
+	if len(opts.CountBy) > 0 || len(opts.SumBy) > 0 {
+		a.custom = newCustomCounter(opts.CountBy, opts.SumBy, opts.MinCount, opts.SortBy)
+	}
+	if opts.Spikes {
+		a.minuteCounts = make(map[int64]int)
+	}
+	if opts.Trend {
+		a.trend = newTrendTracker()
+	}
+	if opts.Bots {
+		a.bots = make(botTracker)
+	}
+	if opts.Params || len(opts.ParamValues) > 0 {
+		a.params = newParamTracker(opts.ParamValues)
+	}
+	if opts.Regularity {
+		a.regularity = newRegularityTracker(opts.RegularityTop, opts.RegularityMinRequests, opts.RegularityMaxCV)
+	}
+	if opts.NormalizeUserAgents {
+		a.uaVariants = make(uaVariants)
+	}
+	return a
+}
+
+func (o *Options) filterCountries() bool {
+	return len(o.OnlyCountries) > 0 || len(o.ExcludeCountries) > 0
+}
+
+func (a *Analyzer) sampling() bool {
+	return a.opts.SampleRate > 0 && a.opts.SampleRate < 1
+}
+
+// AddLine 解析并统计一行日志. 无法按日志格式解析时返回错误, 该行仅计入 Report.ParseErrors.
+// 抽样 (Options.SampleRate) 时未抽中的行只计入 Report.Lines
+func (a *Analyzer) AddLine(line string) error {
+	if a.sampling() {
+		if !sampleKeep(line, a.opts.SampleRate) {
+			a.lines++
+			return nil
+		}
+		a.sampledLines++
+	}
+	entry, err := a.parse(line)
+	a.add(entry, err)
+	return err
+}
+
+// AddOversizedLine 记录一行因超过长度上限而未读取的日志 (见 LineReader), 计入 Report.Lines 与
+// Report.OversizedLines. 这些行没有参与抽样, 计数不按抽样比例放大
+func (a *Analyzer) AddOversizedLine() {
+	a.lines++
+	a.oversizedLines++
+}
+
+// parse 只读取 Analyzer 的配置, 可以在多个 goroutine 中同时调用
+func (a *Analyzer) parse(line string) (logEntry, error) {
+	return parseLogLine(a.parser, line, &a.opts)
+}
+
+// add 统计 parse 的结果
+func (a *Analyzer) add(entry logEntry, parseErr error) {
+	a.lines++
+	if parseErr != nil {
+		a.parseErrors++
+		return
+	}
+	ip, url, userAgent, status := entry.IP, entry.URL, entry.UserAgent, entry.Status
+
+	// 排除的 IP 不出现在任何板块中, 包括过滤之前统计的盗链、404 等
+	if len(a.opts.ExcludeIPs) > 0 && excludedIP(ip, a.opts.ExcludeIPs, a.opts.IncludeIPs) {
+		a.excludedIPs++
+		return
+	}
+	if a.geo != nil && a.opts.filterCountries() && excludedCountry(a.geo, ip, &a.opts) {
+		a.excludedCountries++
+		return
+	}
+
+	// 无法解析的请求单独计数, 不参与各项排名
+	if entry.Malformed {
+		a.malformedCount++
+		if len(a.malformedExamples) < 3 {
+			a.malformedExamples = append(a.malformedExamples, entry.Request)
+		}
+		return
+	}
+
+	// 盗链检测针对静态资源, 需在过滤之前统计
+	if a.referers != nil {
+		a.referers.Add(entry)
+	}
+	// 失效的图片/脚本链接同样需要排查, 404 统计也在过滤之前
+	if a.notFound != nil {
+		a.notFound.Add(entry)
+	}
+
+	// 时间无法解析的请求仍参与其他统计, 只是不计入按时间划分的板块
+	t, err := parseTimestamp(a.timeLayout, entry.Timestamp)
+	if err != nil && entry.Timestamp != "" {
+		a.badTimestamps++
+		if len(a.badTimeExamples) < 3 {
+			a.badTimeExamples = append(a.badTimeExamples, entry.Timestamp)
+		}
+	}
+	if a.redirects != nil {
+		a.redirects.Add(entry, t)
+	}
+
+	// 过滤
+	if containsString(a.opts.ExcludeMethods, entry.Method) {
+		if a.excludedMethods == nil {
+			a.excludedMethods = make(map[string]int)
+		}
+		a.excludedMethods[entry.Method]++
+		return
+	}
+	if matchAnyPattern(userAgent, a.opts.ExcludeUserAgents) {
+		a.excludedUAs++
+		return
+	}
+	if len(a.opts.ExcludePaths) > 0 && containsString(a.opts.ExcludePaths, requestPath(url)) {
+		a.excludedPaths++
+		return
+	}
+	if a.opts.OnOutlier != nil && isOutlier(entry, a.opts.OutlierBytes, a.opts.OutlierTime) {
+		a.outliers++
+		a.opts.OnOutlier(Outlier{
+			Time:        entry.Timestamp,
+			IP:          ip,
+			Method:      entry.Method,
+			URL:         url,
+			Status:      status,
+			Bytes:       entry.Bytes,
+			RequestTime: entry.RequestTime,
+			UserAgent:   userAgent,
+		})
+	}
+	if containsAny(url, a.opts.URLFilter) {
+		return
+	}
+	if a.params != nil {
+		a.params.Add(url)
+	}
+	if a.opts.StripQuery {
+		url = requestPath(url)
+		entry.URL = url
+	}
+	if a.urlGroups != nil {
+		url = a.urlGroups.Group(url)
+		entry.URL = url
+	}
+	if a.uaVariants != nil {
+		raw := userAgent
+		userAgent = NormalizeUserAgent(raw)
+		a.uaVariants.Add(userAgent, raw)
+	}
+
+	a.ipCounts.Add(ip, entry.Bytes)
+	a.userAgentCounts.Add(userAgent, entry.Bytes)
+	a.urlCounts.Add(url, entry.Bytes)
+	a.statusCounts.Add(status, entry.Bytes)
+	a.statusClasses[statusClass(status)]++
+	if a.countries != nil {
+		a.countries.Add(ip, entry.Bytes)
+	}
+	if a.refDomains != nil {
+		a.refDomains.Add(entry.Referer, entry.Bytes)
+	}
+	if a.bots != nil {
+		a.bots.Add(ip, entry.UserAgent)
+	}
+	isError := false
+	if code, err := strconv.Atoi(status); err == nil && code >= 400 {
+		isError = true
+		a.errors++
+	}
+	if a.custom != nil {
+		a.custom.Add(entry)
+	}
+
+	if a.sizes != nil {
+		a.sizes.Add(entry.Bytes)
+	}
+	if a.latency != nil {
+		a.latency.Add(url, entry.RequestTime)
+	}
+	if a.writes != nil {
+		a.writes.Add(entry)
+	}
+
+	if a.uniques != nil {
+		var at time.Time
+		if err == nil {
+			at = t
+		}
+		a.uniques.Add(ip, url, at)
+	}
+
+	if err == nil {
+		if a.start.IsZero() || t.Before(a.start) {
+			a.start = t
+		}
+		if t.After(a.end) {
+			a.end = t
+		}
+		a.hourCounts.Add(t.Format("15:00"), entry.Bytes)
+		if a.minuteCounts != nil {
+			a.minuteCounts[t.Unix()/60]++
+			a.location = t.Location()
+		}
+		if a.trend != nil {
+			a.trend.Add(t, entry.Bytes, isError)
+		}
+		if a.regularity != nil {
+			a.regularity.Add(ip, t, url, userAgent)
+		}
+	}
+
+	if a.opts.Decay {
+		a.ipDecay.Add(ip, t)
+		a.urlDecay.Add(url, t)
+		a.userAgentDecay.Add(userAgent, t)
+		a.statusDecay.Add(status, t)
+	}
+
+	if a.methodURLs != nil {
+		method := entry.Method
+		switch method {
+		case "GET", "POST", "PUT", "DELETE":
+		default:
+			method = "other"
+		}
+		if a.methodURLs[method] == nil {
+			a.methodURLs[method] = make(map[string]int)
+		}
+		a.methodURLs[method][requestPath(url)]++
+	}
+
+	if a.sessions != nil {
+		a.sessions.Add(ip, userAgent, url, t)
+	}
+}
+
+// Report 汇总目前为止的结果. 不修改内部状态, 之后可以继续 AddLine
+func (a *Analyzer) Report() *Report {
+	rep := &Report{
+		Lines:              a.lines,
+		ParseErrors:        a.parseErrors,
+		OversizedLines:     a.oversizedLines,
+		MalformedCount:     a.malformedCount,
+		MalformedExamples:  append([]string(nil), a.malformedExamples...),
+		BadTimestamps:      a.badTimestamps,
+		BadTimeExamples:    append([]string(nil), a.badTimeExamples...),
+		MinCount:           a.opts.MinCount,
+		SortBy:             a.opts.SortBy,
+		Requests:           a.statusCounts.total,
+		Errors:             a.errors,
+		ExcludedUserAgents: a.excludedUAs,
+		ExcludedPaths:      a.excludedPaths,
+		ExcludedIPs:        a.excludedIPs,
+		ExcludedCountries:  a.excludedCountries,
+		Outliers:           a.outliers,
+		Summary:            a.summary(),
+	}
+	if !a.start.IsZero() {
+		start, end := a.start, a.end
+		rep.Start, rep.End = &start, &end
+	}
+	if len(a.excludedMethods) > 0 {
+		rep.ExcludedMethods = make(map[string]int, len(a.excludedMethods))
+		for m, n := range a.excludedMethods {
+			rep.ExcludedMethods[m] = n
+		}
+	}
+
+	if a.opts.Decay {
+		rep.Decay = &DecayInfo{
+			HalfLifeSeconds: a.opts.HalfLife.Seconds(),
+			ReferenceTime:   a.ipDecay.last,
+		}
+		rep.TopIPs = topScores(a.ipDecay.Scores())
+		rep.TopUserAgents = topScores(a.userAgentDecay.Scores())
+		rep.TopURLs = topScores(a.urlDecay.Scores())
+		rep.TopStatuses = topScores(a.statusDecay.Scores())
+		if a.opts.SortBy == SortByName {
+			for _, ranks := range [][]Rank{rep.TopIPs, rep.TopUserAgents, rep.TopURLs, rep.TopStatuses} {
+				sortRanksByKey(ranks)
+			}
+		}
+	} else {
+		rep.TopIPs = a.ipCounts.Ranks(a.opts.MinCount, a.opts.SortBy)
+		rep.TopUserAgents = a.userAgentCounts.Ranks(a.opts.MinCount, a.opts.SortBy)
+		rep.TopURLs = a.urlCounts.Ranks(a.opts.MinCount, a.opts.SortBy)
+		rep.TopHours = a.hourCounts.Ranks(a.opts.MinCount, a.opts.SortBy)
+		rep.TopStatuses = a.statusCounts.Ranks(a.opts.MinCount, a.opts.SortBy)
+	}
+	if a.uaVariants != nil {
+		a.uaVariants.fill(rep.TopUserAgents)
+	}
+
+	if a.urlGroups != nil {
+		rep.URLGroups = a.urlGroups.Report()
+	}
+	if a.custom != nil {
+		rep.Custom = a.custom.Report()
+	}
+	if a.sessions != nil {
+		rep.Sessions = a.sessions.Report()
+	}
+	if a.referers != nil {
+		rep.Referers = a.referers.Report()
+	}
+	if a.refDomains != nil {
+		rep.RefererDomains = a.refDomains.Report()
+	}
+	if a.methodURLs != nil {
+		rep.MethodURL = methodURLReport(a.methodURLs)
+	}
+	if a.notFound != nil {
+		rep.NotFound = a.notFound.Report()
+	}
+	if a.redirects != nil {
+		rep.Redirects = a.redirects.Report()
+	}
+	if a.sizes != nil {
+		rep.Sizes = a.sizes.Report()
+	}
+	if a.latency != nil {
+		rep.Latency = a.latency.Report()
+	}
+	if a.writes != nil {
+		rep.Writes = a.writes.Report()
+	}
+	if a.uniques != nil {
+		rep.Uniques = a.uniques.Report()
+	}
+	if a.countries != nil {
+		rep.Countries = a.countries.Report(a.opts.SortBy)
+	}
+	if a.trend != nil {
+		rep.Trend = a.trend.Report()
+	}
+	if a.params != nil {
+		rep.Params = a.params.Report()
+	}
+	if a.regularity != nil {
+		rep.Regularity = a.regularity.Report()
+	}
+	if a.bots != nil {
+		rep.Bots = a.bots.Report()
+	}
+	if a.minuteCounts != nil {
+		rep.Spikes = &SpikeReport{
+			Window: a.opts.SpikeWindow,
+			Sigma:  a.opts.SpikeSigma,
+			Spikes: detectSpikes(a.minuteCounts, a.opts.SpikeWindow, a.opts.SpikeSigma, a.location),
+		}
+	}
+	if a.sampling() {
+		rep.applySample(a.opts.SampleRate, a.sampledLines)
+	}
+	return rep
+}
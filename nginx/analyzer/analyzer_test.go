@@ -0,0 +1,269 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "重新生成 testdata 中的 golden 文件")
+
+// goldenCases 为 testdata 中的日志及其分析选项, 结果与同名的 .json 比较.
+// 排名按键名排序, 且各排名的项数少于十个, 避免请求数相同时的先后顺序影响结果
+var goldenCases = []struct {
+	name string
+	opts Options
+}{
+	{"combined", Options{
+		LogFormat:      `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+		URLFilter:      DefaultURLFilter,
+		SortBy:         SortByName,
+		Referers:       true,
+		OwnHost:        "example.com",
+		SpamDomains:    DefaultSpamDomains,
+		MethodURL:      true,
+		NotFound:       true,
+		Sizes:          true,
+		Uniques:        true,
+		Trend:          true,
+		Params:         true,
+		ExcludeMethods: []string{"HEAD"},
+	}},
+	{"xff", Options{
+		LogFormat:      `$remote_addr - [$time_local] "$request" $status $body_bytes_sent $request_time "$http_user_agent" "$http_x_forwarded_for"`,
+		SortBy:         SortByName,
+		TrustedProxies: mustParseCIDRList("10.0.0.0/8"),
+		Latency:        true,
+		LatencyTop:     10,
+		Uniques:        true,
+		StripQuery:     true,
+	}},
+	{"json", Options{
+		LogFormat: `{"remote_addr":"$remote_addr","time_iso8601":"$time_iso8601","request":"$request","status":"$status","body_bytes_sent":"$body_bytes_sent","request_time":"$request_time","http_referer":"$http_referer","http_user_agent":"$http_user_agent"}`,
+		SortBy:    SortByName,
+		Latency:   true,
+		Uniques:   true,
+		Trend:     true,
+		CountBy:   []string{"http_referer"},
+	}},
+	{"malformed", Options{
+		SortBy: SortByName,
+	}},
+}
+
+// analyzeFixture 逐行统计 testdata 中的日志, 与命令行工具的顺序统计相同
+func analyzeFixture(t testing.TB, name string, opts Options) *Analyzer {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", name+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	a := New(opts)
+	lines := NewLineReader(file, opts.MaxLineSize)
+	for lines.Next() {
+		a.AddLine(lines.Text())
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < lines.Oversized; i++ {
+		a.AddOversizedLine()
+	}
+	return a
+}
+
+func reportJSON(t testing.TB, rep *Report) []byte {
+	t.Helper()
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+func TestGoldenReports(t *testing.T) {
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := reportJSON(t, analyzeFixture(t, tc.name, tc.opts).Report())
+			golden := filepath.Join("testdata", tc.name+".json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (用 go test -update 生成)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("报告与 %s 不同, 确认改动无误后用 go test -update 更新:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// 时间按日志中的时区划入小时、天等时间段, 而不是按本机时区
+func TestTimeBuckets(t *testing.T) {
+	a := New(Options{Uniques: true, Trend: true, SortBy: SortByName})
+	for _, line := range []string{
+		`1.1.1.1 - - [14/Oct/2026:23:59:59 +0800] "GET /a HTTP/1.1" 200 10 "-" "ua" "-"`,
+		`2.2.2.2 - - [15/Oct/2026:00:00:00 +0800] "GET /a HTTP/1.1" 500 20 "-" "ua" "-"`,
+		`1.1.1.1 - - [15/Oct/2026:00:30:00 +0800] "GET /b HTTP/1.1" 200 30 "-" "ua" "-"`,
+		`3.3.3.3 - - [14/Oct/2026:16:00:00 +0000] "GET /c HTTP/1.1" 200 40 "-" "ua" "-"`,
+	} {
+		if err := a.AddLine(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rep := a.Report()
+
+	hours := map[string]float64{}
+	for _, r := range rep.TopHours {
+		hours[r.Key] = r.Count
+	}
+	if len(hours) != 3 || hours["23:00"] != 1 || hours["00:00"] != 2 || hours["16:00"] != 1 {
+		t.Errorf("TopHours = %+v", rep.TopHours)
+	}
+
+	wantDays := []UniqueBucket{{"2026-10-14", 2}, {"2026-10-15", 2}}
+	if !equalBuckets(rep.Uniques.Days, wantDays) {
+		t.Errorf("Uniques.Days = %+v, want %+v", rep.Uniques.Days, wantDays)
+	}
+	wantHours := []UniqueBucket{{"2026-10-14 16:00", 1}, {"2026-10-14 23:00", 1}, {"2026-10-15 00:00", 2}}
+	if !equalBuckets(rep.Uniques.Hours, wantHours) {
+		t.Errorf("Uniques.Hours = %+v, want %+v", rep.Uniques.Hours, wantHours)
+	}
+
+	if len(rep.Trend) != 2 || rep.Trend[0].Day != "2026-10-14" || rep.Trend[0].Requests != 2 ||
+		rep.Trend[1].Day != "2026-10-15" || rep.Trend[1].Requests != 2 || rep.Trend[1].Errors != 1 {
+		t.Errorf("Trend = %+v", rep.Trend)
+	}
+	if rep.Start == nil || !rep.Start.Equal(time.Date(2026, 10, 14, 15, 59, 59, 0, time.UTC)) {
+		t.Errorf("Start = %v", rep.Start)
+	}
+}
+
+func equalBuckets(a, b []UniqueBucket) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTimeLayout(t *testing.T) {
+	tests := []struct {
+		format, layout string
+		ok             bool
+	}{
+		{"", "", true},
+		{"%d/%b/%Y:%H:%M:%S %z", "02/Jan/2006:15:04:05 -0700", true},
+		{"%Y-%m-%dT%H:%M:%S%:z", "2006-01-02T15:04:05-07:00", true},
+		{"%F %T", "2006-01-02 15:04:05", true},
+		{"2006-01-02 15:04:05", "2006-01-02 15:04:05", true},
+		{"%Q", "", false},
+		{"plain text", "", false},
+	}
+	for _, tt := range tests {
+		layout, err := TimeLayout(tt.format)
+		if (err == nil) != tt.ok || layout != tt.layout {
+			t.Errorf("TimeLayout(%q) = %q, %v; want %q, ok=%v", tt.format, layout, err, tt.layout, tt.ok)
+		}
+	}
+}
+
+func TestParseTimestampAuto(t *testing.T) {
+	want := time.Date(2026, 10, 15, 8, 30, 0, 0, time.UTC)
+	for _, s := range []string{"15/Oct/2026:10:30:00 +0200", "2026-10-15T10:30:00+02:00"} {
+		got, err := parseTimestamp("", s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseTimestamp(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := parseTimestamp("", "yesterday"); err == nil {
+		t.Error("parseTimestamp(yesterday) succeeded, want an error")
+	}
+}
+
+func TestTopSelector(t *testing.T) {
+	top := newTopSelector(3)
+	for i, score := range []float64{5, 1, 9, 5, 7, 2, 5} {
+		top.Offer(string(rune('a'+i)), score)
+	}
+	// 分值相同时按键名排列, 同为 5 的 d、g 排不进前三
+	want := []string{"c", "e", "a"}
+	if len(top.keys) != len(want) {
+		t.Fatalf("keys = %v, want %v", top.keys, want)
+	}
+	for i := range want {
+		if top.keys[i] != want[i] {
+			t.Fatalf("keys = %v, want %v", top.keys, want)
+		}
+	}
+}
+
+// 分值相同时结果与提供的顺序无关
+func TestTopSelectorTies(t *testing.T) {
+	for _, order := range [][]string{{"x", "b", "m"}, {"m", "x", "b"}, {"b", "m", "x"}} {
+		top := newTopSelector(2)
+		for _, key := range order {
+			top.Offer(key, 1)
+		}
+		if len(top.keys) != 2 || top.keys[0] != "b" || top.keys[1] != "m" {
+			t.Errorf("offering %v: keys = %v, want [b m]", order, top.keys)
+		}
+	}
+}
+
+func TestKeyCounterRanks(t *testing.T) {
+	k := newKeyCounter()
+	add := func(key string, n int, bytes int64) {
+		for i := 0; i < n; i++ {
+			k.Add(key, bytes)
+		}
+	}
+	for i := 0; i < 12; i++ {
+		add(string(rune('a'+i)), 20-i, 1)
+	}
+	add("big", 2, 1000)
+
+	ranks := k.Ranks(0, SortByCount)
+	if len(ranks) != 10 || ranks[0].Key != "a" || ranks[0].Count != 20 || ranks[9].Key != "j" {
+		t.Errorf("count ranks = %+v", ranks)
+	}
+
+	ranks = k.Ranks(15, SortByCount)
+	last := ranks[len(ranks)-1]
+	if len(ranks) != 7 || !last.Other || last.Key != OtherKey {
+		t.Fatalf("min count ranks = %+v", ranks)
+	}
+	var sum float64
+	for _, r := range ranks {
+		sum += r.Count
+	}
+	// a 至 f 列出, 其余 (含 big 的 2000 字节) 计入 "(other)"
+	if int(sum) != k.total || last.Bytes != 2069 {
+		t.Errorf("ranks sum to %v requests and other has %d bytes, want %d requests and 2069 bytes", sum, last.Bytes, k.total)
+	}
+
+	ranks = k.Ranks(0, SortByBytes)
+	if ranks[0].Key != "big" || ranks[0].Bytes != 2000 {
+		t.Errorf("byte ranks = %+v", ranks)
+	}
+
+	ranks = k.Ranks(0, SortByName)
+	if len(ranks) != 10 || ranks[0].Key != "a" || ranks[9].Key != "j" {
+		t.Errorf("name ranks = %+v", ranks)
+	}
+}
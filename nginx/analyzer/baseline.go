@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// NewEntries 为与基线报告相比新出现的 IP 与 URL.
+// 基线只保存了各排名的前十, 未进入基线排名的项同样视为新出现
+type NewEntries struct {
+	// Baseline 为基线报告的来源, 如文件名
+	Baseline string `json:"baseline"`
+	IPs      []Rank `json:"ips"`
+	URLs     []Rank `json:"urls"`
+}
+
+// LoadReport 读取以 JSON 保存的 Report, 如命令行工具 --output json 的输出
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rep Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, fmt.Errorf("%s 不是有效的 JSON 报告: %v", path, err)
+	}
+	return &rep, nil
+}
+
+// CompareBaseline 找出 r 的 IP 与 URL 排名中不在 baseline 对应排名里的项, 结果同时保存到 r.New
+func (r *Report) CompareBaseline(baseline *Report, source string) *NewEntries {
+	r.New = &NewEntries{
+		Baseline: source,
+		IPs:      newRanks(r.TopIPs, baseline.TopIPs),
+		URLs:     newRanks(r.TopURLs, baseline.TopURLs),
+	}
+	return r.New
+}
+
+func newRanks(current, baseline []Rank) []Rank {
+	known := make(map[string]bool, len(baseline))
+	for _, rank := range baseline {
+		known[rank.Key] = true
+	}
+	ranks := []Rank{}
+	for _, rank := range current {
+		if !rank.Other && !known[rank.Key] {
+			ranks = append(ranks, rank)
+		}
+	}
+	return ranks
+}
@@ -0,0 +1,215 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 爬虫 IP 的验证结果
+const (
+	BotVerified   = "verified"
+	BotImpostor   = "impostor"
+	BotUnverified = "unverified"
+)
+
+// SearchBot 为一个搜索引擎爬虫: UA 匹配 UserAgent 的请求自称为该爬虫,
+// 其 IP 的反向解析须落在 Domains 之一, 且该域名正向解析包含这个 IP
+type SearchBot struct {
+	Name      string
+	UserAgent *regexp.Regexp
+	Domains   []string
+}
+
+// SearchBots 为各搜索引擎公布了反向 DNS 验证方法的爬虫
+var SearchBots = []SearchBot{
+	{"Googlebot", regexp.MustCompile(`(?i)googlebot|google-inspectiontool|googleother|adsbot-google|mediapartners-google`), []string{"googlebot.com", "google.com", "googleusercontent.com"}},
+	{"Bingbot", regexp.MustCompile(`(?i)bingbot|adidxbot|bingpreview`), []string{"search.msn.com"}},
+	{"Baiduspider", regexp.MustCompile(`(?i)baiduspider`), []string{"baidu.com", "baidu.jp"}},
+	{"YandexBot", regexp.MustCompile(`(?i)yandex(bot|images|mobilebot)`), []string{"yandex.ru", "yandex.net", "yandex.com"}},
+	{"Applebot", regexp.MustCompile(`(?i)applebot`), []string{"applebot.apple.com"}},
+	{"Sogou", regexp.MustCompile(`(?i)sogou`), []string{"sogou.com"}},
+}
+
+// BotReport 为自称搜索引擎爬虫的请求, 按爬虫与 IP 列出
+type BotReport struct {
+	// Checked 为 true 表示已做过反向 DNS 验证, 否则各 IP 均为 BotUnverified
+	Checked bool    `json:"checked"`
+	IPs     []BotIP `json:"ips"`
+}
+
+// BotIP 为自称某爬虫的一个 IP. Host 为通过验证的反向解析域名,
+// Status 为 BotVerified、BotImpostor 或 BotUnverified (未查询、超出查询上限或查询失败)
+type BotIP struct {
+	Bot      string `json:"bot"`
+	IP       string `json:"ip"`
+	Requests int    `json:"requests"`
+	Status   string `json:"status"`
+	Host     string `json:"host,omitempty"`
+}
+
+// 按爬虫统计各 IP 的请求数, bot → ip → 请求数
+type botTracker map[string]map[string]int
+
+func (b botTracker) Add(ip, userAgent string) {
+	for _, bot := range SearchBots {
+		if bot.UserAgent.MatchString(userAgent) {
+			ips, ok := b[bot.Name]
+			if !ok {
+				ips = make(map[string]int)
+				b[bot.Name] = ips
+			}
+			ips[ip]++
+			return
+		}
+	}
+}
+
+func (b botTracker) merge(o botTracker) {
+	for bot, ips := range o {
+		mine, ok := b[bot]
+		if !ok {
+			b[bot] = ips
+			continue
+		}
+		for ip, n := range ips {
+			mine[ip] += n
+		}
+	}
+}
+
+// Report 按请求数从多到少列出全部 IP, 均未验证
+func (b botTracker) Report() *BotReport {
+	rep := &BotReport{IPs: []BotIP{}}
+	for bot, ips := range b {
+		for ip, n := range ips {
+			rep.IPs = append(rep.IPs, BotIP{Bot: bot, IP: ip, Requests: n, Status: BotUnverified})
+		}
+	}
+	sort.Slice(rep.IPs, func(i, j int) bool {
+		a, b := rep.IPs[i], rep.IPs[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		if a.Bot != b.Bot {
+			return a.Bot < b.Bot
+		}
+		return a.IP < b.IP
+	})
+	return rep
+}
+
+// BotResolver 为验证所需的 DNS 查询, *net.Resolver 满足此接口
+type BotResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// BotVerifier 按各搜索引擎公布的方法验证爬虫 IP: 反向解析 IP, 域名须属于该爬虫,
+// 再正向解析该域名, 结果须包含这个 IP. 同一 IP 只查询一次, 结果缓存在 BotVerifier 中
+type BotVerifier struct {
+	Resolver BotResolver
+	// Concurrency 为同时进行的查询数, MaxIPs 为最多验证的 IP 数 (按请求数从多到少), Timeout 为每个 IP 的查询时限
+	Concurrency int
+	MaxIPs      int
+	Timeout     time.Duration
+
+	mu    sync.Mutex
+	cache map[string][]string
+}
+
+// NewBotVerifier 使用系统的 DNS 解析创建 BotVerifier
+func NewBotVerifier(concurrency, maxIPs int, timeout time.Duration) *BotVerifier {
+	return &BotVerifier{Resolver: net.DefaultResolver, Concurrency: concurrency, MaxIPs: maxIPs, Timeout: timeout}
+}
+
+// Verify 验证 rep 中请求数最多的 MaxIPs 个 IP, 结果写入各项的 Status 与 Host
+func (v *BotVerifier) Verify(rep *BotReport) {
+	rep.Checked = true
+	n := len(rep.IPs)
+	if v.MaxIPs > 0 && n > v.MaxIPs {
+		n = v.MaxIPs
+	}
+	concurrency := v.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(entry *BotIP) {
+			defer func() { <-sem; wg.Done() }()
+			entry.Status, entry.Host = v.check(entry.Bot, entry.IP)
+		}(&rep.IPs[i])
+	}
+	wg.Wait()
+}
+
+func (v *BotVerifier) check(botName, ip string) (status, host string) {
+	var bot SearchBot
+	for _, b := range SearchBots {
+		if b.Name == botName {
+			bot = b
+		}
+	}
+	names, err := v.reverse(ip)
+	if err != nil {
+		return BotUnverified, ""
+	}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if !matchDomain(name, bot.Domains) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), v.Timeout)
+		addrs, err := v.Resolver.LookupIPAddr(ctx, name)
+		cancel()
+		if err != nil && !isNotFound(err) {
+			return BotUnverified, ""
+		}
+		for _, addr := range addrs {
+			if addr.IP.Equal(net.ParseIP(ip)) {
+				return BotVerified, name
+			}
+		}
+	}
+	// 没有反向解析记录、域名不属于该爬虫或正向解析不包含该 IP
+	return BotImpostor, ""
+}
+
+// 反向解析 IP, 结果按 IP 缓存. 没有 PTR 记录时返回空列表, 超时等其他错误不缓存
+func (v *BotVerifier) reverse(ip string) ([]string, error) {
+	v.mu.Lock()
+	if v.cache == nil {
+		v.cache = make(map[string][]string)
+	}
+	names, ok := v.cache[ip]
+	v.mu.Unlock()
+	if ok {
+		return names, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), v.Timeout)
+	defer cancel()
+	names, err := v.Resolver.LookupAddr(ctx, ip)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	v.mu.Lock()
+	v.cache[ip] = names
+	v.mu.Unlock()
+	return names, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,80 @@
+package analyzer
+
+import "sort"
+
+// UnknownCountry 为无法确定国家/地区的请求 (内网地址、库中没有的地址) 在国家排名中的名称
+const UnknownCountry = "(unknown)"
+
+// 查询 IP 所属的国家/地区, 每个 IP 只查一次库, 结果缓存在 cache 中. 国家排名与国家过滤共用
+type countryCache struct {
+	geoip *GeoIP
+	cache map[string]string
+}
+
+func newCountryCache(geoip *GeoIP) *countryCache {
+	return &countryCache{geoip: geoip, cache: make(map[string]string)}
+}
+
+// Country 返回 ISO 3166-1 代码, 库中查不到时为 UnknownCountry
+func (c *countryCache) Country(ip string) string {
+	country, ok := c.cache[ip]
+	if !ok {
+		country = c.geoip.Country(ip)
+		if country == "" {
+			country = UnknownCountry
+		}
+		c.cache[ip] = country
+	}
+	return country
+}
+
+// 按客户端 IP 所属国家/地区统计请求数
+type countryTracker struct {
+	lookup *countryCache
+	counts *keyCounter
+}
+
+func newCountryTracker(lookup *countryCache) *countryTracker {
+	return &countryTracker{lookup: lookup, counts: newKeyCounter()}
+}
+
+func (c *countryTracker) Add(ip string, bytes int64) {
+	c.counts.Add(c.lookup.Country(ip), bytes)
+}
+
+// 按 Options.OnlyCountries、ExcludeCountries 与 KeepUnknownCountry 判断是否排除该 IP 的请求
+func excludedCountry(lookup *countryCache, ip string, opts *Options) bool {
+	country := lookup.Country(ip)
+	if country == UnknownCountry {
+		return !opts.KeepUnknownCountry
+	}
+	if len(opts.OnlyCountries) > 0 && !containsString(opts.OnlyCountries, country) {
+		return true
+	}
+	return containsString(opts.ExcludeCountries, country)
+}
+
+func (c *countryTracker) merge(o *countryTracker) {
+	c.counts.merge(o.counts)
+}
+
+// Report 返回全部国家/地区 (不只前十), 按 sortBy 排序, UnknownCountry 总在最后
+func (c *countryTracker) Report(sortBy string) []Rank {
+	ranks := make([]Rank, 0, len(c.counts.stats))
+	for key, st := range c.counts.stats {
+		ranks = append(ranks, Rank{Key: key, Count: float64(st.Count), Bytes: st.Bytes, Other: key == UnknownCountry})
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		a, b := ranks[i], ranks[j]
+		switch {
+		case a.Other != b.Other:
+			return b.Other
+		case sortBy == SortByBytes && a.Bytes != b.Bytes:
+			return a.Bytes > b.Bytes
+		case sortBy != SortByName && a.Count != b.Count:
+			return a.Count > b.Count
+		}
+		return a.Key < b.Key
+	})
+	return ranks
+}
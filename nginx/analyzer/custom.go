@@ -0,0 +1,135 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var formatFieldPattern = regexp.MustCompile(`\$(\w+)`)
+
+// SumSpec 描述一个求和指标: 按 Field 分组, 累加 Value 字段的数值
+type SumSpec struct {
+	Field string
+	Value string
+}
+
+// ParseSumSpec 解析 "<field>:<numeric-field>" 形式的求和指标, 字段名可带 $ 前缀
+func ParseSumSpec(spec string) (SumSpec, error) {
+	field, value, ok := strings.Cut(spec, ":")
+	field, value = strings.TrimPrefix(field, "$"), strings.TrimPrefix(value, "$")
+	if !ok || field == "" || value == "" {
+		return SumSpec{}, fmt.Errorf("无效的求和指标 %q, 应为 <字段>:<数值字段>", spec)
+	}
+	return SumSpec{field, value}, nil
+}
+
+// CustomRanking 为按自定义字段统计的排名. Value 为空时 Ranks 为请求数, 否则为 Value 字段之和
+type CustomRanking struct {
+	Field string `json:"field"`
+	Value string `json:"value,omitempty"`
+	Ranks []Rank `json:"ranks"`
+}
+
+// FormatFields 返回日志格式中的全部字段名 (不含 $)
+func FormatFields(format string) []string {
+	var fields []string
+	for _, m := range formatFieldPattern.FindAllStringSubmatch(format, -1) {
+		fields = append(fields, m[1])
+	}
+	return fields
+}
+
+// Validate 检查 SortBy 是否有效, 以及 CountBy 与 SumBy 引用的字段是否都在日志格式中
+func (o Options) Validate() error {
+	switch o.SortBy {
+	case "", SortByCount, SortByName:
+	case SortByBytes:
+		if o.Decay {
+			return fmt.Errorf("衰减计数不支持按字节数排序")
+		}
+	default:
+		return fmt.Errorf("无效的排序方式 %q, 应为 %s、%s 或 %s", o.SortBy, SortByCount, SortByName, SortByBytes)
+	}
+
+	format := o.LogFormat
+	if format == "" {
+		format = DefaultLogFormat
+	}
+	fields := FormatFields(format)
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f] = true
+	}
+
+	names := append([]string(nil), o.CountBy...)
+	for _, spec := range o.SumBy {
+		names = append(names, spec.Field, spec.Value)
+	}
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("日志格式中没有字段 $%s, 可用字段: $%s", name, strings.Join(fields, ", $"))
+		}
+	}
+	return nil
+}
+
+// 自定义字段统计, 字段值在解析时取出, 汇总时只做计数
+type customCounter struct {
+	countBy  []string
+	sumBy    []SumSpec
+	minCount int
+	sortBy   string
+	counts   []*keyCounter
+	sums     []map[string]float64
+}
+
+func newCustomCounter(countBy []string, sumBy []SumSpec, minCount int, sortBy string) *customCounter {
+	c := &customCounter{countBy: countBy, sumBy: sumBy, minCount: minCount, sortBy: sortBy}
+	for range countBy {
+		c.counts = append(c.counts, newKeyCounter())
+	}
+	for range sumBy {
+		c.sums = append(c.sums, make(map[string]float64))
+	}
+	return c
+}
+
+func (c *customCounter) Add(e logEntry) {
+	for i, key := range e.CountKeys {
+		c.counts[i].Add(key, e.Bytes)
+	}
+	for i, key := range e.SumKeys {
+		// 非数值 (如 "-") 不计入
+		if v, err := strconv.ParseFloat(e.SumValues[i], 64); err == nil {
+			c.sums[i][key] += v
+		}
+	}
+}
+
+func (c *customCounter) merge(o *customCounter) {
+	for i := range c.counts {
+		c.counts[i].merge(o.counts[i])
+	}
+	for i := range c.sums {
+		for key, v := range o.sums[i] {
+			c.sums[i][key] += v
+		}
+	}
+}
+
+func (c *customCounter) Report() []CustomRanking {
+	var rankings []CustomRanking
+	for i, field := range c.countBy {
+		rankings = append(rankings, CustomRanking{Field: field, Ranks: c.counts[i].Ranks(c.minCount, c.sortBy)})
+	}
+	for i, spec := range c.sumBy {
+		ranks := topScores(c.sums[i])
+		if c.sortBy == SortByName {
+			sortRanksByKey(ranks)
+		}
+		rankings = append(rankings, CustomRanking{Field: spec.Field, Value: spec.Value, Ranks: ranks})
+	}
+	return rankings
+}
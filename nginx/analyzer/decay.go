@@ -0,0 +1,100 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// 指数衰减计数: 每次访问按日志时间加权, 统计结束后折算到最后一条日志的时刻,
+// 距今每多一个半衰期, 该次访问的贡献减半
+type decayCounter struct {
+	halfLife time.Duration
+	base     time.Time
+	last     time.Time
+	scores   map[string]float64
+}
+
+func newDecayCounter(halfLife time.Duration) *decayCounter {
+	return &decayCounter{halfLife: halfLife, scores: make(map[string]float64)}
+}
+
+func (d *decayCounter) Add(key string, t time.Time) {
+	if t.IsZero() {
+		t = d.last
+	}
+	if d.base.IsZero() {
+		d.base = t
+	}
+	if t.After(d.last) {
+		d.last = t
+	}
+
+	exp := float64(t.Sub(d.base)) / float64(d.halfLife)
+	// 权重随时间指数增长, 超过一定幅度时整体缩放并前移基准时间, 避免溢出
+	if exp > 64 {
+		scale := math.Exp2(-exp)
+		for k := range d.scores {
+			d.scores[k] *= scale
+		}
+		d.base = t
+		exp = 0
+	}
+	d.scores[key] += math.Exp2(exp)
+}
+
+// 合并另一个衰减计数器: 先把基准时间较早的一方折算到较晚的基准时间, 再相加
+func (d *decayCounter) merge(o *decayCounter) {
+	if o.base.IsZero() {
+		return
+	}
+	if d.base.IsZero() {
+		d.base, d.last = o.base, o.last
+		for k, v := range o.scores {
+			d.scores[k] = v
+		}
+		return
+	}
+	if o.base.After(d.base) {
+		scale := math.Exp2(-float64(o.base.Sub(d.base)) / float64(d.halfLife))
+		for k := range d.scores {
+			d.scores[k] *= scale
+		}
+		d.base = o.base
+	}
+	scale := math.Exp2(-float64(d.base.Sub(o.base)) / float64(d.halfLife))
+	for k, v := range o.scores {
+		d.scores[k] += v * scale
+	}
+	if o.last.After(d.last) {
+		d.last = o.last
+	}
+}
+
+// Scores 返回折算到最后一条日志时刻的衰减计数
+func (d *decayCounter) Scores() map[string]float64 {
+	scale := math.Exp2(-float64(d.last.Sub(d.base)) / float64(d.halfLife))
+	result := make(map[string]float64, len(d.scores))
+	for k, v := range d.scores {
+		result[k] = v * scale
+	}
+	return result
+}
+
+// 按分值取前十, 用于衰减计数与求和
+func topScores(scores map[string]float64) []Rank {
+	var ranks []Rank
+	for key, score := range scores {
+		ranks = append(ranks, Rank{Key: key, Count: score})
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].Count != ranks[j].Count {
+			return ranks[i].Count > ranks[j].Count
+		}
+		return ranks[i].Key < ranks[j].Key
+	})
+	if len(ranks) > 10 {
+		ranks = ranks[:10]
+	}
+	return ranks
+}
@@ -0,0 +1,309 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// GeoIP 为 MaxMind DB (.mmdb) 格式的 IP 地理位置库, 如 GeoLite2-Country 或 GeoLite2-City.
+// 整个文件读入内存, 只读, 可以在多个 goroutine 中共用
+type GeoIP struct {
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// dataStart 为数据区在文件中的偏移, 搜索树之后隔 16 个字节
+	dataStart uint
+	// ipv4Start 为 IPv6 库中 ::/96 子树的节点, IPv4 地址从这里开始查找
+	ipv4Start uint
+}
+
+// MaxMind DB 元数据以该标记开头, 位于文件末尾 128KB 内
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var errInvalidMMDB = errors.New("不是有效的 MaxMind DB 文件")
+
+// OpenGeoIP 读取 MaxMind DB 文件
+func OpenGeoIP(path string) (*GeoIP, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := newGeoIP(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return g, nil
+}
+
+func newGeoIP(data []byte) (*GeoIP, error) {
+	i := bytes.LastIndex(data, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errInvalidMMDB
+	}
+	start := uint(i + len(mmdbMetadataMarker))
+	d := mmdbDecoder{data: data[start:]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("元数据: %v", err)
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidMMDB
+	}
+	g := &GeoIP{data: data}
+	for key, field := range map[string]*uint{"node_count": &g.nodeCount, "record_size": &g.recordSize, "ip_version": &g.ipVersion} {
+		n, ok := meta[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("元数据缺少 %s", key)
+		}
+		*field = uint(n)
+	}
+	switch g.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("不支持的 record_size: %d", g.recordSize)
+	}
+	g.dataStart = g.nodeCount*g.recordSize/4 + 16
+	if g.dataStart > start {
+		return nil, errInvalidMMDB
+	}
+
+	if g.ipVersion == 6 {
+		for i := 0; i < 96 && g.ipv4Start < g.nodeCount; i++ {
+			g.ipv4Start = g.record(g.ipv4Start, 0)
+		}
+	}
+	return g, nil
+}
+
+// record 返回节点的左 (bit 为 0) 或右子记录
+func (g *GeoIP) record(node, bit uint) uint {
+	b := g.data[node*g.recordSize/4:]
+	switch g.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup 沿搜索树查找 ip, 返回其记录解码后的值, 库中没有该地址时返回 nil
+func (g *GeoIP) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, node = ip4, g.ipv4Start
+	} else if g.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(ip)*8 && node < g.nodeCount; i++ {
+		node = g.record(node, uint(ip[i/8]>>(7-i%8))&1)
+	}
+	if node <= g.nodeCount {
+		return nil, nil
+	}
+	offset := node - g.nodeCount - 16
+	d := mmdbDecoder{data: g.data[g.dataStart:]}
+	v, _, err := d.decode(offset)
+	return v, err
+}
+
+// Country 返回 ip 所属国家/地区的 ISO 3166-1 代码 (如 "CN", "US"), 优先取 country, 其次取 registered_country.
+// 无法解析的地址、库中没有的地址 (如内网地址) 或库文件损坏时返回空字符串
+func (g *GeoIP) Country(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	v, err := g.lookup(addr)
+	if err != nil {
+		return ""
+	}
+	record, _ := v.(map[string]interface{})
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := record[key].(map[string]interface{}); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// mmdbDecoder 解码 MaxMind DB 数据区的值, 指针为相对 data 的偏移
+type mmdbDecoder struct {
+	data []byte
+}
+
+// MaxMind DB 的数据类型
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+var errMMDBTruncated = errors.New("数据被截断")
+
+// decode 解码 offset 处的值, 返回值与其后的偏移.
+// 整数统一为 uint64 (int32 为 int64), 浮点数为 float64, uint128 为 []byte
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(d.data)) {
+		return nil, 0, errMMDBTruncated
+	}
+	ctrl := d.data[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+	if kind == mmdbExtended {
+		if offset >= uint(len(d.data)) {
+			return nil, 0, errMMDBTruncated
+		}
+		kind = 7 + uint(d.data[offset])
+		offset++
+	}
+
+	if kind == mmdbPointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(pointer)
+		return v, next, err
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.data)) {
+			return nil, 0, errMMDBTruncated
+		}
+		extra := uint(0)
+		for _, b := range d.data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map 的键不是字符串")
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, errMMDBTruncated
+	}
+	b := d.data[offset : offset+size]
+	offset += size
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes, mmdbUint128:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errInvalidMMDB
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errInvalidMMDB
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case mmdbInt32:
+		n := uint32(0)
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), offset, nil
+	}
+	return nil, 0, fmt.Errorf("未知的数据类型: %d", kind)
+}
+
+// pointer 解析指针, 返回指向的偏移与指针之后的偏移
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3&0x3) + 1
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, errMMDBTruncated
+	}
+	p := uint(0)
+	if n < 4 {
+		p = uint(ctrl & 0x7)
+	}
+	for _, b := range d.data[offset : offset+n] {
+		p = p<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		p += 2048
+	case 3:
+		p += 526336
+	}
+	return p, offset + n, nil
+}
@@ -0,0 +1,52 @@
+package analyzer
+
+import "regexp"
+
+// URLGroupRule 把路径 (不含查询参数) 匹配 Pattern 的请求归入名为 Name 的分组,
+// 各项统计中以 Name 代替 URL. 规则按顺序匹配, 第一条匹配的生效
+type URLGroupRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// URLGroupCount 为一条分组规则归入的请求数, 为 0 的规则可能已经失效
+type URLGroupCount struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Requests int    `json:"requests"`
+}
+
+type urlGrouper struct {
+	rules  []URLGroupRule
+	counts []int
+}
+
+func newURLGrouper(rules []URLGroupRule) *urlGrouper {
+	return &urlGrouper{rules: rules, counts: make([]int, len(rules))}
+}
+
+// Group 返回 url 所属分组的名称, 没有匹配的规则时原样返回 url
+func (g *urlGrouper) Group(url string) string {
+	path := requestPath(url)
+	for i, rule := range g.rules {
+		if rule.Pattern.MatchString(path) {
+			g.counts[i]++
+			return rule.Name
+		}
+	}
+	return url
+}
+
+func (g *urlGrouper) merge(o *urlGrouper) {
+	for i, n := range o.counts {
+		g.counts[i] += n
+	}
+}
+
+func (g *urlGrouper) Report() []URLGroupCount {
+	counts := make([]URLGroupCount, len(g.rules))
+	for i, rule := range g.rules {
+		counts[i] = URLGroupCount{Name: rule.Name, Pattern: rule.Pattern.String(), Requests: g.counts[i]}
+	}
+	return counts
+}
@@ -0,0 +1,230 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// 估算器名称, 见 LatencyReport.Estimator
+const (
+	EstimatorExact  = "exact"
+	EstimatorSketch = "sketch"
+)
+
+// sketch 估算的相对误差
+const sketchAccuracy = 0.01
+
+// LatencyReport 为 $request_time 的分位数统计, 时间单位为秒
+type LatencyReport struct {
+	// Estimator 为 EstimatorExact (保存全部耗时) 或 EstimatorSketch (对数分桶, 约 1% 相对误差)
+	Estimator string       `json:"estimator"`
+	Overall   LatencyStats `json:"overall"`
+	// URLs 为请求数最多的前 N 个路径 (不含查询参数), 请求数少于 MinCount 的路径不列出
+	URLs     []URLLatency `json:"urls"`
+	MinCount int          `json:"min_count"`
+}
+
+// LatencyStats 为一组请求的耗时分位数
+type LatencyStats struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+// URLLatency 为一个路径的耗时分位数
+type URLLatency struct {
+	URL string `json:"url"`
+	LatencyStats
+}
+
+type durationRecorder interface {
+	Add(seconds float64)
+	Count() int
+	Quantile(q float64) float64
+	// Merge 合并同类型 recorder 的数据
+	Merge(o durationRecorder)
+}
+
+// 精确分位数, 每个请求占用 8 字节
+type exactRecorder struct {
+	values []float64
+	sorted bool
+}
+
+func (e *exactRecorder) Add(seconds float64) {
+	e.values = append(e.values, seconds)
+	e.sorted = false
+}
+
+func (e *exactRecorder) Count() int {
+	return len(e.values)
+}
+
+func (e *exactRecorder) Merge(o durationRecorder) {
+	e.values = append(e.values, o.(*exactRecorder).values...)
+	e.sorted = false
+}
+
+// 最近秩法: 取第 ⌈q·n⌉ 个值
+func (e *exactRecorder) Quantile(q float64) float64 {
+	if len(e.values) == 0 {
+		return 0
+	}
+	if !e.sorted {
+		sort.Float64s(e.values)
+		e.sorted = true
+	}
+	i := int(math.Ceil(q*float64(len(e.values)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return e.values[i]
+}
+
+// 对数分桶估算: 第 i 个桶覆盖 (γ^(i-1), γ^i], 取值误差不超过 sketchAccuracy.
+// 内存只取决于耗时的跨度 (1ms 到 60s 约 550 个桶), 与请求数无关
+type sketchRecorder struct {
+	gamma   float64
+	logG    float64
+	buckets map[int]int
+	zeros   int
+	count   int
+}
+
+func newSketchRecorder() *sketchRecorder {
+	gamma := (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	return &sketchRecorder{gamma: gamma, logG: math.Log(gamma), buckets: make(map[int]int)}
+}
+
+func (s *sketchRecorder) Add(seconds float64) {
+	s.count++
+	// $request_time 精度为毫秒, 0.000 单独计数
+	if seconds < 1e-6 {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(seconds)/s.logG))]++
+}
+
+func (s *sketchRecorder) Count() int {
+	return s.count
+}
+
+func (s *sketchRecorder) Merge(o durationRecorder) {
+	other := o.(*sketchRecorder)
+	for k, n := range other.buckets {
+		s.buckets[k] += n
+	}
+	s.zeros += other.zeros
+	s.count += other.count
+}
+
+func (s *sketchRecorder) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q*float64(s.count))) - 1
+	if rank < s.zeros {
+		return 0
+	}
+	rank -= s.zeros
+
+	keys := make([]int, 0, len(s.buckets))
+	for k := range s.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		if rank < s.buckets[k] {
+			return 2 * math.Pow(s.gamma, float64(k)) / (s.gamma + 1)
+		}
+		rank -= s.buckets[k]
+	}
+	return 2 * math.Pow(s.gamma, float64(keys[len(keys)-1])) / (s.gamma + 1)
+}
+
+type latencyTracker struct {
+	sketch   bool
+	top      int
+	minCount int
+	overall  durationRecorder
+	urls     map[string]durationRecorder
+}
+
+func newLatencyTracker(sketch bool, top, minCount int) *latencyTracker {
+	l := &latencyTracker{sketch: sketch, top: top, minCount: minCount, urls: make(map[string]durationRecorder)}
+	l.overall = newDurationRecorder(sketch)
+	return l
+}
+
+func newDurationRecorder(sketch bool) durationRecorder {
+	if sketch {
+		return newSketchRecorder()
+	}
+	return &exactRecorder{}
+}
+
+// Add 记录一个请求的 $request_time, 无法解析的值 (如 "-") 忽略
+func (l *latencyTracker) Add(url, requestTime string) {
+	seconds, err := strconv.ParseFloat(requestTime, 64)
+	if err != nil || seconds < 0 {
+		return
+	}
+	l.overall.Add(seconds)
+	u := requestPath(url)
+	r, ok := l.urls[u]
+	if !ok {
+		r = newDurationRecorder(l.sketch)
+		l.urls[u] = r
+	}
+	r.Add(seconds)
+}
+
+func (l *latencyTracker) merge(o *latencyTracker) {
+	l.overall.Merge(o.overall)
+	for u, r := range o.urls {
+		if mine, ok := l.urls[u]; ok {
+			mine.Merge(r)
+		} else {
+			l.urls[u] = r
+		}
+	}
+}
+
+func latencyStats(r durationRecorder) LatencyStats {
+	return LatencyStats{r.Count(), r.Quantile(0.5), r.Quantile(0.95), r.Quantile(0.99)}
+}
+
+func (l *latencyTracker) Report() *LatencyReport {
+	rep := &LatencyReport{
+		Estimator: EstimatorExact,
+		Overall:   latencyStats(l.overall),
+		URLs:      []URLLatency{},
+		MinCount:  l.minCount,
+	}
+	if l.sketch {
+		rep.Estimator = EstimatorSketch
+	}
+
+	urls := make([]string, 0, len(l.urls))
+	for u, r := range l.urls {
+		if r.Count() >= l.minCount {
+			urls = append(urls, u)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		if ci, cj := l.urls[urls[i]].Count(), l.urls[urls[j]].Count(); ci != cj {
+			return ci > cj
+		}
+		return urls[i] < urls[j]
+	})
+	if len(urls) > l.top {
+		urls = urls[:l.top]
+	}
+	for _, u := range urls {
+		rep.URLs = append(rep.URLs, URLLatency{u, latencyStats(l.urls[u])})
+	}
+	return rep
+}
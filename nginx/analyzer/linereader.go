@@ -0,0 +1,119 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// DefaultMaxLineSize 为 Options.MaxLineSize 为 0 时单行日志的上限
+const DefaultMaxLineSize = 4 << 20
+
+// LineReader 逐行读取日志. 与 bufio.Scanner 不同, 超过上限的行 (如超长的查询参数或 UA)
+// 不会中止读取, 而是整行跳过并计入 Oversized. 行尾的 \r\n 或 \n 不包含在 Text 中
+type LineReader struct {
+	r         *bufio.Reader
+	maxSize   int
+	line      []byte
+	err       error
+	Oversized int
+}
+
+// NewLineReader 创建 LineReader, maxSize 不大于 0 时使用 DefaultMaxLineSize
+func NewLineReader(r io.Reader, maxSize int) *LineReader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxLineSize
+	}
+	return &LineReader{r: bufio.NewReaderSize(r, 64*1024), maxSize: maxSize}
+}
+
+// Next 读取下一行, 读到末尾或出错时返回 false, 错误见 Err
+func (l *LineReader) Next() bool {
+	for {
+		l.line = l.line[:0]
+		oversized := false
+		for {
+			chunk, err := l.r.ReadSlice('\n')
+			if !oversized {
+				if len(l.line)+len(chunk) > l.maxSize+2 {
+					// 超过上限后只找行尾, 不再保存内容
+					oversized = true
+					l.line = l.line[:0]
+				} else {
+					l.line = append(l.line, chunk...)
+				}
+			}
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil && err != io.EOF {
+				l.err = err
+				return false
+			}
+			if err == io.EOF && len(l.line) == 0 && !oversized {
+				return false
+			}
+			break
+		}
+		l.line = bytes.TrimSuffix(bytes.TrimSuffix(l.line, []byte("\n")), []byte("\r"))
+		if oversized || len(l.line) > l.maxSize {
+			l.Oversized++
+			continue
+		}
+		return true
+	}
+}
+
+// Text 返回当前行
+func (l *LineReader) Text() string { return string(l.line) }
+
+// Err 返回读取中遇到的第一个错误, 读到末尾不算错误
+func (l *LineReader) Err() error { return l.err }
+
+// gzipMagic 为 gzip 文件开头的两个字节
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// logFile 为 OpenLog 打开的文件, 压缩的文件经 gz 解压后读取
+type logFile struct {
+	io.Reader
+	file *os.File
+	gz   *gzip.Reader
+}
+
+func (f *logFile) Close() error {
+	if f.gz != nil {
+		f.gz.Close()
+	}
+	return f.file.Close()
+}
+
+// OpenLog 打开日志文件. 以 gzip 魔数开头的文件 (如 logrotate 压缩的 access.log.2.gz) 读取时自动解压,
+// 不看扩展名
+func OpenLog(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(file)
+	if magic, _ := r.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return &logFile{Reader: r, file: file}, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &logFile{Reader: gz, file: file, gz: gz}, nil
+}
+
+// isCompressed 判断 file 是否以 gzip 魔数开头, 不改变读取位置
+func isCompressed(file *os.File) (bool, error) {
+	magic := make([]byte, len(gzipMagic))
+	n, err := file.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return bytes.Equal(magic[:n], gzipMagic), nil
+}
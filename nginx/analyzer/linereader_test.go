@@ -0,0 +1,145 @@
+package analyzer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readLines(t *testing.T, r io.Reader, maxSize int) ([]string, *LineReader) {
+	t.Helper()
+	lines := NewLineReader(r, maxSize)
+	var got []string
+	for lines.Next() {
+		got = append(got, lines.Text())
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got, lines
+}
+
+func TestLineReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxSize   int
+		want      []string
+		oversized int
+	}{
+		{"空", "", 8, nil, 0},
+		{"换行符", "a\nb\r\nc", 8, []string{"a", "b", "c"}, 0},
+		{"空行", "a\n\n\r\nb\n", 8, []string{"a", "", "", "b"}, 0},
+		{"恰好等于上限", "abc\r\nabc\nabc", 3, []string{"abc", "abc", "abc"}, 0},
+		{"超过上限", "a\nabcd\nb\nabcd\r\nc\n", 3, []string{"a", "b", "c"}, 2},
+		{"末行超过上限且无换行符", "a\nabcdef", 3, []string{"a"}, 1},
+		{"连续超长行", "abcd\nabcd\nabcd\n", 3, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, lines := readLines(t, strings.NewReader(tt.input), tt.maxSize)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) || lines.Oversized != tt.oversized {
+				t.Errorf("lines = %q, Oversized = %d; want %q, %d", got, lines.Oversized, tt.want, tt.oversized)
+			}
+		})
+	}
+}
+
+// 超过 bufio 缓冲区 (64KB) 与 bufio.Scanner 默认上限的超长行夹在日志中间, 之后的行仍全部读取
+func TestLineReaderLongLine(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "combined.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(fixture), "\n"), "\n")
+	long := `203.0.113.99 - - [14/Oct/2026:09:00:00 +0800] "GET /search?q=` + strings.Repeat("a", 1<<20) +
+		` HTTP/1.1" 200 5 "-" "curl/8.5.0"`
+	mid := len(want) / 2
+	input := strings.Join(want[:mid], "\n") + "\n" + long + "\r\n" + strings.Join(want[mid:], "\n") + "\n"
+
+	// 默认上限下长行正常读取
+	got, lines := readLines(t, strings.NewReader(input), 0)
+	if len(got) != len(want)+1 || got[mid] != long || got[mid+1] != want[mid] || got[len(got)-1] != want[len(want)-1] || lines.Oversized != 0 {
+		t.Errorf("默认上限: 读到 %d 行, Oversized = %d; want %d 行", len(got), lines.Oversized, len(want)+1)
+	}
+
+	// 上限为 64KB 时跳过长行, 其余各行不变
+	got, lines = readLines(t, strings.NewReader(input), 64<<10)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") || lines.Oversized != 1 {
+		t.Errorf("上限 64KB: 读到 %d 行, Oversized = %d; want %d 行, 1", len(got), lines.Oversized, len(want))
+	}
+}
+
+// 分析器跳过超长行后, 报告除 Lines 与 OversizedLines 外与原日志相同, 顺序与并行统计均如此
+func TestAnalyzeFileLongLine(t *testing.T) {
+	tc := goldenCases[0]
+	opts := tc.opts
+	opts.MaxLineSize = 64 << 10
+	want := analyzeFixture(t, tc.name, opts).Report()
+	want.Lines++
+	want.OversizedLines = 1
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", tc.name+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid := bytes.IndexByte(fixture[len(fixture)/2:], '\n') + len(fixture)/2 + 1
+	long := "203.0.113.99 - - [14/Oct/2026:09:00:00 +0800] \"GET /?q=" + strings.Repeat("a", 1<<20) + " HTTP/1.1\" 200 5 \"-\" \"-\"\n"
+	path := filepath.Join(t.TempDir(), "long.log")
+	data := append(append(append([]byte(nil), fixture[:mid]...), long...), fixture[mid:]...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 3} {
+		a, err := AnalyzeFile(path, opts, workers, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reportJSON(t, a.Report()); !bytes.Equal(got, reportJSON(t, want)) {
+			t.Errorf("%d workers: 报告与原日志不同:\n%s", workers, got)
+		}
+	}
+}
+
+type failingReader struct{ err error }
+
+func (f failingReader) Read([]byte) (int, error) { return 0, f.err }
+
+func TestLineReaderError(t *testing.T) {
+	want := errors.New("disk error")
+	lines := NewLineReader(io.MultiReader(strings.NewReader("a\nb"), failingReader{want}), 0)
+	var got []string
+	for lines.Next() {
+		got = append(got, lines.Text())
+	}
+	if len(got) != 1 || got[0] != "a" || lines.Err() != want {
+		t.Errorf("lines = %q, Err() = %v; want [a], %v", got, lines.Err(), want)
+	}
+}
+
+// gzip 压缩的日志按魔数识别并解压, 读到的行与原文件相同; 并行统计不支持压缩文件
+func TestOpenLogGzip(t *testing.T) {
+	read := func(name string) []string {
+		t.Helper()
+		file, err := OpenLog(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		got, _ := readLines(t, file, 0)
+		return got
+	}
+	plain, compressed := read("combined.log"), read("combined.log.gz")
+	if len(plain) == 0 || strings.Join(compressed, "\n") != strings.Join(plain, "\n") {
+		t.Errorf("combined.log.gz 读到 %d 行, 与 combined.log 的 %d 行不同", len(compressed), len(plain))
+	}
+
+	if _, err := AnalyzeFile(filepath.Join("testdata", "combined.log.gz"), Options{}, 2, nil); err != ErrCompressed {
+		t.Errorf("AnalyzeFile(combined.log.gz) error = %v, want ErrCompressed", err)
+	}
+}
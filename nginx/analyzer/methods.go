@@ -0,0 +1,48 @@
+package analyzer
+
+// CrossMethods 为 URL × 方法统计的列, 其余方法归入 "other"
+var CrossMethods = []string{"GET", "POST", "PUT", "DELETE", "other"}
+
+// MethodURLReport 为请求总数前 20 的 URL 按 HTTP 方法的请求数
+type MethodURLReport struct {
+	Methods []string       `json:"methods"`
+	Rows    []MethodURLRow `json:"rows"`
+}
+
+// MethodURLRow 为一个 URL 的各方法请求数, Counts 与 Methods 一一对应
+type MethodURLRow struct {
+	URL    string `json:"url"`
+	Total  int    `json:"total"`
+	Counts []int  `json:"counts"`
+}
+
+func mergeMethodURLs(dst, src map[string]map[string]int) {
+	for method, urls := range src {
+		if dst[method] == nil {
+			dst[method] = make(map[string]int)
+		}
+		for u, n := range urls {
+			dst[method][u] += n
+		}
+	}
+}
+
+func methodURLReport(methodURLCounts map[string]map[string]int) *MethodURLReport {
+	totals := make(map[string]int)
+	for _, urls := range methodURLCounts {
+		for u, n := range urls {
+			totals[u] += n
+		}
+	}
+	urls := topKeys(totals, 20)
+
+	rep := &MethodURLReport{Methods: CrossMethods, Rows: make([]MethodURLRow, 0, len(urls))}
+	for _, u := range urls {
+		row := MethodURLRow{URL: u, Total: totals[u], Counts: make([]int, len(CrossMethods))}
+		for i, m := range CrossMethods {
+			row.Counts[i] = methodURLCounts[m][u]
+		}
+		rep.Rows = append(rep.Rows, row)
+	}
+	return rep
+}
@@ -0,0 +1,119 @@
+package analyzer
+
+import "net/url"
+
+// 404 来源分类
+const (
+	RefererDirect   = "direct"
+	RefererInternal = "internal"
+	RefererExternal = "external"
+)
+
+// NotFoundReport 为 404 次数前十的 URL 及其来源
+type NotFoundReport struct {
+	// OwnHost 为空时所有带来源的请求均按站外统计
+	OwnHost string        `json:"own_host,omitempty"`
+	URLs    []NotFoundURL `json:"urls"`
+}
+
+// NotFoundURL 为一个 404 URL 的来源分布, TopReferers 最多三项
+type NotFoundURL struct {
+	URL         string            `json:"url"`
+	Count       int               `json:"count"`
+	Internal    int               `json:"internal"`
+	External    int               `json:"external"`
+	Direct      int               `json:"direct"`
+	TopReferers []NotFoundReferer `json:"top_referers"`
+}
+
+// NotFoundReferer 为一个来源, Kind 为 RefererDirect/RefererInternal/RefererExternal
+type NotFoundReferer struct {
+	Referer string `json:"referer"`
+	Kind    string `json:"kind"`
+	Count   int    `json:"count"`
+}
+
+// 404 统计: 仅对 404 响应保留 URL → 来源 的嵌套计数, 控制内存占用
+type notFoundTracker struct {
+	ownHost  string
+	counts   map[string]int
+	referers map[string]map[string]int
+}
+
+func newNotFoundTracker(ownHost string) *notFoundTracker {
+	return &notFoundTracker{
+		ownHost:  ownHost,
+		counts:   make(map[string]int),
+		referers: make(map[string]map[string]int),
+	}
+}
+
+func (n *notFoundTracker) Add(e logEntry) {
+	if e.Status != "404" {
+		return
+	}
+	u := requestPath(e.URL)
+	n.counts[u]++
+	if n.referers[u] == nil {
+		n.referers[u] = make(map[string]int)
+	}
+	referer := e.Referer
+	if referer == "" {
+		referer = "-"
+	}
+	n.referers[u][referer]++
+}
+
+func (n *notFoundTracker) merge(o *notFoundTracker) {
+	for u, count := range o.counts {
+		n.counts[u] += count
+	}
+	for u, referers := range o.referers {
+		if n.referers[u] == nil {
+			n.referers[u] = make(map[string]int)
+		}
+		for referer, count := range referers {
+			n.referers[u][referer] += count
+		}
+	}
+}
+
+// 来源分类: 直接访问 / 站内 / 站外
+func (n *notFoundTracker) refererKind(referer string) string {
+	if referer == "-" {
+		return RefererDirect
+	}
+	if n.ownHost != "" {
+		if u, err := url.Parse(referer); err == nil && isOwnHost(u.Hostname(), n.ownHost) {
+			return RefererInternal
+		}
+	}
+	return RefererExternal
+}
+
+func (n *notFoundTracker) Report() *NotFoundReport {
+	rep := &NotFoundReport{OwnHost: n.ownHost, URLs: []NotFoundURL{}}
+	for _, u := range topTenKeys(n.counts) {
+		row := NotFoundURL{URL: u, Count: n.counts[u]}
+		for referer, count := range n.referers[u] {
+			switch n.refererKind(referer) {
+			case RefererDirect:
+				row.Direct += count
+			case RefererInternal:
+				row.Internal += count
+			default:
+				row.External += count
+			}
+		}
+
+		referers := topTenKeys(n.referers[u])
+		if len(referers) > 3 {
+			referers = referers[:3]
+		}
+		for _, referer := range referers {
+			row.TopReferers = append(row.TopReferers, NotFoundReferer{referer, n.refererKind(referer), n.referers[u][referer]})
+		}
+		rep.URLs = append(rep.URLs, row)
+	}
+	return rep
+}
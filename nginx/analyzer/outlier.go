@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"strconv"
+	"time"
+)
+
+// Outlier 为一个响应过大或耗时过长的请求, 见 Options.OnOutlier.
+// Time 为日志中的原始时间, RequestTime 为原始的 $request_time (日志格式中没有时为空)
+type Outlier struct {
+	Time        string
+	IP          string
+	Method      string
+	URL         string
+	Status      string
+	Bytes       int64
+	RequestTime string
+	UserAgent   string
+}
+
+// OutlierFields 为 Outlier 导出为表格时的列名, 与 Outlier.Fields 的顺序相同
+var OutlierFields = []string{"timestamp", "ip", "method", "url", "status", "bytes", "request_time", "user_agent"}
+
+// Fields 按 OutlierFields 的顺序返回各列的值
+func (o Outlier) Fields() []string {
+	return []string{o.Time, o.IP, o.Method, o.URL, o.Status, strconv.FormatInt(o.Bytes, 10), o.RequestTime, o.UserAgent}
+}
+
+// 判断请求是否超过 Options.OutlierBytes 或 Options.OutlierTime
+func isOutlier(entry logEntry, maxBytes int64, maxTime time.Duration) bool {
+	if maxBytes > 0 && entry.Bytes > maxBytes {
+		return true
+	}
+	if maxTime > 0 && entry.RequestTime != "" {
+		seconds, err := strconv.ParseFloat(entry.RequestTime, 64)
+		return err == nil && seconds > maxTime.Seconds()
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package analyzer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrOrderDependent 表示启用了依赖日志先后顺序的板块 (访问分析、跳转链推测), 不能分段统计后合并
+var ErrOrderDependent = errors.New("访问分析 (Sessions) 与重定向分析 (Redirects) 依赖日志顺序, 不支持分段合并")
+
+// ErrCompressed 表示 AnalyzeFile 的文件经过 gzip 压缩, 无法按偏移切分
+var ErrCompressed = errors.New("gzip 压缩的日志无法切分为多段并行统计, 请去掉 --parallel 或先解压")
+
+// Merge 把 o 的结果并入 a, 二者须由相同的 Options 创建, 且 o 统计的是 a 之后的日志.
+// 合并后的结果与按顺序逐行统计相同 (衰减计数有浮点误差), o 不能再使用.
+// 启用 Sessions 或 Redirects 时返回 ErrOrderDependent, a 不变
+func (a *Analyzer) Merge(o *Analyzer) error {
+	if a.sessions != nil || a.redirects != nil {
+		return ErrOrderDependent
+	}
+
+	a.lines += o.lines
+	a.parseErrors += o.parseErrors
+	a.oversizedLines += o.oversizedLines
+	a.sampledLines += o.sampledLines
+	a.malformedCount += o.malformedCount
+	a.badTimestamps += o.badTimestamps
+	a.errors += o.errors
+	a.excludedUAs += o.excludedUAs
+	a.excludedPaths += o.excludedPaths
+	a.excludedIPs += o.excludedIPs
+	a.excludedCountries += o.excludedCountries
+	a.outliers += o.outliers
+	for i, n := range o.statusClasses {
+		a.statusClasses[i] += n
+	}
+	if !o.start.IsZero() && (a.start.IsZero() || o.start.Before(a.start)) {
+		a.start = o.start
+	}
+	if o.end.After(a.end) {
+		a.end = o.end
+	}
+	for _, request := range o.malformedExamples {
+		if len(a.malformedExamples) < 3 {
+			a.malformedExamples = append(a.malformedExamples, request)
+		}
+	}
+	for _, ts := range o.badTimeExamples {
+		if len(a.badTimeExamples) < 3 {
+			a.badTimeExamples = append(a.badTimeExamples, ts)
+		}
+	}
+	for m, n := range o.excludedMethods {
+		if a.excludedMethods == nil {
+			a.excludedMethods = make(map[string]int)
+		}
+		a.excludedMethods[m] += n
+	}
+
+	if a.urlGroups != nil {
+		a.urlGroups.merge(o.urlGroups)
+	}
+	a.ipCounts.merge(o.ipCounts)
+	a.urlCounts.merge(o.urlCounts)
+	a.userAgentCounts.merge(o.userAgentCounts)
+	if a.uaVariants != nil {
+		a.uaVariants.merge(o.uaVariants)
+	}
+	a.hourCounts.merge(o.hourCounts)
+	a.statusCounts.merge(o.statusCounts)
+
+	if a.opts.Decay {
+		a.ipDecay.merge(o.ipDecay)
+		a.urlDecay.merge(o.urlDecay)
+		a.userAgentDecay.merge(o.userAgentDecay)
+		a.statusDecay.merge(o.statusDecay)
+	}
+
+	if a.referers != nil {
+		a.referers.merge(o.referers)
+	}
+	if a.refDomains != nil {
+		a.refDomains.merge(o.refDomains)
+	}
+	if a.methodURLs != nil {
+		mergeMethodURLs(a.methodURLs, o.methodURLs)
+	}
+	if a.notFound != nil {
+		a.notFound.merge(o.notFound)
+	}
+	if a.sizes != nil {
+		a.sizes.merge(o.sizes)
+	}
+	if a.latency != nil {
+		a.latency.merge(o.latency)
+	}
+	if a.writes != nil {
+		a.writes.merge(o.writes)
+	}
+	if a.uniques != nil {
+		a.uniques.merge(o.uniques)
+	}
+	if a.countries != nil {
+		a.countries.merge(o.countries)
+	}
+	if a.custom != nil {
+		a.custom.merge(o.custom)
+	}
+	if a.trend != nil {
+		a.trend.merge(o.trend)
+	}
+	if a.params != nil {
+		a.params.merge(o.params)
+	}
+	if a.regularity != nil {
+		a.regularity.merge(o.regularity)
+	}
+	if a.bots != nil {
+		a.bots.merge(o.bots)
+	}
+	if a.minuteCounts != nil {
+		for minute, n := range o.minuteCounts {
+			a.minuteCounts[minute] += n
+		}
+		if len(o.minuteCounts) > 0 {
+			a.location = o.location
+		}
+	}
+	return nil
+}
+
+// AnalyzeFile 把文件按行边界切分为 workers 段, 每段由独立的 Analyzer 并行统计, 最后按顺序合并.
+// onError 在解析错误时调用 (已串行化), 可以为 nil. 不支持 Sessions 与 Redirects, 见 Merge;
+// 压缩的文件返回 ErrCompressed, 请用 OpenLog 逐行读取
+func AnalyzeFile(path string, opts Options, workers int, onError func(line string, err error)) (*Analyzer, error) {
+	if opts.Sessions || opts.Redirects {
+		return nil, ErrOrderDependent
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if compressed, err := isCompressed(file); err != nil {
+		return nil, err
+	} else if compressed {
+		return nil, ErrCompressed
+	}
+
+	offsets, err := splitLines(file, workers)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*Analyzer, len(offsets)-1)
+	errs := make([]error, len(parts))
+	var errMu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range parts {
+		parts[i] = New(opts)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			a := parts[i]
+			lines := NewLineReader(io.NewSectionReader(file, offsets[i], offsets[i+1]-offsets[i]), opts.MaxLineSize)
+			for lines.Next() {
+				if err := a.AddLine(lines.Text()); err != nil && onError != nil {
+					errMu.Lock()
+					onError(lines.Text(), err)
+					errMu.Unlock()
+				}
+			}
+			a.lines += lines.Oversized
+			a.oversizedLines += lines.Oversized
+			errs[i] = lines.Err()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, part := range parts[1:] {
+		parts[0].Merge(part)
+	}
+	return parts[0], nil
+}
+
+// splitLines 把文件大致等分为 n 段, 每个分界点后移到下一行的行首.
+// 返回各段的起始偏移与文件末尾, 重合的分界点 (行比段长时) 会被去掉
+func splitLines(file *os.File, n int) ([]int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if n < 1 {
+		n = 1
+	}
+
+	offsets := []int64{0}
+	buf := make([]byte, 4096)
+	for i := 1; i < n; i++ {
+		pos := size * int64(i) / int64(n)
+		if pos <= offsets[len(offsets)-1] {
+			continue
+		}
+		// 从分界点前一个字节开始找换行符, 分界点恰好在行首时不移动
+		next, err := nextLineStart(file, pos-1, size, buf)
+		if err != nil {
+			return nil, err
+		}
+		if next > offsets[len(offsets)-1] && next < size {
+			offsets = append(offsets, next)
+		}
+	}
+	return append(offsets, size), nil
+}
+
+// nextLineStart 返回 pos 及其之后第一个换行符的下一个位置, 没有换行符时返回 size
+func nextLineStart(file *os.File, pos, size int64, buf []byte) (int64, error) {
+	for pos < size {
+		n, err := file.ReadAt(buf, pos)
+		for i := 0; i < n; i++ {
+			if buf[i] == '\n' {
+				return pos + int64(i) + 1, nil
+			}
+		}
+		pos += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,112 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type parallelCase struct {
+	name, option string
+	opts         Options
+}
+
+// parallelCases 为 goldenCases 加上合并方式各不相同的选项:
+// 耗时分桶、HyperLogLog、衰减计数、每分钟计数、写请求、UA 归并与按流量排序
+func parallelCases() []parallelCase {
+	var cases []parallelCase
+	for _, tc := range goldenCases {
+		cases = append(cases, parallelCase{tc.name, "golden", tc.opts})
+	}
+	with := func(name, option string, change func(*Options)) parallelCase {
+		for _, tc := range goldenCases {
+			if tc.name == name {
+				opts := tc.opts
+				change(&opts)
+				return parallelCase{name, option, opts}
+			}
+		}
+		panic("no golden case " + name)
+	}
+	return append(cases,
+		with("xff", "LatencySketch", func(o *Options) { o.LatencySketch = true }),
+		with("xff", "Writes", func(o *Options) { o.Writes = true }),
+		with("combined", "LowMemory", func(o *Options) { o.LowMemory = true }),
+		with("combined", "Decay", func(o *Options) { o.Decay, o.HalfLife = true, time.Hour }),
+		with("combined", "Spikes", func(o *Options) { o.Spikes, o.SpikeWindow, o.SpikeSigma = true, 5, 1 }),
+		with("combined", "NormalizeUserAgents", func(o *Options) { o.NormalizeUserAgents = true }),
+		with("combined", "SortByBytes", func(o *Options) { o.SortBy = SortByBytes }),
+	)
+}
+
+// 把同一份日志分给不同数量的 worker 并行统计, 合并后的报告须与顺序统计相同.
+// 衰减计数的合并有浮点误差 (见 Merge), 数值按相对误差比较
+func TestAnalyzeFileMatchesSequential(t *testing.T) {
+	for _, tc := range parallelCases() {
+		want := reportJSON(t, analyzeFixture(t, tc.name, tc.opts).Report())
+		for _, workers := range []int{1, 2, 3, 4, 7, 16} {
+			a, err := AnalyzeFile(filepath.Join("testdata", tc.name+".log"), tc.opts, workers, nil)
+			if err != nil {
+				t.Fatalf("%s (%s), %d workers: %v", tc.name, tc.option, workers, err)
+			}
+			if got := reportJSON(t, a.Report()); !sameReport(t, got, want) {
+				t.Errorf("%s (%s), %d workers: 合并后的报告与顺序统计不同:\n%s\nwant:\n%s", tc.name, tc.option, workers, got, want)
+			}
+		}
+	}
+}
+
+// sameReport 比较两份 JSON 报告, 数值的相对误差不超过 1e-9 即视为相同
+func sameReport(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var x, y interface{}
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	return nearlyEqual(x, y)
+}
+
+func nearlyEqual(x, y interface{}) bool {
+	switch x := x.(type) {
+	case float64:
+		y, ok := y.(float64)
+		return ok && math.Abs(x-y) <= 1e-9*math.Max(math.Abs(x), math.Abs(y))
+	case []interface{}:
+		y, ok := y.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !nearlyEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := y.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k := range x {
+			if !nearlyEqual(x[k], y[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestAnalyzeFileOrderDependent(t *testing.T) {
+	for _, opts := range []Options{{Sessions: true}, {Redirects: true}} {
+		if _, err := AnalyzeFile(filepath.Join("testdata", "combined.log"), opts, 2, nil); err != ErrOrderDependent {
+			t.Errorf("AnalyzeFile(%+v) error = %v, want ErrOrderDependent", opts, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package analyzer
+
+import (
+	"net/url"
+	"strings"
+)
+
+// 查询参数报告列出的参数名、路径与取值数
+const (
+	paramTopNames     = 10
+	paramTopEndpoints = 5
+	paramEndpointTop  = 5
+)
+
+// ParamReport 为带查询参数的请求中各参数名的出现次数, 可用于发现破坏缓存的随机参数、
+// 值得归一化的来源标记 (utm_*) 等. 同一请求中重复的参数名只计一次, 没有值的参数 (如 ?debug) 同样计入.
+// DecodeErrors 为百分号编码无法解码的参数数, 这些参数按原样统计
+type ParamReport struct {
+	Requests     int `json:"requests"`
+	DecodeErrors int `json:"decode_errors"`
+	// Names 为出现次数最多的参数名
+	Names []Rank `json:"names"`
+	// Endpoints 为带查询参数的请求最多的几个路径, 及各路径下最常见的参数名
+	Endpoints []EndpointParams `json:"endpoints"`
+	// Values 为 Options.ParamValues 中各参数的取值排名, 顺序相同
+	Values []ParamValueRank `json:"values,omitempty"`
+}
+
+// EndpointParams 为一个路径 (不含查询参数) 的参数名排名
+type EndpointParams struct {
+	Path     string `json:"path"`
+	Requests int    `json:"requests"`
+	Names    []Rank `json:"names"`
+}
+
+// ParamValueRank 为一个参数的取值排名
+type ParamValueRank struct {
+	Name   string `json:"name"`
+	Values []Rank `json:"values"`
+}
+
+type endpointParams struct {
+	requests int
+	names    map[string]int
+}
+
+type paramTracker struct {
+	requests     int
+	decodeErrors int
+	names        map[string]int
+	endpoints    map[string]*endpointParams
+	valueNames   []string
+	values       map[string]map[string]int
+}
+
+func newParamTracker(valueNames []string) *paramTracker {
+	p := &paramTracker{
+		names:      make(map[string]int),
+		endpoints:  make(map[string]*endpointParams),
+		valueNames: valueNames,
+		values:     make(map[string]map[string]int),
+	}
+	for _, name := range valueNames {
+		p.values[name] = make(map[string]int)
+	}
+	return p
+}
+
+// 解码查询参数的键或值, 无法解码时返回原文并计入 decodeErrors
+func (p *paramTracker) unescape(s string) string {
+	v, err := url.QueryUnescape(s)
+	if err != nil {
+		p.decodeErrors++
+		return s
+	}
+	return v
+}
+
+// Add 统计请求目标 target (含查询参数) 中的参数, 没有查询参数的请求不计
+func (p *paramTracker) Add(target string) {
+	path, query, ok := strings.Cut(target, "?")
+	if !ok || query == "" {
+		return
+	}
+	p.requests++
+	ep, ok := p.endpoints[path]
+	if !ok {
+		ep = &endpointParams{names: make(map[string]int)}
+		p.endpoints[path] = ep
+	}
+	ep.requests++
+
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		name := p.unescape(key)
+		if name == "" {
+			continue
+		}
+		if values, ok := p.values[name]; ok {
+			values[p.unescape(value)]++
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		p.names[name]++
+		ep.names[name]++
+	}
+}
+
+func (p *paramTracker) merge(o *paramTracker) {
+	p.requests += o.requests
+	p.decodeErrors += o.decodeErrors
+	mergeCounts(p.names, o.names)
+	for path, oe := range o.endpoints {
+		ep, ok := p.endpoints[path]
+		if !ok {
+			p.endpoints[path] = oe
+			continue
+		}
+		ep.requests += oe.requests
+		mergeCounts(ep.names, oe.names)
+	}
+	for name, values := range o.values {
+		mergeCounts(p.values[name], values)
+	}
+}
+
+func mergeCounts(dst, src map[string]int) {
+	for k, n := range src {
+		dst[k] += n
+	}
+}
+
+func countRanks(counts map[string]int, n int) []Rank {
+	ranks := []Rank{}
+	for _, key := range topKeys(counts, n) {
+		ranks = append(ranks, Rank{Key: key, Count: float64(counts[key])})
+	}
+	return ranks
+}
+
+func (p *paramTracker) Report() *ParamReport {
+	rep := &ParamReport{
+		Requests:     p.requests,
+		DecodeErrors: p.decodeErrors,
+		Names:        countRanks(p.names, paramTopNames),
+		Endpoints:    []EndpointParams{},
+	}
+	requests := make(map[string]int, len(p.endpoints))
+	for path, ep := range p.endpoints {
+		requests[path] = ep.requests
+	}
+	for _, path := range topKeys(requests, paramTopEndpoints) {
+		ep := p.endpoints[path]
+		rep.Endpoints = append(rep.Endpoints, EndpointParams{Path: path, Requests: ep.requests, Names: countRanks(ep.names, paramEndpointTop)})
+	}
+	for _, name := range p.valueNames {
+		rep.Values = append(rep.Values, ParamValueRank{Name: name, Values: countRanks(p.values[name], paramTopNames)})
+	}
+	return rep
+}
@@ -0,0 +1,346 @@
+package analyzer
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+var (
+	// 合法的 HTTP 方法 (含 WebDAV), 其余视为无法解析的请求
+	httpMethods = map[string]bool{
+		"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true,
+		"OPTIONS": true, "CONNECT": true, "TRACE": true,
+		"PROPFIND": true, "PROPPATCH": true, "MKCOL": true, "COPY": true, "MOVE": true, "LOCK": true, "UNLOCK": true,
+	}
+
+	botPattern = regexp.MustCompile(`(?i)bot|spider|crawl|slurp|curl|wget|python-requests|go-http-client|java/|okhttp|libwww|httpclient|probe|monitor|headless`)
+)
+
+type logEntry struct {
+	IP        string
+	Method    string
+	URL       string // 请求目标, 已去掉方法与协议, 保留查询参数
+	Protocol  string
+	Malformed bool   // $request 无法解析, 如扫描器发送的 TLS 握手字节
+	Request   string // 原始 $request
+	UserAgent string
+	Timestamp string
+	Status    string
+	Referer   string
+	Bytes     int64
+	// $request_time, 日志格式中没有该字段时为空
+	RequestTime string
+	// $request_length, 日志格式中没有该字段时为 0
+	RequestLength int64
+
+	// 自定义统计的字段值, 与 Options.CountBy / Options.SumBy 一一对应
+	CountKeys []string
+	SumKeys   []string
+	SumValues []string
+	// Splitter 分组字段的值
+	SplitKey string
+}
+
+// newParser 创建日志格式的 gonx 解析器. gonx 的字段名只能由小写字母与下划线组成,
+// $time_iso8601 改名为 $time_iso 后再交给 gonx
+func newParser(format string) *gonx.Parser {
+	return gonx.NewParser(strings.ReplaceAll(format, "$time_iso8601", "$time_iso"))
+}
+
+func parseLogLine(parser *gonx.Parser, line string, opts *Options) (e logEntry, err error) {
+	entry, err := parser.ParseString(line)
+	if err != nil {
+		return e, err
+	}
+
+	remoteAddr, _ := entry.Field("remote_addr")
+	timeLocal, err := entry.Field("time_local")
+	if err != nil {
+		timeLocal, _ = entry.Field("time_iso")
+	}
+	request, _ := entry.Field("request")
+	e.Status, _ = entry.Field("status")
+	e.UserAgent, _ = entry.Field("http_user_agent")
+	e.Referer, _ = entry.Field("http_referer")
+	e.RequestTime, _ = entry.Field("request_time")
+
+	bodyBytes, _ := entry.Field("body_bytes_sent")
+	e.Bytes, _ = strconv.ParseInt(bodyBytes, 10, 64)
+	requestLength, _ := entry.Field("request_length")
+	e.RequestLength, _ = strconv.ParseInt(requestLength, 10, 64)
+
+	httpForwardedIps, _ := entry.Field("http_x_forwarded_for")
+	e.IP = resolveClientIP(remoteAddr, httpForwardedIps, opts.TrustedProxies, opts.IgnoreXFF)
+	e.Request = request
+	e.Method, e.URL, e.Protocol, e.Malformed = parseRequest(request)
+	e.Timestamp = timeLocal
+
+	if opts.splitBy != "" {
+		e.SplitKey, _ = entry.Field(opts.splitBy)
+	}
+	for _, field := range opts.CountBy {
+		v, _ := entry.Field(field)
+		e.CountKeys = append(e.CountKeys, v)
+	}
+	for _, spec := range opts.SumBy {
+		key, _ := entry.Field(spec.Field)
+		v, _ := entry.Field(spec.Value)
+		e.SumKeys = append(e.SumKeys, key)
+		e.SumValues = append(e.SumValues, v)
+	}
+	return e, nil
+}
+
+// FormatMismatch 找出 line 从哪里开始与日志格式不符, 按与 gonx 相同的规则逐段匹配格式:
+// 返回能匹配的最长前缀的字节长度, 以及其后期望出现的格式片段 (如 " [" 或 "$status").
+// 整行能够匹配时 pos 为 -1
+func FormatMismatch(format, line string) (pos int, expected string) {
+	var tokens []string
+	last := 0
+	for _, m := range formatFieldPattern.FindAllStringIndex(format, -1) {
+		if m[0] > last {
+			tokens = append(tokens, format[last:m[0]])
+		}
+		tokens = append(tokens, format[m[0]:m[1]])
+		last = m[1]
+	}
+	if last < len(format) {
+		tokens = append(tokens, format[last:])
+	}
+
+	pattern := "^"
+	for i, token := range tokens {
+		if strings.HasPrefix(token, "$") {
+			// 字段匹配到下一个分隔字符为止, 与 gonx 相同, 最后一个字段到空格为止
+			sep := " "
+			if i+1 < len(tokens) && !strings.HasPrefix(tokens[i+1], "$") {
+				sep = tokens[i+1][:1]
+			}
+			pattern += "[^" + regexp.QuoteMeta(sep) + "]*"
+		} else {
+			pattern += regexp.QuoteMeta(token)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return pos, token
+		}
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			return pos, token
+		}
+		pos = loc[1]
+	}
+	return -1, ""
+}
+
+// ParseCIDRList 解析逗号分隔的 CIDR/IP 列表, 单个 IP 视为 /32 或 /128
+func ParseCIDRList(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的地址: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 CIDR: %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// InternalNetworks 为内网与本机地址: RFC 1918 私有地址、回环、链路本地、运营商级 NAT (100.64.0.0/10)
+// 及 IPv6 的唯一本地地址 (fc00::/7), 命令行的 --exclude-internal 把它们加入 Options.ExcludeIPs
+var InternalNetworks = mustParseCIDRList("10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,127.0.0.0/8,169.254.0.0/16,100.64.0.0/10,::1/128,fe80::/10,fc00::/7")
+
+func mustParseCIDRList(list string) []*net.IPNet {
+	nets, err := ParseCIDRList(list)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// 客户端 IP 落在 exclude 中且不在 include 中时排除, 无法解析的 IP 不排除
+func excludedIP(ip string, exclude, include []*net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	return addr != nil && containsIP(exclude, addr) && !containsIP(include, addr)
+}
+
+// 解析 X-Forwarded-For 中的一跳, 兼容带端口的写法
+func parseHop(hop string) net.IP {
+	hop = strings.TrimSpace(hop)
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	return net.ParseIP(strings.Trim(hop, "[]"))
+}
+
+// 确定客户端 IP:
+//   - 无 XFF 或忽略 XFF 时使用 $remote_addr
+//   - 未配置可信代理时取 XFF 中最左侧的合法 IP (与以往行为一致, 但会去掉空白并校验)
+//   - 配置可信代理时, 把 $remote_addr 视为最右一跳, 从右向左跳过可信代理, 第一个不可信的地址即客户端;
+//     遇到非法地址或整条链都是可信代理时回退到 $remote_addr
+func resolveClientIP(remoteAddr, xff string, trusted []*net.IPNet, ignoreXFF bool) string {
+	xff = strings.TrimSpace(xff)
+	if ignoreXFF || xff == "" || xff == "-" {
+		return remoteAddr
+	}
+	hops := strings.Split(xff, ",")
+
+	if len(trusted) == 0 {
+		for _, hop := range hops {
+			if ip := parseHop(hop); ip != nil {
+				return ip.String()
+			}
+		}
+		return remoteAddr
+	}
+
+	// 直接连接的一方不是可信代理时, 它发来的 XFF 不可信
+	if ip := parseHop(remoteAddr); ip == nil || !containsIP(trusted, ip) {
+		return remoteAddr
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHop(hops[i])
+		if ip == nil {
+			return remoteAddr
+		}
+		if !containsIP(trusted, ip) {
+			return ip.String()
+		}
+	}
+	return remoteAddr
+}
+
+// 拆分 $request 为方法、请求目标与协议: 方法取第一个空格之前, 协议取最后一个空格之后.
+// 代理形式的绝对 URI 只保留路径与查询参数
+func parseRequest(request string) (method, target, protocol string, malformed bool) {
+	first := strings.IndexByte(request, ' ')
+	if first <= 0 {
+		return "", "", "", true
+	}
+	method = request[:first]
+	rest := strings.TrimLeft(request[first+1:], " ")
+	if last := strings.LastIndexByte(rest, ' '); last >= 0 && strings.HasPrefix(rest[last+1:], "HTTP/") {
+		target = strings.TrimRight(rest[:last], " ")
+		protocol = rest[last+1:]
+	} else {
+		// HTTP/0.9 风格, 没有协议部分
+		target = rest
+	}
+
+	if !httpMethods[method] || target == "" {
+		return method, target, protocol, true
+	}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return method, target, protocol, true
+		}
+		target = u.RequestURI()
+	} else if target[0] != '/' && !(target == "*" && method == "OPTIONS") && method != "CONNECT" {
+		return method, target, protocol, true
+	}
+	return method, target, protocol, false
+}
+
+// 去掉请求目标中的查询参数
+func requestPath(target string) string {
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		return target[:i]
+	}
+	return target
+}
+
+// 判断 host 是否为本站或本站子域名, 忽略大小写、端口与 www 前缀
+func isOwnHost(host, own string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	own = strings.TrimPrefix(strings.ToLower(own), "www.")
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	return host == own || strings.HasSuffix(host, "."+own)
+}
+
+func matchDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据 UA 粗略判断是否为爬虫或脚本
+func isBot(userAgent string) bool {
+	return botPattern.MatchString(userAgent)
+}
+
+func containsString(slice []string, str string) bool {
+	for _, v := range slice {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
+
+// CompileUserAgentPatterns 编译 Options.ExcludeUserAgents 的正则, 每个正则须匹配整个 UA
+func CompileUserAgentPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(`^(?:` + p + `)$`)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAnyPattern(str string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(str) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(str string, slice []string) bool {
+	for _, v := range slice {
+		if strings.Contains(str, v) {
+			return true
+		}
+	}
+	return false
+}
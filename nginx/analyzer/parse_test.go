@@ -0,0 +1,130 @@
+package analyzer
+
+import "testing"
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		request   string
+		method    string
+		target    string
+		protocol  string
+		malformed bool
+	}{
+		{"HTTP/1.1", "GET /index.html HTTP/1.1", "GET", "/index.html", "HTTP/1.1", false},
+		{"HTTP/2.0", "GET /a?b=1 HTTP/2.0", "GET", "/a?b=1", "HTTP/2.0", false},
+		{"HTTP/1.0", "POST /login HTTP/1.0", "POST", "/login", "HTTP/1.0", false},
+		{"HTTP/3.0", "HEAD / HTTP/3.0", "HEAD", "/", "HTTP/3.0", false},
+		{"空格较多", "GET   /x  HTTP/1.1", "GET", "/x", "HTTP/1.1", false},
+		{"目标含空格", "GET /a b HTTP/1.1", "GET", "/a b", "HTTP/1.1", false},
+		{"绝对 URI", "GET http://example.com/p?q=1 HTTP/1.1", "GET", "/p?q=1", "HTTP/1.1", false},
+		{"绝对 URI 无路径", "GET https://example.com HTTP/1.1", "GET", "/", "HTTP/1.1", false},
+		{"绝对 URI 无效", "GET http://[::1/x HTTP/1.1", "GET", "http://[::1/x", "HTTP/1.1", true},
+		{"缺少协议", "GET /old", "GET", "/old", "", false},
+		{"缺少协议与目标", "GET ", "GET", "", "", true},
+		{"OPTIONS *", "OPTIONS * HTTP/1.1", "OPTIONS", "*", "HTTP/1.1", false},
+		{"GET *", "GET * HTTP/1.1", "GET", "*", "HTTP/1.1", true},
+		{"CONNECT", "CONNECT example.com:443 HTTP/1.1", "CONNECT", "example.com:443", "HTTP/1.1", false},
+		{"WebDAV", "PROPFIND /dav/ HTTP/1.1", "PROPFIND", "/dav/", "HTTP/1.1", false},
+		{"未知方法", "FOO /x HTTP/1.1", "FOO", "/x", "HTTP/1.1", true},
+		{"小写方法", "get /x HTTP/1.1", "get", "/x", "HTTP/1.1", true},
+		{"相对路径", "GET index.html HTTP/1.1", "GET", "index.html", "HTTP/1.1", true},
+		{"TLS 握手字节", "\\x16\\x03\\x01\\x02\\x00\\x01\\x00\\x01\\xFC\\x03\\x03", "", "", "", true},
+		{"只有方法", "GET", "", "", "", true},
+		{"空", "", "", "", "", true},
+		{"-", "-", "", "", "", true},
+		{"以空格开头", " /x HTTP/1.1", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, target, protocol, malformed := parseRequest(tt.request)
+			if method != tt.method || target != tt.target || protocol != tt.protocol || malformed != tt.malformed {
+				t.Errorf("parseRequest(%q) = %q, %q, %q, %v; want %q, %q, %q, %v", tt.request,
+					method, target, protocol, malformed, tt.method, tt.target, tt.protocol, tt.malformed)
+			}
+		})
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	tests := []struct {
+		target, want string
+	}{
+		{"/a/b", "/a/b"},
+		{"/a/b?x=1&y=2", "/a/b"},
+		{"/?x", "/"},
+		{"?x", ""},
+		{"", ""},
+		{"-", "-"},
+		{"*", "*"},
+	}
+	for _, tt := range tests {
+		if got := requestPath(tt.target); got != tt.want {
+			t.Errorf("requestPath(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := mustParseCIDRList("10.0.0.0/8,192.168.1.1")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		trusted    bool
+		ignoreXFF  bool
+		want       string
+	}{
+		{"无 XFF", "203.0.113.9", "", false, false, "203.0.113.9"},
+		{"XFF 为 -", "203.0.113.9", "-", false, false, "203.0.113.9"},
+		{"忽略 XFF", "203.0.113.9", "1.2.3.4", false, true, "203.0.113.9"},
+		{"未配置代理取最左", "10.0.0.5", "1.2.3.4, 10.0.0.7", false, false, "1.2.3.4"},
+		{"去掉空白", "10.0.0.5", " 1.2.3.4 ", false, false, "1.2.3.4"},
+		{"跳过非法项", "10.0.0.5", "unknown, 1.2.3.4", false, false, "1.2.3.4"},
+		{"带端口", "10.0.0.5", "1.2.3.4:5678", false, false, "1.2.3.4"},
+		{"IPv6 带端口", "10.0.0.5", "[2001:db8::1]:443", false, false, "2001:db8::1"},
+		{"全部非法", "10.0.0.5", "garbage, ,x", false, false, "10.0.0.5"},
+
+		{"多跳取第一个不可信", "10.0.0.5", "198.51.100.7, 1.2.3.4, 10.1.1.1, 192.168.1.1", true, false, "1.2.3.4"},
+		{"伪造的最左项被忽略", "10.0.0.5", "6.6.6.6, 1.2.3.4", true, false, "1.2.3.4"},
+		{"直连方不是代理", "203.0.113.9", "1.2.3.4", true, false, "203.0.113.9"},
+		{"整条链可信", "10.0.0.5", "10.0.0.6, 192.168.1.1", true, false, "10.0.0.5"},
+		{"链中非法项", "10.0.0.5", "1.2.3.4, bogus, 10.0.0.6", true, false, "10.0.0.5"},
+		{"链中空项", "10.0.0.5", "1.2.3.4,,10.0.0.6", true, false, "10.0.0.5"},
+		{"remote_addr 非法", "unix:", "1.2.3.4", true, false, "unix:"},
+		{"IPv6 客户端", "10.0.0.5", "2001:db8::2, 10.0.0.6", true, false, "2001:db8::2"},
+		{"配置代理时忽略 XFF", "10.0.0.5", "1.2.3.4", true, true, "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets := trusted
+			if !tt.trusted {
+				nets = nil
+			}
+			if got := resolveClientIP(tt.remoteAddr, tt.xff, nets, tt.ignoreXFF); got != tt.want {
+				t.Errorf("resolveClientIP(%q, %q) = %q, want %q", tt.remoteAddr, tt.xff, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRList(t *testing.T) {
+	nets, err := ParseCIDRList("10.0.0.0/8, 192.168.1.1,,2001:db8::/32, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.1/32", "2001:db8::/32", "::1/128"}
+	if len(nets) != len(want) {
+		t.Fatalf("got %d networks, want %d", len(nets), len(want))
+	}
+	for i, n := range nets {
+		if n.String() != want[i] {
+			t.Errorf("network %d = %s, want %s", i, n, want[i])
+		}
+	}
+	for _, bad := range []string{"10.0.0.0/33", "1.2.3", "example.com"} {
+		if _, err := ParseCIDRList(bad); err == nil {
+			t.Errorf("ParseCIDRList(%q) succeeded, want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package analyzer
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// RedirectStatuses 为统计的重定向状态码
+var RedirectStatuses = []string{"301", "302", "303", "307", "308"}
+
+// RedirectReport 为重定向次数前十的 URL 与推测出的跳转链
+type RedirectReport struct {
+	URLs []RedirectURL `json:"urls"`
+	// Chains 为出现次数前十的跳转链. 日志中没有 Location,
+	// 只能假设同一 IP 在 1 秒内的下一个请求就是跳转目标, 仅供参考
+	Chains []RedirectChain `json:"chains"`
+	// Flagged 为全部出现循环或超过 2 跳的跳转链, 按路径排序
+	Flagged []RedirectChain `json:"flagged,omitempty"`
+}
+
+// RedirectURL 为一个 URL 的重定向次数及各状态码次数
+type RedirectURL struct {
+	URL      string         `json:"url"`
+	Count    int            `json:"count"`
+	Statuses map[string]int `json:"statuses"`
+}
+
+// RedirectChain 为一条推测的跳转链
+type RedirectChain struct {
+	URLs  []string `json:"urls"`
+	Count int      `json:"count"`
+	Loop  bool     `json:"loop,omitempty"`
+	Long  bool     `json:"long,omitempty"`
+}
+
+func isRedirect(status string) bool {
+	switch status {
+	case "301", "302", "303", "307", "308":
+		return true
+	}
+	return false
+}
+
+type redirectChain struct {
+	urls []string
+	last time.Time
+}
+
+const chainSeparator = " → "
+
+// 重定向统计. 按 URL 的重定向次数是精确值;
+// 跳转链则是推测: 日志中没有 Location, 只能假设同一 IP 在 1 秒内的下一个请求就是跳转目标
+type redirectTracker struct {
+	window    time.Duration
+	counts    map[string]int
+	statuses  map[string]map[string]int
+	pending   map[string]*redirectChain
+	chains    map[string]int
+	loops     map[string]bool
+	lastSweep time.Time
+}
+
+func newRedirectTracker() *redirectTracker {
+	return &redirectTracker{
+		window:   time.Second,
+		counts:   make(map[string]int),
+		statuses: make(map[string]map[string]int),
+		pending:  make(map[string]*redirectChain),
+		chains:   make(map[string]int),
+		loops:    make(map[string]bool),
+	}
+}
+
+func (r *redirectTracker) Add(e logEntry, t time.Time) {
+	u := requestPath(e.URL)
+	redirect := isRedirect(e.Status)
+	if redirect {
+		r.counts[u]++
+		if r.statuses[u] == nil {
+			r.statuses[u] = make(map[string]int)
+		}
+		r.statuses[u][e.Status]++
+	}
+	if t.IsZero() {
+		return
+	}
+
+	chain, ok := r.pending[e.IP]
+	if ok && t.Sub(chain.last) <= r.window {
+		loop := false
+		for _, prev := range chain.urls {
+			if prev == u {
+				loop = true
+				break
+			}
+		}
+		chain.urls = append(chain.urls, u)
+		chain.last = t
+		if redirect && !loop {
+			return
+		}
+		r.finish(chain, loop)
+		delete(r.pending, e.IP)
+	} else if ok {
+		r.finish(chain, false)
+		delete(r.pending, e.IP)
+	}
+
+	if redirect {
+		r.pending[e.IP] = &redirectChain{urls: []string{u}, last: t}
+	}
+
+	if t.Sub(r.lastSweep) > time.Minute {
+		for ip, chain := range r.pending {
+			if t.Sub(chain.last) > r.window {
+				r.finish(chain, false)
+				delete(r.pending, ip)
+			}
+		}
+		r.lastSweep = t
+	}
+}
+
+// 只记录推测出至少一次跳转的链, 出现循环的单独标记
+func (r *redirectTracker) finish(chain *redirectChain, loop bool) {
+	if len(chain.urls) < 2 {
+		return
+	}
+	key := strings.Join(chain.urls, chainSeparator)
+	r.chains[key]++
+	if loop {
+		r.loops[key] = true
+	}
+}
+
+// Report 把尚未结束的跳转链一并计入结果, 但不结算它们
+func (r *redirectTracker) Report() *RedirectReport {
+	chains := make(map[string]int, len(r.chains))
+	for k, v := range r.chains {
+		chains[k] = v
+	}
+	for _, chain := range r.pending {
+		if len(chain.urls) >= 2 {
+			chains[strings.Join(chain.urls, chainSeparator)]++
+		}
+	}
+
+	rep := &RedirectReport{URLs: []RedirectURL{}, Chains: []RedirectChain{}}
+	for _, u := range topTenKeys(r.counts) {
+		statuses := make(map[string]int, len(r.statuses[u]))
+		for code, n := range r.statuses[u] {
+			statuses[code] = n
+		}
+		rep.URLs = append(rep.URLs, RedirectURL{u, r.counts[u], statuses})
+	}
+
+	// 超过 2 跳且没有循环的链单独标记
+	chainOf := func(key string) RedirectChain {
+		urls := strings.Split(key, chainSeparator)
+		loop := r.loops[key]
+		return RedirectChain{urls, chains[key], loop, !loop && len(urls)-1 > 2}
+	}
+	for _, key := range topTenKeys(chains) {
+		rep.Chains = append(rep.Chains, chainOf(key))
+	}
+	var flagged []string
+	for key := range chains {
+		if c := chainOf(key); c.Loop || c.Long {
+			flagged = append(flagged, key)
+		}
+	}
+	sort.Strings(flagged)
+	for _, key := range flagged {
+		rep.Flagged = append(rep.Flagged, chainOf(key))
+	}
+	return rep
+}
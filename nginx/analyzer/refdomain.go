@@ -0,0 +1,102 @@
+package analyzer
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RefererDomain 为按可注册域名 (eTLD+1, 如 google.co.uk) 汇总的来源,
+// www.google.com 与 google.com 合并为 google.com. TopReferer 为该域名下请求数最多的完整来源
+type RefererDomain struct {
+	Domain             string `json:"domain"`
+	Requests           int    `json:"requests"`
+	TopReferer         string `json:"top_referer"`
+	TopRefererRequests int    `json:"top_referer_requests"`
+}
+
+// refererDomain 返回来源的可注册域名. IP 地址、无法解析的来源或公共后缀本身 (如 co.uk)
+// 返回小写的主机名, 没有主机名时返回空字符串
+func refererDomain(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// 按可注册域名统计来源, 同时记录每个域名下各完整来源的请求数
+type refererDomainTracker struct {
+	domains  *keyCounter
+	referers map[string]map[string]int
+}
+
+func newRefererDomainTracker() *refererDomainTracker {
+	return &refererDomainTracker{
+		domains:  newKeyCounter(),
+		referers: make(map[string]map[string]int),
+	}
+}
+
+func (r *refererDomainTracker) Add(referer string, bytes int64) {
+	if referer == "" || referer == "-" {
+		return
+	}
+	domain := refererDomain(referer)
+	if domain == "" {
+		return
+	}
+	r.domains.Add(domain, bytes)
+	full, ok := r.referers[domain]
+	if !ok {
+		full = make(map[string]int)
+		r.referers[domain] = full
+	}
+	full[referer]++
+}
+
+func (r *refererDomainTracker) merge(o *refererDomainTracker) {
+	r.domains.merge(o.domains)
+	for domain, full := range o.referers {
+		mine, ok := r.referers[domain]
+		if !ok {
+			r.referers[domain] = full
+			continue
+		}
+		for referer, n := range full {
+			mine[referer] += n
+		}
+	}
+}
+
+func (r *refererDomainTracker) Report() []RefererDomain {
+	domains := []RefererDomain{}
+	for _, rank := range r.domains.Ranks(0, SortByCount) {
+		d := RefererDomain{Domain: rank.Key, Requests: int(rank.Count)}
+		// 请求数相同时取字典序最小的, 结果不随遍历顺序变化
+		full := r.referers[rank.Key]
+		referers := make([]string, 0, len(full))
+		for referer := range full {
+			referers = append(referers, referer)
+		}
+		sort.Strings(referers)
+		for _, referer := range referers {
+			if full[referer] > d.TopRefererRequests {
+				d.TopReferer, d.TopRefererRequests = referer, full[referer]
+			}
+		}
+		domains = append(domains, d)
+	}
+	return domains
+}
@@ -0,0 +1,151 @@
+package analyzer
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// RefererReport 为垃圾来源与盗链分析结果
+type RefererReport struct {
+	// OwnHost 为空时没有做盗链与伪造站内来源检测
+	OwnHost string `json:"own_host,omitempty"`
+	// Spam 为命中垃圾来源域名的来源, Key 为域名
+	Spam []RefererRank `json:"spam"`
+	// FakeInternal 为声称来自本站但该页面从未成功返回过的来源, Key 为路径
+	FakeInternal []RefererRank `json:"fake_internal"`
+	// Hotlinks 为引用本站静态媒体的外站, Key 为域名
+	Hotlinks []RefererRank `json:"hotlinks"`
+}
+
+// RefererRank 为一个来源的请求数与流量
+type RefererRank struct {
+	Key      string `json:"key"`
+	Requests int    `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+type refererStats struct {
+	Requests int
+	Bytes    int64
+}
+
+// 引用来源分析:
+//   - 垃圾来源: 命中已知 spam 域名, 或声称来自本站但该页面从未成功返回过
+//   - 盗链: 静态媒体请求的来源不属于本站 (含子域名, 不区分 http/https)
+type refererTracker struct {
+	ownHost      string
+	spamDomains  []string
+	spam         map[string]*refererStats
+	hotlinks     map[string]*refererStats
+	fakeInternal map[string]*refererStats
+	served       map[string]bool
+}
+
+func newRefererTracker(ownHost string, spamDomains []string) *refererTracker {
+	return &refererTracker{
+		ownHost:      ownHost,
+		spamDomains:  spamDomains,
+		spam:         make(map[string]*refererStats),
+		hotlinks:     make(map[string]*refererStats),
+		fakeInternal: make(map[string]*refererStats),
+		served:       make(map[string]bool),
+	}
+}
+
+func addRefererStats(m map[string]*refererStats, key string, bytes int64) {
+	st, ok := m[key]
+	if !ok {
+		st = &refererStats{}
+		m[key] = st
+	}
+	st.Requests++
+	st.Bytes += bytes
+}
+
+func (r *refererTracker) Add(e logEntry) {
+	reqPath := requestPath(e.URL)
+	if strings.HasPrefix(e.Status, "2") {
+		r.served[reqPath] = true
+	}
+	if e.Referer == "" || e.Referer == "-" {
+		return
+	}
+
+	u, err := url.Parse(e.Referer)
+	if err != nil || u.Host == "" {
+		return
+	}
+	host := strings.ToLower(u.Hostname())
+
+	if matchDomain(host, r.spamDomains) {
+		addRefererStats(r.spam, host, e.Bytes)
+		return
+	}
+	if r.ownHost == "" {
+		return
+	}
+	if isOwnHost(host, r.ownHost) {
+		addRefererStats(r.fakeInternal, u.Path, e.Bytes)
+		return
+	}
+	// 扩展名须完全相同, 否则 .tsx、.tsv 也会被当作 .ts
+	if containsString(MediaExtensions, strings.ToLower(path.Ext(reqPath))) {
+		addRefererStats(r.hotlinks, host, e.Bytes)
+	}
+}
+
+func mergeRefererStats(dst, src map[string]*refererStats) {
+	for key, st := range src {
+		mine, ok := dst[key]
+		if !ok {
+			mine = &refererStats{}
+			dst[key] = mine
+		}
+		mine.Requests += st.Requests
+		mine.Bytes += st.Bytes
+	}
+}
+
+func (r *refererTracker) merge(o *refererTracker) {
+	mergeRefererStats(r.spam, o.spam)
+	mergeRefererStats(r.hotlinks, o.hotlinks)
+	mergeRefererStats(r.fakeInternal, o.fakeInternal)
+	for p := range o.served {
+		r.served[p] = true
+	}
+}
+
+func topReferers(m map[string]*refererStats) []RefererRank {
+	ranks := make([]RefererRank, 0, len(m))
+	for k, st := range m {
+		ranks = append(ranks, RefererRank{k, st.Requests, st.Bytes})
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].Requests != ranks[j].Requests {
+			return ranks[i].Requests > ranks[j].Requests
+		}
+		return ranks[i].Key < ranks[j].Key
+	})
+	if len(ranks) > 10 {
+		ranks = ranks[:10]
+	}
+	return ranks
+}
+
+func (r *refererTracker) Report() *RefererReport {
+	// 站内来源只有在对应页面从未成功返回过时才算可疑
+	fake := make(map[string]*refererStats)
+	for p, st := range r.fakeInternal {
+		if !r.served[p] && p != "" && p != "/" {
+			fake[p] = st
+		}
+	}
+	return &RefererReport{
+		OwnHost:      r.ownHost,
+		Spam:         topReferers(r.spam),
+		FakeInternal: topReferers(fake),
+		Hotlinks:     topReferers(r.hotlinks),
+	}
+}
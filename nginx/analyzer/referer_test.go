@@ -0,0 +1,14 @@
+package analyzer
+
+import "testing"
+
+func TestRefererHotlinkExtensions(t *testing.T) {
+	r := newRefererTracker("example.com", nil)
+	for _, url := range []string{"/v/seg1.ts", "/img/a.JPG", "/src/app.tsx", "/data/x.tsv", "/b/.tsbuildinfo", "/page"} {
+		r.Add(logEntry{URL: url, Status: "200", Referer: "https://other.net/p", Bytes: 10})
+	}
+	rep := r.Report()
+	if len(rep.Hotlinks) != 1 || rep.Hotlinks[0].Key != "other.net" || rep.Hotlinks[0].Requests != 2 {
+		t.Fatalf("hotlinks = %+v, want other.net with 2 requests (.ts and .jpg)", rep.Hotlinks)
+	}
+}
@@ -0,0 +1,199 @@
+package analyzer
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// 每个 IP 保留的请求间隔样本数 (用于估算中位数) 与主要 URL/UA 的候选数
+const (
+	regularityReservoir = 64
+	regularityHeavy     = 4
+)
+
+// RegularityReport 为请求数最多的前 N 个 IP 的请求间隔分布. 人的访问时疏时密,
+// 间隔的变异系数 (标准差/平均值) 通常在 1 以上; 按固定间隔抓取的脚本即使伪装浏览器 UA,
+// 变异系数也接近 0. 请求数不少于 MinRequests 且变异系数不超过 MaxCV 的 IP 标为 Suspicious
+type RegularityReport struct {
+	MinRequests int            `json:"min_requests"`
+	MaxCV       float64        `json:"max_cv"`
+	IPs         []IPRegularity `json:"ips"`
+}
+
+// IPRegularity 为一个 IP 的请求间隔统计, 间隔以秒计. $time_local 只精确到秒,
+// 同一秒内的请求间隔为 0; 间隔全为 0 时 CV 无意义, 记为 0 且不标记.
+// MedianGap 由抽样的间隔估算, MeanGap 与 CV 为精确值. URL 与 UserAgent 为该 IP 最主要的 URL 与 UA
+type IPRegularity struct {
+	IP         string  `json:"ip"`
+	Requests   int     `json:"requests"`
+	MedianGap  float64 `json:"median_gap"`
+	MeanGap    float64 `json:"mean_gap"`
+	CV         float64 `json:"cv"`
+	Suspicious bool    `json:"suspicious"`
+	URL        string  `json:"url"`
+	UserAgent  string  `json:"user_agent"`
+}
+
+// 出现次数最多的几项 (Misra-Gries), 只保留 regularityHeavy 个候选, 计数为下限
+type heavyHitters map[string]int
+
+func (h heavyHitters) Add(key string, n int) {
+	h[key] += n
+	if len(h) <= regularityHeavy {
+		return
+	}
+	// 候选过多时所有计数减去最小值, 去掉减为 0 的项
+	min := math.MaxInt
+	for _, c := range h {
+		if c < min {
+			min = c
+		}
+	}
+	for k, c := range h {
+		if c -= min; c <= 0 {
+			delete(h, k)
+		} else {
+			h[k] = c
+		}
+	}
+}
+
+func (h heavyHitters) Top() string {
+	top, best := "", 0
+	for k, c := range h {
+		if c > best || (c == best && k < top) {
+			top, best = k, c
+		}
+	}
+	return top
+}
+
+// 一个 IP 的请求时间. 间隔的平均值与方差按 Welford 算法累计, 另按蓄水池抽样保留部分间隔
+type ipTiming struct {
+	first, last time.Time
+	requests    int
+	gaps        int
+	mean, m2    float64
+	sample      []float64
+	urls, uas   heavyHitters
+}
+
+type regularityTracker struct {
+	ips map[string]*ipTiming
+	rng *rand.Rand
+
+	top         int
+	minRequests int
+	maxCV       float64
+}
+
+func newRegularityTracker(top, minRequests int, maxCV float64) *regularityTracker {
+	return &regularityTracker{
+		ips:         make(map[string]*ipTiming),
+		rng:         rand.New(rand.NewSource(1)),
+		top:         top,
+		minRequests: minRequests,
+		maxCV:       maxCV,
+	}
+}
+
+func (r *regularityTracker) Add(ip string, t time.Time, url, userAgent string) {
+	s, ok := r.ips[ip]
+	if !ok {
+		s = &ipTiming{first: t, urls: make(heavyHitters), uas: make(heavyHitters)}
+		r.ips[ip] = s
+	} else {
+		r.addGap(s, t.Sub(s.last))
+	}
+	s.last = t
+	s.requests++
+	s.urls.Add(url, 1)
+	s.uas.Add(userAgent, 1)
+}
+
+// 日志按请求结束时间写入, 相邻两行可能略有倒序, 间隔取绝对值
+func (r *regularityTracker) addGap(s *ipTiming, d time.Duration) {
+	gap := math.Abs(d.Seconds())
+	s.gaps++
+	delta := gap - s.mean
+	s.mean += delta / float64(s.gaps)
+	s.m2 += delta * (gap - s.mean)
+
+	if len(s.sample) < regularityReservoir {
+		s.sample = append(s.sample, gap)
+	} else if i := r.rng.Intn(s.gaps); i < regularityReservoir {
+		s.sample[i] = gap
+	}
+}
+
+// merge 并入 o 的统计, o 为之后的日志: 两段之间补上一个间隔, 方差按 Chan 的并行算法合并,
+// 抽样按两段的间隔数加权抽取
+func (r *regularityTracker) merge(o *regularityTracker) {
+	for ip, b := range o.ips {
+		a, ok := r.ips[ip]
+		if !ok {
+			r.ips[ip] = b
+			continue
+		}
+		r.addGap(a, b.first.Sub(a.last))
+		if b.gaps > 0 {
+			n := float64(a.gaps + b.gaps)
+			delta := b.mean - a.mean
+			a.m2 += b.m2 + delta*delta*float64(a.gaps)*float64(b.gaps)/n
+			a.mean += delta * float64(b.gaps) / n
+
+			weight := float64(b.gaps) / n
+			for i := range a.sample {
+				if r.rng.Float64() < weight {
+					a.sample[i] = b.sample[r.rng.Intn(len(b.sample))]
+				}
+			}
+			for _, gap := range b.sample {
+				if len(a.sample) >= regularityReservoir {
+					break
+				}
+				a.sample = append(a.sample, gap)
+			}
+			a.gaps += b.gaps
+		}
+		a.last = b.last
+		a.requests += b.requests
+		for k, c := range b.urls {
+			a.urls.Add(k, c)
+		}
+		for k, c := range b.uas {
+			a.uas.Add(k, c)
+		}
+	}
+}
+
+func (r *regularityTracker) Report() *RegularityReport {
+	rep := &RegularityReport{MinRequests: r.minRequests, MaxCV: r.maxCV, IPs: []IPRegularity{}}
+	top := newTopSelector(r.top)
+	for ip, s := range r.ips {
+		top.Offer(ip, float64(s.requests))
+	}
+	for _, ip := range top.keys {
+		s := r.ips[ip]
+		row := IPRegularity{
+			IP:        ip,
+			Requests:  s.requests,
+			MeanGap:   s.mean,
+			URL:       s.urls.Top(),
+			UserAgent: s.uas.Top(),
+		}
+		if len(s.sample) > 0 {
+			sorted := append([]float64(nil), s.sample...)
+			sort.Float64s(sorted)
+			row.MedianGap = sorted[len(sorted)/2]
+		}
+		if s.gaps > 1 && s.mean > 0 {
+			row.CV = math.Sqrt(s.m2/float64(s.gaps)) / s.mean
+			row.Suspicious = s.requests >= r.minRequests && row.CV <= r.maxCV
+		}
+		rep.IPs = append(rep.IPs, row)
+	}
+	return rep
+}
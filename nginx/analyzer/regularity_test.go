@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var traceStart = time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+
+// regularTrace 为定时抓取的请求时间: 每 period 秒一次, 带 ±jitter 秒的抖动, 与日志一样只精确到秒
+func regularTrace(n, period, jitter int, rng *rand.Rand) []time.Time {
+	times := make([]time.Time, n)
+	for i := range times {
+		offset := i*period + rng.Intn(2*jitter+1) - jitter
+		times[i] = traceStart.Add(time.Duration(offset) * time.Second)
+	}
+	return times
+}
+
+// burstyTrace 为人的访问: 打开页面后 1 到 5 秒内连续请求几次, 之后停顿几分钟到一小时
+func burstyTrace(n int, rng *rand.Rand) []time.Time {
+	times := make([]time.Time, 0, n)
+	t := traceStart
+	for len(times) < n {
+		for burst := 2 + rng.Intn(6); burst > 0 && len(times) < n; burst-- {
+			times = append(times, t)
+			t = t.Add(time.Duration(1+rng.Intn(5)) * time.Second)
+		}
+		t = t.Add(time.Duration(60+rng.Intn(3600)) * time.Second)
+	}
+	return times
+}
+
+func regularityRow(t *testing.T, rep *RegularityReport, ip string) IPRegularity {
+	t.Helper()
+	for _, row := range rep.IPs {
+		if row.IP == ip {
+			return row
+		}
+	}
+	t.Fatalf("报告中没有 %s: %+v", ip, rep.IPs)
+	return IPRegularity{}
+}
+
+// 定时抓取与人的访问的变异系数应明显分开, 前者标为 Suspicious, 后者不标
+func TestRegularitySeparatesBotsFromHumans(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	traces := map[string][]time.Time{}
+	for i, period := range []int{10, 60, 300} {
+		traces[fmt.Sprintf("10.0.0.%d", i+1)] = regularTrace(200, period, 2, rng)
+	}
+	for i := 0; i < 5; i++ {
+		traces[fmt.Sprintf("192.168.0.%d", i+1)] = burstyTrace(200, rng)
+	}
+
+	r := newRegularityTracker(20, 50, 0.25)
+	for ip, times := range traces {
+		for _, ts := range times {
+			r.Add(ip, ts, "/", "Mozilla/5.0")
+		}
+	}
+	rep := r.Report()
+
+	maxBot, minHuman := 0.0, math.Inf(1)
+	for ip := range traces {
+		row := regularityRow(t, rep, ip)
+		bot := ip[:3] == "10."
+		if row.Suspicious != bot {
+			t.Errorf("%s: CV = %.3f, Suspicious = %v, want %v", ip, row.CV, row.Suspicious, bot)
+		}
+		if bot {
+			maxBot = math.Max(maxBot, row.CV)
+		} else {
+			minHuman = math.Min(minHuman, row.CV)
+		}
+	}
+	if maxBot > 0.25 || minHuman < 1 {
+		t.Errorf("定时抓取的 CV 最大为 %.3f, 人的访问的 CV 最小为 %.3f, 未能分开", maxBot, minHuman)
+	}
+}
+
+func TestRegularityEdgeCases(t *testing.T) {
+	r := newRegularityTracker(10, 50, 0.25)
+	for i := 0; i < 100; i++ {
+		// 同一秒内的请求间隔全为 0, CV 无意义
+		r.Add("1.1.1.1", traceStart, "/", "ua")
+		// 完全规律, 但请求数少于 MinRequests
+		if i < 20 {
+			r.Add("2.2.2.2", traceStart.Add(time.Duration(i)*time.Minute), "/", "ua")
+		}
+		// 完全规律, CV 为 0
+		r.Add("3.3.3.3", traceStart.Add(time.Duration(i)*time.Minute), "/", "ua")
+	}
+	rep := r.Report()
+
+	if row := regularityRow(t, rep, "1.1.1.1"); row.CV != 0 || row.Suspicious {
+		t.Errorf("间隔全为 0: %+v", row)
+	}
+	if row := regularityRow(t, rep, "2.2.2.2"); row.CV != 0 || row.Suspicious {
+		t.Errorf("请求数不足: %+v", row)
+	}
+	if row := regularityRow(t, rep, "3.3.3.3"); row.CV != 0 || !row.Suspicious || row.MeanGap != 60 || row.MedianGap != 60 {
+		t.Errorf("完全规律: %+v", row)
+	}
+}
+
+// 分两段统计后合并, 平均间隔与变异系数与一次统计相同
+func TestRegularityMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	times := burstyTrace(300, rng)
+
+	whole := newRegularityTracker(10, 50, 0.25)
+	a, b := newRegularityTracker(10, 50, 0.25), newRegularityTracker(10, 50, 0.25)
+	for i, ts := range times {
+		whole.Add("1.1.1.1", ts, "/", "ua")
+		if i < 120 {
+			a.Add("1.1.1.1", ts, "/", "ua")
+		} else {
+			b.Add("1.1.1.1", ts, "/", "ua")
+		}
+	}
+	a.merge(b)
+
+	want, got := whole.Report().IPs[0], a.Report().IPs[0]
+	if got.Requests != want.Requests || math.Abs(got.MeanGap-want.MeanGap) > 1e-9 || math.Abs(got.CV-want.CV) > 1e-9 {
+		t.Errorf("合并后 %+v, 一次统计为 %+v", got, want)
+	}
+}
@@ -0,0 +1,289 @@
+package analyzer
+
+import (
+	"sort"
+	"time"
+)
+
+// Report 为一次分析的结果, 可直接序列化为 JSON. 未启用的板块为 nil
+type Report struct {
+	// Lines 为读取的总行数
+	Lines int `json:"lines"`
+	// ParseErrors 为不符合日志格式的行数
+	ParseErrors int `json:"parse_errors"`
+	// OversizedLines 为超过 Options.MaxLineSize 而跳过的行数, 这些行计入 Lines
+	OversizedLines int `json:"oversized_lines,omitempty"`
+	// MalformedCount 为 $request 无法解析的请求数, 这些请求不参与其他统计
+	MalformedCount    int      `json:"malformed_count"`
+	MalformedExamples []string `json:"malformed_examples,omitempty"`
+	// BadTimestamps 为时间无法按 Options.TimeFormat 解析的请求数, 这些请求不计入每小时排名、
+	// 每日趋势等按时间划分的板块, BadTimeExamples 为其中几个原始时间
+	BadTimestamps   int      `json:"bad_timestamps,omitempty"`
+	BadTimeExamples []string `json:"bad_time_examples,omitempty"`
+
+	// ExcludedMethods 为按 Options.ExcludeMethods 排除的各方法请求数
+	ExcludedMethods map[string]int `json:"excluded_methods,omitempty"`
+	// ExcludedUserAgents 与 ExcludedPaths 为按 Options.ExcludeUserAgents 与 Options.ExcludePaths 排除的请求数
+	ExcludedUserAgents int `json:"excluded_user_agents,omitempty"`
+	ExcludedPaths      int `json:"excluded_paths,omitempty"`
+	// ExcludedIPs 为客户端 IP 落在 Options.ExcludeIPs 中而排除的请求数
+	ExcludedIPs int `json:"excluded_ips,omitempty"`
+	// ExcludedCountries 为按 Options.OnlyCountries、ExcludeCountries 排除的请求数, 含查不到国家而排除的请求
+	ExcludedCountries int `json:"excluded_countries,omitempty"`
+
+	// Requests 为参与统计的请求数 (不含被 URLFilter、ExcludeMethods 过滤的请求),
+	// Errors 为其中状态码不小于 400 的请求数
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+	// Outliers 为交给 Options.OnOutlier 的请求数, 抽样统计时不放大
+	Outliers int `json:"outliers,omitempty"`
+	// Start 与 End 为最早与最晚的日志时间, 没有可解析的时间时为 nil
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+
+	// Summary 为概览, 包含各类状态码 (2xx/3xx/4xx/5xx) 的占比
+	Summary *Summary `json:"summary"`
+
+	// MinCount 为 Options.MinCount, 大于 0 时计数排名末尾可能有 "(other)" 行
+	MinCount int `json:"min_count,omitempty"`
+	// SortBy 为排名的排序方式, SortByCount、SortByName 或 SortByBytes
+	SortBy string `json:"sort_by"`
+
+	// Sample 非 nil 时为抽样统计, 各计数为按抽样率放大的估算值
+	Sample *SampleInfo `json:"sample,omitempty"`
+
+	// Decay 非 nil 时, 下列排名为衰减计数, 且不统计访问时间
+	Decay *DecayInfo `json:"decay,omitempty"`
+
+	TopIPs        []Rank `json:"top_ips"`
+	TopUserAgents []Rank `json:"top_user_agents"`
+	TopURLs       []Rank `json:"top_urls"`
+	TopHours      []Rank `json:"top_hours,omitempty"`
+	TopStatuses   []Rank `json:"top_statuses"`
+	// URLGroups 为 Options.URLGroups 各规则归入的请求数, 顺序与规则相同
+	URLGroups []URLGroupCount `json:"url_groups,omitempty"`
+	// Countries 为全部国家/地区的请求数排名, 见 Options.Countries
+	Countries []Rank `json:"countries,omitempty"`
+	// Custom 为 Options.CountBy 与 Options.SumBy 对应的排名, 顺序相同
+	Custom []CustomRanking `json:"custom,omitempty"`
+
+	Sessions *SessionReport `json:"sessions,omitempty"`
+	Referers *RefererReport `json:"referers,omitempty"`
+	// RefererDomains 为来源域名排名, 见 Options.RefererDomains
+	RefererDomains []RefererDomain  `json:"referer_domains,omitempty"`
+	MethodURL      *MethodURLReport `json:"method_url,omitempty"`
+	NotFound       *NotFoundReport  `json:"not_found,omitempty"`
+	Redirects      *RedirectReport  `json:"redirects,omitempty"`
+	Sizes          []SizeBucket     `json:"sizes,omitempty"`
+	Latency        *LatencyReport   `json:"latency,omitempty"`
+	Writes         *WriteReport     `json:"writes,omitempty"`
+	Uniques        *UniqueReport    `json:"uniques,omitempty"`
+	// New 为 CompareBaseline 的结果
+	New    *NewEntries  `json:"new,omitempty"`
+	Spikes *SpikeReport `json:"spikes,omitempty"`
+	// Trend 为每日趋势, 见 Options.Trend
+	Trend []TrendDay `json:"trend,omitempty"`
+	// Params 为查询参数统计, 见 Options.Params
+	Params *ParamReport `json:"params,omitempty"`
+	// Regularity 为主要 IP 的请求间隔分布, 见 Options.Regularity
+	Regularity *RegularityReport `json:"regularity,omitempty"`
+	// Bots 为自称搜索引擎爬虫的 IP, 见 Options.Bots
+	Bots *BotReport `json:"bots,omitempty"`
+	// Alerts 为 EvaluateAlerts 的结果, 包括未触发的条件
+	Alerts []AlertResult `json:"alerts,omitempty"`
+
+	// Meta 为本次运行的耗时与资源占用, 由调用方 (命令行工具) 填写
+	Meta *Meta `json:"meta,omitempty"`
+}
+
+// OtherKey 为 Options.MinCount 汇总行的名称
+const OtherKey = "(other)"
+
+// Rank 为排名中的一项. 衰减模式下 Count 为小数; Bytes 只有计数排名才有.
+// Other 为 true 的是不参与排名的汇总行, 即汇总未列出项的 "(other)" 或国家排名中的 UnknownCountry, 总在最后
+type Rank struct {
+	Key   string  `json:"key"`
+	Count float64 `json:"count"`
+	Bytes int64   `json:"bytes,omitempty"`
+	Other bool    `json:"other,omitempty"`
+	// Variants 为合并进该项的不同原始 UA 数, 只有 Options.NormalizeUserAgents 时 UA 排名才有
+	Variants int `json:"variants,omitempty"`
+}
+
+// DecayInfo 说明衰减计数的参数
+type DecayInfo struct {
+	HalfLifeSeconds float64 `json:"half_life_seconds"`
+	// ReferenceTime 为计数折算到的时刻, 即最后一条日志的时间
+	ReferenceTime time.Time `json:"reference_time"`
+}
+
+// Meta 为一次分析的运行统计. Workers 为并行统计的分段数, 内存与 goroutine 数为运行期间定时采样的峰值,
+// Filtered 为各项排除规则去掉的请求数, Failed 为无法按日志格式解析的行数与无法解析的请求数之和
+type Meta struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	Lines           int     `json:"lines"`
+	InputBytes      int64   `json:"input_bytes"`
+	LinesPerSecond  float64 `json:"lines_per_second"`
+	MBPerSecond     float64 `json:"mb_per_second"`
+	PeakMemoryBytes uint64  `json:"peak_memory_bytes"`
+	Workers         int     `json:"workers"`
+	Goroutines      int     `json:"goroutines"`
+	Filtered        int     `json:"filtered"`
+	Failed          int     `json:"failed"`
+}
+
+// 统计出现次数最多的前十项
+func topTenKeys(counts map[string]int) []string {
+	return topKeys(counts, 10)
+}
+
+// 出现次数最多的前 n 项
+func topKeys(counts map[string]int, n int) []string {
+	return topKeysAbove(counts, n, 0)
+}
+
+// 同 topKeys, 但跳过出现次数低于 min 的项
+func topKeysAbove(counts map[string]int, n, min int) []string {
+	top := newTopSelector(n)
+	for key, count := range counts {
+		if count >= min {
+			top.Offer(key, float64(count))
+		}
+	}
+	return top.keys
+}
+
+// 按分值保留前 n 项. 只维护长度为 n 的有序结果, 避免对整张表排序,
+// 快照时对百万级的 URL 表也只需一次遍历. 分值相同时按键名排列,
+// 结果与遍历计数表的顺序无关, 同一份日志每次 (包括分段合并后) 的报告相同
+type topSelector struct {
+	n      int
+	keys   []string
+	scores []float64
+}
+
+func newTopSelector(n int) *topSelector {
+	return &topSelector{n: n, keys: make([]string, 0, n+1), scores: make([]float64, 0, n+1)}
+}
+
+func (t *topSelector) Offer(key string, score float64) {
+	if len(t.keys) == t.n && !t.before(key, score, t.n-1) {
+		return
+	}
+	i := sort.Search(len(t.scores), func(i int) bool { return t.before(key, score, i) })
+	t.keys = append(t.keys, "")
+	copy(t.keys[i+1:], t.keys[i:])
+	t.keys[i] = key
+	t.scores = append(t.scores, 0)
+	copy(t.scores[i+1:], t.scores[i:])
+	t.scores[i] = score
+	if len(t.keys) > t.n {
+		t.keys, t.scores = t.keys[:t.n], t.scores[:t.n]
+	}
+}
+
+// before 判断 key 是否应排在第 i 项之前
+func (t *topSelector) before(key string, score float64, i int) bool {
+	return score > t.scores[i] || score == t.scores[i] && key < t.keys[i]
+}
+
+func topCounts(counts map[string]int) []Rank {
+	var ranks []Rank
+	for _, key := range topTenKeys(counts) {
+		ranks = append(ranks, Rank{Key: key, Count: float64(counts[key])})
+	}
+	return ranks
+}
+
+// 排名的排序方式, 见 Options.SortBy
+const (
+	SortByCount = "count"
+	SortByName  = "name"
+	SortByBytes = "bytes"
+)
+
+// 按键名排序, "(other)" 行保持在最后
+func sortRanksByKey(ranks []Rank) {
+	sort.SliceStable(ranks, func(i, j int) bool {
+		if ranks[i].Other != ranks[j].Other {
+			return ranks[j].Other
+		}
+		return ranks[i].Key < ranks[j].Key
+	})
+}
+
+// 单个键的累计值
+type keyStats struct {
+	Count int
+	Bytes int64
+}
+
+// 按键计数并累计响应字节数
+type keyCounter struct {
+	stats map[string]*keyStats
+	total int
+	sum   int64
+}
+
+func newKeyCounter() *keyCounter {
+	return &keyCounter{stats: make(map[string]*keyStats)}
+}
+
+func (k *keyCounter) Add(key string, bytes int64) {
+	st, ok := k.stats[key]
+	if !ok {
+		st = &keyStats{}
+		k.stats[key] = st
+	}
+	st.Count++
+	st.Bytes += bytes
+	k.total++
+	k.sum += bytes
+}
+
+// 合并另一个计数器的结果
+func (k *keyCounter) merge(o *keyCounter) {
+	for key, st := range o.stats {
+		mine, ok := k.stats[key]
+		if !ok {
+			mine = &keyStats{}
+			k.stats[key] = mine
+		}
+		mine.Count += st.Count
+		mine.Bytes += st.Bytes
+	}
+	k.total += o.total
+	k.sum += o.sum
+}
+
+// Ranks 返回前十且请求数不少于 minCount 的项, sortBy 为 SortByBytes 时按字节数选取并排序,
+// 否则按请求数选取, SortByName 时再按键名排序. minCount 大于 0 时追加 "(other)" 行
+func (k *keyCounter) Ranks(minCount int, sortBy string) []Rank {
+	top := newTopSelector(10)
+	for key, st := range k.stats {
+		if st.Count < minCount {
+			continue
+		}
+		if sortBy == SortByBytes {
+			top.Offer(key, float64(st.Bytes))
+		} else {
+			top.Offer(key, float64(st.Count))
+		}
+	}
+
+	var ranks []Rank
+	shown, shownBytes := 0, int64(0)
+	for _, key := range top.keys {
+		st := k.stats[key]
+		ranks = append(ranks, Rank{Key: key, Count: float64(st.Count), Bytes: st.Bytes})
+		shown += st.Count
+		shownBytes += st.Bytes
+	}
+	if minCount > 0 && shown < k.total {
+		ranks = append(ranks, Rank{Key: OtherKey, Count: float64(k.total - shown), Bytes: k.sum - shownBytes, Other: true})
+	}
+	if sortBy == SortByName {
+		sortRanksByKey(ranks)
+	}
+	return ranks
+}
@@ -0,0 +1,132 @@
+package analyzer
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// SampleInfo 说明抽样统计的参数. 抽样时各计数 (请求数、字节数、排名、概览、每日趋势等)
+// 已按 1/Rate 放大为估算值, Lines 仍为读取的实际行数; Unscaled 中的板块 (JSON 字段名)
+// 只基于抽样到的行, 其中的数值未放大
+type SampleInfo struct {
+	Rate float64 `json:"rate"`
+	// SampledLines 为抽中并统计的行数
+	SampledLines int      `json:"sampled_lines"`
+	Unscaled     []string `json:"unscaled,omitempty"`
+}
+
+// sampleKeep 按行内容的哈希决定是否抽中该行, 同一行总是得到相同的结果,
+// 因此抽样结果与读取顺序、分段并行无关
+func sampleKeep(line string, rate float64) bool {
+	h := fnv.New32a()
+	h.Write([]byte(line))
+	return float64(h.Sum32()) < rate*(1<<32)
+}
+
+func scaleInt(n int, factor float64) int {
+	return int(math.Round(float64(n) * factor))
+}
+
+func scaleInt64(n int64, factor float64) int64 {
+	return int64(math.Round(float64(n) * factor))
+}
+
+// round 为 true 时请求数取整, 数值字段求和 (Options.SumBy) 的排名保留小数
+func scaleRanks(ranks []Rank, factor float64, round bool) {
+	for i := range ranks {
+		ranks[i].Count *= factor
+		if round {
+			ranks[i].Count = math.Round(ranks[i].Count)
+		}
+		ranks[i].Bytes = scaleInt64(ranks[i].Bytes, factor)
+	}
+}
+
+// applySample 把抽样统计的计数放大 1/rate 倍, 并在 r.Sample 中记录未放大的板块
+func (r *Report) applySample(rate float64, sampledLines int) {
+	factor := 1 / rate
+	r.Sample = &SampleInfo{Rate: rate, SampledLines: sampledLines}
+
+	r.ParseErrors = scaleInt(r.ParseErrors, factor)
+	r.MalformedCount = scaleInt(r.MalformedCount, factor)
+	r.BadTimestamps = scaleInt(r.BadTimestamps, factor)
+	for m, n := range r.ExcludedMethods {
+		r.ExcludedMethods[m] = scaleInt(n, factor)
+	}
+	r.ExcludedUserAgents = scaleInt(r.ExcludedUserAgents, factor)
+	r.ExcludedPaths = scaleInt(r.ExcludedPaths, factor)
+	r.ExcludedIPs = scaleInt(r.ExcludedIPs, factor)
+	r.ExcludedCountries = scaleInt(r.ExcludedCountries, factor)
+	r.Requests = scaleInt(r.Requests, factor)
+	r.Errors = scaleInt(r.Errors, factor)
+
+	if s := r.Summary; s != nil {
+		s.Requests = scaleInt(s.Requests, factor)
+		s.Bytes = scaleInt64(s.Bytes, factor)
+		s.RequestsPerSecond *= factor
+		s.InvalidStatus = scaleInt(s.InvalidStatus, factor)
+		for i := range s.StatusClasses {
+			s.StatusClasses[i].Requests = scaleInt(s.StatusClasses[i].Requests, factor)
+		}
+	}
+	for _, ranks := range [][]Rank{r.TopIPs, r.TopUserAgents, r.TopURLs, r.TopHours, r.TopStatuses, r.Countries} {
+		scaleRanks(ranks, factor, r.Decay == nil)
+	}
+	for _, c := range r.Custom {
+		scaleRanks(c.Ranks, factor, c.Value == "")
+	}
+	for i := range r.URLGroups {
+		r.URLGroups[i].Requests = scaleInt(r.URLGroups[i].Requests, factor)
+	}
+	for i := range r.RefererDomains {
+		d := &r.RefererDomains[i]
+		d.Requests = scaleInt(d.Requests, factor)
+		d.TopRefererRequests = scaleInt(d.TopRefererRequests, factor)
+	}
+	for i := range r.Sizes {
+		r.Sizes[i].Count = scaleInt(r.Sizes[i].Count, factor)
+		r.Sizes[i].Bytes = scaleInt64(r.Sizes[i].Bytes, factor)
+	}
+	if p := r.Params; p != nil {
+		p.Requests = scaleInt(p.Requests, factor)
+		p.DecodeErrors = scaleInt(p.DecodeErrors, factor)
+		scaleRanks(p.Names, factor, true)
+		for i := range p.Endpoints {
+			p.Endpoints[i].Requests = scaleInt(p.Endpoints[i].Requests, factor)
+			scaleRanks(p.Endpoints[i].Names, factor, true)
+		}
+		for _, v := range p.Values {
+			scaleRanks(v.Values, factor, true)
+		}
+	}
+	for i := range r.Trend {
+		d := &r.Trend[i]
+		d.Requests = scaleInt(d.Requests, factor)
+		d.Bytes = scaleInt64(d.Bytes, factor)
+		d.Errors = scaleInt(d.Errors, factor)
+		d.Delta = scaleInt(d.Delta, factor)
+	}
+
+	// 访问、独立计数、逐条示例等不能简单按比例放大
+	unscaled := []struct {
+		name    string
+		present bool
+	}{
+		{"sessions", r.Sessions != nil},
+		{"referers", r.Referers != nil},
+		{"method_url", r.MethodURL != nil},
+		{"not_found", r.NotFound != nil},
+		{"redirects", r.Redirects != nil},
+		{"latency", r.Latency != nil},
+		{"writes", r.Writes != nil},
+		{"uniques", r.Uniques != nil},
+		{"spikes", r.Spikes != nil},
+		{"bots", r.Bots != nil},
+		{"regularity", r.Regularity != nil},
+	}
+	for _, u := range unscaled {
+		if u.present {
+			r.Sample.Unscaled = append(r.Sample.Unscaled, u.name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package analyzer
+
+import "time"
+
+// SessionReport 为访问(visit)分析结果
+type SessionReport struct {
+	GapSeconds  float64 `json:"gap_seconds"`
+	ExcludeBots bool    `json:"exclude_bots"`
+	Visits      int     `json:"visits"`
+	Requests    int     `json:"requests"`
+	// AvgDurationSeconds 为平均每次访问从第一个到最后一个请求的时长
+	AvgDurationSeconds float64 `json:"avg_duration_seconds"`
+	EntryPages         []Rank  `json:"entry_pages"`
+	ExitPages          []Rank  `json:"exit_pages"`
+}
+
+type visit struct {
+	start    time.Time
+	last     time.Time
+	requests int
+	entry    string
+	exit     string
+}
+
+// 访问(visit)统计: 同一 IP+UA 的相邻请求间隔不超过 gap 视为同一次访问.
+// 日志基本按时间顺序写入, 只需保留仍可能延续的访问, 超过间隔的访问随时结算释放,
+// 内存占用取决于一个间隔内的活跃客户端数, 而不是整份日志
+type sessionTracker struct {
+	gap         time.Duration
+	excludeBots bool
+	open        map[string]*visit
+	lastSweep   time.Time
+
+	visits      int
+	requests    int
+	duration    time.Duration
+	entryCounts map[string]int
+	exitCounts  map[string]int
+}
+
+func newSessionTracker(gap time.Duration, excludeBots bool) *sessionTracker {
+	return &sessionTracker{
+		gap:         gap,
+		excludeBots: excludeBots,
+		open:        make(map[string]*visit),
+		entryCounts: make(map[string]int),
+		exitCounts:  make(map[string]int),
+	}
+}
+
+func (s *sessionTracker) Add(ip, userAgent, url string, t time.Time) {
+	if t.IsZero() || (s.excludeBots && isBot(userAgent)) {
+		return
+	}
+
+	client := ip + "|" + userAgent
+	v, ok := s.open[client]
+	if ok && t.Sub(v.last) > s.gap {
+		s.close(v)
+		ok = false
+	}
+	if !ok {
+		v = &visit{start: t, last: t, entry: url}
+		s.open[client] = v
+	}
+	v.requests++
+	if t.Before(v.start) {
+		v.start = t
+	}
+	if !t.Before(v.last) {
+		v.last = t
+		v.exit = url
+	}
+
+	if t.Sub(s.lastSweep) > s.gap {
+		for key, v := range s.open {
+			if t.Sub(v.last) > s.gap {
+				s.close(v)
+				delete(s.open, key)
+			}
+		}
+		s.lastSweep = t
+	}
+}
+
+func (s *sessionTracker) close(v *visit) {
+	s.visits++
+	s.requests += v.requests
+	s.duration += v.last.Sub(v.start)
+	s.entryCounts[v.entry]++
+	s.exitCounts[v.exit]++
+}
+
+// Report 把尚未结束的访问一并计入结果, 但不结算它们, 之后的请求仍可延续这些访问
+func (s *sessionTracker) Report() *SessionReport {
+	visits, requests, duration := s.visits, s.requests, s.duration
+	entryCounts := make(map[string]int, len(s.entryCounts))
+	for k, v := range s.entryCounts {
+		entryCounts[k] = v
+	}
+	exitCounts := make(map[string]int, len(s.exitCounts))
+	for k, v := range s.exitCounts {
+		exitCounts[k] = v
+	}
+	for _, v := range s.open {
+		visits++
+		requests += v.requests
+		duration += v.last.Sub(v.start)
+		entryCounts[v.entry]++
+		exitCounts[v.exit]++
+	}
+
+	rep := &SessionReport{
+		GapSeconds:  s.gap.Seconds(),
+		ExcludeBots: s.excludeBots,
+		Visits:      visits,
+		Requests:    requests,
+		EntryPages:  topCounts(entryCounts),
+		ExitPages:   topCounts(exitCounts),
+	}
+	if visits > 0 {
+		rep.AvgDurationSeconds = (duration / time.Duration(visits)).Seconds()
+	}
+	return rep
+}
@@ -0,0 +1,58 @@
+package analyzer
+
+// SizeBucketLabels 为响应大小分布的区间
+var SizeBucketLabels = []string{"0", "<1KB", "1-10KB", "10-100KB", ">100KB"}
+
+// SizeBucket 为一个响应大小区间的请求数与总字节数
+type SizeBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+func sizeBucket(bytes int64) int {
+	switch {
+	case bytes <= 0:
+		return 0
+	case bytes < 1<<10:
+		return 1
+	case bytes < 10<<10:
+		return 2
+	case bytes < 100<<10:
+		return 3
+	}
+	return 4
+}
+
+type sizeCounter struct {
+	counts []int
+	bytes  []int64
+}
+
+func newSizeCounter() *sizeCounter {
+	return &sizeCounter{
+		counts: make([]int, len(SizeBucketLabels)),
+		bytes:  make([]int64, len(SizeBucketLabels)),
+	}
+}
+
+func (s *sizeCounter) Add(bytes int64) {
+	b := sizeBucket(bytes)
+	s.counts[b]++
+	s.bytes[b] += bytes
+}
+
+func (s *sizeCounter) merge(o *sizeCounter) {
+	for i := range s.counts {
+		s.counts[i] += o.counts[i]
+		s.bytes[i] += o.bytes[i]
+	}
+}
+
+func (s *sizeCounter) Report() []SizeBucket {
+	buckets := make([]SizeBucket, len(SizeBucketLabels))
+	for i, label := range SizeBucketLabels {
+		buckets[i] = SizeBucket{label, s.counts[i], s.bytes[i]}
+	}
+	return buckets
+}
@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"math"
+	"time"
+)
+
+// SpikeReport 为每分钟请求数突增检测结果
+type SpikeReport struct {
+	// Window 为移动平均窗口 (分钟), Sigma 为判定突增的标准差倍数
+	Window int     `json:"window"`
+	Sigma  float64 `json:"sigma"`
+	Spikes []Spike `json:"spikes"`
+}
+
+// Spike 为一个突增的分钟及其前 Window 分钟的平均值与标准差
+type Spike struct {
+	Minute time.Time `json:"minute"`
+	Count  int       `json:"count"`
+	Mean   float64   `json:"mean"`
+	StdDev float64   `json:"std_dev"`
+}
+
+// 突增检测: 按分钟顺序一次遍历 (无请求的分钟按 0 计), 用前 window 分钟的
+// 移动平均与标准差判断当前分钟是否突增. 请求数存在泊松噪声, 标准差至少按 √均值 计
+func detectSpikes(minuteCounts map[int64]int, window int, sigma float64, loc *time.Location) []Spike {
+	spikes := []Spike{}
+	if len(minuteCounts) == 0 || window < 2 {
+		return spikes
+	}
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	for m := range minuteCounts {
+		if m < first {
+			first = m
+		}
+		if m > last {
+			last = m
+		}
+	}
+
+	history := make([]float64, 0, window)
+	var sum, sumSq float64
+	for m := first; m <= last; m++ {
+		count := float64(minuteCounts[m])
+		if len(history) == window {
+			mean := sum / float64(window)
+			std := math.Sqrt(math.Max(sumSq/float64(window)-mean*mean, 0))
+			if floor := math.Sqrt(mean); std < floor {
+				std = floor
+			}
+			if std > 0 && count > mean+sigma*std {
+				spikes = append(spikes, Spike{time.Unix(m*60, 0).In(loc), int(count), mean, std})
+			}
+
+			oldest := history[0]
+			history = history[1:]
+			sum -= oldest
+			sumSq -= oldest * oldest
+		}
+		history = append(history, count)
+		sum += count
+		sumSq += count * count
+	}
+	return spikes
+}
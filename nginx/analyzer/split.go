@@ -0,0 +1,118 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// Splitter 按某个日志字段 (如 $host) 的值把请求分组, 每组由独立的 Analyzer 统计,
+// 读一遍日志即可得到各组的报告. 分组数达到上限后, 新出现的值都归入 OtherKey 组
+type Splitter struct {
+	opts      Options
+	parser    *gonx.Parser
+	maxGroups int
+	groups    map[string]*Analyzer
+
+	lines       int
+	parseErrors int
+	oversized   int
+	// overflow 为超出上限而归入 OtherKey 组的不同值的个数
+	overflow map[string]bool
+}
+
+// NewSplitter 按 opts 创建 Splitter, field 为日志格式中的字段名 (不带 $), maxGroups 不大于 0 时不限制分组数.
+// Splitter 不支持抽样, 忽略 Options.SampleRate
+func NewSplitter(opts Options, field string, maxGroups int) (*Splitter, error) {
+	opts.SampleRate = 0
+	if opts.LogFormat == "" {
+		opts.LogFormat = DefaultLogFormat
+	}
+	fields := FormatFields(opts.LogFormat)
+	if !containsString(fields, field) {
+		return nil, fmt.Errorf("日志格式中没有字段 $%s, 可用字段: $%s", field, strings.Join(fields, ", $"))
+	}
+	opts.splitBy = field
+	return &Splitter{
+		opts:      opts,
+		parser:    newParser(opts.LogFormat),
+		maxGroups: maxGroups,
+		groups:    make(map[string]*Analyzer),
+		overflow:  make(map[string]bool),
+	}, nil
+}
+
+// AddLine 解析一行日志并交给所属分组统计. 无法按日志格式解析时返回错误, 该行不属于任何分组,
+// 只计入 ParseErrors
+func (s *Splitter) AddLine(line string) error {
+	s.lines++
+	entry, err := parseLogLine(s.parser, line, &s.opts)
+	if err != nil {
+		s.parseErrors++
+		return err
+	}
+
+	key := entry.SplitKey
+	if key == "" {
+		key = "-"
+	}
+	a, ok := s.groups[key]
+	if !ok {
+		if s.maxGroups > 0 && len(s.groups) >= s.maxGroups {
+			// OtherKey 组不计入上限
+			s.overflow[key] = true
+			key = OtherKey
+			a = s.groups[key]
+		}
+		if a == nil {
+			a = New(s.opts)
+			s.groups[key] = a
+		}
+	}
+	a.add(entry, nil)
+	return nil
+}
+
+// AddOversizedLine 记录一行因超过长度上限而未读取的日志, 该行不属于任何分组
+func (s *Splitter) AddOversizedLine() {
+	s.lines++
+	s.oversized++
+}
+
+// Lines 为读取的总行数, ParseErrors 与 OversizedLines 为其中不符合日志格式与超过长度上限的行数
+func (s *Splitter) Lines() int          { return s.lines }
+func (s *Splitter) ParseErrors() int    { return s.parseErrors }
+func (s *Splitter) OversizedLines() int { return s.oversized }
+
+// Overflow 为因超出分组数上限而归入 OtherKey 组的不同值的个数
+func (s *Splitter) Overflow() int { return len(s.overflow) }
+
+// Groups 返回各分组的值, 按请求数从多到少排列, OtherKey 组总在最后
+func (s *Splitter) Groups() []string {
+	keys := make([]string, 0, len(s.groups))
+	for key := range s.groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if (a == OtherKey) != (b == OtherKey) {
+			return b == OtherKey
+		}
+		if na, nb := s.groups[a].lines, s.groups[b].lines; na != nb {
+			return na > nb
+		}
+		return a < b
+	})
+	return keys
+}
+
+// Report 返回一个分组的报告, 分组不存在时返回 nil
+func (s *Splitter) Report(group string) *Report {
+	a, ok := s.groups[group]
+	if !ok {
+		return nil
+	}
+	return a.Report()
+}
@@ -0,0 +1,79 @@
+package analyzer
+
+// Stream 是可以并发使用的 Analyzer, 供持续读取日志并定期输出报告的场景使用.
+//
+// 日志行在调用方的 goroutine 中解析, 解析结果与 Snapshot 请求按调用顺序进入同一个队列,
+// 由唯一的汇总 goroutine 依次处理, 因此:
+//   - Snapshot 返回的报告恰好包含在它之前返回的全部 AddLine, 不会出现只统计了一行的一部分;
+//   - 生成快照期间汇总暂停, AddLine 只有在队列写满时才会阻塞, 快照耗时约等于一次 Report()
+//     (主要是对各计数表取前 N, 与已跟踪的 URL 数成正比, 一百万个 URL 时约 0.1 秒, 见 BenchmarkSnapshot);
+//   - 多个 goroutine 同时写入时, 行的先后顺序由调度决定. 访问分析与跳转链推测假设日志基本有序,
+//     乱序较多时结果会有偏差.
+type Stream struct {
+	a     *Analyzer
+	queue chan interface{}
+	done  chan *Report
+}
+
+type parsedLine struct {
+	entry logEntry
+	err   error
+}
+
+// oversizedLine 为超过长度上限而跳过的一行
+type oversizedLine struct{}
+
+// streamQueueSize 为汇总队列的长度, 快照期间最多缓冲这么多行而不阻塞写入方
+const streamQueueSize = 4096
+
+// NewStream 按 opts 创建 Stream 并启动汇总 goroutine, 用完后需调用 Close. Stream 不支持抽样, 忽略 Options.SampleRate
+func NewStream(opts Options) *Stream {
+	opts.SampleRate = 0
+	s := &Stream{
+		a:     New(opts),
+		queue: make(chan interface{}, streamQueueSize),
+		done:  make(chan *Report, 1),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Stream) run() {
+	for msg := range s.queue {
+		switch m := msg.(type) {
+		case parsedLine:
+			s.a.add(m.entry, m.err)
+		case oversizedLine:
+			s.a.AddOversizedLine()
+		case chan *Report:
+			m <- s.a.Report()
+		}
+	}
+	s.done <- s.a.Report()
+}
+
+// AddLine 解析一行日志并交给汇总 goroutine, 可以在多个 goroutine 中同时调用.
+// 解析错误同步返回, 该行计入 Report.ParseErrors. Close 之后不能再调用
+func (s *Stream) AddLine(line string) error {
+	entry, err := s.a.parse(line)
+	s.queue <- parsedLine{entry, err}
+	return err
+}
+
+// AddOversizedLine 记录一行超过长度上限而没有读取的日志, 见 Analyzer.AddOversizedLine
+func (s *Stream) AddOversizedLine() {
+	s.queue <- oversizedLine{}
+}
+
+// Snapshot 返回当前结果的副本, 不会中断后续的 AddLine
+func (s *Stream) Snapshot() *Report {
+	reply := make(chan *Report, 1)
+	s.queue <- reply
+	return <-reply
+}
+
+// Close 等待队列中的行处理完毕, 停止汇总 goroutine 并返回最终结果
+func (s *Stream) Close() *Report {
+	close(s.queue)
+	return <-s.done
+}
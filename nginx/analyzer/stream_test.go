@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkSnapshot 测量跟踪一百万个 URL 时一次快照的耗时, 即 Stream 文档中汇总暂停的时长
+func BenchmarkSnapshot(b *testing.B) {
+	s := NewStream(Options{})
+	defer s.Close()
+	for i := 0; i < 1000000; i++ {
+		line := fmt.Sprintf(`10.0.%d.%d - - [15/Oct/2026:10:%02d:%02d +0000] "GET /item/%d HTTP/1.1" 200 512 "-" "bench" "-"`,
+			i>>8&255, i&255, i/60%60, i%60, i)
+		if err := s.AddLine(line); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if rep := s.Snapshot(); rep.Requests != 1000000 {
+		b.Fatalf("requests = %d, want 1000000", rep.Requests)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Snapshot()
+	}
+}
+
+// 超长的行与 AnalyzeFile 中一样计入 Lines 与 OversizedLines
+func TestStreamOversizedLine(t *testing.T) {
+	s := NewStream(Options{})
+	if err := s.AddLine(`10.0.0.1 - - [15/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "test" "-"`); err != nil {
+		t.Fatal(err)
+	}
+	s.AddOversizedLine()
+	if rep := s.Close(); rep.Lines != 2 || rep.OversizedLines != 1 || rep.Requests != 1 {
+		t.Errorf("Lines = %d, OversizedLines = %d, Requests = %d; 应为 2, 1, 1", rep.Lines, rep.OversizedLines, rep.Requests)
+	}
+}
@@ -0,0 +1,62 @@
+package analyzer
+
+import (
+	"strconv"
+	"time"
+)
+
+// Summary 为报告开头的概览: 请求数、流量、时间范围、平均每秒请求数与各类状态码的占比
+type Summary struct {
+	Requests int        `json:"requests"`
+	Bytes    int64      `json:"bytes"`
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	// DurationSeconds 为日志覆盖的秒数, 日志时间精确到秒, 首尾两条所在的秒都计入
+	DurationSeconds   float64 `json:"duration_seconds"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// StatusClasses 依次为 1xx 至 5xx
+	StatusClasses []StatusClass `json:"status_classes"`
+	// InvalidStatus 为状态码不是 100-599 的三位数字的请求数, 不计入任何类别
+	InvalidStatus int `json:"invalid_status"`
+}
+
+// StatusClass 为一类状态码的请求数, Percent 为占全部请求的百分比
+type StatusClass struct {
+	Class    string  `json:"class"`
+	Requests int     `json:"requests"`
+	Percent  float64 `json:"percent"`
+}
+
+// statusClass 返回状态码的类别 (首位数字 1-5), 不是合法状态码时返回 0
+func statusClass(status string) int {
+	if len(status) != 3 {
+		return 0
+	}
+	if _, err := strconv.Atoi(status); err != nil || status[0] < '1' || status[0] > '5' {
+		return 0
+	}
+	return int(status[0] - '0')
+}
+
+func (a *Analyzer) summary() *Summary {
+	s := &Summary{
+		Requests:      a.statusCounts.total,
+		Bytes:         a.statusCounts.sum,
+		StatusClasses: make([]StatusClass, 5),
+		InvalidStatus: a.statusClasses[0],
+	}
+	if !a.start.IsZero() {
+		start, end := a.start, a.end
+		s.Start, s.End = &start, &end
+		s.DurationSeconds = end.Sub(start).Seconds() + 1
+		s.RequestsPerSecond = float64(s.Requests) / s.DurationSeconds
+	}
+	for i := range s.StatusClasses {
+		n := a.statusClasses[i+1]
+		s.StatusClasses[i] = StatusClass{Class: strconv.Itoa(i+1) + "xx", Requests: n}
+		if s.Requests > 0 {
+			s.StatusClasses[i].Percent = float64(n) * 100 / float64(s.Requests)
+		}
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// strftime 指令对应的 Go 时间布局片段
+var strftimeDirectives = map[string]string{
+	"Y": "2006", "y": "06", "m": "01", "d": "02", "e": "_2", "j": "002",
+	"H": "15", "I": "03", "M": "04", "S": "05", "p": "PM",
+	"b": "Jan", "h": "Jan", "B": "January", "a": "Mon", "A": "Monday",
+	"z": "-0700", ":z": "-07:00", "Z": "MST",
+	"T": "15:04:05", "R": "15:04", "F": "2006-01-02", "D": "01/02/06",
+	"%": "%",
+}
+
+// TimeLayout 把 Options.TimeFormat 转换为 Go 时间布局: 含 % 时按 strftime 翻译
+// (如 "%d/%b/%Y:%H:%M:%S %z"), 否则视为 Go 布局原样返回. format 为空时返回空串, 表示自动识别
+func TimeLayout(format string) (string, error) {
+	if format == "" {
+		return "", nil
+	}
+	layout := format
+	if strings.Contains(format, "%") {
+		var b strings.Builder
+		for i := 0; i < len(format); i++ {
+			if format[i] != '%' {
+				b.WriteByte(format[i])
+				continue
+			}
+			directive := ""
+			if i+1 < len(format) {
+				directive = format[i+1 : i+2]
+				if directive == ":" && i+2 < len(format) {
+					directive = format[i+1 : i+3]
+				}
+			}
+			s, ok := strftimeDirectives[directive]
+			if !ok {
+				return "", fmt.Errorf("时间格式 %q 中的 %%%s 不受支持", format, directive)
+			}
+			b.WriteString(s)
+			i += len(directive)
+		}
+		layout = b.String()
+	}
+	// 不含任何时间元素的布局格式化任意时间后都不变
+	if time.Date(2001, 3, 4, 7, 8, 9, 0, time.UTC).Format(layout) == layout {
+		return "", fmt.Errorf("时间格式 %q 不含日期或时间, 应为 Go 布局 (如 2006-01-02 15:04:05) 或 strftime (如 %%Y-%%m-%%d %%H:%%M:%%S)", format)
+	}
+	return layout, nil
+}
+
+// 无效的 TimeFormat 按空处理, 即自动识别. 命令行工具在创建 Analyzer 前已用 TimeLayout 检查
+func timeLayoutOrAuto(format string) string {
+	layout, err := TimeLayout(format)
+	if err != nil {
+		return ""
+	}
+	return layout
+}
+
+// parseTimestamp 按 layout 解析日志时间. layout 为空时在 $time_local (02/Jan/2006:15:04:05 -0700)
+// 与 $time_iso8601 (2006-01-02T15:04:05-07:00) 之间自动识别
+func parseTimestamp(layout, s string) (time.Time, error) {
+	if layout == "" {
+		layout = timeLayout
+		if len(s) > 4 && s[4] == '-' {
+			layout = time.RFC3339
+		}
+	}
+	return time.Parse(layout, s)
+}
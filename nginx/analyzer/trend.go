@@ -0,0 +1,94 @@
+package analyzer
+
+import (
+	"sort"
+	"time"
+)
+
+// TrendDay 为一天的请求数、流量与错误率 (状态码 ≥ 400 的比例), 日期按日志中的时区划分.
+// Delta 与 DeltaPercent 为请求数较前一天的变化, 第一天及前一天没有请求时 DeltaPercent 为 0
+type TrendDay struct {
+	Day          string  `json:"day"`
+	Requests     int     `json:"requests"`
+	Bytes        int64   `json:"bytes"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	Delta        int     `json:"delta"`
+	DeltaPercent float64 `json:"delta_percent"`
+}
+
+type trendStat struct {
+	requests int
+	bytes    int64
+	errors   int
+}
+
+// 按天汇总请求数、流量与错误数, key 形如 "2006-01-02"
+type trendTracker struct {
+	days map[string]*trendStat
+}
+
+func newTrendTracker() *trendTracker {
+	return &trendTracker{days: make(map[string]*trendStat)}
+}
+
+func (tr *trendTracker) Add(t time.Time, bytes int64, isError bool) {
+	day := t.Format("2006-01-02")
+	st, ok := tr.days[day]
+	if !ok {
+		st = &trendStat{}
+		tr.days[day] = st
+	}
+	st.requests++
+	st.bytes += bytes
+	if isError {
+		st.errors++
+	}
+}
+
+func (tr *trendTracker) merge(o *trendTracker) {
+	for day, st := range o.days {
+		mine, ok := tr.days[day]
+		if !ok {
+			tr.days[day] = st
+			continue
+		}
+		mine.requests += st.requests
+		mine.bytes += st.bytes
+		mine.errors += st.errors
+	}
+}
+
+// Report 返回第一天到最后一天的每一天, 没有请求的日子 (日志缺失) 也列出, 各项为 0
+func (tr *trendTracker) Report() []TrendDay {
+	trend := []TrendDay{}
+	if len(tr.days) == 0 {
+		return trend
+	}
+	keys := make([]string, 0, len(tr.days))
+	for day := range tr.days {
+		keys = append(keys, day)
+	}
+	sort.Strings(keys)
+	// 按 UTC 的日历日逐天递增, 不受夏令时影响
+	first, _ := time.Parse("2006-01-02", keys[0])
+	last, _ := time.Parse("2006-01-02", keys[len(keys)-1])
+
+	prev := 0
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		day := TrendDay{Day: d.Format("2006-01-02")}
+		if st, ok := tr.days[day.Day]; ok {
+			day.Requests, day.Bytes, day.Errors = st.requests, st.bytes, st.errors
+			day.ErrorRate = float64(st.errors) / float64(st.requests)
+		}
+		if len(trend) > 0 {
+			day.Delta = day.Requests - prev
+			if prev > 0 {
+				day.DeltaPercent = float64(day.Delta) * 100 / float64(prev)
+			}
+		}
+		prev = day.Requests
+		trend = append(trend, day)
+	}
+	return trend
+}
@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// hllMaxError 为允许的相对误差: 标准误差约 0.8%, 取 3σ
+const hllMaxError = 0.025
+
+// 各基数下的估算误差不超过 hllMaxError, IP 与 URL 两类键分别检查
+func TestHyperLogLogError(t *testing.T) {
+	keys := map[string]func(i int) string{
+		"ip": func(i int) string {
+			return fmt.Sprintf("%d.%d.%d.%d", 10+i>>24, i>>16&0xff, i>>8&0xff, i&0xff)
+		},
+		"url": func(i int) string {
+			return fmt.Sprintf("/static/img/%d.png?v=%d", i/7, i%7)
+		},
+	}
+	for name, key := range keys {
+		for _, n := range []int{1e3, 1e5, 1e6} {
+			h := newHyperLogLog()
+			for i := 0; i < n; i++ {
+				h.Add(key(i))
+				// 重复的键不影响估算
+				if i%3 == 0 {
+					h.Add(key(i))
+				}
+			}
+			got := h.Count()
+			if e := math.Abs(float64(got-n)) / float64(n); e > hllMaxError {
+				t.Errorf("%s, n=%d: Count() = %d, 相对误差 %.2f%% 超过 %.1f%%", name, n, got, e*100, hllMaxError*100)
+			}
+		}
+	}
+}
+
+// 分段统计后合并的估算值与一次统计全部键相同
+func TestHyperLogLogMerge(t *testing.T) {
+	whole, a, b := newHyperLogLog(), newHyperLogLog(), newHyperLogLog()
+	for i := 0; i < 50000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		whole.Add(key)
+		if i%2 == 0 {
+			a.Add(key)
+		} else {
+			b.Add(key)
+		}
+		// 两段都出现的键只计一次
+		if i%10 == 0 {
+			b.Add(key)
+		}
+	}
+	a.Merge(b)
+	if a.Count() != whole.Count() {
+		t.Errorf("合并后 Count() = %d, 一次统计为 %d", a.Count(), whole.Count())
+	}
+}
+
+func TestHyperLogLogSmall(t *testing.T) {
+	h := newHyperLogLog()
+	if got := h.Count(); got != 0 {
+		t.Errorf("空计数器 Count() = %d, want 0", got)
+	}
+	for i := 0; i < 10; i++ {
+		h.Add(fmt.Sprint(i))
+	}
+	if got := h.Count(); got != 10 {
+		t.Errorf("Count() = %d, want 10", got)
+	}
+}
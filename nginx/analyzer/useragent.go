@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// 斜杠后含数字的版本号, 如 Chrome/124.0.6367.62、Mozilla/5.0、Build/UP1A.231005.007.
+	// 不跨过方括号与 #, 以保留 [FBAN/FBIOS;FBAV/460.0] 的 "]" 与 URL 中的锚点
+	uaSlashVersion = regexp.MustCompile(`/[^\s;()/\[\]#]*\d[^\s;()/\[\]#]*`)
+	// 独立的版本号, 如 Windows NT 10.0、Android 14、iPhone OS 17_4_1
+	uaBareVersion = regexp.MustCompile(`([\s(;])v?\d+(?:[._]\d+)*[a-z]?\b`)
+	// 冒号后的版本号 (rv:115.0) 与括号中的十六进制构建号 (MicroMessenger/8.0.47(0x18002f2c))
+	uaOtherVersion = regexp.MustCompile(`:\d+(?:\.\d+)*\b|\(0x[0-9a-fA-F]+\)`)
+	uaSpaces       = regexp.MustCompile(`\s+`)
+	uaPunctSpace   = regexp.MustCompile(`\s*([;)])\s*`)
+)
+
+// NormalizeUserAgent 去掉 UA 中的版本号并合并空白, 使仅版本不同的 UA 归为一项:
+// "Chrome/124.0.6367.62" 变为 "Chrome", "Windows NT 10.0" 变为 "Windows NT", "rv:115.0" 变为 "rv".
+// 以字母开头的设备型号 (如 SM-S918B) 保留不变, 独立的数字 (如 Pixel 7 中的 7) 同样视为版本号去掉
+func NormalizeUserAgent(ua string) string {
+	s := uaSlashVersion.ReplaceAllString(ua, "")
+	s = uaBareVersion.ReplaceAllString(s, "$1")
+	s = uaOtherVersion.ReplaceAllString(s, "")
+	s = uaSpaces.ReplaceAllString(s, " ")
+	s = uaPunctSpace.ReplaceAllString(s, "$1 ")
+	s = strings.ReplaceAll(s, "( ", "(")
+	s = strings.ReplaceAll(s, "; )", ")")
+	return strings.TrimSpace(s)
+}
+
+// 记录每个归一化后的 UA 合并了哪些原始 UA
+type uaVariants map[string]map[string]struct{}
+
+func (v uaVariants) Add(normalized, raw string) {
+	set, ok := v[normalized]
+	if !ok {
+		set = make(map[string]struct{})
+		v[normalized] = set
+	}
+	set[raw] = struct{}{}
+}
+
+func (v uaVariants) merge(o uaVariants) {
+	for normalized, set := range o {
+		for raw := range set {
+			v.Add(normalized, raw)
+		}
+	}
+}
+
+// fill 为 UA 排名的各项填入 Rank.Variants
+func (v uaVariants) fill(ranks []Rank) {
+	for i := range ranks {
+		if !ranks[i].Other {
+			ranks[i].Variants = len(v[ranks[i].Key])
+		}
+	}
+}
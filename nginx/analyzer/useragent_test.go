@@ -0,0 +1,130 @@
+package analyzer
+
+import "testing"
+
+// uaCorpus 为真实的 UA, 含桌面与移动浏览器、App 内置 WebView、搜索引擎爬虫与脚本工具.
+// bot 为 isBot 的结果, searchBot 为匹配的 SearchBots 名称
+var uaCorpus = []struct {
+	name       string
+	ua         string
+	normalized string
+	bot        bool
+	searchBot  string
+}{
+	{"Windows Chrome",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.62 Safari/537.36",
+		"Mozilla (Windows NT; Win64; x64) AppleWebKit (KHTML, like Gecko) Chrome Safari", false, ""},
+	{"Windows Firefox",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:115.0) Gecko/20100101 Firefox/115.0",
+		"Mozilla (Windows NT; Win64; x64; rv) Gecko Firefox", false, ""},
+	{"macOS Safari",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15",
+		"Mozilla (Macintosh; Intel Mac OS X) AppleWebKit (KHTML, like Gecko) Version Safari", false, ""},
+	{"Linux Edge",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+		"Mozilla (X11; Linux x86_64) AppleWebKit (KHTML, like Gecko) Chrome Safari Edg", false, ""},
+	{"iPhone Safari",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1",
+		"Mozilla (iPhone; CPU iPhone OS like Mac OS X) AppleWebKit (KHTML, like Gecko) Version Mobile Safari", false, ""},
+	{"iPad Chrome",
+		"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+		"Mozilla (iPad; CPU OS like Mac OS X) AppleWebKit (KHTML, like Gecko) CriOS Mobile Safari", false, ""},
+	{"Android Chrome",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36",
+		"Mozilla (Linux; Android; Pixel) AppleWebKit (KHTML, like Gecko) Chrome Mobile Safari", false, ""},
+	{"Android Chrome 精简 UA",
+		"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+		"Mozilla (Linux; Android; K) AppleWebKit (KHTML, like Gecko) Chrome Mobile Safari", false, ""},
+	{"三星浏览器",
+		"Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+		"Mozilla (Linux; Android; SM-S918B) AppleWebKit (KHTML, like Gecko) SamsungBrowser Chrome Mobile Safari", false, ""},
+	{"Android WebView",
+		"Mozilla/5.0 (Linux; Android 12; M2102J20SG Build/SKQ1.211006.001; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/123.0.6312.118 Mobile Safari/537.36",
+		"Mozilla (Linux; Android; M2102J20SG Build; wv) AppleWebKit (KHTML, like Gecko) Version Chrome Mobile Safari", false, ""},
+	{"微信 iOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 MicroMessenger/8.0.47(0x18002f2c) NetType/WIFI Language/zh_CN",
+		"Mozilla (iPhone; CPU iPhone OS like Mac OS X) AppleWebKit (KHTML, like Gecko) Mobile MicroMessenger NetType/WIFI Language/zh_CN", false, ""},
+	{"Facebook iOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_7_8 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/460.0.0.37.103;FBBV/588848340]",
+		"Mozilla (iPhone; CPU iPhone OS like Mac OS X) AppleWebKit (KHTML, like Gecko) Mobile [FBAN/FBIOS; FBAV; FBBV]", false, ""},
+	{"Instagram Android",
+		"Mozilla/5.0 (Linux; Android 14; SM-A546E Build/UP1A.231005.007; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/124.0.6367.82 Mobile Safari/537.36 Instagram 327.0.0.42.90 Android",
+		"Mozilla (Linux; Android; SM-A546E Build; wv) AppleWebKit (KHTML, like Gecko) Version Chrome Mobile Safari Instagram Android", false, ""},
+	{"Googlebot",
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla (compatible; Googlebot; +http://www.google.com/bot.html)", true, "Googlebot"},
+	{"Googlebot 手机版",
+		"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.60 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla (Linux; Android; Nexus 5X Build) AppleWebKit (KHTML, like Gecko) Chrome Mobile Safari (compatible; Googlebot; +http://www.google.com/bot.html)", true, "Googlebot"},
+	{"Bingbot",
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		"Mozilla (compatible; bingbot; +http://www.bing.com/bingbot.htm)", true, "Bingbot"},
+	{"Baiduspider",
+		"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)",
+		"Mozilla (compatible; Baiduspider; +http://www.baidu.com/search/spider.html)", true, "Baiduspider"},
+	{"YandexBot",
+		"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)",
+		"Mozilla (compatible; YandexBot; +http://yandex.com/bots)", true, "YandexBot"},
+	{"Applebot",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.1.1 Safari/605.1.15 (Applebot/0.1; +http://www.apple.com/go/applebot)",
+		"Mozilla (Macintosh; Intel Mac OS X) AppleWebKit (KHTML, like Gecko) Version Safari (Applebot; +http://www.apple.com/go/applebot)", true, "Applebot"},
+	{"搜狗",
+		"Sogou web spider/4.0(+http://www.sogou.com/docs/help/webmasters.htm#07)",
+		"Sogou web spider(+http://www.sogou.com/docs/help/webmasters.htm#07)", true, "Sogou"},
+	{"无头 Chrome",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/124.0.6367.60 Safari/537.36",
+		"Mozilla (X11; Linux x86_64) AppleWebKit (KHTML, like Gecko) HeadlessChrome Safari", true, ""},
+	{"curl", "curl/8.5.0", "curl", true, ""},
+	{"python-requests", "python-requests/2.31.0", "python-requests", true, ""},
+	{"Go", "Go-http-client/1.1", "Go-http-client", true, ""},
+	{"空", "", "", false, ""},
+	{"-", "-", "-", false, ""},
+}
+
+func TestUserAgentCorpus(t *testing.T) {
+	for _, tt := range uaCorpus {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeUserAgent(tt.ua); got != tt.normalized {
+				t.Errorf("NormalizeUserAgent(%q)\n = %q\nwant %q", tt.ua, got, tt.normalized)
+			}
+			if got := isBot(tt.ua); got != tt.bot {
+				t.Errorf("isBot(%q) = %v, want %v", tt.ua, got, tt.bot)
+			}
+			var searchBot string
+			for _, bot := range SearchBots {
+				if bot.UserAgent.MatchString(tt.ua) {
+					searchBot = bot.Name
+					break
+				}
+			}
+			if searchBot != tt.searchBot {
+				t.Errorf("%q 匹配的爬虫为 %q, want %q", tt.ua, searchBot, tt.searchBot)
+			}
+		})
+	}
+}
+
+// 仅版本不同的 UA 归为一项, 设备型号不同的仍分开
+func TestNormalizeUserAgentFolds(t *testing.T) {
+	same := [][2]string{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.62 Safari/537.36",
+			"Mozilla/5.0 (Windows NT 6.1; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 MicroMessenger/8.0.47(0x18002f2c) NetType/WIFI Language/zh_CN",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 MicroMessenger/8.0.44(0x1800302d) NetType/WIFI Language/zh_CN"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:115.0) Gecko/20100101 Firefox/115.0",
+			"Mozilla/5.0 (Windows NT 10.0; Win64;   x64; rv:125.0) Gecko/20100101 Firefox/125.0"},
+	}
+	for _, pair := range same {
+		if a, b := NormalizeUserAgent(pair[0]), NormalizeUserAgent(pair[1]); a != b {
+			t.Errorf("%q 与 %q 应归为一项:\n%q\n%q", pair[0], pair[1], a, b)
+		}
+	}
+
+	a := NormalizeUserAgent("Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Mobile Safari/537.36")
+	b := NormalizeUserAgent("Mozilla/5.0 (Linux; Android 13; SM-A546E) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Mobile Safari/537.36")
+	if a == b {
+		t.Errorf("不同的设备型号被归为一项: %q", a)
+	}
+}
@@ -0,0 +1,137 @@
+package analyzer
+
+import "strconv"
+
+// WriteMethods 为写流量统计的 HTTP 方法, 即会修改服务端状态的请求
+var WriteMethods = []string{"POST", "PUT", "PATCH", "DELETE"}
+
+// WriteReport 为写请求的统计. 读流量通常远多于写流量, 单独统计写请求便于定位数据库压力来源
+type WriteReport struct {
+	// Requests 为写请求总数
+	Requests int `json:"requests"`
+	// HasRequestLength 为 false 时日志格式中没有 $request_length, 上行字节数均为 0
+	HasRequestLength bool `json:"has_request_length"`
+	// HasLatency 为 false 时日志格式中没有 $request_time, 不统计耗时
+	HasLatency bool `json:"has_latency"`
+	// Endpoints 为请求数前十的 "方法 路径" (不含查询参数)
+	Endpoints []WriteEndpoint `json:"endpoints"`
+	// TopIPs 为写请求最多的客户端, Bytes 为上行字节数 ($request_length)
+	TopIPs []Rank `json:"top_ips"`
+}
+
+// WriteEndpoint 为一个写接口的统计. Errors 为状态码不小于 400 的请求数
+type WriteEndpoint struct {
+	Method       string        `json:"method"`
+	URL          string        `json:"url"`
+	Count        int           `json:"count"`
+	RequestBytes int64         `json:"request_bytes"`
+	Errors       int           `json:"errors"`
+	ErrorRate    float64       `json:"error_rate"`
+	Latency      *LatencyStats `json:"latency,omitempty"`
+}
+
+type writeStats struct {
+	method, url string
+	errors      int
+	latency     durationRecorder
+}
+
+type writeTracker struct {
+	sketch           bool
+	hasRequestLength bool
+	hasLatency       bool
+	requests         int
+	endpoints        *keyCounter
+	stats            map[string]*writeStats
+	ips              *keyCounter
+}
+
+func newWriteTracker(format string, sketch bool) *writeTracker {
+	w := &writeTracker{
+		sketch:    sketch,
+		endpoints: newKeyCounter(),
+		stats:     make(map[string]*writeStats),
+		ips:       newKeyCounter(),
+	}
+	for _, f := range FormatFields(format) {
+		switch f {
+		case "request_length":
+			w.hasRequestLength = true
+		case "request_time":
+			w.hasLatency = true
+		}
+	}
+	return w
+}
+
+func (w *writeTracker) Add(e logEntry) {
+	if !containsString(WriteMethods, e.Method) {
+		return
+	}
+	w.requests++
+	path := requestPath(e.URL)
+	key := e.Method + " " + path
+	w.endpoints.Add(key, e.RequestLength)
+	w.ips.Add(e.IP, e.RequestLength)
+
+	st, ok := w.stats[key]
+	if !ok {
+		st = &writeStats{method: e.Method, url: path}
+		if w.hasLatency {
+			st.latency = newDurationRecorder(w.sketch)
+		}
+		w.stats[key] = st
+	}
+	if code, err := strconv.Atoi(e.Status); err == nil && code >= 400 {
+		st.errors++
+	}
+	if st.latency != nil {
+		if seconds, err := strconv.ParseFloat(e.RequestTime, 64); err == nil && seconds >= 0 {
+			st.latency.Add(seconds)
+		}
+	}
+}
+
+func (w *writeTracker) merge(o *writeTracker) {
+	w.requests += o.requests
+	w.endpoints.merge(o.endpoints)
+	w.ips.merge(o.ips)
+	for key, st := range o.stats {
+		mine, ok := w.stats[key]
+		if !ok {
+			w.stats[key] = st
+			continue
+		}
+		mine.errors += st.errors
+		if mine.latency != nil {
+			mine.latency.Merge(st.latency)
+		}
+	}
+}
+
+func (w *writeTracker) Report() *WriteReport {
+	rep := &WriteReport{
+		Requests:         w.requests,
+		HasRequestLength: w.hasRequestLength,
+		HasLatency:       w.hasLatency,
+		Endpoints:        []WriteEndpoint{},
+		TopIPs:           w.ips.Ranks(0, SortByCount),
+	}
+	for _, r := range w.endpoints.Ranks(0, SortByCount) {
+		st, count := w.stats[r.Key], int(r.Count)
+		ep := WriteEndpoint{
+			Method:       st.method,
+			URL:          st.url,
+			Count:        count,
+			RequestBytes: r.Bytes,
+			Errors:       st.errors,
+			ErrorRate:    float64(st.errors) / float64(count),
+		}
+		if st.latency != nil && st.latency.Count() > 0 {
+			stats := latencyStats(st.latency)
+			ep.Latency = &stats
+		}
+		rep.Endpoints = append(rep.Endpoints, ep)
+	}
+	return rep
+}
@@ -0,0 +1,12 @@
+// nginx 访问日志分析, 见 nginxlog 包
+package main
+
+import (
+	"os"
+
+	"github.com/ushell/tools/nginx/nginxlog"
+)
+
+func main() {
+	os.Exit(nginxlog.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,192 @@
+package nginxlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ushell/tools/internal/tui"
+	"github.com/ushell/tools/nginx/analyzer"
+)
+
+// 摘要每行的最大显示宽度, 适合直接作为邮件正文
+const digestWidth = 78
+
+// 摘要中各排名列出的条数
+const digestTop = 5
+
+// 读取上一期的报告. 状态文件不存在时返回 nil, 摘要只列出本期数值
+func loadDigestState(path string) (*analyzer.Report, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return analyzer.LoadReport(path)
+}
+
+// 把本期报告以 JSON 保存为下一期的状态文件, 格式与 --output json 相同, 也可用作 --baseline
+func saveDigestState(path string, rep *analyzer.Report) error {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// wrapLine 按显示宽度把 s 折成不超过 width 列的多行, 续行以 indent 开头.
+// 优先在空格处断开, 没有空格的长串 (如 URL) 直接断开
+func wrapLine(s string, width int, indent string) []string {
+	var lines []string
+	line := []rune{}
+	w, start, lastSpace := 0, 0, -1
+	for _, r := range s {
+		rw := tui.Width(string(r))
+		if w+rw > width && len(line) > start {
+			if lastSpace > start {
+				lines = append(lines, strings.TrimRight(string(line[:lastSpace]), " "))
+				line = append([]rune(indent), line[lastSpace+1:]...)
+			} else {
+				lines = append(lines, string(line))
+				line = []rune(indent)
+			}
+			start, lastSpace = len([]rune(indent)), -1
+			w = tui.Width(string(line))
+		}
+		if r == ' ' {
+			lastSpace = len(line)
+		}
+		line = append(line, r)
+		w += rw
+	}
+	return append(lines, string(line))
+}
+
+func digestf(format string, args ...interface{}) {
+	for _, line := range wrapLine(fmt.Sprintf(format, args...), digestWidth, "      ") {
+		fmt.Fprintln(out, line)
+	}
+}
+
+// 与上一期相比的变化, 如 "(上周 1000, +12.5%)"
+func digestChange(current, previous float64, previousText string) string {
+	if previous == 0 {
+		return fmt.Sprintf("(上周 %s)", previousText)
+	}
+	return fmt.Sprintf("(上周 %s, %+.1f%%)", previousText, (current-previous)*100/previous)
+}
+
+func errorRate(rep *analyzer.Report) float64 {
+	if rep.Requests == 0 {
+		return 0
+	}
+	return float64(rep.Errors) * 100 / float64(rep.Requests)
+}
+
+// printDigest 输出适合邮件发送的纯文本周报: 不使用颜色、表情与制表符号, 每行不超过 78 列.
+// prev 为上一期的报告, 为 nil 时只列出本期的数值
+func printDigest(rep, prev *analyzer.Report) {
+	s := rep.Summary
+	digestf("Nginx 访问日志周报")
+	if s.Start != nil {
+		digestf("统计区间: %s 至 %s (%d 天)", s.Start.Format("2006-01-02 15:04"), s.End.Format("2006-01-02 15:04"), len(rep.Trend))
+	}
+
+	digestf("")
+	digestf("== 概况 ==")
+	if prev == nil {
+		digestf("没有上周的状态文件, 以下只列出本周数值")
+	}
+	requests := fmt.Sprintf("请求数: %d", s.Requests)
+	bandwidth := "流量: " + formatBytes(s.Bytes)
+	errors := fmt.Sprintf("错误率 (状态码 >= 400): %.1f%%", errorRate(rep))
+	if prev != nil {
+		requests += " " + digestChange(float64(s.Requests), float64(prev.Requests), fmt.Sprint(prev.Requests))
+		if prev.Summary != nil {
+			bandwidth += " " + digestChange(float64(s.Bytes), float64(prev.Summary.Bytes), formatBytes(prev.Summary.Bytes))
+		}
+		errors += fmt.Sprintf(" (上周 %.1f%%, %+.1f 个百分点)", errorRate(prev), errorRate(rep)-errorRate(prev))
+	}
+	digestf("%s", requests)
+	digestf("%s", bandwidth)
+	digestf("%s", errors)
+
+	digestRanks("请求最多的 URL", rep.TopURLs)
+	digestRanks("请求最多的 IP", rep.TopIPs)
+
+	digestf("")
+	digestf("== 错误与突增 ==")
+	// 错误率超过全周两倍的日子, 全周错误率很低时至少按 1% 算, 避免零星错误被当作异常
+	threshold := errorRate(rep) * 2
+	if threshold < 1 {
+		threshold = 1
+	}
+	var noisy []analyzer.TrendDay
+	for _, d := range rep.Trend {
+		if d.ErrorRate*100 >= threshold {
+			noisy = append(noisy, d)
+		}
+	}
+	if len(noisy) == 0 {
+		digestf("没有错误率超过 %.1f%% 的日子", threshold)
+	} else {
+		digestf("错误率超过 %.1f%% 的日子:", threshold)
+		for _, d := range noisy {
+			digestf("  %s  %.1f%% (%d/%d)", d.Day, d.ErrorRate*100, d.Errors, d.Requests)
+		}
+	}
+	if rep.Spikes != nil {
+		spikes := append([]analyzer.Spike(nil), rep.Spikes.Spikes...)
+		// 只列出偏离最大的几次
+		sort.SliceStable(spikes, func(i, j int) bool {
+			return (float64(spikes[i].Count)-spikes[i].Mean)/spikes[i].StdDev > (float64(spikes[j].Count)-spikes[j].Mean)/spikes[j].StdDev
+		})
+		if len(spikes) > digestTop {
+			spikes = spikes[:digestTop]
+		}
+		if len(spikes) == 0 {
+			digestf("未发现每分钟请求数突增")
+		} else {
+			digestf("每分钟请求数突增 (超过前 %d 分钟平均 %.1f 个标准差):", rep.Spikes.Window, rep.Spikes.Sigma)
+			for _, sp := range spikes {
+				digestf("  %s  %d 次 (平均 %.1f)", sp.Minute.Format("2006-01-02 15:04"), sp.Count, sp.Mean)
+			}
+		}
+	}
+
+	digestf("")
+	digestf("== 带宽 ==")
+	var busiest *analyzer.TrendDay
+	days := 0
+	for i, d := range rep.Trend {
+		if d.Requests > 0 {
+			days++
+		}
+		if busiest == nil || d.Bytes > busiest.Bytes {
+			busiest = &rep.Trend[i]
+		}
+	}
+	digestf("总流量 %s", formatBytes(s.Bytes))
+	if len(rep.Trend) > 0 {
+		digestf("日均 %s, 最高 %s (%s)", formatBytes(s.Bytes/int64(len(rep.Trend))), formatBytes(busiest.Bytes), busiest.Day)
+	}
+	if days < len(rep.Trend) {
+		digestf("其中 %d 天没有日志", len(rep.Trend)-days)
+	}
+}
+
+func digestRanks(title string, ranks []analyzer.Rank) {
+	digestf("")
+	digestf("== %s ==", title)
+	n := 0
+	for _, rank := range ranks {
+		if rank.Other || n == digestTop {
+			continue
+		}
+		n++
+		digestf("%d. %d 次  %s", n, int(rank.Count), rank.Key)
+	}
+	if n == 0 {
+		digestf("无")
+	}
+}
@@ -0,0 +1,184 @@
+package nginxlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/nginx/analyzer"
+)
+
+// tailedLine 为 tailLines 读到的一行. oversized 的行超过长度上限, 只计数不保存内容
+type tailedLine struct {
+	text      string
+	oversized bool
+}
+
+// 持续读取日志文件, 类似 tail -F: 读到末尾后等待新内容,
+// 文件被截断时从头读取, 被轮转 (换成新文件) 时重新打开.
+// 与 analyzer.LineReader 一样, 超过 maxSize 的行不保存内容, maxSize 不大于 0 时使用 DefaultMaxLineSize
+func tailLines(path string, maxSize int, lines chan<- tailedLine, stop <-chan struct{}) error {
+	if maxSize <= 0 {
+		maxSize = analyzer.DefaultMaxLineSize
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	// partial 为尚未读到行尾的内容, 写入方可能只写了半行
+	var partial []byte
+	oversized := false
+	var offset int64
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		offset += int64(len(chunk))
+		if !oversized {
+			if len(partial)+len(chunk) > maxSize+2 {
+				oversized = true
+				partial = partial[:0]
+			} else {
+				partial = append(partial, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == nil {
+			text := strings.TrimRight(string(partial), "\r\n")
+			if oversized || len(text) > maxSize {
+				lines <- tailedLine{oversized: true}
+			} else {
+				lines <- tailedLine{text: text}
+			}
+			partial, oversized = partial[:0], false
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		current, statErr := os.Stat(path)
+		opened, _ := file.Stat()
+		switch {
+		case statErr == nil && opened != nil && !os.SameFile(current, opened):
+			// 已轮转, 旧文件读完后切换到新文件
+			newFile, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			file.Close()
+			file, offset = newFile, 0
+			reader.Reset(file)
+			partial, oversized = partial[:0], false
+		case opened != nil && opened.Size() < offset:
+			// 被截断 (如 copytruncate)
+			if _, err := file.Seek(0, io.SeekStart); err == nil {
+				offset = 0
+				reader.Reset(file)
+				partial, oversized = partial[:0], false
+			}
+		}
+	}
+}
+
+// 实时模式: 每隔 interval 输出一次当前结果. 默认清屏重绘;
+// noClear 时改为追加带时间戳的精简快照, 便于重定向到文件留档
+func follow(path string, opts analyzer.Options, interval time.Duration, noClear bool, format string) error {
+	stream := analyzer.NewStream(opts)
+	lines := make(chan tailedLine, 1024)
+	stop := make(chan struct{})
+	tailErr := make(chan error, 1)
+	go func() {
+		tailErr <- tailLines(path, opts.MaxLineSize, lines, stop)
+		close(lines)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	render := func() {
+		rep := stream.Snapshot()
+		switch {
+		case format == cli.OutputJSON:
+			// 每个快照一行 JSON
+			if err := json.NewEncoder(stdout).Encode(rep); err != nil {
+				fmt.Fprintln(stderr, "输出 JSON 时出错:", err)
+			}
+		case noClear:
+			printSnapshotBlock(rep, time.Now())
+		default:
+			fmt.Fprint(stdout, "\033[H\033[2J")
+			printReport(rep, format == "markdown")
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				stream.Close()
+				return <-tailErr
+			}
+			if line.oversized {
+				stream.AddOversizedLine()
+				continue
+			}
+			if err := stream.AddLine(line.text); err != nil {
+				fmt.Fprintln(stderr, "解析错误:", err)
+			}
+		case <-ticker.C:
+			render()
+		case <-signals:
+			close(stop)
+			render()
+			stream.Close()
+			return nil
+		}
+	}
+}
+
+// 精简快照: 每个排名只列前 3 项并压缩为一行, 首尾有明确的分隔行
+func printSnapshotBlock(rep *analyzer.Report, now time.Time) {
+	fmt.Fprintf(out, "===== %s 共 %d 行 =====\n", now.Format("2006-01-02 15:04:05"), rep.Lines)
+	for _, section := range rankingSections(rep) {
+		var items []string
+		for i, row := range section.Rows {
+			if i == 3 {
+				break
+			}
+			items = append(items, fmt.Sprintf("%s (%s)", row.Key, section.formatCount(row.Count)))
+		}
+		fmt.Fprintf(out, "[%s] %s\n", section.Title, strings.Join(items, ", "))
+	}
+	if excluded := excludedSummary(rep); excluded != "" {
+		fmt.Fprintf(out, "[🙈 已排除的请求] %s\n", excluded)
+	}
+	if rep.MalformedCount > 0 {
+		fmt.Fprintf(out, "[⚠ 无法解析的请求] %d\n", rep.MalformedCount)
+	}
+	if rep.BadTimestamps > 0 {
+		fmt.Fprintf(out, "[⚠ 无法解析的时间] %d\n", rep.BadTimestamps)
+	}
+	if rep.OversizedLines > 0 {
+		fmt.Fprintf(out, "[⚠ 超长的行] %d\n", rep.OversizedLines)
+	}
+	fmt.Fprintln(out, "===== end =====")
+}
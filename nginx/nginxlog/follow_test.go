@@ -0,0 +1,59 @@
+package nginxlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 超长的行只计数, 跨越多次读取的半行在写完后作为一行返回
+func TestTailLinesMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	long := strings.Repeat("x", 200*1024)
+	if err := os.WriteFile(path, []byte("a\n"+long+"\nb\r\nc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan tailedLine, 16)
+	stop := make(chan struct{})
+	tailErr := make(chan error, 1)
+	go func() { tailErr <- tailLines(path, 1000, lines, stop) }()
+	defer func() {
+		close(stop)
+		if err := <-tailErr; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	next := func() tailedLine {
+		t.Helper()
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待新行超时")
+			return tailedLine{}
+		}
+	}
+	for _, want := range []tailedLine{{text: "a"}, {oversized: true}, {text: "b"}} {
+		if got := next(); got != want {
+			t.Errorf("读到 %+v, 应为 %+v", got, want)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString("d\n" + long + "\ne\n"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	for _, want := range []tailedLine{{text: "cd"}, {oversized: true}, {text: "e"}} {
+		if got := next(); got != want {
+			t.Errorf("追加后读到 %+v, 应为 %+v", got, want)
+		}
+	}
+}
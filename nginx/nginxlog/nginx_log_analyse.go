@@ -0,0 +1,1936 @@
+package nginxlog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ushell/tools/internal/cli"
+	"github.com/ushell/tools/internal/tui"
+	"github.com/ushell/tools/nginx/analyzer"
+	"gopkg.in/yaml.v3"
+)
+
+// 命令行参数, Run 每次解析前恢复为默认值. 参数错误时 flag 默认以 2 退出,
+// 与 cli.ExitThreshold 冲突, 因此用 ContinueOnError 自行处理
+var flags = flag.NewFlagSet("nginx-log", flag.ContinueOnError)
+
+var (
+	logFormat   = flags.String("log-format", analyzer.DefaultLogFormat, "nginx log_format 定义")
+	timeFormat  = flags.String("time-format", "", "$time_local/$time_iso8601 的时间格式, Go 布局 (2006-01-02 15:04:05) 或 strftime (%Y-%m-%d %H:%M:%S); 默认在 nginx 的两种格式之间自动识别")
+	showVersion = flags.Bool("version", false, "输出版本号")
+	force       = flags.Bool("force", false, "前 100 行大多无法按日志格式解析时仍继续分析 (用于脏数据较多的日志)")
+
+	excludeMethods = flags.String("exclude-methods", "OPTIONS", "不参与排名的 HTTP 方法 (逗号分隔), 单独汇总请求数, 设为空字符串则不排除")
+	excludeUA      = flags.String("exclude-ua", "", "不参与统计的 UA 正则 (逗号分隔, 须匹配整个 UA), 如 'kube-probe/.*,ELB-HealthChecker/.*'")
+	groupRules     = flags.String("group-rules", "", "URL 分组规则文件 (YAML 列表, 每项为 pattern: 正则, name: 分组名), 匹配的路径以分组名统计")
+	excludeHealth  = flags.Bool("exclude-healthchecks", false, "排除常见健康检查的 UA (kube-probe、ELB、GoogleHC 等) 与路径 (/healthz、/health、/ping 等)")
+	verifyBotsMode = flags.Bool("verify-bots", false, "列出 UA 自称 Googlebot/Bingbot 等搜索引擎爬虫的 IP, 并用反向 DNS 验证真假")
+	botMaxIPs      = flags.Int("verify-bots-max", 100, "最多验证的爬虫 IP 数 (按请求数从多到少), 其余标为 unverified")
+	botTimeout     = flags.Duration("verify-bots-timeout", 3*time.Second, "每个爬虫 IP 的 DNS 查询时限")
+	noDNS          = flags.Bool("no-dns", false, "不做 DNS 查询 (离线环境), --verify-bots 只列出自称爬虫的 IP, 均标为 unverified")
+	regularityMode = flags.Bool("regularity", false, "分析请求最多的 IP 的请求间隔, 标出间隔过于规律 (疑似定时抓取) 的客户端")
+	regularityTop  = flags.Int("regularity-top", 20, "请求间隔分析的 IP 数 (按请求数从多到少)")
+	regularityMin  = flags.Int("regularity-min-requests", 50, "请求数少于该值的 IP 不标记为规律访问")
+	regularityCV   = flags.Float64("regularity-max-cv", 0.25, "请求间隔的变异系数 (标准差/平均值) 不超过该值时标记为规律访问")
+	normalizeUA    = flags.Bool("normalize-ua", false, "UA 排名去掉版本号 (Chrome/124.0.6367.62 → Chrome) 后统计, 并标出每项合并了几种原始 UA")
+
+	excludeIPs      = flags.String("exclude-ip", "", "不参与任何统计的客户端地址 (CIDR 或 IP, 逗号分隔), 按解析 X-Forwarded-For 之后的客户端 IP 匹配")
+	excludeInternal = flags.Bool("exclude-internal", false, "排除内网与本机地址 (10/8、172.16/12、192.168/16、回环、链路本地、100.64/10 及 IPv6 对应网段), 可与 --exclude-ip 同时使用")
+	includeIPs      = flags.String("include-ip", "", "即使落在 --exclude-ip 或 --exclude-internal 中也保留的地址 (CIDR 或 IP, 逗号分隔)")
+	trustedProxies  = flags.String("trusted-proxies", "", "可信代理地址列表 (CIDR 或 IP, 逗号分隔), 从右向左跳过可信代理取客户端 IP")
+	noXFF           = flags.Bool("no-xff", false, "忽略 X-Forwarded-For, 始终使用 $remote_addr")
+
+	decayMode = flags.Bool("decay", false, "按指数衰减计数, 排名偏向近期流量")
+	halfLife  = flags.Duration("half-life", time.Hour, "衰减半衰期, 每经过一个半衰期访问的权重减半 (配合 --decay)")
+
+	sessionMode     = flags.Bool("sessions", false, "输出访问(visit)分析")
+	sessionGap      = flags.Duration("session-gap", 30*time.Minute, "同一客户端相邻请求间隔超过该值即视为新的访问")
+	sessionSkipBots = flags.Bool("session-exclude-bots", false, "访问分析中排除爬虫/脚本流量")
+
+	outputFormat = flags.String("output", cli.OutputTable, "输出格式: table (默认, 也可写作 text), markdown, json 或 csv (只含各排名)")
+	outFile      = flags.String("out", "", "把报告写入文件 (与 --output 的格式一致), 终端只显示摘要")
+	alsoStdout   = flags.Bool("also-stdout", false, "配合 --out, 同时把完整报告输出到终端")
+	splitBy      = flags.String("split-by", "", "按日志字段 (如 host) 的值分组, 每组的报告写入 --output-dir 下的单独文件")
+	outputDir    = flags.String("output-dir", "", "配合 --split-by, 各分组报告的目录 (不存在时创建)")
+	maxGroups    = flags.Int("max-groups", 100, "配合 --split-by, 分组数上限, 之后新出现的值归入 (other) 组")
+	statsMode    = flags.Bool("stats", false, "把运行统计 (耗时、每秒行数与 MB 数、内存峰值等) 写到标准错误, 而不是报告末尾")
+	quiet        = flags.Bool("quiet", false, "安静模式 (可简写为 -q): 标准输出只有 JSON/Markdown 报告, 不输出摘要等提示, 警告与错误写入标准错误")
+
+	baseline = flags.String("baseline", "", "以前一次 --output json 的结果为基线, 标出 IP/URL 排名中新出现的项")
+	minCount = flags.Int("min-count", 0, "各计数排名去掉请求数低于该值的项, 并汇总为 (other) 行")
+	sortBy   = flags.String("sort", analyzer.SortByCount, "排名的排序方式: count (请求数), name (取前十后按名称排列) 或 bytes (响应字节数之和)")
+
+	parallel = flags.Int("parallel", 1, "把文件按行边界切分为 N 段并行统计 (不支持 --sessions 与 --redirects)")
+
+	followMode     = flags.Bool("follow", false, "持续读取日志 (类似 tail -F), 定期刷新结果, Ctrl-C 退出")
+	followInterval = flags.Duration("interval", 5*time.Second, "实时模式的刷新间隔")
+	noClear        = flags.Bool("no-clear", false, "实时模式下不清屏, 每次追加带时间戳的精简快照, 便于记录到文件")
+
+	crossMethod = flags.Bool("cross-method-url", false, "输出 URL × HTTP 方法交叉统计表")
+
+	notFoundMode = flags.Bool("not-found", false, "输出 404 URL 及其来源页面 (站内/站外/直接访问)")
+
+	redirectMode = flags.Bool("redirects", false, "输出重定向 (301/302/303/307/308) 分析与跳转链推测")
+
+	spikeMode   = flags.Bool("spikes", false, "检测每分钟请求数的突增")
+	spikeWindow = flags.Int("spike-window", 15, "突增检测的移动平均窗口 (分钟)")
+	spikeSigma  = flags.Float64("spike-sigma", 3, "超过移动平均多少个标准差视为突增")
+
+	digestMode  = flags.String("digest", "", "输出适合邮件发送的纯文本摘要, 目前只支持 weekly (周报), 日志应为一周的日志")
+	digestState = flags.String("digest-state", "", "周报的状态文件: 存在时与其中的上周数据对比, 输出后保存本周数据供下周使用")
+
+	sampleRate = flags.Float64("sample", 0, "抽样统计: 只统计约该比例的行 (如 0.05, 按行内容哈希抽取, 结果固定), 计数按比例放大为估算值; 0 为统计全部")
+
+	trendMode = flags.Bool("trend", false, "输出每日趋势: 每天的请求数、流量、错误率、较前一天的变化及趋势图")
+
+	sizeMode = flags.Bool("sizes", false, "输出响应大小 ($body_bytes_sent) 分布")
+
+	uniqueMode = flags.Bool("uniques", false, "输出独立 IP/URL 数, 以及每天、每小时的独立 IP 数")
+	lowMemory  = flags.Bool("low-memory", false, "独立计数改用 HyperLogLog 估算 (误差约 1%, 每个计数 16KB), 适合超大日志")
+
+	geoipFile      = flags.String("geoip", "", "MaxMind DB 格式的 IP 地理位置库 (.mmdb, 如 GeoLite2-Country.mmdb)")
+	onlyCountry    = flags.String("only-country", "", "只统计来自这些国家/地区的请求 (ISO 代码, 逗号分隔, 如 DE,FR), 作用于全部板块, 需要 --geoip")
+	excludeCountry = flags.String("exclude-country", "", "不统计来自这些国家/地区的请求 (ISO 代码, 逗号分隔, 如 CN,RU), 需要 --geoip")
+	unknownCountry = flags.String("unknown-country", "", "使用国家过滤时, 库中查不到国家的地址 (如内网地址) 的处理方式: keep 或 drop, 必须指定")
+	countryMode    = flags.Bool("countries", false, "输出按国家/地区的请求数排名 (需要 --geoip, 每个 IP 只查一次库)")
+
+	writeMode = flags.Bool("writes", false, "输出写请求 (POST/PUT/PATCH/DELETE) 的接口与客户端排名 (日志格式包含 $request_length/$request_time 时统计上行字节与耗时)")
+
+	latencyMode     = flags.Bool("latency", false, "输出整体及各 URL 的响应时间 p50/p95/p99 (日志格式需包含 $request_time)")
+	latencySketch   = flags.Bool("latency-sketch", false, "用对数分桶估算分位数 (约 1% 误差), 内存不随请求数增长")
+	latencyTop      = flags.Int("latency-top", 10, "响应时间按请求数列出的 URL 数量")
+	latencyMinCount = flags.Int("latency-min-count", 5, "请求数少于该值的 URL 不列出响应时间")
+
+	refererMode = flags.Bool("referers", false, "输出引用来源垃圾(referer spam)与盗链分析")
+	ownHost     = flags.String("own-host", "", "本站域名, 用于识别盗链与伪造的站内来源 (包含子域名)")
+	refDomains  = flags.Bool("referer-domains", false, "按可注册域名 (eTLD+1) 汇总来源排名, 如 www.google.com 与 google.com 合并, 并列出各域名下最多的完整来源")
+	spamList    = flags.String("spam-list", "", "额外的垃圾来源域名列表文件, 每行一个")
+
+	countBy     stringList
+	sumBy       stringList
+	alerts      stringList
+	paramValues stringList
+
+	outlierFile  = flags.String("outliers", "", "把响应过大或耗时过长的请求逐条写入该 CSV 文件, 阈值见 --outlier-bytes 与 --outlier-time")
+	outlierBytes = flags.String("outlier-bytes", "", "配合 --outliers, 响应字节数超过该值的请求, 如 10MB、512KB")
+	outlierTime  = flags.Duration("outlier-time", 0, "配合 --outliers, $request_time 超过该值的请求, 如 5s、800ms")
+
+	maxLineSize = flags.String("max-line-size", "4MB", "单行日志的长度上限, 超过的行跳过并在报告中计数, 如 16MB")
+
+	paramsMode = flags.Bool("params", false, "输出查询参数统计: 最常见的参数名, 以及请求最多的几个路径各自的常见参数")
+	stripQuery = flags.Bool("strip-query", false, "各项统计去掉 URL 中的查询参数, 只按路径统计 (--params 仍基于原始查询参数)")
+
+	pushURL      = flags.String("push-url", "", "分析完成后把报告 POST 到该地址 (如 webhook), 临时失败会重试")
+	pushFormat   = flags.String("push-format", "json", "推送格式: json (完整报告) 或 slack (概览与告警, Slack incoming webhook 格式)")
+	pushRequired = flags.Bool("push-required", false, "推送失败时以退出码 1 结束, 默认只输出警告")
+	pushHeaders  stringList
+
+	// 标准输出与标准错误, 由 Run 设置
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+
+	// 报告的输出位置, 默认为标准输出, 指定 --out 时先写入缓冲区
+	out io.Writer = os.Stdout
+
+	refererKindLabels = map[string]string{
+		analyzer.RefererDirect:   "直接",
+		analyzer.RefererInternal: "站内",
+		analyzer.RefererExternal: "站外",
+	}
+)
+
+func printSessions(s *analyzer.SessionReport) {
+	fmt.Fprintln(out, "\n[👣 访问分析]")
+	definition := fmt.Sprintf("访问定义: 同一 IP+UA, 相邻请求间隔不超过 %s 视为一次访问", seconds(s.GapSeconds))
+	if s.ExcludeBots {
+		definition += " (已排除爬虫)"
+	}
+	fmt.Fprintln(out, definition)
+	if s.Visits == 0 {
+		fmt.Fprintln(out, "无访问记录")
+		return
+	}
+
+	fmt.Fprintf(out, "访问次数: %d\n", s.Visits)
+	fmt.Fprintf(out, "平均每次请求数: %.2f\n", float64(s.Requests)/float64(s.Visits))
+	fmt.Fprintf(out, "平均访问时长: %s\n", seconds(s.AvgDurationSeconds).Round(time.Second))
+
+	fmt.Fprintln(out, "入口页面:")
+	for _, r := range s.EntryPages {
+		fmt.Fprintf(out, "  %s: %.0f\n", r.Key, r.Count)
+	}
+	fmt.Fprintln(out, "退出页面:")
+	for _, r := range s.ExitPages {
+		fmt.Fprintf(out, "  %s: %.0f\n", r.Key, r.Count)
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func printReferers(r *analyzer.RefererReport) {
+	fmt.Fprintln(out, "\n[🚫 垃圾来源]")
+	if len(r.Spam) == 0 && len(r.FakeInternal) == 0 {
+		fmt.Fprintln(out, "未发现")
+	}
+	for _, st := range r.Spam {
+		fmt.Fprintf(out, "%s: %d 次, %d 字节\n", st.Key, st.Requests, st.Bytes)
+	}
+	for _, st := range r.FakeInternal {
+		fmt.Fprintf(out, "%s%s (本站无此页面): %d 次, %d 字节\n", r.OwnHost, st.Key, st.Requests, st.Bytes)
+	}
+	if len(r.Spam) > 0 {
+		fmt.Fprintln(out, "\n建议的 nginx 垃圾来源屏蔽配置 (配合 if ($bad_referer) { return 403; }):")
+		fmt.Fprintln(out, "map $http_referer $bad_referer {")
+		fmt.Fprintln(out, "    default 0;")
+		for _, st := range r.Spam {
+			fmt.Fprintf(out, "    \"~*%s\" 1;\n", regexp.QuoteMeta(st.Key))
+		}
+		fmt.Fprintln(out, "}")
+	}
+
+	if r.OwnHost == "" {
+		fmt.Fprintln(out, "\n未指定 --own-host, 跳过盗链检测")
+		return
+	}
+
+	fmt.Fprintln(out, "\n[🔗 盗链]")
+	if len(r.Hotlinks) == 0 {
+		fmt.Fprintln(out, "未发现")
+	}
+	for _, st := range r.Hotlinks {
+		fmt.Fprintf(out, "%s: %d 次, %d 字节\n", st.Key, st.Requests, st.Bytes)
+	}
+
+	own := strings.TrimPrefix(strings.ToLower(r.OwnHost), "www.")
+	exts := make([]string, len(analyzer.MediaExtensions))
+	for i, ext := range analyzer.MediaExtensions {
+		exts[i] = strings.TrimPrefix(ext, ".")
+	}
+	fmt.Fprintln(out, "\n建议的 nginx 防盗链配置:")
+	fmt.Fprintf(out, "location ~* \\.(%s)$ {\n", strings.Join(exts, "|"))
+	fmt.Fprintf(out, "    valid_referers none blocked server_names %s *.%s;\n", own, own)
+	fmt.Fprintln(out, "    if ($invalid_referer) {")
+	fmt.Fprintln(out, "        return 403;")
+	fmt.Fprintln(out, "    }")
+	fmt.Fprintln(out, "}")
+}
+
+func printRefererDomains(domains []analyzer.RefererDomain) {
+	fmt.Fprintln(out, "\n[🔗 来源域名]")
+	if len(domains) == 0 {
+		fmt.Fprintln(out, "无来源")
+	}
+	for _, d := range domains {
+		fmt.Fprintf(out, "%s: %d\n", d.Domain, d.Requests)
+		fmt.Fprintf(out, "  └ %s: %d\n", d.TopReferer, d.TopRefererRequests)
+	}
+}
+
+// URL × 方法交叉统计: 行为请求总数前 20 的 URL, 列为各 HTTP 方法
+func printMethodURLMatrix(m *analyzer.MethodURLReport) {
+	urlWidth := 3
+	for _, row := range m.Rows {
+		if n := tui.Width(row.URL); n > urlWidth {
+			urlWidth = n
+		}
+	}
+	if urlWidth > 50 {
+		urlWidth = 50
+	}
+
+	fmt.Fprintln(out, "\n[🔀 URL × 方法]")
+	fmt.Fprint(out, tui.PadRight("URL", urlWidth))
+	for _, method := range m.Methods {
+		fmt.Fprintf(out, " %9s", method+" ")
+	}
+	fmt.Fprintln(out)
+
+	for _, row := range m.Rows {
+		max := 0
+		for _, n := range row.Counts {
+			if n > max {
+				max = n
+			}
+		}
+
+		fmt.Fprint(out, tui.PadRight(tui.Truncate(row.URL, urlWidth), urlWidth))
+		for _, n := range row.Counts {
+			cell := "-"
+			if n > 0 {
+				cell = strconv.Itoa(n)
+			}
+			if n > 0 && n == max {
+				cell += "*"
+			} else {
+				cell += " "
+			}
+			fmt.Fprintf(out, " %9s", cell)
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintln(out, "(* 为该 URL 请求最多的方法)")
+}
+
+func printNotFound(n *analyzer.NotFoundReport) {
+	fmt.Fprintln(out, "\n[❓ 404 URL 及来源]")
+	if len(n.URLs) == 0 {
+		fmt.Fprintln(out, "无 404 请求")
+		return
+	}
+	if n.OwnHost == "" {
+		fmt.Fprintln(out, "未指定 --own-host, 所有带来源的请求均按站外统计")
+	}
+
+	for _, u := range n.URLs {
+		fmt.Fprintf(out, "%s: %d (站内 %d, 站外 %d, 直接 %d)\n", u.URL, u.Count, u.Internal, u.External, u.Direct)
+		for _, r := range u.TopReferers {
+			fmt.Fprintf(out, "  [%s] %s: %d\n", refererKindLabels[r.Kind], r.Referer, r.Count)
+		}
+	}
+}
+
+func printRedirects(r *analyzer.RedirectReport) {
+	fmt.Fprintln(out, "\n[↪️ 重定向URL]")
+	if len(r.URLs) == 0 {
+		fmt.Fprintln(out, "无重定向请求")
+		return
+	}
+	for _, u := range r.URLs {
+		var parts []string
+		for _, code := range analyzer.RedirectStatuses {
+			if n := u.Statuses[code]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%s: %d", code, n))
+			}
+		}
+		fmt.Fprintf(out, "%s: %d (%s)\n", u.URL, u.Count, strings.Join(parts, ", "))
+	}
+
+	fmt.Fprintln(out, "\n[⛓ 重定向链 (推测)]")
+	fmt.Fprintln(out, "根据同一 IP 在 1 秒内的后续请求推测, 仅供参考")
+	if len(r.Chains) == 0 {
+		fmt.Fprintln(out, "未发现")
+		return
+	}
+	for _, chain := range r.Chains {
+		mark := ""
+		if chain.Loop {
+			mark = " ⚠ 循环"
+		} else if chain.Long {
+			mark = " ⚠ 超过 2 跳"
+		}
+		fmt.Fprintf(out, "%s: %d%s\n", strings.Join(chain.URLs, " → "), chain.Count, mark)
+	}
+
+	if len(r.Flagged) > 0 {
+		fmt.Fprintln(out, "需要关注的跳转链:")
+		for _, chain := range r.Flagged {
+			fmt.Fprintf(out, "  %s: %d\n", strings.Join(chain.URLs, " → "), chain.Count)
+		}
+	}
+}
+
+func printSpikes(s *analyzer.SpikeReport) {
+	fmt.Fprintln(out, "\n[📈 流量突增]")
+	fmt.Fprintf(out, "规则: 每分钟请求数超过前 %d 分钟移动平均 %.1f 个标准差\n", s.Window, s.Sigma)
+	if len(s.Spikes) == 0 {
+		fmt.Fprintln(out, "未发现")
+		return
+	}
+	for _, sp := range s.Spikes {
+		fmt.Fprintf(out, "%s: %d (平均 %.1f, 标准差 %.1f, +%.1fσ)\n",
+			sp.Minute.Format("2006-01-02 15:04"), sp.Count, sp.Mean, sp.StdDev, (float64(sp.Count)-sp.Mean)/sp.StdDev)
+	}
+}
+
+var botStatusLabels = map[string]string{
+	analyzer.BotVerified:   "验证通过",
+	analyzer.BotImpostor:   "冒充",
+	analyzer.BotUnverified: "未验证",
+}
+
+func printBots(b *analyzer.BotReport) {
+	fmt.Fprintln(out, "\n[🤖 搜索引擎爬虫]")
+	if len(b.IPs) == 0 {
+		fmt.Fprintln(out, "没有自称搜索引擎爬虫的请求")
+		return
+	}
+	if !b.Checked {
+		fmt.Fprintln(out, "未做 DNS 验证 (--no-dns), 以下均为未验证")
+	}
+
+	type tally struct{ requests, ips int }
+	var bots []string
+	counts := make(map[string]map[string]*tally)
+	for _, ip := range b.IPs {
+		if counts[ip.Bot] == nil {
+			bots = append(bots, ip.Bot)
+			counts[ip.Bot] = make(map[string]*tally)
+		}
+		t := counts[ip.Bot][ip.Status]
+		if t == nil {
+			t = &tally{}
+			counts[ip.Bot][ip.Status] = t
+		}
+		t.requests += ip.Requests
+		t.ips++
+	}
+	sort.Strings(bots)
+	for _, bot := range bots {
+		var parts []string
+		for _, status := range []string{analyzer.BotVerified, analyzer.BotImpostor, analyzer.BotUnverified} {
+			if t := counts[bot][status]; t != nil {
+				parts = append(parts, fmt.Sprintf("%s %d 次 (%d 个 IP)", botStatusLabels[status], t.requests, t.ips))
+			}
+		}
+		fmt.Fprintf(out, "%s: %s\n", bot, strings.Join(parts, ", "))
+	}
+
+	var impostors, unverified int
+	for _, ip := range b.IPs {
+		switch ip.Status {
+		case analyzer.BotImpostor:
+			if impostors == 0 {
+				fmt.Fprintln(out, "冒充的 IP (反向解析不属于该搜索引擎或正向解析不一致):")
+			}
+			impostors++
+			fmt.Fprintf(out, "  %s (自称 %s): %d\n", ip.IP, ip.Bot, ip.Requests)
+		case analyzer.BotUnverified:
+			unverified++
+		}
+	}
+	if b.Checked && unverified > 0 {
+		fmt.Fprintf(out, "%d 个 IP 未验证: 超出 --verify-bots-max 或 DNS 查询失败\n", unverified)
+	}
+}
+
+func printTrend(days []analyzer.TrendDay) {
+	fmt.Fprintln(out, "\n[📅 每日趋势]")
+	if len(days) == 0 {
+		fmt.Fprintln(out, "日志中没有可解析的时间")
+		return
+	}
+	fmt.Fprintf(out, "%s %s %s %s  %s\n", tui.PadRight("日期", 10), tui.PadLeft("请求数", 8), tui.PadLeft("流量", 10), tui.PadLeft("错误率", 7), "较前一天")
+	counts := make([]int, len(days))
+	for i, d := range days {
+		counts[i] = d.Requests
+		delta := "-"
+		if i > 0 {
+			delta = fmt.Sprintf("%+d", d.Delta)
+			if days[i-1].Requests > 0 {
+				delta += fmt.Sprintf(" (%+.1f%%)", d.DeltaPercent)
+			}
+		}
+		mark := ""
+		if d.Requests == 0 {
+			mark = "  ⚠ 无日志"
+		}
+		fmt.Fprintf(out, "%s %8d %10s %6.1f%%  %s%s\n", d.Day, d.Requests, formatBytes(d.Bytes), d.ErrorRate*100, delta, mark)
+	}
+	fmt.Fprintf(out, "请求数趋势: %s\n", tui.Sparkline(counts))
+	fmt.Fprintln(out, "(错误率为状态码 ≥ 400 的比例)")
+}
+
+func formatLatency(seconds float64) string {
+	return strconv.FormatFloat(seconds*1000, 'f', 0, 64) + "ms"
+}
+
+func printLatency(l *analyzer.LatencyReport) {
+	fmt.Fprintln(out, "\n[⏱ 响应时间]")
+	if l.Overall.Count == 0 {
+		fmt.Fprintln(out, "无 $request_time 数据")
+		return
+	}
+	if l.Estimator == analyzer.EstimatorSketch {
+		fmt.Fprintln(out, "分位数为估算值, 误差约 1%")
+	}
+
+	rows := append([]analyzer.URLLatency{{URL: "(全部)", LatencyStats: l.Overall}}, l.URLs...)
+	urlWidth := 3
+	for _, row := range rows {
+		if n := tui.Width(row.URL); n > urlWidth {
+			urlWidth = n
+		}
+	}
+	if urlWidth > 50 {
+		urlWidth = 50
+	}
+
+	fmt.Fprintf(out, "%s %s %8s %8s %8s\n", tui.PadRight("URL", urlWidth), tui.PadLeft("请求数", 8), "p50", "p95", "p99")
+	for _, row := range rows {
+		label := tui.Truncate(row.URL, urlWidth)
+		fmt.Fprintf(out, "%s %8d %8s %8s %8s\n", tui.PadRight(label, urlWidth), row.Count,
+			formatLatency(row.P50), formatLatency(row.P95), formatLatency(row.P99))
+	}
+	if len(l.URLs) == 0 {
+		fmt.Fprintf(out, "(没有请求数不少于 %d 的 URL)\n", l.MinCount)
+	}
+}
+
+func printParams(p *analyzer.ParamReport) {
+	fmt.Fprintf(out, "\n[❓ 查询参数] 带查询参数的请求 %d 个\n", p.Requests)
+	if p.DecodeErrors > 0 {
+		fmt.Fprintf(out, "%d 个参数的百分号编码无法解码, 已按原样统计\n", p.DecodeErrors)
+	}
+	if p.Requests == 0 {
+		return
+	}
+	for _, r := range p.Names {
+		fmt.Fprintf(out, "%s: %.0f\n", r.Key, r.Count)
+	}
+	fmt.Fprintln(out, "各路径的常见参数:")
+	for _, ep := range p.Endpoints {
+		var names []string
+		for _, r := range ep.Names {
+			names = append(names, fmt.Sprintf("%s (%.0f)", r.Key, r.Count))
+		}
+		fmt.Fprintf(out, "  %s [%d]: %s\n", ep.Path, ep.Requests, strings.Join(names, ", "))
+	}
+	for _, v := range p.Values {
+		fmt.Fprintf(out, "%s 的取值:\n", v.Name)
+		if len(v.Values) == 0 {
+			fmt.Fprintln(out, "  无")
+		}
+		for _, r := range v.Values {
+			value := r.Key
+			if value == "" {
+				value = "(空)"
+			}
+			fmt.Fprintf(out, "  %s: %.0f\n", value, r.Count)
+		}
+	}
+}
+
+func printRegularity(r *analyzer.RegularityReport) {
+	fmt.Fprintln(out, "\n[⏲ 请求间隔]")
+	if len(r.IPs) == 0 {
+		fmt.Fprintln(out, "无")
+		return
+	}
+	ipWidth := 2
+	for _, row := range r.IPs {
+		if n := tui.Width(row.IP); n > ipWidth {
+			ipWidth = n
+		}
+	}
+	fmt.Fprintf(out, "%s %s %s %s %6s\n", tui.PadRight("IP", ipWidth), tui.PadLeft("请求数", 8), tui.PadLeft("间隔中位数", 10), tui.PadLeft("平均间隔", 10), "CV")
+	var suspicious []analyzer.IPRegularity
+	for _, row := range r.IPs {
+		mark := ""
+		if row.Suspicious {
+			mark = " ⚠"
+			suspicious = append(suspicious, row)
+		}
+		fmt.Fprintf(out, "%s %8d %10s %10s %6.2f%s\n", tui.PadRight(row.IP, ipWidth), row.Requests,
+			seconds(row.MedianGap), seconds(row.MeanGap).Round(time.Millisecond), row.CV, mark)
+	}
+	if len(suspicious) == 0 {
+		fmt.Fprintf(out, "(没有请求数不少于 %d 且 CV 不超过 %.2f 的 IP)\n", r.MinRequests, r.MaxCV)
+		return
+	}
+	fmt.Fprintf(out, "⚠ 间隔过于规律 (CV ≤ %.2f), 疑似定时抓取:\n", r.MaxCV)
+	for _, row := range suspicious {
+		fmt.Fprintf(out, "  %s: 主要 URL %s, UA %q\n", row.IP, row.URL, row.UserAgent)
+	}
+}
+
+// 与基线相比新出现的 IP 与 URL
+func printNewEntries(n *analyzer.NewEntries, markdown bool) {
+	if markdown {
+		fmt.Fprintf(out, "\n## 🆕 新出现 (对比 %s)\n\n", markdownCell(n.Baseline))
+	} else {
+		fmt.Fprintf(out, "\n[🆕 新出现] 对比 %s\n", n.Baseline)
+	}
+	if len(n.IPs) == 0 && len(n.URLs) == 0 {
+		fmt.Fprintln(out, "无")
+		return
+	}
+	for _, group := range []struct {
+		label string
+		ranks []analyzer.Rank
+	}{{"IP", n.IPs}, {"URL", n.URLs}} {
+		for _, r := range group.ranks {
+			if markdown {
+				fmt.Fprintf(out, "- %s `%s`: %.0f\n", group.label, strings.ReplaceAll(r.Key, "`", "'"), r.Count)
+			} else {
+				fmt.Fprintf(out, "%s %s: %.0f\n", group.label, r.Key, r.Count)
+			}
+		}
+	}
+	if !markdown {
+		fmt.Fprintln(out, "(基线只保存了排名前十, 未进入基线排名的项也会列出)")
+	}
+}
+
+func printUniques(u *analyzer.UniqueReport) {
+	fmt.Fprintln(out, "\n[🔢 独立访客]")
+	if u.Approximate {
+		fmt.Fprintln(out, "以下为 HyperLogLog 估算值, 误差约 1%")
+	}
+	fmt.Fprintf(out, "独立 IP: %d\n独立 URL: %d\n", u.IPs, u.URLs)
+	if len(u.Days) > 1 {
+		fmt.Fprintln(out, "每天独立 IP:")
+		for _, b := range u.Days {
+			fmt.Fprintf(out, "  %s: %d\n", b.Key, b.IPs)
+		}
+	}
+	if len(u.Hours) > 0 {
+		fmt.Fprintln(out, "每小时独立 IP:")
+		for _, b := range u.Hours {
+			fmt.Fprintf(out, "  %s: %d\n", b.Key, b.IPs)
+		}
+	}
+}
+
+func printWrites(w *analyzer.WriteReport) {
+	fmt.Fprintln(out, "\n[✏️ 写请求]")
+	if w.Requests == 0 {
+		fmt.Fprintln(out, "无写请求")
+		return
+	}
+	fmt.Fprintf(out, "写请求 (%s) 共 %d 次\n", strings.Join(analyzer.WriteMethods, "/"), w.Requests)
+
+	urlWidth := 3
+	for _, ep := range w.Endpoints {
+		if n := tui.Width(ep.Method + " " + ep.URL); n > urlWidth {
+			urlWidth = n
+		}
+	}
+	if urlWidth > 50 {
+		urlWidth = 50
+	}
+
+	header := fmt.Sprintf("%s %s %s", tui.PadRight("接口", urlWidth), tui.PadLeft("请求数", 8), tui.PadLeft("错误率", 8))
+	if w.HasRequestLength {
+		header += " " + tui.PadLeft("上行", 10)
+	}
+	if w.HasLatency {
+		header += fmt.Sprintf(" %8s %8s", "p50", "p95")
+	}
+	fmt.Fprintln(out, header)
+	for _, ep := range w.Endpoints {
+		label := tui.Truncate(ep.Method+" "+ep.URL, urlWidth)
+		line := fmt.Sprintf("%s %8d %7.1f%%", tui.PadRight(label, urlWidth), ep.Count, ep.ErrorRate*100)
+		if w.HasRequestLength {
+			line += fmt.Sprintf(" %10s", formatBytes(ep.RequestBytes))
+		}
+		if w.HasLatency {
+			if ep.Latency != nil {
+				line += fmt.Sprintf(" %8s %8s", formatLatency(ep.Latency.P50), formatLatency(ep.Latency.P95))
+			} else {
+				line += fmt.Sprintf(" %8s %8s", "-", "-")
+			}
+		}
+		fmt.Fprintln(out, line)
+	}
+	fmt.Fprintln(out, "(错误率为状态码 ≥ 400 的比例)")
+
+	fmt.Fprintln(out, "\n[✏️ 写请求客户端]")
+	for _, r := range w.TopIPs {
+		if w.HasRequestLength {
+			fmt.Fprintf(out, "%s: %.0f (上行 %s)\n", r.Key, r.Count, formatBytes(r.Bytes))
+		} else {
+			fmt.Fprintf(out, "%s: %.0f\n", r.Key, r.Count)
+		}
+	}
+}
+
+// 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// 按 1024 进制格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+type histogramBar struct {
+	Label string
+	Count int
+	Extra string
+}
+
+// 文本直方图, 条形长度按最大计数缩放
+func printHistogram(bars []histogramBar) {
+	total, max, labelWidth := 0, 0, 0
+	for _, b := range bars {
+		total += b.Count
+		if b.Count > max {
+			max = b.Count
+		}
+		if n := tui.Width(b.Label); n > labelWidth {
+			labelWidth = n
+		}
+	}
+
+	const width = 30
+	for _, b := range bars {
+		pct := 0.0
+		if total > 0 {
+			pct = float64(b.Count) * 100 / float64(total)
+		}
+		fmt.Fprintf(out, "%s %s %d (%.1f%%)", tui.PadRight(b.Label, labelWidth), tui.Bar(b.Count, max, width), b.Count, pct)
+		if b.Extra != "" {
+			fmt.Fprintf(out, " %s", b.Extra)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+func printSizeBuckets(buckets []analyzer.SizeBucket) {
+	fmt.Fprintln(out, "\n[📦 响应大小分布]")
+	bars := make([]histogramBar, len(buckets))
+	for i, b := range buckets {
+		bars[i] = histogramBar{Label: b.Label, Count: b.Count, Extra: "共 " + formatBytes(b.Bytes)}
+	}
+	printHistogram(bars)
+}
+
+// 读取每行一个域名的列表文件, 忽略空行与 # 注释
+func readDomainList(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var domains []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			domains = append(domains, line)
+		}
+	}
+	return domains, nil
+}
+
+// --group-rules 文件中的一条规则
+type groupRuleEntry struct {
+	Pattern string `yaml:"pattern"`
+	Name    string `yaml:"name"`
+}
+
+// 读取 --group-rules 的规则文件: YAML 列表, 每项为 {pattern: 正则, name: 分组名}.
+// 正则无效或缺少字段时返回的错误中指明是第几条规则
+func readGroupRules(file string) ([]analyzer.URLGroupRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var entries []groupRuleEntry
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&entries); err != nil && err != io.EOF {
+		return nil, err
+	}
+	rules := make([]analyzer.URLGroupRule, 0, len(entries))
+	for i, e := range entries {
+		if e.Pattern == "" || e.Name == "" {
+			return nil, fmt.Errorf("第 %d 条规则缺少 pattern 或 name", i+1)
+		}
+		re, err := regexp.Compile(e.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条规则 (%s): %v", i+1, e.Name, err)
+		}
+		rules = append(rules, analyzer.URLGroupRule{Name: e.Name, Pattern: re})
+	}
+	return rules, nil
+}
+
+func printURLGroups(groups []analyzer.URLGroupCount) {
+	fmt.Fprintln(out, "\n[🏷 URL 分组规则]")
+	for _, g := range groups {
+		if g.Requests == 0 {
+			fmt.Fprintf(out, "%s (%s): 0 ⚠ 未匹配任何请求\n", g.Name, g.Pattern)
+			continue
+		}
+		fmt.Fprintf(out, "%s (%s): %d\n", g.Name, g.Pattern, g.Requests)
+	}
+}
+
+// 一个排名板块, 文本与 Markdown 输出共用同一份数据
+type rankSection struct {
+	Title       string
+	Column      string
+	CountHeader string
+	Decimals    int // 小于 0 时整数不带小数, 否则保留两位
+	Rows        []analyzer.Rank
+	ShowTotal   bool            // 显示合计行, 配合 --min-count 的 (other) 行核对总数
+	ShowBytes   bool            // 显示每项的响应字节数之和与平均值
+	New         []analyzer.Rank // 与基线相比新出现的项, 在排名中标出
+}
+
+const newMark = " 🆕"
+
+// --normalize-ua 时标出合并了几种原始 UA
+func variantsMark(row analyzer.Rank) string {
+	if row.Variants > 1 {
+		return fmt.Sprintf(" (%d 种原始 UA)", row.Variants)
+	}
+	return ""
+}
+
+func (s rankSection) isNew(key string) bool {
+	for _, r := range s.New {
+		if r.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 合计请求数与字节数, 包含 (other) 行
+func (s rankSection) total() (count float64, bytes int64) {
+	for _, row := range s.Rows {
+		count += row.Count
+		bytes += row.Bytes
+	}
+	return count, bytes
+}
+
+func (s rankSection) formatCount(v float64) string {
+	if s.Decimals < 0 {
+		if v == math.Trunc(v) {
+			return strconv.FormatFloat(v, 'f', 0, 64)
+		}
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	return strconv.FormatFloat(v, 'f', s.Decimals, 64)
+}
+
+// 每个请求的平均响应字节数
+func averageBytes(row analyzer.Rank) string {
+	if row.Count == 0 {
+		return formatBytes(0)
+	}
+	return formatBytes(int64(float64(row.Bytes) / row.Count))
+}
+
+func rankingSections(rep *analyzer.Report) []rankSection {
+	header, decimals := "请求数", 0
+	if rep.Decay != nil {
+		header, decimals = "衰减计数", 1
+	}
+	sections := []rankSection{
+		{Title: "🖥 IP排名", Column: "IP", Rows: rep.TopIPs},
+		{Title: "🛸 UA排名", Column: "UA", Rows: rep.TopUserAgents},
+		{Title: "🌐 URL排名", Column: "URL", Rows: rep.TopURLs},
+	}
+	if rep.New != nil {
+		sections[0].New, sections[2].New = rep.New.IPs, rep.New.URLs
+	}
+	if rep.Decay == nil {
+		sections = append(sections, rankSection{Title: "⏰ 访问时间", Column: "时间", Rows: rep.TopHours})
+	}
+	sections = append(sections, rankSection{Title: "🚦 HTTP状态码", Column: "状态码", Rows: rep.TopStatuses})
+	byBytes := rep.SortBy == analyzer.SortByBytes
+	for i := range sections {
+		sections[i].CountHeader, sections[i].Decimals = header, decimals
+		sections[i].ShowTotal = rep.MinCount > 0 && rep.Decay == nil
+		// URL 排名总是附带响应大小, 便于发现请求数不变但响应变大的接口
+		sections[i].ShowBytes = rep.Decay == nil && (byBytes || sections[i].Column == "URL")
+	}
+	// 国家排名不受衰减计数影响, 列出全部国家/地区及流量
+	if rep.Countries != nil {
+		sections = append(sections, rankSection{Title: "🌍 国家/地区", Column: "国家/地区", CountHeader: "请求数",
+			Rows: rep.Countries, ShowBytes: true})
+	}
+
+	for _, c := range rep.Custom {
+		if c.Value == "" {
+			sections = append(sections, rankSection{Title: "📊 $" + c.Field, Column: "$" + c.Field, CountHeader: "请求数",
+				Rows: c.Ranks, ShowTotal: rep.MinCount > 0, ShowBytes: byBytes})
+		} else {
+			sections = append(sections, rankSection{Title: "📊 $" + c.Field + " → Σ$" + c.Value, Column: "$" + c.Field,
+				CountHeader: "Σ$" + c.Value, Decimals: -1, Rows: c.Ranks})
+		}
+	}
+	return sections
+}
+
+// 概览: 请求数、流量、时间范围、平均每秒请求数与 2xx/3xx/4xx/5xx 占比
+func printOverview(s *analyzer.Summary, markdown bool) {
+	lines := []string{fmt.Sprintf("请求数: %d, 流量: %s", s.Requests, formatBytes(s.Bytes))}
+	if s.Start != nil {
+		lines = append(lines, fmt.Sprintf("时间: %s 至 %s (%s), 平均 %.2f 请求/秒",
+			s.Start.Format("2006-01-02 15:04:05"), s.End.Format("2006-01-02 15:04:05"), seconds(s.DurationSeconds), s.RequestsPerSecond))
+	}
+	var classes []string
+	for _, c := range s.StatusClasses {
+		// 1xx 很少见, 为 0 时不列出
+		if c.Class == "1xx" && c.Requests == 0 {
+			continue
+		}
+		classes = append(classes, fmt.Sprintf("%s: %d (%.1f%%)", c.Class, c.Requests, c.Percent))
+	}
+	if s.InvalidStatus > 0 {
+		classes = append(classes, fmt.Sprintf("无效状态码: %d", s.InvalidStatus))
+	}
+	lines = append(lines, strings.Join(classes, ", "))
+
+	if markdown {
+		fmt.Fprint(out, "\n## 📋 概览\n\n")
+		for _, line := range lines {
+			fmt.Fprintf(out, "- %s\n", line)
+		}
+		return
+	}
+	fmt.Fprintln(out, "[📋 概览]")
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+}
+
+// 告警: 列出触发的条件及实测值, 未触发的只计数
+func printAlerts(alerts []analyzer.AlertResult, markdown bool) {
+	var lines []string
+	for _, a := range alerts {
+		if a.Fired {
+			lines = append(lines, fmt.Sprintf("%s (实测 %s)", a.Expr, a.Measured))
+		}
+	}
+	title := fmt.Sprintf("%d 条告警触发, %d 条正常", len(lines), len(alerts)-len(lines))
+	if markdown {
+		fmt.Fprintf(out, "\n## 🚨 告警\n\n%s\n\n", title)
+		for _, line := range lines {
+			fmt.Fprintf(out, "- %s\n", markdownCell(line))
+		}
+		return
+	}
+	fmt.Fprintf(out, "[🚨 告警] %s\n", title)
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+}
+
+func printTextSections(note string, sections []rankSection) {
+	if note != "" {
+		fmt.Fprintf(out, "%s\n\n", note)
+	}
+	for i, section := range sections {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "[%s]\n", section.Title)
+		for _, row := range section.Rows {
+			if section.isNew(row.Key) {
+				row.Key += newMark
+			}
+			row.Key += variantsMark(row)
+			switch {
+			case row.Other:
+				fmt.Fprintf(out, "%s: %s (共 %s)\n", row.Key, section.formatCount(row.Count), formatBytes(row.Bytes))
+			case section.ShowBytes:
+				fmt.Fprintf(out, "%s: %s (共 %s, 平均 %s)\n", row.Key, section.formatCount(row.Count), formatBytes(row.Bytes), averageBytes(row))
+			default:
+				fmt.Fprintf(out, "%s: %s\n", row.Key, section.formatCount(row.Count))
+			}
+		}
+		if section.ShowTotal {
+			count, bytes := section.total()
+			fmt.Fprintf(out, "合计: %s (共 %s)\n", section.formatCount(count), formatBytes(bytes))
+		}
+	}
+}
+
+// 转义 Markdown 表格单元格中的特殊字符
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "`", "\\`")
+}
+
+func printMarkdownSections(note string, sections []rankSection) {
+	if note != "" {
+		fmt.Fprintf(out, "\n> %s\n", note)
+	}
+	for _, section := range sections {
+		fmt.Fprintf(out, "\n## %s\n\n", section.Title)
+		if section.ShowBytes {
+			fmt.Fprintf(out, "| # | %s | %s | 字节数 | 平均 |\n", markdownCell(section.Column), markdownCell(section.CountHeader))
+			fmt.Fprintln(out, "|---:|---|---:|---:|---:|")
+		} else {
+			fmt.Fprintf(out, "| # | %s | %s |\n", markdownCell(section.Column), markdownCell(section.CountHeader))
+			fmt.Fprintln(out, "|---:|---|---:|")
+		}
+		for i, row := range section.Rows {
+			// (other) 行不参与排名, 不编号
+			rank := strconv.Itoa(i + 1)
+			if row.Other {
+				rank = ""
+			}
+			if section.isNew(row.Key) {
+				row.Key += newMark
+			}
+			row.Key += variantsMark(row)
+			if section.ShowBytes {
+				fmt.Fprintf(out, "| %s | %s | %s | %s | %s |\n", rank, markdownCell(row.Key), section.formatCount(row.Count),
+					formatBytes(row.Bytes), averageBytes(row))
+				continue
+			}
+			fmt.Fprintf(out, "| %s | %s | %s |\n", rank, markdownCell(row.Key), section.formatCount(row.Count))
+		}
+		if section.ShowTotal {
+			count, bytes := section.total()
+			if section.ShowBytes {
+				fmt.Fprintf(out, "| | **合计** | %s | %s | |\n", section.formatCount(count), formatBytes(bytes))
+			} else {
+				fmt.Fprintf(out, "| | **合计** | %s |\n", section.formatCount(count))
+			}
+		}
+	}
+}
+
+func sampleNote(s *analyzer.SampleInfo) string {
+	return fmt.Sprintf("抽样率 %s, 统计了 %d 行, 各计数已按 %.4g 倍放大为估算值",
+		strconv.FormatFloat(s.Rate*100, 'f', -1, 64)+"%", s.SampledLines, 1/s.Rate)
+}
+
+// 抽样时, 在不能按比例放大的分析板块后注明
+func printUnscaledMark(rep *analyzer.Report) {
+	if rep.Sample != nil {
+		fmt.Fprintf(out, "(以上只基于抽样到的 %d 行, 数值未放大)\n", rep.Sample.SampledLines)
+	}
+}
+
+func printReport(rep *analyzer.Report, markdown bool) {
+	var note string
+	if rep.Decay != nil {
+		note = fmt.Sprintf("衰减计数, 半衰期 %s, 折算至 %s", seconds(rep.Decay.HalfLifeSeconds), rep.Decay.ReferenceTime.Format("2006-01-02 15:04:05"))
+	}
+	sections := rankingSections(rep)
+
+	if markdown {
+		fmt.Fprintln(out, "# Nginx 日志分析")
+		if rep.Sample != nil {
+			fmt.Fprintf(out, "\n> 🎲 %s\n", sampleNote(rep.Sample))
+		}
+		if rep.Summary != nil {
+			printOverview(rep.Summary, true)
+		}
+		if len(rep.Alerts) > 0 {
+			printAlerts(rep.Alerts, true)
+		}
+		printMarkdownSections(note, sections)
+	} else {
+		if rep.Sample != nil {
+			fmt.Fprintf(out, "[🎲 抽样估算] %s\n\n", sampleNote(rep.Sample))
+		}
+		if rep.Summary != nil {
+			printOverview(rep.Summary, false)
+			fmt.Fprintln(out)
+		}
+		if len(rep.Alerts) > 0 {
+			printAlerts(rep.Alerts, false)
+			fmt.Fprintln(out)
+		}
+		printTextSections(note, sections)
+	}
+
+	if rep.New != nil {
+		printNewEntries(rep.New, markdown)
+	}
+
+	// 其余分析板块暂无表格形式, Markdown 模式下原样放入代码块
+	if markdown && (rep.URLGroups != nil || rep.MethodURL != nil || rep.Sessions != nil || rep.Referers != nil || rep.RefererDomains != nil ||
+		rep.NotFound != nil || rep.Redirects != nil || rep.Spikes != nil || rep.Sizes != nil || rep.Latency != nil || rep.Writes != nil || rep.Uniques != nil || rep.Trend != nil || rep.Bots != nil ||
+		rep.Regularity != nil || rep.Params != nil) {
+		fmt.Fprint(out, "\n## 其他分析\n\n```text")
+		defer fmt.Fprintln(out, "```")
+	}
+
+	if rep.URLGroups != nil {
+		printURLGroups(rep.URLGroups)
+	}
+
+	if rep.MethodURL != nil {
+		printMethodURLMatrix(rep.MethodURL)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Sessions != nil {
+		printSessions(rep.Sessions)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Referers != nil {
+		printReferers(rep.Referers)
+		printUnscaledMark(rep)
+	}
+
+	if rep.RefererDomains != nil {
+		printRefererDomains(rep.RefererDomains)
+	}
+
+	if rep.NotFound != nil {
+		printNotFound(rep.NotFound)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Redirects != nil {
+		printRedirects(rep.Redirects)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Sizes != nil {
+		printSizeBuckets(rep.Sizes)
+	}
+
+	if rep.Latency != nil {
+		printLatency(rep.Latency)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Writes != nil {
+		printWrites(rep.Writes)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Uniques != nil {
+		printUniques(rep.Uniques)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Bots != nil {
+		printBots(rep.Bots)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Params != nil {
+		printParams(rep.Params)
+	}
+
+	if rep.Regularity != nil {
+		printRegularity(rep.Regularity)
+		printUnscaledMark(rep)
+	}
+
+	if rep.Trend != nil {
+		printTrend(rep.Trend)
+	}
+
+	if rep.Spikes != nil {
+		printSpikes(rep.Spikes)
+		printUnscaledMark(rep)
+	}
+
+	if excluded := excludedSummary(rep); excluded != "" {
+		fmt.Fprintf(out, "\n[🙈 已排除的请求] %s\n", excluded)
+	}
+
+	if rep.MalformedCount > 0 {
+		fmt.Fprintf(out, "\n[⚠ 无法解析的请求] %d\n", rep.MalformedCount)
+		for _, request := range rep.MalformedExamples {
+			fmt.Fprintf(out, "  %q\n", request)
+		}
+	}
+
+	if rep.BadTimestamps > 0 {
+		printBadTimestamps(rep)
+	}
+
+	if rep.OversizedLines > 0 {
+		fmt.Fprintf(out, "\n[⚠ 超长的行] %d 行超过 --max-line-size, 已跳过\n", rep.OversizedLines)
+	}
+
+	if *outlierFile != "" {
+		fmt.Fprintf(out, "\n[📤 异常请求] %d 个请求超过阈值, 已写入 %s\n", rep.Outliers, *outlierFile)
+	}
+
+	if rep.Meta != nil && !*statsMode {
+		printMeta(rep.Meta)
+	}
+}
+
+// 时间无法解析的请求不计入按时间划分的板块, 提示用 --time-format 指定格式
+func printBadTimestamps(rep *analyzer.Report) {
+	fmt.Fprintf(out, "\n[⚠ 无法解析的时间] %d 个请求, 未计入按时间划分的板块, 可用 --time-format 指定时间格式\n", rep.BadTimestamps)
+	for _, ts := range rep.BadTimeExamples {
+		fmt.Fprintf(out, "  %q\n", ts)
+	}
+}
+
+// 日志格式检查: 前 formatCheckLines 行中可解析的比例低于 formatCheckMinRate 时不做分析
+const (
+	formatCheckLines   = 100
+	formatCheckMinRate = 0.5
+)
+
+// 读取文件的前 formatCheckLines 行, 可解析的行太少时向标准错误输出第一条失败的行、
+// 日志格式与开始不符的位置, 并返回 true
+func formatMismatch(path string, opts analyzer.Options) (bool, error) {
+	file, err := analyzer.OpenLog(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	// 格式检查逐行进行, 不抽样, 也不导出异常请求
+	opts.SampleRate = 0
+	opts.OnOutlier = nil
+	a := analyzer.New(opts)
+	reader := analyzer.NewLineReader(file, opts.MaxLineSize)
+	lines, parsed, failed, failedLine := 0, 0, "", 0
+	for lines < formatCheckLines && reader.Next() {
+		lines++
+		if err := a.AddLine(reader.Text()); err == nil {
+			parsed++
+		} else if failedLine == 0 {
+			failed, failedLine = reader.Text(), lines
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return false, err
+	}
+	if lines == 0 || float64(parsed) >= float64(lines)*formatCheckMinRate {
+		return false, nil
+	}
+
+	fmt.Fprintf(stderr, "日志与格式不匹配: 前 %d 行中只有 %d 行可以解析, 已停止分析\n\n", lines, parsed)
+	fmt.Fprintf(stderr, "第 %d 行:\n  %s\n", failedLine, failed)
+	if pos, expected := analyzer.FormatMismatch(opts.LogFormat, failed); pos >= 0 {
+		fmt.Fprintf(stderr, "  %s^ 从这里开始不符, 格式此处应为 `%s`\n", strings.Repeat(" ", tui.Width(failed[:pos])), expected)
+	}
+	fmt.Fprintf(stderr, "\n日志格式:\n  %s\n\n", opts.LogFormat)
+	fmt.Fprintln(stderr, "请用 --log-format 指定与 nginx 配置中 log_format 一致的格式; 日志确有较多脏数据时可加 --force 继续分析")
+	return true, nil
+}
+
+// 逐行统计整个文件, gzip 压缩的文件边读边解压
+func analyzeFile(path string, opts analyzer.Options) (*analyzer.Analyzer, error) {
+	file, err := analyzer.OpenLog(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	a := analyzer.New(opts)
+	reader := analyzer.NewLineReader(file, opts.MaxLineSize)
+	for reader.Next() {
+		if err := a.AddLine(reader.Text()); err != nil {
+			fmt.Fprintln(stderr, "解析错误:", err)
+		}
+	}
+	for i := 0; i < reader.Oversized; i++ {
+		a.AddOversizedLine()
+	}
+	return a, reader.Err()
+}
+
+// 排除的请求数, 方法按名称排序, 如 "HEAD: 3, OPTIONS: 12, UA: 40, 路径: 7". 没有排除任何请求时为空
+func excludedSummary(rep *analyzer.Report) string {
+	methods := make([]string, 0, len(rep.ExcludedMethods))
+	for m := range rep.ExcludedMethods {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	var parts []string
+	for _, m := range methods {
+		parts = append(parts, fmt.Sprintf("%s: %d", m, rep.ExcludedMethods[m]))
+	}
+	if rep.ExcludedUserAgents > 0 {
+		parts = append(parts, fmt.Sprintf("UA: %d", rep.ExcludedUserAgents))
+	}
+	if rep.ExcludedPaths > 0 {
+		parts = append(parts, fmt.Sprintf("路径: %d", rep.ExcludedPaths))
+	}
+	if rep.ExcludedIPs > 0 {
+		parts = append(parts, fmt.Sprintf("IP: %d", rep.ExcludedIPs))
+	}
+	if rep.ExcludedCountries > 0 {
+		parts = append(parts, fmt.Sprintf("国家/地区: %d", rep.ExcludedCountries))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// 解析逗号分隔的国家/地区代码, 统一为大写
+func countryCodes(name, list string) []string {
+	var codes []string
+	for _, c := range strings.Split(list, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if len(c) != 2 || c[0] < 'A' || c[0] > 'Z' || c[1] < 'A' || c[1] > 'Z' {
+			fatalf("%s: %q 不是 ISO 3166-1 两位国家/地区代码", name, c)
+		}
+		codes = append(codes, c)
+	}
+	return codes
+}
+
+// 向标准错误输出错误信息并以 cli.ExitError 结束 Run
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintf(stderr, format+"\n", a...)
+	cli.Exit(cli.ExitError)
+}
+
+func init() {
+	flags.BoolVar(quiet, "q", false, "同 --quiet")
+	flags.Var(&countBy, "count-by", "按任意日志字段的请求数排名, 可重复指定, 如 --count-by http_x_api_client")
+	flags.Var(&alerts, "alert", "告警条件, 可重复指定, 任一触发时以退出码 2 结束, 如 '5xx_rate>1%' 'p99_latency>2s' 'requests<1000'")
+	flags.Var(&pushHeaders, "push-header", "推送时附加的请求头, 可重复指定, 如 'Authorization: Bearer xxx'")
+	flags.Var(&paramValues, "param-values", "列出该查询参数的取值排名 (同时启用 --params), 可重复指定, 如 --param-values utm_source")
+	flags.Var(&sumBy, "sum-by", "按字段分组对数值字段求和排名, 格式 <字段>:<数值字段>, 可重复指定, 如 --sum-by host:gzip_ratio")
+	flags.Usage = func() {
+		w := flags.Output()
+		fmt.Fprintln(w, "用法: nginx-log [选项] <nginx_log_file>")
+		flags.PrintDefaults()
+		fmt.Fprintf(w, "\n退出码: %d 正常, %d 出错 (参数错误、文件无法读取或格式不匹配等), %d 超过阈值\n", cli.ExitOK, cli.ExitError, cli.ExitThreshold)
+	}
+}
+
+// Run 以命令行参数 args (不含程序名) 分析日志, 报告写入 stdout, 错误写入 stderr, 返回退出码
+func Run(args []string, stdoutW, stderrW io.Writer) (code int) {
+	defer cli.Recover(&code)
+	stdout, stderr, out = stdoutW, stderrW, stdoutW
+	botVerifier = nil
+	flags.VisitAll(func(f *flag.Flag) {
+		if list, ok := f.Value.(*stringList); ok {
+			*list = nil
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return cli.ExitOK
+		}
+		return cli.ExitError
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, "nginx-log", cli.Version)
+		return cli.ExitOK
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return cli.ExitError
+	}
+	if format, err := cli.ParseOutput(*outputFormat, "markdown"); err == nil {
+		*outputFormat = format
+	} else {
+		fatalf("不支持的输出格式: %s", *outputFormat)
+	}
+	if *digestMode != "" {
+		switch {
+		case *digestMode != "weekly":
+			fatalf("不支持的摘要周期: %s, 目前只支持 weekly", *digestMode)
+		case *outputFormat != cli.OutputTable:
+			fatalf("--digest 输出纯文本, 不能与 --output %s 同时使用", *outputFormat)
+		case *followMode || *splitBy != "":
+			fatalf("--digest 不能与 --follow 或 --split-by 同时使用")
+		}
+	} else if *digestState != "" {
+		fatalf("--digest-state 需要与 --digest 同时使用")
+	}
+	if *quiet && *outputFormat == cli.OutputTable && *splitBy == "" && *digestMode == "" && (*outFile == "" || *alsoStdout) {
+		fatalf("--quiet 只输出机器可读的报告, 请同时指定 --output json、csv 或 markdown")
+	}
+	if *followMode && *outputFormat == cli.OutputCSV {
+		fatalf("实时模式不支持 --output csv, 每个快照一行 JSON 请用 --output json")
+	}
+	if *quiet && *followMode && *outputFormat != cli.OutputJSON {
+		fatalf("实时模式下 --quiet 只支持 --output json")
+	}
+	if *sampleRate < 0 || *sampleRate > 1 {
+		fatalf("--sample 须在 0 与 1 之间")
+	}
+	if *sampleRate > 0 && *sampleRate < 1 && (*followMode || *splitBy != "") {
+		fatalf("--sample 不能与 --follow 或 --split-by 同时使用")
+	}
+	if _, err := analyzer.TimeLayout(*timeFormat); err != nil {
+		fatalf("--time-format: %v", err)
+	}
+	if *regularityMode && (*regularityTop <= 0 || *regularityMin < 2 || *regularityCV <= 0) {
+		fatalf("--regularity-top 必须大于 0, --regularity-min-requests 不能小于 2, --regularity-max-cv 必须大于 0")
+	}
+	if *decayMode && *halfLife <= 0 {
+		fatalf("--half-life 必须大于 0")
+	}
+
+	var alertRules []analyzer.AlertRule
+	for _, expr := range alerts {
+		rule, err := analyzer.ParseAlert(expr)
+		if err != nil {
+			fatalf("--alert: %v", err)
+		}
+		alertRules = append(alertRules, rule)
+		if rule.NeedsLatency() && !*latencyMode {
+			if !strings.Contains(*logFormat, "$request_time") {
+				fatalf("--alert %s 需要日志格式包含 $request_time, 请通过 --log-format 指定", expr)
+			}
+			*latencyMode = true
+		}
+	}
+	if len(alertRules) > 0 && (*followMode || *splitBy != "") {
+		fatalf("--alert 不能与 --follow 或 --split-by 同时使用")
+	}
+	var push *pushTarget
+	if *pushURL != "" {
+		if *followMode || *splitBy != "" {
+			fatalf("--push-url 不能与 --follow 或 --split-by 同时使用")
+		}
+		target, err := newPushTarget(*pushURL, *pushFormat, pushHeaders)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		push = target
+	} else if len(pushHeaders) > 0 || *pushRequired {
+		fatalf("--push-header 与 --push-required 需要与 --push-url 同时使用")
+	}
+
+	lineLimit, sizeErr := parseByteSize(*maxLineSize)
+	if sizeErr != nil || lineLimit <= 0 {
+		fatalf("--max-line-size 应为正的大小, 如 4MB")
+	}
+
+	var outliers *outlierWriter
+	var maxOutlierBytes int64
+	if *outlierBytes != "" {
+		n, err := parseByteSize(*outlierBytes)
+		if err != nil {
+			fatalf("--outlier-bytes: %v", err)
+		}
+		maxOutlierBytes = n
+	}
+	if *outlierFile != "" {
+		if maxOutlierBytes <= 0 && *outlierTime <= 0 {
+			fatalf("--outliers 需要 --outlier-bytes 或 --outlier-time 指定阈值")
+		}
+		if *outlierTime > 0 && !strings.Contains(*logFormat, "$request_time") {
+			fatalf("--outlier-time 需要日志格式包含 $request_time, 请通过 --log-format 指定")
+		}
+	} else if *outlierBytes != "" || *outlierTime != 0 {
+		fatalf("--outlier-bytes 与 --outlier-time 需要与 --outliers 同时使用")
+	}
+
+	if *latencyMode && !strings.Contains(*logFormat, "$request_time") {
+		fatalf("--latency 需要日志格式包含 $request_time, 请通过 --log-format 指定")
+	}
+
+	opts := analyzer.Options{
+		LogFormat:             *logFormat,
+		TimeFormat:            *timeFormat,
+		MaxLineSize:           int(lineLimit),
+		URLFilter:             analyzer.DefaultURLFilter,
+		MinCount:              *minCount,
+		SortBy:                *sortBy,
+		IgnoreXFF:             *noXFF,
+		Decay:                 *decayMode,
+		HalfLife:              *halfLife,
+		Sessions:              *sessionMode,
+		SessionGap:            *sessionGap,
+		SessionExcludeBots:    *sessionSkipBots,
+		Referers:              *refererMode,
+		OwnHost:               *ownHost,
+		RefererDomains:        *refDomains,
+		SpamDomains:           analyzer.DefaultSpamDomains,
+		MethodURL:             *crossMethod,
+		NotFound:              *notFoundMode,
+		Redirects:             *redirectMode,
+		Sizes:                 *sizeMode,
+		Writes:                *writeMode,
+		Uniques:               *uniqueMode,
+		LowMemory:             *lowMemory,
+		Countries:             *countryMode,
+		Latency:               *latencyMode,
+		LatencySketch:         *latencySketch,
+		LatencyTop:            *latencyTop,
+		LatencyMinCount:       *latencyMinCount,
+		SpikeWindow:           *spikeWindow,
+		SpikeSigma:            *spikeSigma,
+		Trend:                 *trendMode || *digestMode != "",
+		SampleRate:            *sampleRate,
+		NormalizeUserAgents:   *normalizeUA,
+		Bots:                  *verifyBotsMode,
+		StripQuery:            *stripQuery,
+		Params:                *paramsMode,
+		ParamValues:           paramValues,
+		Regularity:            *regularityMode,
+		RegularityTop:         *regularityTop,
+		RegularityMinRequests: *regularityMin,
+		RegularityMaxCV:       *regularityCV,
+		Spikes:                *spikeMode || *digestMode != "",
+	}
+	for _, m := range strings.Split(*excludeMethods, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			opts.ExcludeMethods = append(opts.ExcludeMethods, m)
+		}
+	}
+	var uaPatterns []string
+	for _, p := range strings.Split(*excludeUA, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			uaPatterns = append(uaPatterns, p)
+		}
+	}
+	if *excludeHealth {
+		uaPatterns = append(uaPatterns, analyzer.HealthCheckUserAgents...)
+		opts.ExcludePaths = analyzer.HealthCheckPaths
+	}
+	if len(uaPatterns) > 0 {
+		patterns, err := analyzer.CompileUserAgentPatterns(uaPatterns)
+		if err != nil {
+			fatalf("--exclude-ua: %v", err)
+		}
+		opts.ExcludeUserAgents = patterns
+	}
+	for _, field := range countBy {
+		opts.CountBy = append(opts.CountBy, strings.TrimPrefix(field, "$"))
+	}
+	for _, spec := range sumBy {
+		sum, err := analyzer.ParseSumSpec(spec)
+		if err != nil {
+			fatalf("--sum-by: %v", err)
+		}
+		opts.SumBy = append(opts.SumBy, sum)
+	}
+	if err := opts.Validate(); err != nil {
+		fatalf("%v", err)
+	}
+	if *trustedProxies != "" {
+		nets, err := analyzer.ParseCIDRList(*trustedProxies)
+		if err != nil {
+			fatalf("--trusted-proxies: %v", err)
+		}
+		opts.TrustedProxies = nets
+	}
+	if *excludeIPs != "" {
+		nets, err := analyzer.ParseCIDRList(*excludeIPs)
+		if err != nil {
+			fatalf("--exclude-ip: %v", err)
+		}
+		opts.ExcludeIPs = nets
+	}
+	if *excludeInternal {
+		opts.ExcludeIPs = append(opts.ExcludeIPs, analyzer.InternalNetworks...)
+	}
+	if *includeIPs != "" {
+		if len(opts.ExcludeIPs) == 0 {
+			fatalf("--include-ip 需要与 --exclude-ip 或 --exclude-internal 同时使用")
+		}
+		nets, err := analyzer.ParseCIDRList(*includeIPs)
+		if err != nil {
+			fatalf("--include-ip: %v", err)
+		}
+		opts.IncludeIPs = nets
+	}
+	if *geoipFile != "" {
+		geoip, err := analyzer.OpenGeoIP(*geoipFile)
+		if err != nil {
+			fatalf("无法读取 GeoIP 库: %v", err)
+		}
+		opts.GeoIP = geoip
+	} else if opts.Countries {
+		fmt.Fprintln(stderr, "--countries 需要 --geoip 指定 IP 地理位置库, 已跳过国家/地区排名")
+	}
+	opts.OnlyCountries = countryCodes("--only-country", *onlyCountry)
+	opts.ExcludeCountries = countryCodes("--exclude-country", *excludeCountry)
+	if len(opts.OnlyCountries) > 0 || len(opts.ExcludeCountries) > 0 {
+		if opts.GeoIP == nil {
+			fatalf("--only-country 与 --exclude-country 需要 --geoip 指定 IP 地理位置库")
+		}
+		switch *unknownCountry {
+		case "keep":
+			opts.KeepUnknownCountry = true
+		case "drop":
+		case "":
+			fatalf("使用国家过滤时须用 --unknown-country keep 或 drop 指定如何处理库中查不到国家的地址")
+		default:
+			fatalf("--unknown-country 应为 keep 或 drop")
+		}
+	} else if *unknownCountry != "" {
+		fatalf("--unknown-country 需要与 --only-country 或 --exclude-country 同时使用")
+	}
+	if *outlierFile != "" {
+		w, err := createOutlierWriter(*outlierFile)
+		if err != nil {
+			fatalf("无法写入异常请求文件: %v", err)
+		}
+		outliers = w
+		opts.OutlierBytes = maxOutlierBytes
+		opts.OutlierTime = *outlierTime
+		opts.OnOutlier = outliers.Write
+	}
+	if *groupRules != "" {
+		rules, err := readGroupRules(*groupRules)
+		if err != nil {
+			fatalf("无法读取 URL 分组规则: %s, %v", *groupRules, err)
+		}
+		opts.URLGroups = rules
+	}
+	if *spamList != "" {
+		extra, err := readDomainList(*spamList)
+		if err != nil {
+			fatalf("无法读取垃圾来源列表: %s, %v", *spamList, err)
+		}
+		opts.SpamDomains = append(opts.SpamDomains, extra...)
+	}
+
+	logFile := flags.Arg(0)
+	if *splitBy != "" {
+		switch {
+		case *outputDir == "":
+			fatalf("--split-by 需要 --output-dir 指定报告目录")
+		case *followMode || *outFile != "" || *parallel > 1 || *baseline != "":
+			fatalf("--split-by 不能与 --follow、--out、--parallel 或 --baseline 同时使用")
+		}
+	}
+	if *verifyBotsMode && *followMode {
+		fatalf("--verify-bots 不能与 --follow 同时使用")
+	}
+	if *verifyBotsMode && *botTimeout <= 0 {
+		fatalf("--verify-bots-timeout 必须大于 0")
+	}
+	if *outFile != "" && *followMode {
+		fatalf("--out 不能与 --follow 同时使用")
+	}
+	if *parallel > 1 && (*followMode || opts.Sessions || opts.Redirects) {
+		fatalf("--parallel 不能与 --follow、--sessions 或 --redirects 同时使用, 这些模式依赖日志的先后顺序")
+	}
+	if *followMode {
+		if *followInterval <= 0 {
+			fatalf("--interval 必须大于 0")
+		}
+		if err := follow(logFile, opts, *followInterval, *noClear, *outputFormat); err != nil {
+			fatalf("读取文件时出错: %v", err)
+		}
+		return
+	}
+
+	if !*force {
+		mismatch, err := formatMismatch(logFile, opts)
+		if err != nil {
+			fatalf("无法读取文件: %s, %v", logFile, err)
+		}
+		if mismatch {
+			return cli.ExitError
+		}
+	}
+
+	if *splitBy != "" {
+		if err := splitLog(logFile, opts, *splitBy, *outputDir, *maxGroups); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+
+	stats := startRunStats()
+	var a *analyzer.Analyzer
+	var err error
+	if *parallel > 1 {
+		a, err = analyzer.AnalyzeFile(logFile, opts, *parallel, func(line string, err error) {
+			fmt.Fprintln(stderr, "解析错误:", err)
+		})
+	} else {
+		a, err = analyzeFile(logFile, opts)
+	}
+	if err != nil {
+		fatalf("读取文件时出错: %v", err)
+	}
+
+	if outliers != nil {
+		if err := outliers.Close(); err != nil {
+			fatalf("写入异常请求文件时出错: %s, %v", *outlierFile, err)
+		}
+	}
+	rep := a.Report()
+	var inputBytes int64
+	if info, err := os.Stat(logFile); err == nil {
+		inputBytes = info.Size()
+	}
+	workers := 1
+	if *parallel > 1 {
+		workers = *parallel
+	}
+	stats.Finish(rep, inputBytes, workers)
+	verifyBots(rep)
+	fired := rep.EvaluateAlerts(alertRules)
+	if *baseline != "" {
+		base, err := analyzer.LoadReport(*baseline)
+		if err != nil {
+			fatalf("无法读取基线: %v", err)
+		}
+		rep.CompareBaseline(base, *baseline)
+	}
+
+	var prev *analyzer.Report
+	if *digestState != "" {
+		prev, err = loadDigestState(*digestState)
+		if err != nil {
+			fatalf("无法读取周报状态文件: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if *outFile != "" {
+		out = &buf
+	}
+	if *digestMode != "" {
+		printDigest(rep, prev)
+	} else if err := renderReport(rep, *outputFormat); err != nil {
+		fatalf("输出报告时出错: %v", err)
+	}
+	if *outFile != "" {
+		if err := writeFileAtomic(*outFile, buf.Bytes()); err != nil {
+			fatalf("无法写入报告: %s, %v", *outFile, err)
+		}
+	}
+	saveDigest(rep)
+	if *outFile != "" {
+		if *alsoStdout {
+			stdout.Write(buf.Bytes())
+		} else if !*quiet {
+			printSummary(rep, *outFile)
+		}
+	}
+	if *statsMode {
+		out = stderr
+		printMeta(rep.Meta)
+	}
+
+	if push != nil {
+		if err := push.Send(rep); err != nil {
+			if *pushRequired {
+				fatalf("推送报告失败: %v", err)
+			}
+			fmt.Fprintf(stderr, "推送报告失败: %v\n", err)
+		}
+	}
+
+	if fired > 0 {
+		// 文本与 Markdown 报告中已列出触发的告警, 其余情况 (JSON、CSV、周报或只写入文件) 另写到标准错误
+		if *digestMode != "" || *outputFormat == cli.OutputJSON || *outputFormat == cli.OutputCSV || (*outFile != "" && !*alsoStdout) {
+			w := out
+			out = stderr
+			printAlerts(rep.Alerts, false)
+			out = w
+		}
+		return cli.ExitThreshold
+	}
+	return cli.ExitOK
+}
+
+// 周报输出后保存本周数据, 写入失败不影响已输出的周报, 但下周将无法对比
+func saveDigest(rep *analyzer.Report) {
+	if *digestState == "" {
+		return
+	}
+	if err := saveDigestState(*digestState, rep); err != nil {
+		fatalf("无法保存周报状态文件: %s, %v", *digestState, err)
+	}
+}
+
+// 同时进行的爬虫 DNS 验证数
+const botLookupConcurrency = 16
+
+// 各报告共用一个 BotVerifier, --split-by 时同一 IP 也只查询一次
+var botVerifier *analyzer.BotVerifier
+
+// 按 --verify-bots 验证报告中的爬虫 IP, --no-dns 时跳过
+func verifyBots(rep *analyzer.Report) {
+	if rep.Bots == nil || *noDNS {
+		return
+	}
+	if botVerifier == nil {
+		botVerifier = analyzer.NewBotVerifier(botLookupConcurrency, *botMaxIPs, *botTimeout)
+	}
+	botVerifier.Verify(rep.Bots)
+}
+
+// 按 --output 的格式把报告写入 out
+func renderReport(rep *analyzer.Report, format string) error {
+	switch format {
+	case cli.OutputJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	case cli.OutputCSV:
+		return writeRankingsCSV(rep)
+	}
+	printReport(rep, format == "markdown")
+	return nil
+}
+
+// writeRankingsCSV 把各排名写为 CSV, 每行一项: 所属排名、名次 ((other) 行为空)、键、计数与字节数.
+// 其余分析板块没有统一的表格形式, 需要时用 --output json
+func writeRankingsCSV(rep *analyzer.Report) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"section", "rank", "key", "count", "bytes"})
+	for _, section := range rankingSections(rep) {
+		for i, row := range section.Rows {
+			rank := strconv.Itoa(i + 1)
+			if row.Other {
+				rank = ""
+			}
+			w.Write([]string{section.Title, rank, row.Key, strconv.FormatFloat(row.Count, 'f', -1, 64), strconv.FormatInt(row.Bytes, 10)})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// 各输出格式的报告文件扩展名
+var reportExtensions = map[string]string{cli.OutputTable: ".txt", "markdown": ".md", cli.OutputJSON: ".json", cli.OutputCSV: ".csv"}
+
+// 分组值对应的文件名: 字母、数字与 . - _ 以外的字符替换为 _, 与已用的文件名重复时加序号
+func groupFileName(group string, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, group)
+	if strings.Trim(name, ".") == "" {
+		name = strings.Repeat("_", len(name)+1)
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// 读一遍日志, 按 field 的值分组统计, 每组的报告写入 dir 下的单独文件
+func splitLog(path string, opts analyzer.Options, field, dir string, maxGroups int) error {
+	s, err := analyzer.NewSplitter(opts, field, maxGroups)
+	if err != nil {
+		return err
+	}
+	file, err := analyzer.OpenLog(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := analyzer.NewLineReader(file, opts.MaxLineSize)
+	for reader.Next() {
+		if err := s.AddLine(reader.Text()); err != nil {
+			fmt.Fprintln(stderr, "解析错误:", err)
+		}
+	}
+	for i := 0; i < reader.Oversized; i++ {
+		s.AddOversizedLine()
+	}
+	if err := reader.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	for _, group := range s.Groups() {
+		rep := s.Report(group)
+		verifyBots(rep)
+		var buf bytes.Buffer
+		out = &buf
+		err := renderReport(rep, *outputFormat)
+		out = stdout
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(dir, groupFileName(group, used)+reportExtensions[*outputFormat])
+		if err := writeFileAtomic(name, buf.Bytes()); err != nil {
+			return err
+		}
+		if !*quiet {
+			fmt.Fprintf(stdout, "%s: %d 行, 统计 %d 个请求 → %s\n", group, rep.Lines, rep.Requests, name)
+		}
+	}
+	if *quiet {
+		return nil
+	}
+	fmt.Fprintf(stdout, "共 %d 行, 分为 %d 组", s.Lines(), len(used))
+	if n := s.Overflow(); n > 0 {
+		fmt.Fprintf(stdout, ", 超出 --max-groups 的 %d 个值归入 %s 组", n, analyzer.OtherKey)
+	}
+	if n := s.ParseErrors(); n > 0 {
+		fmt.Fprintf(stdout, ", %d 行无法解析", n)
+	}
+	if n := s.OversizedLines(); n > 0 {
+		fmt.Fprintf(stdout, ", %d 行超过 --max-line-size 已跳过", n)
+	}
+	fmt.Fprintln(stdout)
+	return nil
+}
+
+// 先写入同目录下的临时文件再重命名, 失败时不会留下不完整的报告
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp 创建的文件只有属主可读, 改为与普通输出文件相同的权限
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// 报告写入文件时在终端显示的一段摘要
+func printSummary(rep *analyzer.Report, path string) {
+	summary := fmt.Sprintf("共 %d 行, 统计 %d 个请求", rep.Lines, rep.Requests)
+	if rep.Start != nil {
+		summary += fmt.Sprintf(", 时间 %s 至 %s", rep.Start.Format("2006-01-02 15:04:05"), rep.End.Format("2006-01-02 15:04:05"))
+	}
+	if rep.Requests > 0 {
+		summary += fmt.Sprintf(", 错误率 (状态码 ≥ 400) %.1f%%", float64(rep.Errors)*100/float64(rep.Requests))
+	}
+	if excluded := excludedSummary(rep); excluded != "" {
+		summary += fmt.Sprintf(", 已排除 %s", excluded)
+	}
+	if rep.Sample != nil {
+		summary += fmt.Sprintf(", 抽样率 %s (请求数等为估算值)", strconv.FormatFloat(rep.Sample.Rate*100, 'f', -1, 64)+"%")
+	}
+	if rep.ParseErrors > 0 {
+		summary += fmt.Sprintf(", %d 行无法解析", rep.ParseErrors)
+	}
+	if rep.BadTimestamps > 0 {
+		summary += fmt.Sprintf(", %d 个请求的时间无法解析", rep.BadTimestamps)
+	}
+	if rep.OversizedLines > 0 {
+		summary += fmt.Sprintf(", %d 行过长已跳过", rep.OversizedLines)
+	}
+	if *outlierFile != "" {
+		summary += fmt.Sprintf(", %d 个异常请求已写入 %s", rep.Outliers, *outlierFile)
+	}
+	fmt.Fprintf(stdout, "%s. 报告已写入 %s\n", summary, path)
+}
@@ -0,0 +1,69 @@
+package nginxlog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ushell/tools/nginx/analyzer"
+)
+
+// 解析带单位的字节数, 如 10MB、512k、1.5GiB, 单位按 1024 进位 (与 formatBytes 一致), 不带单位时为字节
+func parseByteSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "IB"), "B")
+	multiplier := int64(1)
+	if i := strings.IndexAny(v, "KMGT"); i >= 0 && i == len(v)-1 {
+		multiplier = 1 << (10 * (strings.IndexByte("KMGT", v[i]) + 1))
+		v = v[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小 %q, 应为 10MB、512KB 等", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// 把超过阈值的请求逐行写入 CSV, 每行写入后立即刷新, 内存占用与行数无关.
+// 并行统计时各段同时调用 Write, 由 mu 保护
+type outlierWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *csv.Writer
+	err  error
+}
+
+func createOutlierWriter(path string) (*outlierWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	o := &outlierWriter{file: file, w: csv.NewWriter(file)}
+	o.w.Write(analyzer.OutlierFields)
+	o.w.Flush()
+	return o, o.w.Error()
+}
+
+func (o *outlierWriter) Write(r analyzer.Outlier) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return
+	}
+	o.w.Write(r.Fields())
+	o.w.Flush()
+	o.err = o.w.Error()
+}
+
+// Close 关闭文件, 返回写入过程中的第一个错误
+func (o *outlierWriter) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.file.Close(); o.err == nil {
+		o.err = err
+	}
+	return o.err
+}
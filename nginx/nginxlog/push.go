@@ -0,0 +1,123 @@
+package nginxlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ushell/tools/nginx/analyzer"
+)
+
+// 推送失败后的重试等待时间, 共尝试 len(pushBackoff)+1 次
+var pushBackoff = []time.Duration{time.Second, 3 * time.Second}
+
+const pushTimeout = 10 * time.Second
+
+// 报告的推送目标, 见 --push-url
+type pushTarget struct {
+	url    string
+	format string
+	header http.Header
+}
+
+// 检查 --push-url、--push-format 与 --push-header, headers 的每项为 "Name: value"
+func newPushTarget(rawURL, format string, headers []string) (*pushTarget, error) {
+	if format != "json" && format != "slack" {
+		return nil, fmt.Errorf("不支持的推送格式: %s", format)
+	}
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("--push-url 须为 http 或 https 地址: %s", rawURL)
+	}
+	header := make(http.Header)
+	for _, v := range headers {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("--push-header: %q 不是有效的请求头, 格式为 'Name: value'", v)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return &pushTarget{url: rawURL, format: format, header: header}, nil
+}
+
+// 推送的请求体: json 为完整报告, slack 为 Slack incoming webhook 的 {"text": ...},
+// 内容为概览与触发的告警
+func pushPayload(rep *analyzer.Report, format string) ([]byte, error) {
+	if format == "json" {
+		return json.Marshal(rep)
+	}
+
+	var buf bytes.Buffer
+	w := out
+	out = &buf
+	fmt.Fprintln(out, "*Nginx 日志分析*")
+	if rep.Summary != nil {
+		printOverview(rep.Summary, false)
+	}
+	if len(rep.Alerts) > 0 {
+		printAlerts(rep.Alerts, false)
+	}
+	out = w
+	return json.Marshal(map[string]string{"text": strings.TrimRight(buf.String(), "\n")})
+}
+
+// 推送失败的原因, temporary 为 true 时值得重试 (网络错误、429 与 5xx)
+type pushError struct {
+	err       error
+	temporary bool
+}
+
+func (e *pushError) Error() string { return e.err.Error() }
+
+func (p *pushTarget) post(client *http.Client, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return &pushError{err: err}
+	}
+	req.Header = p.header.Clone()
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &pushError{err: err, temporary: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	err = fmt.Errorf("%s", resp.Status)
+	if text := strings.TrimSpace(string(msg)); text != "" {
+		err = fmt.Errorf("%s: %s", resp.Status, text)
+	}
+	return &pushError{
+		err:       err,
+		temporary: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+	}
+}
+
+// Send 把报告 POST 到推送地址, 网络错误、429 与 5xx 按 pushBackoff 重试
+func (p *pushTarget) Send(rep *analyzer.Report) error {
+	body, err := pushPayload(rep, p.format)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: pushTimeout}
+	for attempt := 0; ; attempt++ {
+		err := p.post(client, body)
+		if err == nil {
+			return nil
+		}
+		if pe, ok := err.(*pushError); !ok || !pe.temporary || attempt == len(pushBackoff) {
+			return err
+		}
+		time.Sleep(pushBackoff[attempt])
+	}
+}
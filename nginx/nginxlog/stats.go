@@ -0,0 +1,97 @@
+package nginxlog
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ushell/tools/nginx/analyzer"
+)
+
+// 运行统计的采样间隔. 内存与 goroutine 数只在后台定时读取, 不影响逐行统计
+const statsInterval = 100 * time.Millisecond
+
+// 记录一次分析的耗时与资源占用峰值, 见 --stats
+type runStats struct {
+	start time.Time
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	mu         sync.Mutex
+	peakMemory uint64
+	goroutines int
+}
+
+func startRunStats() *runStats {
+	s := &runStats{start: time.Now(), stop: make(chan struct{})}
+	s.sample()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(statsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sample()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// 向操作系统申请且未归还的内存, 近似于 Go 运行时占用的常驻内存
+func (s *runStats) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	n := runtime.NumGoroutine()
+	s.mu.Lock()
+	if resident := m.Sys - m.HeapReleased; resident > s.peakMemory {
+		s.peakMemory = resident
+	}
+	if n > s.goroutines {
+		s.goroutines = n
+	}
+	s.mu.Unlock()
+}
+
+// Finish 停止采样, 把统计结果写入 rep.Meta. inputBytes 为读取的日志字节数, workers 为并行统计的分段数
+func (s *runStats) Finish(rep *analyzer.Report, inputBytes int64, workers int) {
+	s.sample()
+	close(s.stop)
+	s.wg.Wait()
+
+	elapsed := time.Since(s.start).Seconds()
+	meta := &analyzer.Meta{
+		DurationSeconds: elapsed,
+		Lines:           rep.Lines,
+		InputBytes:      inputBytes,
+		PeakMemoryBytes: s.peakMemory,
+		Workers:         workers,
+		// 不计采样自身的 goroutine
+		Goroutines: s.goroutines - 1,
+		Filtered:   rep.ExcludedUserAgents + rep.ExcludedPaths + rep.ExcludedIPs + rep.ExcludedCountries,
+		Failed:     rep.ParseErrors + rep.MalformedCount,
+	}
+	for _, n := range rep.ExcludedMethods {
+		meta.Filtered += n
+	}
+	if elapsed > 0 {
+		meta.LinesPerSecond = float64(rep.Lines) / elapsed
+		meta.MBPerSecond = float64(inputBytes) / (1 << 20) / elapsed
+	}
+	rep.Meta = meta
+}
+
+func printMeta(m *analyzer.Meta) {
+	fmt.Fprintf(out, "\n[⏱ 运行统计] 用时 %s, %d 行 (%s), 每秒 %.0f 行 / %.1f MB, 内存峰值 %s, 并行 %d 段, goroutine 峰值 %d",
+		time.Duration(m.DurationSeconds*float64(time.Second)).Round(time.Millisecond), m.Lines, formatBytes(m.InputBytes),
+		m.LinesPerSecond, m.MBPerSecond, formatBytes(int64(m.PeakMemoryBytes)), m.Workers, m.Goroutines)
+	if m.Filtered > 0 || m.Failed > 0 {
+		fmt.Fprintf(out, ", 排除 %d, 无法解析 %d", m.Filtered, m.Failed)
+	}
+	fmt.Fprintln(out)
+}